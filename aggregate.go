@@ -0,0 +1,786 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/indicators"
+	"github.com/mal-as/tinkoff_candles/pkg/patterns"
+)
+
+// runAggregate builds candles from ticks, the default command.
+func runAggregate(args []string) {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	stream := fs.Bool("stream", false, "emit candles as soon as their interval closes instead of buffering the whole input")
+	intervalsFlag := fs.String("intervals", "1m,2m,5m", "comma separated candle intervals, e.g. 1m,5m,15m,1h,1d,1w,1mo")
+	autoIntervals := fs.Bool("auto-intervals", false, "build only the -intervals that suit the tick density of every instrument")
+	tz := fs.String("tz", "UTC", "time zone of candle boundaries and output times, e.g. Europe/Moscow")
+	lateTolerance := fs.Duration("late-tolerance", 0, "in -stream mode, how long to wait for out of order ticks before closing a candle")
+	maxMemory := fs.String("max-memory", "", "keep buffered ticks within this budget, e.g. 2GB, by spilling them sorted to temporary files")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of instruments aggregated concurrently")
+	inputFormat := fs.String("input-format", "csv", "input format: csv or jsonl")
+	outputFormat := fs.String("output-format", "csv", "output format: csv, jsonl, parquet, proto, arrow or xlsx")
+	sheetBy := fs.String("sheet-by", "id", "with -output-format xlsx, the field naming the sheets of the workbook: id or interval")
+	partitionDir := fs.String("partition-dir", "", "with -output-format parquet, write files partitioned by instrument and date into this directory instead of stdout")
+	storePath := fs.String("store", "", "save candles into this SQLite database instead of writing them to stdout")
+	delimiter := fs.String("delimiter", ",", "CSV input field delimiter, \\t for tab")
+	maxLineBytes := fs.Int("max-line-bytes", 0, "treat input lines longer than this many bytes as bad records, 0 for no limit")
+	lazyQuotes := fs.Bool("lazy-quotes", false, "allow malformed quotes in CSV input")
+	mmapFlag := fs.Bool("mmap", false, "map uncompressed CSV input files into memory and parse them in place, faster for huge files")
+	inputHeader := fs.Bool("input-header", false, "the first CSV input row names the columns (id, price, time, volume, seq)")
+	timeFormat := fs.String("time-format", "auto", "input time format: auto, rfc3339, unix, unix_ms, unix_us, unix_ns or a Go layout like \"2006-01-02 15:04:05\"")
+	dedupe := fs.Bool("dedupe", false, "drop exact duplicate ticks, equal in ID, price, time and sequence number")
+	minPrice := fs.Float64("min-price", 0, "reject ticks priced below this, 0 for no bound")
+	maxPrice := fs.Float64("max-price", 0, "reject ticks priced above this, 0 for no bound")
+	priceLimits := fs.String("price-limits", "", "CSV file of id,min,max price bounds of instruments overriding -min-price and -max-price; an empty bound is none")
+	outliersFlag := fs.String("outliers", "", "drop bad prints far from the rolling median price of an instrument: pct:N, more than N% away, or mad:N, more than N median absolute deviations")
+	outlierWindow := fs.Int("outlier-window", candles.DefaultOutlierWindow, "number of recent ticks of an instrument in the rolling median of -outliers")
+	outliersPath := fs.String("outliers-log", "", "with -outliers, write dropped ticks with the median they deviate from to this CSV file")
+	quiet := fs.Bool("quiet", false, "don't report the progress of reading input files to stderr")
+	skipBadLines := fs.Bool("skip-bad-lines", false, "skip unparseable input records instead of failing")
+	rejectsPath := fs.String("rejects", "", "with -skip-bad-lines, write skipped records with error reasons to this CSV file")
+	compressFlag := fs.String("compress", "none", "compress the output: none, gzip or zstd")
+	header := fs.Bool("header", false, "write a header row to the CSV output")
+	columnsFlag := fs.String("columns", strings.Join(candles.DefaultColumns, ","), "comma separated CSV output columns")
+	candleType := fs.String("candle-type", "regular", "candle type: regular, heikin-ashi or renko")
+	barsFlag := fs.String("bars", "", "build activity driven bars instead of time candles: tick:N, volume:N or dollar:N")
+	brickSize := fs.Float64("brick-size", 0, "price move of a brick with -candle-type renko")
+	indicatorsFlag := fs.String("indicators", "", "comma separated indicators appended to the output, e.g. sma:20,ema:50,rsi:14")
+	returns := fs.Bool("returns", false, "append the simple and log returns of the close, the return and log_return indicators")
+	returnsWindow := fs.Int("returns-window", 0, "with -returns, also append the realized volatility over this many candles, the rvol indicator")
+	patternsFlag := fs.Bool("patterns", false, "tag candles with candlestick patterns (doji, hammer, engulfing, star...) in a patterns column")
+	sessionsFlag := fs.String("session-candles", "", "align candles to trading sessions and drop ticks outside them: moex, or sessions in -tz such as 10:00-18:40,19:05-23:50")
+	calendarFlag := fs.String("calendar", "", "don't fill non trading days with -fill-gaps: moex, spb or calendar files, see README")
+	carryFlag := fs.String("carry-open", "none", "which candles open at the previous close instead of their first trade: none, intraday (not the first candle of a day or session) or always")
+	completeOnly := fs.Bool("complete-only", false, "drop candles whose interval, cut at the session end, extends beyond the latest input tick")
+	fillGaps := fs.Bool("fill-gaps", false, "emit candles with the previous close and zero volume for intervals without ticks")
+	volumeFlag := fs.String("volume", "traded", "what candle volumes measure: traded, the sum of tick volumes, or ticks, the number of ticks")
+	extraFlag := fs.String("extra", "", "comma separated extra candle fields to output: vwap, count, spread, max_spread, first_time, last_time, first_seq, last_seq")
+	refPath := fs.String("ref", "", "CSV file of instrument metadata to join lot, currency and isin columns onto csv and jsonl output and convert prices in points by point_value, see README")
+	currency := fs.String("currency", "", "with -ref, convert prices into this currency, e.g. usd, by the -fx or -fx-figi rates")
+	fxPath := fs.String("fx", "", "CSV file of currency,time,rate rows, the prices of currency units in -fx-base from their time on")
+	fxFIGI := fs.String("fx-figi", "", "fetch daily fx rates over -from and -to from the api, comma separated currency=ticker or currency=FIGI pairs, e.g. usd=USD000UTSTOM")
+	fxBase := fs.String("fx-base", "rub", "currency the fx rates are in")
+	token := fs.String("token", os.Getenv("INVEST_TOKEN"), "Tinkoff Invest API token for -fx-figi (default $INVEST_TOKEN)")
+	quotes := fs.Bool("quotes", false, "build candles from the midpoints of the bid and ask prices of quote records instead of trade prices")
+	precisionFlag := fs.String("precision", "float", "price and volume arithmetic: float or decimal")
+	scaleFlag := fs.String("scale", "2", "decimal places of output prices, or auto to fit the prices of every candle")
+	roundingFlag := fs.String("rounding", "default", "price rounding: default, half-up, half-even, down or up")
+	idsFlag := fs.String("ids", "", "comma separated instrument IDs to aggregate, all by default")
+	excludeIDs := fs.String("exclude-ids", "", "comma separated instrument IDs to skip")
+	idRegex := fs.String("id-regex", "", "aggregate only instruments with IDs matching this regular expression")
+	fromFlag := fs.String("from", "", "drop ticks and candles before this time, RFC3339 or 2006-01-02")
+	source := fs.String("source", "", "read ticks from a message broker instead of files, e.g. kafka://host:9092/ticks?group=candles or nats://host:4222/ticks.>")
+	sink := fs.String("sink", "", "write candles to a message broker or a database instead of stdout, e.g. kafka://host:9092/candles, redis://host:6379/0, nats://host:4222/candles, clickhouse://host:8123/db or postgres://host:5432/db")
+	outputTemplate := fs.String("output", "", "write candles into files named by this template instead of stdout, e.g. 'candles/{{.ID}}/{{.Date}}.csv'")
+	outputDir := fs.String("output-dir", "", "write candles into a file per -split-by key in this directory instead of stdout")
+	splitBy := fs.String("split-by", "id", "with -output-dir, comma separated fields naming the files: id, interval, date")
+	watchDir := fs.String("watch", "", "process the tick files appearing in this directory one by one as batches until interrupted, moving them into its done subdirectory")
+	listen := fs.String("listen", "", "read tick lines local processes write into a socket instead of files, e.g. unix:///tmp/ticks.sock or tcp://127.0.0.1:9000")
+	follow := fs.Bool("follow", false, "with -stream, keep reading the input file as ticks are appended to it, like tail -f")
+	checkpointPath := fs.String("checkpoint", "", "in -stream mode, save the open candles and the input position to this file to resume from")
+	checkpointEvery := fs.Duration("checkpoint-interval", 10*time.Second, "how often -checkpoint is saved while no candles close")
+	resume := fs.Bool("resume", false, "continue from the -checkpoint file, skipping the input it covers")
+	corrections := fs.Bool("corrections", false, "in -stream mode, keep the trades of open candles so that cancel and amend records can correct them; batch mode always applies them")
+	emitPartial := fs.Duration("emit-partial", 0, "in -stream mode, write the current state of open candles that changed this often, marked partial")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "export the time of the read, parse, aggregate and sink stages as OpenTelemetry spans to this OTLP/HTTP collector, e.g. http://localhost:4318 (default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	traceEvery := fs.Duration("trace-every", 10*time.Second, "with -otlp-endpoint, how long a span of the stage times covers")
+	toFlag := fs.String("to", "", "drop ticks and candles at or after this time, RFC3339 or 2006-01-02")
+	parseFlags(fs, args)
+
+	intervals, err := candles.ParseIntervals(*intervalsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	if *returns {
+		// Returns are indicators, restricted alike.
+		specs := []string{"return", "log_return"}
+		if *returnsWindow > 0 {
+			specs = append(specs, "rvol:"+strconv.Itoa(*returnsWindow))
+		}
+
+		if *indicatorsFlag != "" {
+			specs = append([]string{*indicatorsFlag}, specs...)
+		}
+
+		*indicatorsFlag = strings.Join(specs, ",")
+	} else if *returnsWindow != 0 {
+		usagef("-returns-window needs -returns")
+	}
+
+	if *autoIntervals && (*stream || *maxMemory != "") {
+		usagef("-auto-intervals can't be combined with -stream or -max-memory")
+	}
+
+	if *follow && !*stream {
+		usagef("-follow requires -stream")
+	}
+
+	if *watchDir != "" {
+		if fs.NArg() > 0 || *source != "" || *listen != "" || *follow {
+			usagef("-watch can't be combined with input files, -source, -listen or -follow")
+		}
+
+		if *stream || *maxMemory != "" || *barsFlag != "" || *candleType == "renko" {
+			usagef("-watch can't be combined with -stream, -max-memory, -bars or -candle-type renko")
+		}
+
+		if *outputFormat == "parquet" || *outputFormat == "arrow" || *outputFormat == "xlsx" {
+			usagef("-watch can't be combined with -output-format parquet, arrow or xlsx, written only at exit")
+		}
+	}
+
+	if *completeOnly && (*barsFlag != "" || *candleType == "renko" || *emitPartial != 0) {
+		usagef("-complete-only can't be combined with -bars, -candle-type renko or -emit-partial")
+	}
+
+	if *corrections && !*stream {
+		usagef("-corrections requires -stream")
+	}
+
+	if *maxMemory != "" && (*stream || *dedupe || *barsFlag != "" || *candleType == "renko") {
+		usagef("-max-memory can't be combined with -stream, -dedupe, -bars or -candle-type renko")
+	}
+
+	if *mmapFlag && (*follow || *source != "" || *listen != "") {
+		usagef("-mmap can't be combined with -follow, -source or -listen")
+	}
+
+	if *checkpointPath != "" {
+		if !*stream || *barsFlag != "" || *candleType != "regular" {
+			usagef("-checkpoint requires -stream with regular time candles")
+		}
+
+		if *source != "" || *listen != "" || *dedupe || *outliersFlag != "" || *indicatorsFlag != "" || *patternsFlag || *fillGaps || *carryFlag != "none" {
+			usagef("-checkpoint can't be combined with -source, -listen, -dedupe, -outliers, -indicators, -patterns, -fill-gaps or -carry-open")
+		}
+	}
+
+	if *emitPartial > 0 {
+		if !*stream || *barsFlag != "" || *candleType != "regular" {
+			usagef("-emit-partial requires -stream with regular time candles")
+		}
+
+		if *indicatorsFlag != "" || *patternsFlag || *fillGaps || *outputFormat == "parquet" || *outputFormat == "arrow" || *outputFormat == "xlsx" {
+			usagef("-emit-partial can't be combined with -indicators, -patterns, -fill-gaps or -output-format parquet, arrow or xlsx")
+		}
+	}
+
+	if *resume && *checkpointPath == "" {
+		usagef("-resume requires -checkpoint")
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	comma, err := parseDelimiter(*delimiter)
+	if err != nil {
+		usage(err)
+	}
+
+	parseTime, err := candles.NewTimeParser(*timeFormat)
+	if err != nil {
+		usage(err)
+	}
+
+	precision, err := candles.ParsePrecision(*precisionFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	volume, err := candles.ParseVolumeKind(*volumeFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	if volume == candles.TickVolume && *barsFlag != "" {
+		usagef("-volume ticks can't be combined with -bars")
+	}
+
+	var schedule *candles.Schedule
+
+	if *sessionsFlag != "" {
+		if *barsFlag != "" || *candleType == "renko" {
+			usagef("-session-candles can't be combined with -bars or -candle-type renko")
+		}
+
+		if schedule, err = candles.ParseSchedule(*sessionsFlag, loc); err != nil {
+			usagef("bad -session-candles: %v", err)
+		}
+	}
+
+	carry, err := candles.ParseCarryOpen(*carryFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	if carry != candles.CarryNone && (*barsFlag != "" || *candleType == "renko") {
+		usagef("-carry-open can't be combined with -bars or -candle-type renko")
+	}
+
+	var calendar *candles.Calendar
+
+	if *calendarFlag != "" {
+		if *barsFlag != "" || *candleType == "renko" {
+			usagef("-calendar can't be combined with -bars or -candle-type renko")
+		}
+
+		if calendar, err = candles.ParseCalendar(*calendarFlag, loc); err != nil {
+			usagef("bad -calendar: %v", err)
+		}
+	}
+
+	format, err := parseFormat(precision, *scaleFlag, *roundingFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	ctx := signalContext()
+
+	if *traceEvery <= 0 {
+		usagef("-trace-every must be positive")
+	}
+
+	tracing, err := startTracing(ctx, *otlpEndpoint, *traceEvery)
+	if err != nil {
+		usage(err)
+	}
+
+	if tracing != nil && *watchDir != "" {
+		usagef("-watch can't be traced: its files are aggregated while reading")
+	}
+
+	csvOpts := candles.CSVOptions{
+		Comma:        comma,
+		LazyQuotes:   *lazyQuotes,
+		Header:       *inputHeader,
+		ParseTime:    parseTime,
+		Precision:    precision,
+		MaxLineBytes: *maxLineBytes,
+	}
+
+	var (
+		r           tickReader
+		closeInputs func() error
+		prog        *progress
+		watch       *watchReader
+	)
+
+	inputs := inputOptions{format: *inputFormat, csv: csvOpts, mmap: *mmapFlag, trace: tracing}
+
+	if *watchDir != "" {
+		watch, err = openWatch(ctx, *watchDir, inputs)
+		r, closeInputs = watch, watch.Close
+	} else if *source != "" {
+		if fs.NArg() > 0 {
+			usagef("-source can't be combined with input files")
+		}
+
+		if *listen != "" {
+			usagef("-source can't be combined with -listen")
+		}
+
+		r, closeInputs, err = openSource(ctx, *source, inputs)
+	} else if *listen != "" {
+		if fs.NArg() > 0 || *follow {
+			usagef("-listen can't be combined with input files or -follow")
+		}
+
+		r, closeInputs, err = openListen(ctx, *listen, inputs)
+	} else if *follow {
+		if fs.NArg() != 1 || fs.Arg(0) == "-" {
+			usagef("-follow requires a single input file")
+		}
+
+		r, closeInputs, err = openFollow(ctx, fs.Arg(0), inputs)
+	} else {
+		if !*quiet && fs.NArg() > 0 {
+			prog = newProgress()
+			inputs.progress = prog
+		}
+
+		r, closeInputs, err = openInputs(fs.Args(), inputs)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	defer closeInputs()
+
+	src, _ := r.(committer)
+
+	if prog != nil {
+		prog.run()
+	}
+
+	var in *countingReader
+
+	if *checkpointPath != "" {
+		in = &countingReader{r: r}
+		r = in
+	}
+
+	columns, err := candles.ParseColumns(*columnsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	extra, err := parseExtra(*extraFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	filter, err := newTickFilter(*idsFlag, *excludeIDs, *idRegex, *fromFlag, *toFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	var dup *deduper
+
+	if *dedupe {
+		// Batch mode keeps all the ticks anyway, streams only the recent
+		// ones.
+		window := time.Duration(0)
+		if *stream {
+			window = max(*lateTolerance, time.Second)
+		}
+
+		dup = newDeduper(window)
+	}
+
+	bounds, err := newPriceBounds(*minPrice, *maxPrice, *priceLimits)
+	if err != nil {
+		usage(err)
+	}
+
+	var ref *reference
+
+	if *refPath != "" {
+		if *storePath != "" || *outputFormat != "csv" && *outputFormat != "jsonl" {
+			usagef("-ref requires csv or jsonl output")
+		}
+
+		if ref, err = readReference(*refPath); err != nil {
+			fatal(err)
+		}
+	}
+
+	if *currency != "" {
+		if ref == nil {
+			usagef("-currency requires -ref")
+		}
+
+		if *fxPath == "" && *fxFIGI == "" {
+			usagef("-currency requires -fx or -fx-figi")
+		}
+
+		fx := newFXRates(*fxBase)
+
+		if *fxPath != "" {
+			if err := fx.read(*fxPath); err != nil {
+				fatal(err)
+			}
+		}
+
+		if *fxFIGI != "" {
+			if *token == "" || filter.from.IsZero() {
+				usagef("-fx-figi requires -token and -from")
+			}
+
+			to := filter.to
+			if to.IsZero() {
+				to = time.Now()
+			}
+
+			if err := fx.fetch(ctx, newTinkoffClient(*token), *fxFIGI, filter.from, to); err != nil {
+				fatal(err)
+			}
+		}
+
+		if err := ref.convertTo(*currency, fx); err != nil {
+			usage(err)
+		}
+	} else if *fxPath != "" || *fxFIGI != "" {
+		usagef("-fx and -fx-figi need -currency")
+	}
+
+	var spikes *outliers
+
+	if *outliersFlag != "" {
+		spec, err := candles.ParseOutlierSpec(*outliersFlag)
+		if err != nil {
+			usage(err)
+		}
+
+		if *outlierWindow <= 0 {
+			usagef("-outlier-window must be positive")
+		}
+
+		spec.Window = *outlierWindow
+
+		if spikes, err = newOutliers(spec, *outliersPath); err != nil {
+			fatal(err)
+		}
+	} else if *outliersPath != "" {
+		usagef("-outliers-log needs -outliers")
+	}
+
+	var (
+		pipeline         *indicators.Pipeline
+		indicatorColumns []string
+	)
+
+	if *indicatorsFlag != "" {
+		specs, err := indicators.Parse(*indicatorsFlag)
+		if err != nil {
+			usage(err)
+		}
+
+		pipeline, err = indicators.NewPipeline(specs)
+		if err != nil {
+			usage(err)
+		}
+
+		indicatorColumns = pipeline.Columns()
+		format.Ratios = pipeline.Ratios()
+	}
+
+	if *partitionDir != "" && *outputFormat != "parquet" {
+		usagef("-partition-dir requires -output-format parquet")
+	}
+
+	if *outputTemplate != "" && *outputDir != "" {
+		usagef("-output can't be combined with -output-dir")
+	}
+
+	toFiles := *outputTemplate != "" || *outputDir != ""
+
+	if toFiles && (*partitionDir != "" || *storePath != "" || *candleType == "renko") {
+		usagef("-output and -output-dir can't be combined with -partition-dir, -store or -candle-type renko")
+	}
+
+	if *sink != "" && (toFiles || *partitionDir != "" || *storePath != "" || *candleType == "renko") {
+		usagef("-sink can't be combined with -output, -output-dir, -partition-dir, -store or -candle-type renko")
+	}
+
+	stdoutCompression := *compressFlag
+	if toFiles {
+		// Files are compressed one by one and nothing goes to stdout.
+		stdoutCompression = "none"
+	}
+
+	out, err := compress(stdoutCompression, os.Stdout)
+	if err != nil {
+		fatal(err)
+	}
+
+	opts := []candles.Option{
+		candles.WithIntervals(intervals...),
+		candles.WithTimezone(loc),
+		candles.WithLateTolerance(*lateTolerance),
+		candles.WithWorkers(*workers),
+		candles.WithPrecision(precision),
+		candles.WithAutoIntervals(*autoIntervals),
+		candles.WithFillGaps(*fillGaps),
+		candles.WithVolume(volume),
+		candles.WithSessions(schedule),
+		candles.WithCalendar(calendar),
+		candles.WithCarryOpen(carry),
+		candles.WithCorrections(*corrections),
+		candles.WithMidpoints(*quotes),
+	}
+
+	var (
+		e        engine
+		complete *completeWriter
+	)
+
+	if *candleType == "renko" {
+		if *barsFlag != "" {
+			usagef("-bars can't be combined with -candle-type renko")
+		}
+
+		if *brickSize <= 0 {
+			usagef("-candle-type renko requires a positive -brick-size")
+		}
+
+		bw, err := newBrickWriter(*outputFormat, out, *header, format)
+		if err != nil {
+			usage(err)
+		}
+
+		e = newRenkoEngine(bw, *brickSize, loc, *stream)
+	} else {
+		var w candleWriter
+
+		wopts := writerOptions{
+			columns:      columns,
+			header:       *header,
+			extra:        extra,
+			indicators:   indicatorColumns,
+			patterns:     *patternsFlag,
+			partitionDir: *partitionDir,
+			sheetBy:      *sheetBy,
+			format:       &format,
+			partial:      *emitPartial > 0,
+		}
+
+		if ref != nil {
+			wopts.labels = refLabels
+		}
+
+		switch {
+		case *storePath != "":
+			w, err = newStoreCandleWriter(*storePath)
+		case *sink != "":
+			w, err = openSink(ctx, *sink)
+		case toFiles:
+			var path func(c candles.Candle) string
+
+			if *outputTemplate != "" {
+				path, err = templatePath(*outputTemplate)
+			} else {
+				path, err = splitPath(*outputDir, *splitBy, outputExt(*outputFormat, *compressFlag))
+			}
+
+			w = &splitWriter{
+				path: path,
+				open: func(w io.Writer) (candleWriter, error) {
+					return newCandleWriter(*outputFormat, w, wopts)
+				},
+				compress: *compressFlag,
+				rotate:   *stream,
+			}
+		default:
+			w, err = newCandleWriter(*outputFormat, out, wopts)
+		}
+		if err != nil {
+			fatal(err)
+		}
+
+		w = tracing.writer(w)
+
+		if ref != nil {
+			w = &labelWriter{candleWriter: w, labels: ref.labels}
+		}
+
+		if pipeline != nil {
+			w = &indicatorWriter{candleWriter: w, p: pipeline}
+		}
+
+		if *patternsFlag {
+			w = &patternWriter{candleWriter: w, d: patterns.NewDetector()}
+		}
+
+		if w, err = withCandleType(*candleType, w); err != nil {
+			fatal(err)
+		}
+
+		if *fromFlag != "" || *toFlag != "" {
+			w = &rangeWriter{candleWriter: w, f: filter, schedule: schedule}
+		}
+
+		if *completeOnly {
+			complete = &completeWriter{candleWriter: w, schedule: schedule}
+			w = complete
+		}
+
+		switch {
+		case *barsFlag != "":
+			spec, err := candles.ParseBarSpec(*barsFlag)
+			if err != nil {
+				usage(err)
+			}
+
+			spec.Precision = precision
+			e = newBarEngine(w, spec, loc, *stream)
+		case *stream:
+			se := &streamEngine{w: w, agg: candles.NewAggregator(opts...), src: src}
+
+			if *checkpointPath != "" {
+				se.cp = &checkpointer{path: *checkpointPath, every: *checkpointEvery, in: in, agg: se.agg}
+
+				if *resume {
+					if err := se.cp.resume(); err != nil {
+						fatal(err)
+					}
+				}
+			}
+
+			if *emitPartial > 0 {
+				se.emitPartial(*emitPartial)
+			}
+
+			if *follow || *listen != "" {
+				se.advanceClock(clockPeriod(intervals))
+			}
+
+			e = se
+		case *maxMemory != "":
+			budget, err := parseSize(*maxMemory)
+			if err != nil {
+				usage(err)
+			}
+
+			// Let the garbage collector work harder rather than exceed it.
+			debug.SetMemoryLimit(budget)
+
+			e = newSpillEngine(w, opts, budget)
+		default:
+			be := &batchEngine{w: w, opts: opts}
+
+			if watch != nil {
+				watch.done = be.flushFile
+			}
+
+			e = be
+		}
+	}
+
+	bad, err := newRejects(*rejectsPath)
+	if err != nil {
+		fatal(err)
+	}
+	// On interrupt stop reading: -stream mode still flushes the open candles.
+	for ctx.Err() == nil {
+		start := tracing.now()
+		tick, err := r.Read()
+		tracing.read(start)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil && *skipBadLines {
+			skipped, rejectErr := bad.add(err)
+			if rejectErr != nil {
+				fatal(rejectErr)
+			}
+
+			if skipped {
+				slog.Debug("skipped bad line", "err", err)
+				continue
+			}
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+
+		if prog != nil {
+			prog.ticks.Add(1)
+		}
+
+		if complete != nil {
+			complete.observe(tick.Time)
+		}
+
+		if !filter.match(tick) {
+			continue
+		}
+
+		if dup != nil && dup.duplicate(tick) {
+			continue
+		}
+
+		if checked, ok := pricedTick(tick, *quotes); ok {
+			if bounds != nil && bounds.reject(checked) {
+				continue
+			}
+
+			if spikes != nil {
+				outlier, err := spikes.drop(checked)
+				if err != nil {
+					fatal(err)
+				}
+
+				if outlier {
+					continue
+				}
+			}
+		}
+
+		if ref != nil {
+			tick = ref.convert(tick)
+		}
+
+		start = tracing.now()
+
+		if err := e.add(tick); err != nil {
+			fatal(err)
+		}
+
+		tracing.aggregate(start)
+	}
+
+	if prog != nil {
+		prog.finish()
+	}
+
+	if watch != nil {
+		// The partly read file stays to be read again on the next run.
+		e.(*batchEngine).ticks = nil
+		ctx = context.Background()
+	}
+
+	start := tracing.now()
+
+	if err := e.finish(ctx); err != nil {
+		fatal(err)
+	}
+
+	tracing.finish(start)
+
+	if err := out.Close(); err != nil {
+		fatal(err)
+	}
+
+	// Every candle is written, so every tick read is done with.
+	if src != nil {
+		if err := src.commit(allClosed); err != nil {
+			fatal(err)
+		}
+	}
+
+	if err := bad.Close(); err != nil {
+		fatal(err)
+	}
+
+	if err := tracing.shutdown(context.Background()); err != nil {
+		slog.Warn("exporting traces", "err", err)
+	}
+
+	if dup != nil && dup.dropped > 0 {
+		slog.Info("dropped duplicate ticks", "count", dup.dropped)
+	}
+
+	if bounds != nil && bounds.rejected > 0 {
+		slog.Warn("rejected ticks out of price bounds", "count", bounds.rejected)
+	}
+
+	if spikes != nil {
+		if err := spikes.Close(); err != nil {
+			fatal(err)
+		}
+
+		if spikes.dropped > 0 {
+			slog.Info("dropped outlier ticks", "count", spikes.dropped)
+		}
+	}
+
+	if bad.count > 0 {
+		slog.Warn("skipped bad lines", "count", bad.count)
+	}
+}
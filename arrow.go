@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/internal/arrow"
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// arrowBatchSize is the number of candles buffered before they are written
+// as a record batch.
+const arrowBatchSize = 1 << 16
+
+var arrowFields = []arrow.Field{
+	{Name: "id", Type: arrow.Utf8},
+	{Name: "open", Type: arrow.Float64},
+	{Name: "high", Type: arrow.Float64},
+	{Name: "low", Type: arrow.Float64},
+	{Name: "close", Type: arrow.Float64},
+	{Name: "volume", Type: arrow.Float64},
+	{Name: "time", Type: arrow.Timestamp},
+	// interval is the length of the candle, which varies for calendar
+	// intervals and is null for activity driven bars.
+	{Name: "interval", Type: arrow.Duration, Nullable: true},
+}
+
+// arrowCandleWriter writes candles into an Arrow IPC file. The schema is
+// written with the first candle, whose time zone becomes the one of the
+// time column.
+type arrowCandleWriter struct {
+	w          io.Writer
+	fields     []arrow.Field
+	extra      []string
+	indicators []string
+	patterns   bool
+	aw         *arrow.Writer
+}
+
+func newArrowCandleWriter(w io.Writer, opts writerOptions) *arrowCandleWriter {
+	fields := arrowFields[:len(arrowFields):len(arrowFields)]
+
+	for _, name := range opts.extra {
+		switch extraType(name) {
+		case "int":
+			fields = append(fields, arrow.Field{Name: name, Type: arrow.Int64})
+		case "time":
+			fields = append(fields, arrow.Field{Name: name, Type: arrow.Timestamp, Nullable: true})
+		default:
+			fields = append(fields, arrow.Field{Name: name, Type: arrow.Float64})
+		}
+	}
+
+	// Indicators are null until they have enough candles.
+	for _, name := range opts.indicators {
+		fields = append(fields, arrow.Field{Name: name, Type: arrow.Float64, Nullable: true})
+	}
+
+	if opts.patterns {
+		fields = append(fields, arrow.Field{Name: "patterns", Type: arrow.Utf8})
+	}
+
+	return &arrowCandleWriter{
+		w:          w,
+		fields:     fields,
+		extra:      opts.extra,
+		indicators: opts.indicators,
+		patterns:   opts.patterns,
+	}
+}
+
+func (w *arrowCandleWriter) Write(c candles.Candle) error {
+	if err := w.start(c.Time.Location()); err != nil {
+		return err
+	}
+
+	aw := w.aw
+
+	aw.WriteString(0, c.ID)
+	aw.WriteDouble(1, c.Open)
+	aw.WriteDouble(2, c.High)
+	aw.WriteDouble(3, c.Low)
+	aw.WriteDouble(4, c.Close)
+	aw.WriteDouble(5, c.Volume)
+	aw.WriteInt64(6, c.Time.UnixNano())
+
+	if c.Interval == (candles.Interval{}) {
+		aw.WriteNull(7)
+	} else {
+		aw.WriteInt64(7, int64(c.Interval.End(c.Time).Sub(c.Time)))
+	}
+
+	for i, name := range w.extra {
+		column := len(arrowFields) + i
+
+		switch extraType(name) {
+		case "int":
+			aw.WriteInt64(column, extraInt(c, name))
+		case "time":
+			// Filled gaps have no ticks.
+			if t := extraTime(c, name); t.IsZero() {
+				aw.WriteNull(column)
+			} else {
+				aw.WriteInt64(column, t.UnixNano())
+			}
+		default:
+			aw.WriteDouble(column, extraFloat(c, name))
+		}
+	}
+
+	for i, name := range w.indicators {
+		col := len(arrowFields) + len(w.extra) + i
+
+		if v, ok := c.Indicators[name]; ok && !math.IsNaN(v) {
+			aw.WriteDouble(col, v)
+		} else {
+			aw.WriteNull(col)
+		}
+	}
+
+	if w.patterns {
+		aw.WriteString(len(w.fields)-1, strings.Join(c.Patterns, "|"))
+	}
+
+	aw.EndRow()
+
+	if aw.Rows() >= arrowBatchSize {
+		return aw.Flush()
+	}
+
+	return nil
+}
+
+// start writes the schema unless written already.
+func (w *arrowCandleWriter) start(loc *time.Location) error {
+	if w.aw != nil {
+		return nil
+	}
+
+	// Readers need a time zone name of the tz database.
+	tz := loc.String()
+	if tz == "Local" {
+		tz = "UTC"
+	}
+
+	fields := slices.Clone(w.fields)
+	fields[6].Timezone = tz
+
+	aw, err := arrow.NewWriter(w.w, fields)
+	if err != nil {
+		return err
+	}
+
+	w.aw = aw
+
+	return nil
+}
+
+// Flush is a no-op: an Arrow file can only be read once it is closed.
+func (w *arrowCandleWriter) Flush() error {
+	return nil
+}
+
+func (w *arrowCandleWriter) Close() error {
+	if err := w.start(time.UTC); err != nil {
+		return err
+	}
+
+	return w.aw.Close()
+}
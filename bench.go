@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := fs.Int("n", 5, "number of runs")
+	intervalsFlag := fs.String("intervals", "1m,2m,5m", "comma separated candle intervals")
+	tz := fs.String("tz", "UTC", "time zone of candle boundaries")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of instruments aggregated concurrently")
+	inputFormat := fs.String("input-format", "csv", "input format: csv or jsonl")
+	instruments := fs.Int("instruments", 100, "without input files, instruments of the generated ticks")
+	rate := fs.Float64("rate", 10, "without input files, mean ticks per second of a generated instrument")
+	duration := fs.Duration("duration", time.Hour, "without input files, time span of the generated ticks")
+	seed := fs.Uint64("seed", 1, "random seed of the generated ticks")
+	parseFlags(fs, args)
+
+	if *runs <= 0 {
+		usagef("bench: -n must be positive")
+	}
+
+	intervals, err := candles.ParseIntervals(*intervalsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	ctx := signalContext()
+
+	var ticks []candles.Tick
+
+	if fs.NArg() > 0 {
+		r, closeInputs, err := openInputs(fs.Args(), inputOptions{format: *inputFormat})
+		if err != nil {
+			fatal(err)
+		}
+
+		for {
+			tick, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				fatal(err)
+			}
+
+			ticks = append(ticks, tick)
+		}
+
+		closeInputs()
+	} else {
+		ids := make([]string, *instruments)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("SYN%d", i)
+		}
+
+		from := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+		g := newTickGenerator(genOptions{
+			ids: ids, from: from, to: from.Add(*duration), rate: *rate,
+			price: 100, tickSize: 0.01, volatility: 0.3, volume: 10, seed: *seed,
+		})
+
+		for {
+			tick, ok := g.next()
+			if !ok {
+				break
+			}
+
+			ticks = append(ticks, tick)
+		}
+	}
+
+	if len(ticks) == 0 {
+		usagef("bench: no ticks")
+	}
+
+	opts := []candles.Option{
+		candles.WithIntervals(intervals...),
+		candles.WithTimezone(loc),
+		candles.WithWorkers(*workers),
+	}
+
+	fmt.Printf("%d ticks, %d instruments, intervals %s, %d workers\n\n", len(ticks), countIDs(ticks), *intervalsFlag, *workers)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "run\ttime\tticks/s\tcandles/s\tallocs\talloc MB\tGCs\t")
+
+	var times []time.Duration
+
+	for run := 1; run <= *runs && ctx.Err() == nil; run++ {
+		var before, after runtime.MemStats
+
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		start := time.Now()
+
+		result, err := candles.AggregateContext(ctx, ticks, opts...)
+		if err != nil {
+			fatal(err)
+		}
+
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		times = append(times, elapsed)
+
+		fmt.Fprintf(tw, "%d\t%v\t%.0f\t%.0f\t%d\t%.1f\t%d\t\n",
+			run,
+			elapsed.Round(time.Microsecond),
+			float64(len(ticks))/elapsed.Seconds(),
+			float64(len(result))/elapsed.Seconds(),
+			after.Mallocs-before.Mallocs,
+			float64(after.TotalAlloc-before.TotalAlloc)/(1<<20),
+			after.NumGC-before.NumGC)
+	}
+
+	if err := ctx.Err(); err != nil {
+		tw.Flush()
+		fatal(err)
+	}
+
+	slices.Sort(times)
+
+	best, median := times[0], times[len(times)/2]
+
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "best\t%v\t%.0f\t\n", best.Round(time.Microsecond), float64(len(ticks))/best.Seconds())
+	fmt.Fprintf(tw, "median\t%v\t%.0f\t\n", median.Round(time.Microsecond), float64(len(ticks))/median.Seconds())
+
+	if rss := peakRSS(); rss > 0 {
+		fmt.Fprintf(tw, "peak RSS\t%.1f MB\t\n", float64(rss)/(1<<20))
+	}
+
+	if err := tw.Flush(); err != nil {
+		fatal(err)
+	}
+}
+
+// countIDs returns the number of instruments of the ticks.
+func countIDs(ticks []candles.Tick) int {
+	ids := make(map[string]bool)
+
+	for _, tick := range ticks {
+		ids[tick.ID] = true
+	}
+
+	return len(ids)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// priceRange bounds plausible prices to [min, max].
+type priceRange struct {
+	min, max float64
+}
+
+func (r priceRange) contains(price float64) bool {
+	return price >= r.min && price <= r.max
+}
+
+// priceBounds drops the ticks with prices outside of the plausible range of
+// their instrument: the one of the -price-limits file, or the -min-price
+// and -max-price one.
+type priceBounds struct {
+	global   priceRange
+	limits   map[string]priceRange
+	rejected int
+}
+
+// newPriceBounds returns the bounds of the flags, or nil if there are none.
+// Zero min and max prices are unbounded.
+func newPriceBounds(minPrice, maxPrice float64, limitsPath string) (*priceBounds, error) {
+	if minPrice == 0 && maxPrice == 0 && limitsPath == "" {
+		return nil, nil
+	}
+
+	b := &priceBounds{global: priceRange{min: math.Inf(-1), max: math.Inf(1)}}
+
+	if minPrice != 0 {
+		b.global.min = minPrice
+	}
+
+	if maxPrice != 0 {
+		b.global.max = maxPrice
+	}
+
+	if b.global.min > b.global.max {
+		return nil, fmt.Errorf("-min-price %g is above -max-price %g", minPrice, maxPrice)
+	}
+
+	if limitsPath != "" {
+		limits, err := readPriceLimits(limitsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		b.limits = limits
+	}
+
+	return b, nil
+}
+
+// readPriceLimits reads a CSV file of id,min,max rows, optionally headed by
+// such a row. An empty min or max leaves that side unbounded.
+func readPriceLimits(path string) (map[string]priceRange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(records) > 0 && strings.EqualFold(records[0][0], "id") {
+		records = records[1:]
+	}
+
+	limits := make(map[string]priceRange, len(records))
+
+	for _, record := range records {
+		lo, err := parseLimit(record[1], math.Inf(-1))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: bad min price: %w", path, record[0], err)
+		}
+
+		hi, err := parseLimit(record[2], math.Inf(1))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: bad max price: %w", path, record[0], err)
+		}
+
+		if lo > hi {
+			return nil, fmt.Errorf("%s: %s: min price %s is above max price %s", path, record[0], record[1], record[2])
+		}
+
+		limits[record[0]] = priceRange{min: lo, max: hi}
+	}
+
+	return limits, nil
+}
+
+// parseLimit parses a price limit, unbounded if empty.
+func parseLimit(s string, unbounded float64) (float64, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return unbounded, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// pricedTick returns the tick with the price checked by the bounds and the
+// outlier filter: the midpoint of its quotes with -quotes, else its trade
+// price. It returns false for ticks without one, cancels and the quotes
+// ignored without -quotes.
+func pricedTick(tick candles.Tick, quotes bool) (candles.Tick, bool) {
+	switch {
+	case tick.Kind == candles.Cancel:
+		return tick, false
+	case quotes:
+		tick.Price = (tick.Bid + tick.Ask) / 2
+		return tick, tick.Bid != 0 && tick.Ask != 0
+	}
+
+	return tick, tick.Kind != candles.Quote
+}
+
+// reject reports whether the price of tick is implausible, counting it if
+// so.
+func (b *priceBounds) reject(tick candles.Tick) bool {
+	bounds, ok := b.limits[tick.ID]
+	if !ok {
+		bounds = b.global
+	}
+
+	// NaN is outside of any range.
+	if bounds.contains(tick.Price) {
+		return false
+	}
+
+	b.rejected++
+	slog.Debug("rejected tick out of price bounds", "id", tick.ID, "price", tick.Price, "time", tick.Time)
+
+	return true
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/indicators"
+	"github.com/mal-as/tinkoff_candles/pkg/store"
+)
+
+const (
+	ansiGreen = "\x1b[32m"
+	ansiRed   = "\x1b[31m"
+	ansiReset = "\x1b[0m"
+
+	chartHelp = "←/→ h/l pan  PgUp/PgDn H/L page  +/- zoom  Home/End g/G  q quit"
+)
+
+func runChart(args []string) {
+	fs := flag.NewFlagSet("chart", flag.ExitOnError)
+	db := fs.String("db", "", "SQLite candle store written with -store to read instead of candle files")
+	id := fs.String("id", "", "instrument to chart (default the first one)")
+	intervalFlag := fs.String("interval", "", "candle interval to chart, e.g. 5m or 1d (default the first one of the instrument)")
+	tz := fs.String("tz", "UTC", "time zone of the time axis, e.g. Europe/Moscow")
+	inputFormat := fs.String("input-format", "csv", "input format: csv, jsonl or proto")
+	inputHeader := fs.Bool("input-header", false, "the first CSV input row names the columns")
+	static := fs.Bool("static", false, "print the chart once instead of the interactive view, the default when stdout is not a terminal")
+	width := fs.Int("width", 0, "chart width in columns, or pixels with -o (default the terminal width or 100, 1200 with -o)")
+	height := fs.Int("height", 0, "chart height in rows, or pixels with -o (default the terminal height or 30, 600 with -o)")
+	output := fs.String("o", "", "draw the chart into this .png or .svg file instead of the terminal")
+	volume := fs.Bool("volume", false, "with -o, add a volume pane below the candles")
+	indicatorsFlag := fs.String("indicators", "", "with -o, comma separated indicators drawn over the candles: sma:N, ema:N or bb[:period:multiplier]")
+	parseFlags(fs, args)
+
+	var specs []indicators.Spec
+
+	if *indicatorsFlag != "" {
+		if *output == "" {
+			usagef("chart: -indicators requires -o")
+		}
+
+		var err error
+
+		if specs, err = indicators.Parse(*indicatorsFlag); err != nil {
+			fatal(err)
+		}
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	var interval string
+
+	if *intervalFlag != "" {
+		i, err := candles.ParseInterval(*intervalFlag)
+		if err != nil {
+			usagef("chart: bad -interval: %v", err)
+		}
+
+		interval = i.String()
+	}
+
+	var all []candles.Candle
+
+	if *db != "" {
+		s, err := store.Open(*db)
+		if err != nil {
+			fatal(err)
+		}
+
+		all, err = s.Query(signalContext(), store.Query{ID: *id, Interval: interval})
+		s.Close()
+
+		if err != nil {
+			fatal(err)
+		}
+	} else if all, err = readCandles(fs.Args(), *inputFormat, *inputHeader); err != nil {
+		fatal(err)
+	}
+
+	cs := chartCandles(all, *id, interval)
+	if len(cs) == 0 {
+		fatal(errors.New("chart: no candles to draw"))
+	}
+
+	for i := range cs {
+		cs[i].Time = cs[i].Time.In(loc)
+	}
+
+	if *output != "" {
+		w, h := *width, *height
+		if w <= 0 {
+			w = 1200
+		}
+
+		if h <= 0 {
+			h = 600
+		}
+
+		if err := writeChartImage(*output, cs, specs, *volume, w, h); err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
+	v := &chartView{cs: cs, end: len(cs), per: 1, step: 2}
+
+	if *static || !term.IsTerminal(int(os.Stdout.Fd())) {
+		w, h := chartSize(*width, *height)
+		v.color = term.IsTerminal(int(os.Stdout.Fd()))
+
+		for _, line := range v.render(w, h, false) {
+			fmt.Println(line)
+		}
+
+		return
+	}
+
+	v.color = true
+
+	if err := v.run(*width, *height); err != nil {
+		fatal(err)
+	}
+}
+
+// chartCandles returns the candles of the instrument and interval, by
+// default of the first instrument and its first interval, in time order.
+func chartCandles(all []candles.Candle, id, interval string) []candles.Candle {
+	var result []candles.Candle
+
+	for _, c := range all {
+		if id == "" {
+			id = c.ID
+		}
+
+		if c.ID != id {
+			continue
+		}
+
+		if interval == "" {
+			interval = c.Interval.String()
+		}
+
+		if c.Interval.String() == interval {
+			result = append(result, c)
+		}
+	}
+
+	slices.SortStableFunc(result, func(a, b candles.Candle) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return result
+}
+
+// chartSize returns the flag sizes, defaulting to the terminal size.
+func chartSize(width, height int) (int, int) {
+	w, h, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		w, h = 100, 30
+	}
+
+	if width > 0 {
+		w = width
+	}
+
+	if height > 0 {
+		h = height
+	}
+
+	return w, h
+}
+
+// chartView is the visible part of a candle series. Zoomed out, every
+// column shows per candles merged into one; zoomed in, a candle takes step
+// columns.
+type chartView struct {
+	cs    []candles.Candle
+	end   int
+	per   int
+	step  int
+	color bool
+}
+
+// run shows the interactive chart until q is pressed. Keys are read from
+// the terminal, so the candles may come from stdin.
+func (v *chartView) run(width, height int) error {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return err
+	}
+
+	defer tty.Close()
+
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		return err
+	}
+
+	defer term.Restore(int(tty.Fd()), state)
+
+	out := bufio.NewWriter(os.Stdout)
+
+	// The alternate screen keeps the shell history intact.
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+
+	defer func() {
+		out.WriteString("\x1b[?25h\x1b[?1049l")
+		out.Flush()
+	}()
+
+	keys := make(chan string)
+
+	go func() {
+		buf := make([]byte, 16)
+
+		for {
+			n, err := tty.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+
+			keys <- string(buf[:n])
+		}
+	}()
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	var w, h int
+
+	draw := func() error {
+		w, h = chartSize(width, height)
+
+		out.WriteString("\x1b[H")
+
+		for i, line := range v.render(w, h, true) {
+			if i > 0 {
+				out.WriteString("\r\n")
+			}
+
+			out.WriteString(line + "\x1b[K")
+		}
+
+		out.WriteString("\x1b[J")
+
+		return out.Flush()
+	}
+
+	if err := draw(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case k, ok := <-keys:
+			if !ok || !v.key(k, w) {
+				return nil
+			}
+		case <-ticker.C:
+			// Redraw when the terminal is resized.
+			if nw, nh := chartSize(width, height); nw == w && nh == h {
+				continue
+			}
+		}
+
+		if err := draw(); err != nil {
+			return err
+		}
+	}
+}
+
+// key applies a key press to the view, returning false to quit.
+func (v *chartView) key(k string, width int) bool {
+	page := max(1, (width-10)/v.step) * v.per
+
+	switch k {
+	case "q", "Q", "\x1b", "\x03":
+		return false
+	case "h", "\x1b[D":
+		v.end -= v.per
+	case "l", "\x1b[C":
+		v.end += v.per
+	case "H", "\x1b[5~":
+		v.end -= page
+	case "L", "\x1b[6~":
+		v.end += page
+	case "g", "\x1b[H", "\x1b[1~":
+		v.end = 0
+	case "G", "\x1b[F", "\x1b[4~":
+		v.end = len(v.cs)
+	case "+", "=":
+		if v.per > 1 {
+			v.per /= 2
+		} else if v.step < 5 {
+			v.step++
+		}
+	case "-", "_":
+		if v.step > 1 {
+			v.step--
+		} else if v.per < len(v.cs) {
+			v.per *= 2
+		}
+	}
+
+	// Keep at least a screen of candles when panned to the start.
+	v.end = min(max(v.end, page), len(v.cs))
+
+	return true
+}
+
+// render draws the chart as lines of the given size: a status line, the
+// candles with a price axis on the right, the time axis and, if help is
+// set, the keys.
+func (v *chartView) render(width, height int, help bool) []string {
+	plotH := height - 2
+	if help {
+		plotH--
+	}
+
+	plotH = max(plotH, 3)
+
+	// The width of the price labels depends on the prices shown, so take
+	// the candles of a guessed width first and then those that fit.
+	groups := v.groups(max(1, (width-10)/v.step))
+	lo, hi, prec := chartRange(groups, plotH)
+
+	labelW := 0
+	for _, p := range []float64{lo, hi} {
+		labelW = max(labelW, len(strconv.FormatFloat(p, 'f', prec, 64)))
+	}
+
+	plotW := max(width-labelW-1, 1)
+	if n := max(plotW/v.step, 1); n < len(groups) {
+		groups = groups[len(groups)-n:]
+		lo, hi, prec = chartRange(groups, plotH)
+	}
+
+	// scale maps a price to half rows from the bottom of the plot.
+	scale := func(p float64) float64 {
+		return (p - lo) / (hi - lo) * float64(2*plotH)
+	}
+
+	halves := func(a, b float64) (int, int) {
+		from := int(math.Floor(scale(a)))
+		to := max(int(math.Ceil(scale(b)))-1, from)
+
+		return min(max(from, 0), 2*plotH-1), min(max(to, 0), 2*plotH-1)
+	}
+
+	lines := []string{v.status(groups)}
+
+	for row := range plotH {
+		var b strings.Builder
+
+		// The bottom and top half rows of the line.
+		bottom := 2 * (plotH - 1 - row)
+
+		for i, g := range groups {
+			bodyFrom, bodyTo := halves(min(g.Open, g.Close), max(g.Open, g.Close))
+			wickFrom, wickTo := halves(g.Low, g.High)
+
+			part := func(half int) int {
+				switch {
+				case half >= bodyFrom && half <= bodyTo:
+					return 2
+				case half >= wickFrom && half <= wickTo:
+					return 1
+				}
+
+				return 0
+			}
+
+			ch := candleGlyphs[part(bottom+1)][part(bottom)]
+
+			if i > 0 {
+				b.WriteString(strings.Repeat(" ", v.step-1))
+			}
+
+			if ch != ' ' && v.color {
+				color := ansiGreen
+				if g.Close < g.Open {
+					color = ansiRed
+				}
+
+				b.WriteString(color + string(ch) + ansiReset)
+			} else {
+				b.WriteRune(ch)
+			}
+		}
+
+		used := max(len(groups)*v.step-(v.step-1), 0)
+		b.WriteString(strings.Repeat(" ", max(plotW-used, 0)+1))
+
+		if row%4 == 0 {
+			p := hi - (float64(row)+0.5)/float64(plotH)*(hi-lo)
+			b.WriteString(strconv.FormatFloat(p, 'f', prec, 64))
+		}
+
+		lines = append(lines, b.String())
+	}
+
+	lines = append(lines, v.timeAxis(groups, plotW))
+
+	if help {
+		lines = append(lines, chartHelp)
+	}
+
+	return lines
+}
+
+// candleGlyphs draws a cell by its top and bottom halves: 0 empty, 1 wick,
+// 2 body.
+var candleGlyphs = [3][3]rune{
+	{' ', '╷', '╻'},
+	{'╵', '│', '╽'},
+	{'╹', '╿', '┃'},
+}
+
+// groups returns the last n visible columns of candles, merging per
+// candles into each. Columns are aligned to the start of the series, so
+// panning doesn't change them.
+func (v *chartView) groups(n int) []candles.Candle {
+	last := (v.end + v.per - 1) / v.per
+	first := max(last-n, 0)
+
+	var result []candles.Candle
+
+	for g := first; g < last; g++ {
+		part := v.cs[g*v.per : min((g+1)*v.per, len(v.cs))]
+
+		c := part[0]
+		for _, next := range part[1:] {
+			c.High, c.Low = max(c.High, next.High), min(c.Low, next.Low)
+			c.Close = next.Close
+			c.Volume += next.Volume
+		}
+
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// status describes the last visible column.
+func (v *chartView) status(groups []candles.Candle) string {
+	if len(groups) == 0 {
+		return ""
+	}
+
+	c := groups[len(groups)-1]
+
+	s := fmt.Sprintf("%s %s  %s  O %g  H %g  L %g  C %g  V %g", c.ID, c.Interval, c.Time.Format("2006-01-02 15:04:05"), c.Open, c.High, c.Low, c.Close, c.Volume)
+
+	if v.per > 1 {
+		s += fmt.Sprintf("  (%d candles per column)", v.per)
+	}
+
+	return s
+}
+
+// timeAxis labels the columns with the times of their candles, as many as
+// fit without overlapping.
+func (v *chartView) timeAxis(groups []candles.Candle, width int) string {
+	layout := "01-02 15:04"
+	if len(groups) > 0 && (groups[0].Interval.IsCalendar() || groups[0].Interval.Duration >= 24*time.Hour) {
+		layout = "2006-01-02"
+	}
+
+	axis := []rune(strings.Repeat(" ", width))
+	free := 0
+
+	for i, g := range groups {
+		col := i * v.step
+		label := g.Time.Format(layout)
+
+		if col < free || col+len(label) > width {
+			continue
+		}
+
+		copy(axis[col:], []rune(label))
+		free = col + len(label) + 2
+	}
+
+	return strings.TrimRight(string(axis), " ")
+}
+
+// chartRange returns the price range of the candles and the decimals of
+// its labels.
+func chartRange(groups []candles.Candle, rows int) (float64, float64, int) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, g := range groups {
+		lo, hi = min(lo, g.Low), max(hi, g.High)
+	}
+
+	if hi-lo < 1e-9 {
+		pad := max(math.Abs(hi)*0.01, 0.5)
+		lo, hi = lo-pad, hi+pad
+	}
+
+	return lo, hi, chartPrecision((hi - lo) / float64(rows))
+}
+
+// chartPrecision returns the number of decimals telling apart prices a row
+// apart.
+func chartPrecision(row float64) int {
+	if row <= 0 {
+		return 2
+	}
+
+	return min(max(int(-math.Floor(math.Log10(row)))+1, 0), 8)
+}
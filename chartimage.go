@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/internal/plot"
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/indicators"
+)
+
+// overlayIndicators are the indicators on the price scale, which can be
+// drawn over the candles.
+var overlayIndicators = []string{"sma", "ema", "bb"}
+
+var (
+	chartUp       = color.RGBA{0x26, 0xa6, 0x9a, 0xff}
+	chartDown     = color.RGBA{0xef, 0x53, 0x50, 0xff}
+	chartGrid     = color.RGBA{0xe6, 0xe6, 0xe6, 0xff}
+	chartText     = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartOverlays = []color.RGBA{
+		{0x1e, 0x88, 0xe5, 0xff},
+		{0xfb, 0x8c, 0x00, 0xff},
+		{0x8e, 0x24, 0xaa, 0xff},
+		{0x43, 0xa0, 0x47, 0xff},
+		{0x6d, 0x4c, 0x41, 0xff},
+	}
+)
+
+// writeChartImage draws the candles into an SVG or PNG file, with the
+// indicators over them and, if volume is set, a volume pane below.
+func writeChartImage(path string, cs []candles.Candle, specs []indicators.Spec, volume bool, width, height int) error {
+	for _, spec := range specs {
+		if !slices.Contains(overlayIndicators, spec.Name) {
+			return fmt.Errorf("chart: %s is not on the price scale, only %v can be drawn over candles", spec.Name, overlayIndicators)
+		}
+	}
+
+	canvas, err := plot.New(path, width, height)
+	if err != nil {
+		return err
+	}
+
+	var columns []string
+
+	if len(specs) > 0 {
+		p, err := indicators.NewPipeline(specs)
+		if err != nil {
+			return err
+		}
+
+		columns = p.Columns()
+
+		for i := range cs {
+			cs[i].Indicators = p.Next(cs[i])
+		}
+	}
+
+	drawChart(canvas, cs, columns, volume)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := canvas.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// drawChart draws candles of a series in time order with the indicator
+// columns as lines.
+func drawChart(c plot.Canvas, cs []candles.Candle, columns []string, volume bool) {
+	width, height := c.Size()
+
+	const (
+		left   = 10.0
+		right  = 70.0
+		top    = 40.0
+		bottom = 30.0
+		gap    = 10.0
+	)
+
+	plotW := float64(width) - left - right
+	priceTop, priceBottom := top, float64(height)-bottom
+	volumeTop := priceBottom
+
+	if volume {
+		volumeTop = priceTop + (priceBottom-priceTop)*0.75 + gap/2
+		priceBottom = volumeTop - gap
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+
+	for _, candle := range cs {
+		lo, hi = min(lo, candle.Low), max(hi, candle.High)
+
+		for _, column := range columns {
+			if v := candle.Indicators[column]; !math.IsNaN(v) {
+				lo, hi = min(lo, v), max(hi, v)
+			}
+		}
+	}
+
+	if hi-lo < 1e-9 {
+		pad := max(math.Abs(hi)*0.01, 0.5)
+		lo, hi = lo-pad, hi+pad
+	}
+
+	pad := (hi - lo) * 0.05
+	lo, hi = lo-pad, hi+pad
+
+	slot := plotW / float64(len(cs))
+	body := max(slot*0.7, 1)
+
+	x := func(i int) float64 {
+		return left + (float64(i)+0.5)*slot
+	}
+
+	y := func(p float64) float64 {
+		return priceBottom - (p-lo)/(hi-lo)*(priceBottom-priceTop)
+	}
+
+	ticks, prec := plot.Ticks(lo, hi, max(int((priceBottom-priceTop)/50), 2))
+
+	for _, t := range ticks {
+		c.Line(left, y(t), left+plotW, y(t), 1, chartGrid)
+		c.Text(left+plotW+8, y(t), strconv.FormatFloat(t, 'f', prec, 64), plot.Left, chartText)
+	}
+
+	drawTimeAxis(c, cs, x, slot, float64(height)-bottom/2)
+
+	for i, candle := range cs {
+		col := chartUp
+		if candle.Close < candle.Open {
+			col = chartDown
+		}
+
+		c.Line(x(i), y(candle.High), x(i), y(candle.Low), 1, col)
+		c.FillRect(x(i)-body/2, y(max(candle.Open, candle.Close)), x(i)+body/2, y(min(candle.Open, candle.Close)), col)
+	}
+
+	legend := left
+
+	for j, column := range columns {
+		col := chartOverlays[j%len(chartOverlays)]
+
+		xs := make([]float64, len(cs))
+		ys := make([]float64, len(cs))
+
+		for i, candle := range cs {
+			xs[i] = x(i)
+			ys[i] = math.NaN()
+
+			if v, ok := candle.Indicators[column]; ok && !math.IsNaN(v) {
+				ys[i] = y(v)
+			}
+		}
+
+		plot.Polyline(c, xs, ys, 1.5, col)
+
+		c.FillRect(legend, top-12, legend+12, top-10, col)
+		c.Text(legend+16, top-11, column, plot.Left, chartText)
+		legend += 16 + 8*float64(len(column)) + 16
+	}
+
+	first, last := cs[0], cs[len(cs)-1]
+	c.Text(left, 14, fmt.Sprintf("%s %s  %s - %s", first.ID, first.Interval, first.Time.Format("2006-01-02 15:04"), last.Time.Format("2006-01-02 15:04")), plot.Left, chartText)
+
+	if !volume {
+		return
+	}
+
+	maxVolume := 0.0
+	for _, candle := range cs {
+		maxVolume = max(maxVolume, candle.Volume)
+	}
+
+	volumeBottom := float64(height) - bottom
+	c.Line(left, volumeBottom, left+plotW, volumeBottom, 1, chartGrid)
+	c.Text(left+plotW+8, volumeTop, compactNumber(maxVolume), plot.Left, chartText)
+
+	if maxVolume == 0 {
+		return
+	}
+
+	for i, candle := range cs {
+		col := chartUp
+		if candle.Close < candle.Open {
+			col = chartDown
+		}
+
+		h := candle.Volume / maxVolume * (volumeBottom - volumeTop)
+
+		c.FillRect(x(i)-body/2, volumeBottom-h, x(i)+body/2, volumeBottom, color.NRGBA{col.R, col.G, col.B, 0x99})
+	}
+}
+
+// drawTimeAxis labels candles with their times, leaving room between the
+// labels.
+func drawTimeAxis(c plot.Canvas, cs []candles.Candle, x func(int) float64, slot, y float64) {
+	layout := "01-02 15:04"
+	if cs[0].Interval.IsCalendar() || cs[0].Interval.Duration >= 24*time.Hour {
+		layout = "2006-01-02"
+	}
+
+	width, _ := c.Size()
+	every := max(int(math.Ceil(110/slot)), 1)
+
+	for i := 0; i < len(cs); i += every {
+		// Skip labels cut by the edges of the image.
+		if half := 4 * float64(len(layout)); x(i) < half || x(i) > float64(width)-half {
+			continue
+		}
+
+		c.Text(x(i), y, cs[i].Time.Format(layout), plot.Center, chartText)
+	}
+}
+
+// compactNumber formats large values with a k, M or B suffix.
+func compactNumber(v float64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   float64
+	}{{"B", 1e9}, {"M", 1e6}, {"k", 1e3}} {
+		if math.Abs(v) >= unit.size {
+			return strconv.FormatFloat(v/unit.size, 'f', 1, 64) + unit.suffix
+		}
+	}
+
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
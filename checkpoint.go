@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// checkpoint is the state of a -stream run saved to resume it: the number
+// of input records consumed and the open candles built from them. The
+// candles closed before it have been written.
+type checkpoint struct {
+	Saved time.Time `json:"saved"`
+	// Ticks is the number of input records consumed, including filtered
+	// and skipped ones, and Last the last tick among them.
+	Ticks      int64           `json:"ticks"`
+	Last       candles.Tick    `json:"last"`
+	Aggregator json.RawMessage `json:"aggregator"`
+}
+
+// countingReader counts the records read, so that a resumed run can skip
+// them.
+type countingReader struct {
+	r    tickReader
+	n    int64
+	last candles.Tick
+}
+
+func (r *countingReader) Read() (candles.Tick, error) {
+	tick, err := r.r.Read()
+	if err == io.EOF {
+		return tick, err
+	}
+
+	r.n++
+
+	if err == nil {
+		r.last = tick
+	}
+
+	return tick, err
+}
+
+// checkpointer saves checkpoints of a stream engine to a file: after every
+// write of closed candles, so they aren't written again on resume, and at
+// least every interval while ticks come in.
+type checkpointer struct {
+	path  string
+	every time.Duration
+	in    *countingReader
+	agg   *candles.Aggregator
+	saved time.Time
+}
+
+// maybeSave saves a checkpoint if the last one is older than the interval.
+func (c *checkpointer) maybeSave() error {
+	if time.Since(c.saved) < c.every {
+		return nil
+	}
+
+	return c.save()
+}
+
+// save writes the checkpoint to a temporary file renamed over the previous
+// one, so a crash leaves either of them intact.
+func (c *checkpointer) save() error {
+	state, err := c.agg.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	c.saved = time.Now()
+
+	data, err := json.Marshal(checkpoint{Saved: c.saved, Ticks: c.in.n, Last: c.in.last, Aggregator: state})
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(c.path), "."+filepath.Base(c.path)+".tmp")
+
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+
+	slog.Debug("checkpoint saved", "path", c.path, "ticks", c.in.n)
+
+	return nil
+}
+
+// resume restores the aggregator from the checkpoint file, if it exists,
+// and skips the input records it covers. The input must start as it did in
+// the checkpointed run.
+func (c *checkpointer) resume() error {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var cp checkpoint
+
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("checkpoint %s: %w", c.path, err)
+	}
+
+	if err := c.agg.UnmarshalJSON(cp.Aggregator); err != nil {
+		return fmt.Errorf("checkpoint %s: %w", c.path, err)
+	}
+
+	for c.in.n < cp.Ticks {
+		// Bad records were skipped or the run failed on them.
+		if _, err := c.in.Read(); err == io.EOF {
+			return fmt.Errorf("checkpoint %s: the input has %d records, the checkpoint covers %d", c.path, c.in.n, cp.Ticks)
+		}
+	}
+
+	last := c.in.last
+	if cp.Ticks > 0 && (last.ID != cp.Last.ID || last.Price != cp.Last.Price || !last.Time.Equal(cp.Last.Time) || last.Seq != cp.Last.Seq) {
+		return fmt.Errorf("checkpoint %s: the input differs from the checkpointed one at record %d", c.path, cp.Ticks)
+	}
+
+	c.saved = time.Now()
+
+	slog.Info("resumed from checkpoint", "path", c.path, "ticks", cp.Ticks, "saved", cp.Saved)
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// parseFlags parses the arguments of a command and sets the flags they
+// don't set from CANDLES_* environment variables, then from the -config
+// file: the command line takes precedence over the environment, which takes
+// precedence over the file. -h prints the usage of the command. It then
+// sets up the logging and profiling asked for by the flags shared by all
+// commands.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	path := fs.String("config", os.Getenv("CANDLES_CONFIG"), "read flag values from this YAML or TOML file, see README")
+	profile := addProfileFlags(fs)
+	logging := addLogFlags(fs)
+
+	fs.Usage = func() {
+		commandUsage(fs)
+	}
+
+	fs.Parse(args)
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	values := make(map[string]string)
+	source := make(map[string]string)
+
+	if *path != "" {
+		var err error
+		if values, err = readConfig(*path, fs.Name(), fs); err != nil {
+			usage(err)
+		}
+
+		for name := range values {
+			source[name] = *path
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		env := envName(f.Name)
+		if v, ok := os.LookupEnv(env); ok && f.Name != "config" {
+			values[f.Name] = v
+			source[f.Name] = env
+		}
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if set[name] {
+			continue
+		}
+
+		if err := fs.Set(name, values[name]); err != nil {
+			usagef("%s: bad %s: %v", source[name], name, err)
+		}
+	}
+
+	setupLogging(logging)
+	startProfiling(profile)
+}
+
+// envName returns the environment variable of a flag: CANDLES_ followed by
+// the flag name in upper case with dashes replaced by underscores.
+func envName(flagName string) string {
+	return "CANDLES_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readConfig reads the flag values of a command from a YAML file, or a TOML
+// one if its name ends with .toml. Top level keys name flags shared by the
+// commands, those not defined by the command are ignored; a table named
+// after a subcommand holds flags of that command only, overriding the top
+// level ones, and may not name unknown flags.
+func readConfig(path, command string, fs *flag.FlagSet) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+
+	for key, v := range doc {
+		if _, ok := v.(map[string]any); ok || fs.Lookup(key) == nil {
+			continue
+		}
+
+		if values[key], err = configValue(v); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+	}
+
+	section, _ := doc[command].(map[string]any)
+
+	for key, v := range section {
+		if fs.Lookup(key) == nil {
+			return nil, fmt.Errorf("%s: %s: unknown flag %q", path, command, key)
+		}
+
+		if values[key], err = configValue(v); err != nil {
+			return nil, fmt.Errorf("%s: %s.%s: %w", path, command, key, err)
+		}
+	}
+
+	return values, nil
+}
+
+// configValue formats a value of the config file as a flag value. Lists
+// become comma separated.
+func configValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	case []any:
+		items := make([]string, len(v))
+
+		for i, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+
+			items[i] = s
+		}
+
+		return strings.Join(items, ","), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", v)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// connectorURL is a -source or -sink address such as
+// kafka://host1:9092,host2:9092/topic?group=candles. Hosts is a comma
+// separated list, so it isn't parsed by net/url.
+type connectorURL struct {
+	Scheme string
+	Hosts  []string
+	Path   string
+	Query  url.Values
+}
+
+func parseConnectorURL(s string) (connectorURL, error) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok {
+		return connectorURL{}, fmt.Errorf("connector address must be scheme://hosts/path: %q", s)
+	}
+
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	hosts, path, _ := strings.Cut(rest, "/")
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return connectorURL{}, fmt.Errorf("%s: %w", s, err)
+	}
+
+	u := connectorURL{Scheme: scheme, Path: path, Query: query}
+
+	if hosts != "" {
+		u.Hosts = strings.Split(hosts, ",")
+	}
+
+	return u, nil
+}
+
+// openSource returns a reader of ticks from a message broker. Messages are
+// parsed as single records of the input format.
+func openSource(ctx context.Context, address string, in inputOptions) (tickReader, func() error, error) {
+	u, err := parseConnectorURL(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parse, err := messageParser(in.format, in.csv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parse = in.trace.parser(parse)
+
+	switch u.Scheme {
+	case "kafka":
+		return openKafkaSource(ctx, u, parse)
+	case "nats":
+		return openNATSSource(ctx, u, parse)
+	}
+
+	return nil, nil, fmt.Errorf("unknown source: %s", u.Scheme)
+}
+
+// openSink returns a writer of candles to a message broker or a database.
+func openSink(ctx context.Context, address string) (candleWriter, error) {
+	u, err := parseConnectorURL(address)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "kafka":
+		return newKafkaCandleWriter(ctx, u)
+	case "redis", "rediss":
+		return newRedisCandleWriter(ctx, u)
+	case "nats":
+		return newNATSCandleWriter(ctx, u)
+	case "clickhouse":
+		return newClickhouseCandleWriter(ctx, u)
+	case "postgres", "postgresql":
+		return newPostgresCandleWriter(ctx, u)
+	}
+
+	return nil, fmt.Errorf("unknown sink: %s", u.Scheme)
+}
+
+// messageParser returns a parser of ticks from messages of the input
+// format. CSV messages use the default column layout.
+func messageParser(format string, opts candles.CSVOptions) (func(msg []byte) (candles.Tick, error), error) {
+	parser := candles.TickParser{ParseTime: opts.ParseTime, Precision: opts.Precision}
+
+	switch format {
+	case "csv":
+		comma := opts.Comma
+		if comma == 0 {
+			comma = ','
+		}
+
+		return func(msg []byte) (candles.Tick, error) {
+			record := strings.Split(strings.TrimSpace(string(msg)), string(comma))
+			return parser.ParseRecord(record)
+		}, nil
+	case "jsonl":
+		return parser.ParseJSON, nil
+	}
+
+	return nil, fmt.Errorf("unknown input format: %s", format)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// dedupeKey identifies a tick for -dedupe: ticks equal in all of these are
+// repeats of the same trade.
+type dedupeKey struct {
+	id    string
+	price float64
+	time  int64
+	seq   int64
+	kind  candles.TickKind
+	bid   float64
+	ask   float64
+}
+
+// deduper drops exact duplicate ticks. With a window it forgets ticks more
+// than the window older than the latest one, which in -stream mode can't
+// enter candles anyway, so that its memory stays bounded.
+type deduper struct {
+	window time.Duration
+	seen   map[dedupeKey]struct{}
+	latest int64
+	// pruneAt is the number of remembered ticks at which the old ones are
+	// forgotten.
+	pruneAt int
+	dropped int
+}
+
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{window: window, seen: make(map[dedupeKey]struct{}), pruneAt: 1 << 16}
+}
+
+// duplicate reports whether tick repeats a tick seen before, remembering it
+// if not.
+func (d *deduper) duplicate(tick candles.Tick) bool {
+	key := dedupeKey{id: tick.ID, price: tick.Price, time: tick.Time.UnixNano(), seq: tick.Seq, kind: tick.Kind, bid: tick.Bid, ask: tick.Ask}
+
+	if _, ok := d.seen[key]; ok {
+		d.dropped++
+		return true
+	}
+
+	d.seen[key] = struct{}{}
+	d.latest = max(d.latest, key.time)
+
+	if d.window > 0 && len(d.seen) >= d.pruneAt {
+		d.prune()
+	}
+
+	return false
+}
+
+// prune forgets the ticks older than the window.
+func (d *deduper) prune() {
+	oldest := d.latest - int64(d.window)
+
+	for key := range d.seen {
+		if key.time < oldest {
+			delete(d.seen, key)
+		}
+	}
+
+	// Prune again once the map doubles, so that pruning takes amortized
+	// constant time per tick.
+	d.pruneAt = max(1<<16, 2*len(d.seen))
+}
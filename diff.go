@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+type candleKey struct {
+	id       string
+	interval candles.Interval
+	time     int64
+}
+
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	tolerance := fs.Float64("tolerance", 1e-9, "largest absolute price difference treated as equal")
+	volumeTolerance := fs.Float64("volume-tolerance", 1e-9, "largest absolute volume difference treated as equal")
+	fieldsFlag := fs.String("fields", "open,high,low,close,volume", "comma separated fields to compare")
+	inputFormat := fs.String("input-format", "csv", "input format of both files: csv, jsonl or proto")
+	inputHeader := fs.Bool("input-header", false, "the first CSV row of both files names the columns")
+	parseFlags(fs, args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		usagef("diff: two candle files are required")
+	}
+
+	fields := strings.Split(*fieldsFlag, ",")
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(field)
+
+		switch fields[i] {
+		case "open", "high", "low", "close", "volume":
+		default:
+			usagef("diff: unknown field %q", field)
+		}
+	}
+
+	oursName, refName := fs.Arg(0), fs.Arg(1)
+
+	ours, err := readCandles([]string{oursName}, *inputFormat, *inputHeader)
+	if err != nil {
+		fatal(err)
+	}
+
+	ref, err := readCandles([]string{refName}, *inputFormat, *inputHeader)
+	if err != nil {
+		fatal(err)
+	}
+
+	refByKey := make(map[candleKey]candles.Candle, len(ref))
+	for _, c := range ref {
+		refByKey[keyOf(c)] = c
+	}
+
+	var (
+		compared, differ, onlyOurs int
+		seen                       = make(map[candleKey]bool, len(ours))
+	)
+
+	for _, c := range ours {
+		key := keyOf(c)
+		seen[key] = true
+
+		r, ok := refByKey[key]
+		if !ok {
+			fmt.Printf("%s: only in %s\n", describeCandle(c), oursName)
+			onlyOurs++
+			continue
+		}
+
+		compared++
+		different := false
+
+		for _, field := range fields {
+			a, b := candleField(c, field), candleField(r, field)
+
+			tol := *tolerance
+			if field == "volume" {
+				tol = *volumeTolerance
+			}
+
+			if math.Abs(a-b) > tol {
+				fmt.Printf("%s: %s: %v vs %v (delta %.6g)\n", describeCandle(c), field, a, b, a-b)
+				different = true
+			}
+		}
+
+		if different {
+			differ++
+		}
+	}
+
+	var onlyRef []candles.Candle
+
+	for key, c := range refByKey {
+		if !seen[key] {
+			onlyRef = append(onlyRef, c)
+		}
+	}
+
+	sort.Slice(onlyRef, func(i, j int) bool {
+		if onlyRef[i].ID != onlyRef[j].ID {
+			return onlyRef[i].ID < onlyRef[j].ID
+		}
+
+		return onlyRef[i].Time.Before(onlyRef[j].Time)
+	})
+
+	for _, c := range onlyRef {
+		fmt.Printf("%s: only in %s\n", describeCandle(c), refName)
+	}
+
+	slog.Info("diff: compared candles", "compared", compared, "differ", differ, "only_"+oursName, onlyOurs, "only_"+refName, len(onlyRef))
+
+	if differ > 0 || onlyOurs > 0 || len(onlyRef) > 0 {
+		fatal(errors.New("candles differ"))
+	}
+}
+
+func keyOf(c candles.Candle) candleKey {
+	return candleKey{c.ID, c.Interval, c.Time.UnixNano()}
+}
+
+func describeCandle(c candles.Candle) string {
+	return fmt.Sprintf("%s %s %s", c.ID, c.Interval, c.Time.Format(time.RFC3339Nano))
+}
+
+func candleField(c candles.Candle, field string) float64 {
+	switch field {
+	case "open":
+		return c.Open
+	case "high":
+		return c.High
+	case "low":
+		return c.Low
+	case "close":
+		return c.Close
+	}
+
+	return c.Volume
+}
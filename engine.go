@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// engine turns the input ticks into output records.
+type engine interface {
+	add(tick candles.Tick) error
+	// finish writes the remaining output once the input is exhausted or
+	// interrupted, and closes the writer.
+	finish(ctx context.Context) error
+}
+
+// committer is a source acknowledging the ticks it has delivered, such as
+// a Kafka consumer group, so that they aren't delivered again. commit
+// acknowledges the ticks at times closed reports true for.
+type committer interface {
+	commit(closed func(time.Time) bool) error
+}
+
+// allClosed is the closed function once every candle is written.
+func allClosed(time.Time) bool { return true }
+
+// batchEngine aggregates the whole input at once.
+type batchEngine struct {
+	w     candleWriter
+	opts  []candles.Option
+	ticks []candles.Tick
+}
+
+func (e *batchEngine) add(tick candles.Tick) error {
+	e.ticks = append(e.ticks, tick)
+	return nil
+}
+
+func (e *batchEngine) finish(ctx context.Context) error {
+	if err := e.write(ctx); err != nil {
+		return err
+	}
+
+	return e.w.Close()
+}
+
+// write aggregates and writes the ticks added so far, and forgets them.
+func (e *batchEngine) write(ctx context.Context) error {
+	ticks, unmatched := candles.ApplyCorrections(e.ticks)
+	if unmatched > 0 {
+		slog.Warn("dropped corrections of unknown trades", "count", unmatched)
+	}
+
+	result, err := candles.AggregateContext(ctx, ticks, e.opts...)
+	if err != nil {
+		return err
+	}
+
+	writeCandles(e.w, result)
+	e.ticks = nil
+
+	return nil
+}
+
+// flushFile writes the candles of the ticks of a -watch file.
+func (e *batchEngine) flushFile(string) error {
+	if err := e.write(context.Background()); err != nil {
+		return err
+	}
+
+	return e.w.Flush()
+}
+
+// streamEngine writes candles as soon as their interval closes. With a
+// checkpointer it saves its state as it goes, and on interrupt keeps the
+// open candles in the checkpoint instead of writing them.
+type streamEngine struct {
+	w   candleWriter
+	agg *candles.Aggregator
+	cp  *checkpointer
+	// src, if set, is told which ticks are done with once the candles
+	// they closed are written.
+	src committer
+
+	// mu guards agg and w against the partial candle emitter and the
+	// clock.
+	mu sync.Mutex
+	// stops stop the partial candle emitter and the clock, if started;
+	// bgErr is the first error they met.
+	stops []func()
+	bgErr error
+	// idle is false once a tick is added since the last clock tick.
+	idle bool
+}
+
+func (e *streamEngine) add(tick candles.Tick) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.bgErr != nil {
+		return e.bgErr
+	}
+
+	e.idle = false
+
+	closed := e.agg.AddTick(tick)
+	if len(closed) == 0 {
+		if e.cp != nil {
+			return e.cp.maybeSave()
+		}
+
+		return nil
+	}
+
+	return e.write(closed)
+}
+
+// write writes closed candles, then acknowledges their ticks to the source
+// and saves the checkpoint. It must be called with mu held.
+func (e *streamEngine) write(closed []candles.Candle) error {
+	writeCandles(e.w, closed)
+
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+
+	if e.src != nil {
+		if err := e.src.commit(e.agg.Closed); err != nil {
+			return err
+		}
+	}
+
+	if e.cp != nil {
+		return e.cp.save()
+	}
+
+	return nil
+}
+
+// emitPartial starts writing the current state of the open candles that
+// changed, marked partial, every interval until finish.
+func (e *streamEngine) emitPartial(every time.Duration) {
+	e.every(every, func(time.Time) error {
+		partial := e.agg.Partial()
+		if len(partial) == 0 {
+			return nil
+		}
+
+		writeCandles(e.w, partial)
+
+		return e.w.Flush()
+	})
+}
+
+// advanceClock starts moving the aggregator clock to the wall clock every
+// period until finish, like the live streams do, so that the candles of a
+// quiet -follow or -listen input close. The clock only moves
+// after a period without ticks, so that the ticks of a backlog read at
+// once aren't taken for late.
+func (e *streamEngine) advanceClock(period time.Duration) {
+	e.every(period, func(now time.Time) error {
+		if !e.idle {
+			e.idle = true
+			return nil
+		}
+
+		closed := e.agg.Advance(now)
+		if len(closed) == 0 {
+			return nil
+		}
+
+		return e.write(closed)
+	})
+}
+
+// every calls f with mu held every period until finish, until it fails.
+func (e *streamEngine) every(period time.Duration, f func(now time.Time) error) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	e.stops = append(e.stops, func() {
+		close(done)
+		<-stopped
+	})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				e.mu.Lock()
+
+				if e.bgErr == nil {
+					e.bgErr = f(now)
+				}
+
+				e.mu.Unlock()
+			}
+		}
+	}()
+}
+
+func (e *streamEngine) finish(ctx context.Context) error {
+	for _, stop := range e.stops {
+		stop()
+	}
+
+	if e.bgErr != nil {
+		return e.bgErr
+	}
+
+	if e.cp != nil && ctx.Err() != nil {
+		if err := e.cp.save(); err != nil {
+			return err
+		}
+
+		return e.w.Close()
+	}
+
+	writeCandles(e.w, e.agg.Flush())
+
+	if late := e.agg.LateTicks(); late > 0 {
+		slog.Warn("dropped late ticks", "count", late)
+	}
+
+	if unmatched := e.agg.UnmatchedCorrections(); unmatched > 0 {
+		slog.Warn("dropped corrections of trades not in open candles", "count", unmatched)
+	}
+
+	if e.cp != nil {
+		if err := e.w.Flush(); err != nil {
+			return err
+		}
+
+		if err := e.cp.save(); err != nil {
+			return err
+		}
+	}
+
+	return e.w.Close()
+}
+
+// renkoEngine builds Renko bricks. Unless streaming, the input is sorted
+// by time first.
+type renkoEngine struct {
+	w      brickWriter
+	size   float64
+	loc    *time.Location
+	stream bool
+	renko  *candles.Renko
+	ticks  []candles.Tick
+}
+
+func newRenkoEngine(w brickWriter, size float64, loc *time.Location, stream bool) *renkoEngine {
+	return &renkoEngine{w: w, size: size, loc: loc, stream: stream, renko: candles.NewRenko(size, loc)}
+}
+
+func (e *renkoEngine) add(tick candles.Tick) error {
+	if !e.stream {
+		e.ticks = append(e.ticks, tick)
+		return nil
+	}
+
+	bricks := e.renko.AddTick(tick)
+	if len(bricks) == 0 {
+		return nil
+	}
+
+	if err := writeBricks(e.w, bricks); err != nil {
+		return err
+	}
+
+	return e.w.Flush()
+}
+
+func (e *renkoEngine) finish(context.Context) error {
+	if !e.stream {
+		if err := writeBricks(e.w, candles.RenkoBricks(e.ticks, e.size, e.loc)); err != nil {
+			return err
+		}
+	}
+
+	return e.w.Close()
+}
+
+func writeBricks(w brickWriter, bricks []candles.Brick) error {
+	for _, b := range bricks {
+		if err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// barEngine builds activity driven bars. Unless streaming, the input is
+// sorted by time first.
+type barEngine struct {
+	w       candleWriter
+	spec    candles.BarSpec
+	loc     *time.Location
+	stream  bool
+	builder *candles.BarBuilder
+	ticks   []candles.Tick
+}
+
+func newBarEngine(w candleWriter, spec candles.BarSpec, loc *time.Location, stream bool) *barEngine {
+	return &barEngine{w: w, spec: spec, loc: loc, stream: stream, builder: candles.NewBarBuilder(spec, loc)}
+}
+
+func (e *barEngine) add(tick candles.Tick) error {
+	if !e.stream {
+		e.ticks = append(e.ticks, tick)
+		return nil
+	}
+
+	c, ok := e.builder.AddTick(tick)
+	if !ok {
+		return nil
+	}
+
+	if err := e.w.Write(c); err != nil {
+		return err
+	}
+
+	return e.w.Flush()
+}
+
+func (e *barEngine) finish(context.Context) error {
+	if e.stream {
+		writeCandles(e.w, e.builder.Flush())
+	} else {
+		writeCandles(e.w, candles.Bars(e.ticks, e.spec, e.loc))
+	}
+
+	return e.w.Close()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// Exit statuses, so that scripts can tell failures apart. Commands that
+// find differences or violations, like diff and validate, exit with
+// exitFailure.
+const (
+	exitFailure = 1
+	// exitUsage is for bad flags and arguments, as the flag package exits.
+	exitUsage = 2
+	// exitBadInput is for an input record that can't be parsed.
+	exitBadInput = 3
+	// exitIO is for files and connections that fail.
+	exitIO = 4
+	// exitInterrupted is for work cut short by SIGINT or SIGTERM.
+	exitInterrupted = 130
+)
+
+// usageError is an error in the flags or arguments.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// fatal logs err and exits with the status of its kind.
+func fatal(err error) {
+	slog.Error(err.Error())
+	stopProfiling()
+	os.Exit(exitStatus(err))
+}
+
+// usage logs an error in the flags or arguments and exits with exitUsage.
+func usage(err error) {
+	fatal(usageError{err})
+}
+
+// usagef is usage with a formatted message.
+func usagef(format string, args ...any) {
+	usage(fmt.Errorf(format, args...))
+}
+
+func exitStatus(err error) int {
+	var (
+		usageErr usageError
+		parseErr *candles.ParseError
+		fieldErr *candles.FieldError
+		pathErr  *fs.PathError
+		netErr   net.Error
+	)
+
+	switch {
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &parseErr), errors.As(err, &fieldErr):
+		return exitBadInput
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &pathErr), errors.As(err, &netErr):
+		return exitIO
+	}
+
+	return exitFailure
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+func runFetch(args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	token := fs.String("token", os.Getenv("INVEST_TOKEN"), "Tinkoff Invest API token (default $INVEST_TOKEN)")
+	figis := fs.String("figi", "", "comma separated FIGIs or tickers of the instruments, e.g. SBER or SBER@TQBR")
+	intervalFlag := fs.String("interval", "1m", "candle interval supported by the API, e.g. 1m, 5m, 1h, 1d, 1w, 1mo")
+	fromFlag := fs.String("from", "", "start of the range, RFC3339 or 2006-01-02")
+	toFlag := fs.String("to", "", "end of the range, RFC3339 or 2006-01-02 (default now)")
+	tz := fs.String("tz", "UTC", "time zone of output times, e.g. Europe/Moscow")
+	outputFormat := fs.String("output-format", "csv", "output format: csv, jsonl, parquet, proto, arrow or xlsx")
+	storePath := fs.String("store", "", "save candles into this SQLite database instead of writing them to stdout")
+	enrich := fs.Bool("enrich", false, "add the ticker, lot and currency columns of the instruments to csv and jsonl output")
+	cache := fs.String("instruments-cache", defaultInstrumentsCache(), "file caching looked up instruments, empty to disable")
+	parseFlags(fs, args)
+
+	if *token == "" {
+		usagef("fetch: api token is required")
+	}
+
+	if *figis == "" {
+		usagef("fetch: at least one FIGI or ticker is required")
+	}
+
+	if *enrich && (*storePath != "" || *outputFormat != "csv" && *outputFormat != "jsonl") {
+		usagef("fetch: -enrich requires csv or jsonl output")
+	}
+
+	interval, err := candles.ParseInterval(*intervalFlag)
+	if err != nil {
+		usagef("fetch: bad -interval: %v", err)
+	}
+
+	from, err := parseTime(*fromFlag)
+	if err != nil {
+		usagef("fetch: bad -from: %v", err)
+	}
+
+	to := time.Now()
+	if *toFlag != "" {
+		if to, err = parseTime(*toFlag); err != nil {
+			usagef("fetch: bad -to: %v", err)
+		}
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	ctx := signalContext()
+	client := newTinkoffClient(*token)
+
+	insts, err := resolveInstruments(ctx, client, *cache, []string{*figis})
+	if err != nil {
+		fatal(err)
+	}
+
+	var w candleWriter
+
+	if *storePath != "" {
+		w, err = newStoreCandleWriter(*storePath)
+	} else {
+		var opts writerOptions
+		if *enrich {
+			opts.labels = instrumentLabels
+		}
+
+		w, err = newCandleWriter(*outputFormat, os.Stdout, opts)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	if *enrich {
+		w = newLabelWriter(w, insts)
+	}
+
+	for _, inst := range insts {
+		result, err := client.GetCandles(ctx, inst.FIGI, interval, from, to)
+		if err != nil {
+			fatal(err)
+		}
+
+		for i := range result {
+			result[i].Time = result[i].Time.In(loc)
+		}
+
+		writeCandles(w, result)
+	}
+
+	if err := w.Close(); err != nil {
+		fatal(err)
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty time")
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02", s)
+}
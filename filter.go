@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// tickFilter drops the ticks of instruments not selected by the -ids,
+// -exclude-ids and -id-regex flags and the ticks outside of the -from and
+// -to range.
+type tickFilter struct {
+	ids     map[string]bool
+	exclude map[string]bool
+	re      *regexp.Regexp
+	// from and to bound tick times to [from, to), zero when unbounded.
+	from time.Time
+	to   time.Time
+}
+
+func newTickFilter(ids, exclude, re, from, to string) (*tickFilter, error) {
+	f := &tickFilter{ids: parseIDSet(ids), exclude: parseIDSet(exclude)}
+
+	var err error
+
+	if re != "" {
+		if f.re, err = regexp.Compile(re); err != nil {
+			return nil, err
+		}
+	}
+
+	if from != "" {
+		if f.from, err = parseTime(from); err != nil {
+			return nil, err
+		}
+	}
+
+	if to != "" {
+		if f.to, err = parseTime(to); err != nil {
+			return nil, err
+		}
+	}
+
+	if !f.from.IsZero() && !f.to.IsZero() && !f.from.Before(f.to) {
+		return nil, fmt.Errorf("-from %s is not before -to %s", from, to)
+	}
+
+	return f, nil
+}
+
+// inRange reports whether t is in the [from, to) range.
+func (f *tickFilter) inRange(t time.Time) bool {
+	if !f.from.IsZero() && t.Before(f.from) {
+		return false
+	}
+
+	return f.to.IsZero() || t.Before(f.to)
+}
+
+// parseIDSet parses a comma separated list of instrument IDs, nil if empty.
+func parseIDSet(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+
+	set := make(map[string]bool)
+
+	for _, id := range strings.Split(s, ",") {
+		set[strings.TrimSpace(id)] = true
+	}
+
+	return set
+}
+
+// match reports whether the tick passes the filter.
+func (f *tickFilter) match(tick candles.Tick) bool {
+	if f.ids != nil && !f.ids[tick.ID] {
+		return false
+	}
+
+	if f.exclude[tick.ID] {
+		return false
+	}
+
+	if f.re != nil && !f.re.MatchString(tick.ID) {
+		return false
+	}
+
+	return f.inRange(tick.Time)
+}
+
+// completeWriter drops the candles whose interval, cut at the session end,
+// ends after the latest tick observed, only partially covered by the
+// input. Candles closed in -stream mode have ended before it anyway.
+type completeWriter struct {
+	candleWriter
+	schedule *candles.Schedule
+	// latest is the time of the latest tick in Unix nanoseconds, set
+	// while the partial candle emitter may be writing.
+	latest atomic.Int64
+}
+
+func (w *completeWriter) observe(t time.Time) {
+	if ns := t.UnixNano(); ns > w.latest.Load() {
+		w.latest.Store(ns)
+	}
+}
+
+func (w *completeWriter) Write(c candles.Candle) error {
+	if candleEnd(c, w.schedule).UnixNano() > w.latest.Load() {
+		return nil
+	}
+
+	return w.candleWriter.Write(c)
+}
+
+// candleEnd returns the end of the interval of a candle, cut at the
+// session end with a schedule.
+func candleEnd(c candles.Candle, schedule *candles.Schedule) time.Time {
+	if schedule != nil {
+		return schedule.End(c.Interval, c.Time)
+	}
+
+	return c.Interval.End(c.Time)
+}
+
+// rangeWriter drops the candles not within the range of the filter, such
+// as the ones of an interval partially before -from or after -to.
+type rangeWriter struct {
+	candleWriter
+	f        *tickFilter
+	schedule *candles.Schedule
+}
+
+func (w *rangeWriter) Write(c candles.Candle) error {
+	if !w.f.inRange(c.Time) {
+		return nil
+	}
+
+	if !w.f.to.IsZero() && candleEnd(c, w.schedule).After(w.f.to) {
+		return nil
+	}
+
+	return w.candleWriter.Write(c)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// followPoll is how often a followed file is checked for new data.
+const followPoll = 250 * time.Millisecond
+
+// followReader reads a file like tail -f: at the end of the file it waits
+// for more data until ctx is done. A truncated file is read again from the
+// start, and a file replaced under the same name, as by log rotation, is
+// reopened once the old one is read to the end.
+type followReader struct {
+	ctx  context.Context
+	name string
+	f    *os.File
+	pos  int64
+}
+
+// openFollow returns a reader of the ticks of the file and of the ticks
+// appended to it until ctx is done.
+func openFollow(ctx context.Context, name string, in inputOptions) (tickReader, func() error, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fr := &followReader{ctx: ctx, name: name, f: f}
+
+	dr, err := decompress(fr)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	r, err := newTickReader(in.format, in.trace.input(dr), in.csv)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return r, fr.Close, nil
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		r.pos += int64(n)
+
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+
+		changed, err := r.reopen()
+		if err != nil {
+			return 0, err
+		}
+
+		if changed {
+			continue
+		}
+
+		select {
+		case <-time.After(followPoll):
+		case <-r.ctx.Done():
+			return 0, io.EOF
+		}
+	}
+}
+
+// reopen starts over after truncation and switches to a new file under the
+// name, reporting whether it did either.
+func (r *followReader) reopen() (bool, error) {
+	info, err := r.f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if info.Size() < r.pos {
+		r.pos = 0
+		_, err := r.f.Seek(0, io.SeekStart)
+
+		return true, err
+	}
+
+	latest, err := os.Stat(r.name)
+	if err != nil || os.SameFile(info, latest) {
+		// The file may be missing for a moment while being replaced.
+		return false, nil
+	}
+
+	f, err := os.Open(r.name)
+	if err != nil {
+		return false, nil
+	}
+
+	r.f.Close()
+	r.f, r.pos = f, 0
+
+	return true, nil
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+type tickReader interface {
+	Read() (candles.Tick, error)
+}
+
+func newTickReader(format string, r io.Reader, opts candles.CSVOptions) (tickReader, error) {
+	switch format {
+	case "csv":
+		return candles.NewCSVReader(r, opts), nil
+	case "jsonl":
+		return candles.NewJSONReaderSize(r, candles.TickParser{ParseTime: opts.ParseTime, Precision: opts.Precision}, opts.MaxLineBytes), nil
+	}
+
+	return nil, fmt.Errorf("unknown input format: %s", format)
+}
+
+type candleWriter interface {
+	candles.Sink
+	// Close flushes the written candles and finishes the output format.
+	Close() error
+}
+
+type writerOptions struct {
+	columns []string
+	header  bool
+	// extra are the optional columns of ExtraColumns to output.
+	extra []string
+	// labels are the label columns to output, see candles.Candle.Labels.
+	labels []string
+	// indicators are the indicator columns to output.
+	indicators []string
+	// patterns adds the column of candlestick patterns.
+	patterns bool
+	// partial adds the column marking partial candles.
+	partial bool
+	// partitionDir is the directory of partitioned Parquet output.
+	partitionDir string
+	// sheetBy is the field naming the sheets of XLSX output: id or
+	// interval.
+	sheetBy string
+	// format formats the CSV output, candles.DefaultFormat if nil.
+	format *candles.Format
+}
+
+func newCandleWriter(format string, w io.Writer, opts writerOptions) (candleWriter, error) {
+	switch format {
+	case "csv":
+		if opts.columns == nil {
+			opts.columns = candles.DefaultColumns
+		}
+
+		columns := append(opts.columns[:len(opts.columns):len(opts.columns)], opts.extra...)
+		columns = append(columns, opts.labels...)
+		columns = append(columns, opts.indicators...)
+
+		if opts.patterns {
+			columns = append(columns, "patterns")
+		}
+
+		if opts.partial {
+			columns = append(columns, "partial")
+		}
+
+		return csvCandleWriter{candles.NewCSVSink(w, candles.CSVSinkOptions{Columns: columns, Header: opts.header, Format: opts.format})}, nil
+	case "jsonl":
+		bw := bufio.NewWriter(w)
+		return &jsonCandleWriter{w: bw, enc: json.NewEncoder(bw), extra: opts.extra}, nil
+	case "parquet":
+		return newParquetCandleWriter(w, opts.partitionDir, opts), nil
+	case "proto":
+		return &protoCandleWriter{w: candles.NewProtoWriter(w), extra: opts.extra}, nil
+	case "arrow":
+		return newArrowCandleWriter(w, opts), nil
+	case "xlsx":
+		return newXLSXCandleWriter(w, opts)
+	}
+
+	return nil, fmt.Errorf("unknown output format: %s", format)
+}
+
+// parseExtra parses a comma separated list of ExtraColumns.
+func parseExtra(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var result []string
+
+	for _, column := range strings.Split(s, ",") {
+		column = strings.TrimSpace(column)
+
+		if !slices.Contains(candles.ExtraColumns, column) {
+			return nil, fmt.Errorf("unknown extra column: %q", column)
+		}
+
+		result = append(result, column)
+	}
+
+	return result, nil
+}
+
+type csvCandleWriter struct {
+	*candles.CSVSink
+}
+
+func (w csvCandleWriter) Close() error {
+	return w.Flush()
+}
+
+type jsonCandleWriter struct {
+	w     *bufio.Writer
+	enc   *json.Encoder
+	extra []string
+}
+
+func (w *jsonCandleWriter) Write(c candles.Candle) error {
+	// Zero fields are omitted from the JSON, so clear the ones not asked for.
+	return w.enc.Encode(omitExtra(c, w.extra))
+}
+
+// omitExtra clears the extra fields of the candle not in extra.
+func omitExtra(c candles.Candle, extra []string) candles.Candle {
+	if !slices.Contains(extra, "vwap") {
+		c.VWAP = 0
+	}
+
+	if !slices.Contains(extra, "count") {
+		c.Count = 0
+	}
+
+	if !slices.Contains(extra, "spread") {
+		c.Spread = 0
+	}
+
+	if !slices.Contains(extra, "max_spread") {
+		c.MaxSpread = 0
+	}
+
+	if !slices.Contains(extra, "first_time") {
+		c.FirstTime = time.Time{}
+	}
+
+	if !slices.Contains(extra, "last_time") {
+		c.LastTime = time.Time{}
+	}
+
+	if !slices.Contains(extra, "first_seq") {
+		c.FirstSeq = 0
+	}
+
+	if !slices.Contains(extra, "last_seq") {
+		c.LastSeq = 0
+	}
+
+	return c
+}
+
+// extraType is the type of an extra field in the typed output formats:
+// float, int or time.
+func extraType(name string) string {
+	switch name {
+	case "count", "first_seq", "last_seq":
+		return "int"
+	case "first_time", "last_time":
+		return "time"
+	}
+
+	return "float"
+}
+
+// extraFloat returns the value of a floating point extra field.
+func extraFloat(c candles.Candle, name string) float64 {
+	switch name {
+	case "spread":
+		return c.Spread
+	case "max_spread":
+		return c.MaxSpread
+	}
+
+	return c.VWAP
+}
+
+// extraInt returns the value of an integer extra field.
+func extraInt(c candles.Candle, name string) int64 {
+	switch name {
+	case "first_seq":
+		return c.FirstSeq
+	case "last_seq":
+		return c.LastSeq
+	}
+
+	return int64(c.Count)
+}
+
+// extraTime returns the value of a time extra field.
+func extraTime(c candles.Candle, name string) time.Time {
+	if name == "first_time" {
+		return c.FirstTime
+	}
+
+	return c.LastTime
+}
+
+func (w *jsonCandleWriter) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *jsonCandleWriter) Close() error {
+	return w.Flush()
+}
+
+type protoCandleWriter struct {
+	w     *candles.ProtoWriter
+	extra []string
+}
+
+func (w *protoCandleWriter) Write(c candles.Candle) error {
+	// As in JSON, only the extra fields asked for are set.
+	return w.w.Write(omitExtra(c, w.extra))
+}
+
+func (w *protoCandleWriter) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *protoCandleWriter) Close() error {
+	return w.Flush()
+}
+
+type brickWriter interface {
+	Write(b candles.Brick) error
+	Flush() error
+	Close() error
+}
+
+// brickColumns is the CSV layout of Renko bricks.
+var brickColumns = []string{"id", "open", "close", "direction", "time"}
+
+func newBrickWriter(format string, w io.Writer, header bool, f candles.Format) (brickWriter, error) {
+	switch format {
+	case "csv":
+		return &csvBrickWriter{w: csv.NewWriter(w), header: header, format: f}, nil
+	case "jsonl":
+		bw := bufio.NewWriter(w)
+		return &jsonBrickWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+
+	return nil, fmt.Errorf("output format %s is not supported for renko bricks", format)
+}
+
+type csvBrickWriter struct {
+	w      *csv.Writer
+	format candles.Format
+	// header is true while the header row is still to be written.
+	header bool
+}
+
+func (w *csvBrickWriter) Write(b candles.Brick) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	return w.w.Write([]string{
+		b.ID,
+		w.format.Price(b.Open),
+		w.format.Price(b.Close),
+		b.Direction.String(),
+		b.Time.Format(time.RFC3339Nano),
+	})
+}
+
+func (w *csvBrickWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvBrickWriter) Close() error {
+	return w.Flush()
+}
+
+func (w *csvBrickWriter) writeHeader() error {
+	if !w.header {
+		return nil
+	}
+
+	w.header = false
+
+	return w.w.Write(brickColumns)
+}
+
+type jsonBrickWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonBrickWriter) Write(b candles.Brick) error {
+	return w.enc.Encode(b)
+}
+
+func (w *jsonBrickWriter) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *jsonBrickWriter) Close() error {
+	return w.Flush()
+}
+
+type candleReader interface {
+	Read() (candles.Candle, error)
+	// Line returns the line of the last candle read.
+	Line() int
+}
+
+func newCandleReader(format string, r io.Reader, header bool) (candleReader, error) {
+	switch format {
+	case "csv":
+		return candles.NewCandleCSVReader(r, header), nil
+	case "jsonl":
+		return &jsonCandleReader{r: candles.NewLineReader(r, 0)}, nil
+	case "proto":
+		return &protoCandleReader{r: candles.NewProtoReader(r)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown input format: %s", format)
+}
+
+type jsonCandleReader struct {
+	r    *candles.LineReader
+	line int
+}
+
+func (r *jsonCandleReader) Read() (candles.Candle, error) {
+	for {
+		line, err := r.r.ReadLine()
+		if err != nil {
+			return candles.Candle{}, err
+		}
+
+		r.line++
+
+		if len(line) == 0 {
+			continue
+		}
+
+		var c candles.Candle
+
+		if err := json.Unmarshal(line, &c); err != nil {
+			return candles.Candle{}, &candles.ParseError{Line: r.line, Record: string(line), Err: err}
+		}
+
+		return c, nil
+	}
+}
+
+func (r *jsonCandleReader) Line() int {
+	return r.line
+}
+
+// protoCandleReader counts the messages read in place of lines.
+type protoCandleReader struct {
+	r *candles.ProtoReader
+	n int
+}
+
+func (r *protoCandleReader) Read() (candles.Candle, error) {
+	c, err := r.r.Read()
+	if err == nil {
+		r.n++
+	}
+
+	return c, err
+}
+
+func (r *protoCandleReader) Line() int {
+	return r.n
+}
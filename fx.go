@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/tinkoff"
+)
+
+// fxRate is the price of a currency unit in the base currency, in effect
+// from its time on.
+type fxRate struct {
+	time time.Time
+	rate float64
+}
+
+// fxRates are the rate series of currencies in the base currency by
+// lowercase code, each sorted by time.
+type fxRates struct {
+	base   string
+	series map[string][]fxRate
+}
+
+func newFXRates(base string) *fxRates {
+	return &fxRates{base: strings.ToLower(base), series: make(map[string][]fxRate)}
+}
+
+// read reads a CSV file of currency,time,rate rows, optionally
+// headed by such a row, into the rates.
+func (fx *fxRates) read(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(records) > 0 && strings.EqualFold(records[0][0], "currency") {
+		records = records[1:]
+	}
+
+	for _, record := range records {
+		t, err := parseTime(record[1])
+		if err != nil {
+			return fmt.Errorf("%s: %s: bad time: %w", path, record[0], err)
+		}
+
+		rate, err := strconv.ParseFloat(record[2], 64)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("%s: %s: bad rate %q", path, record[0], record[2])
+		}
+
+		fx.add(record[0], t, rate)
+	}
+
+	fx.sort()
+
+	return nil
+}
+
+// fetch adds the daily closes of currency instruments, given as
+// comma separated code=ticker or code=FIGI pairs such as usd=USD000UTSTOM,
+// over [from, to). A close is in effect from the end of its day.
+func (fx *fxRates) fetch(ctx context.Context, client *tinkoff.Client, pairs string, from, to time.Time) error {
+	// Ticks at the start of the range need the close of the day before,
+	// which may be a week back over holidays.
+	from = from.AddDate(0, 0, -7)
+
+	for _, pair := range strings.Split(pairs, ",") {
+		code, ref, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("bad -fx-figi pair %q, want currency=ticker or currency=FIGI", pair)
+		}
+
+		insts, err := resolveInstruments(ctx, client, defaultInstrumentsCache(), []string{strings.TrimSpace(ref)})
+		if err != nil {
+			return err
+		}
+
+		result, err := client.GetCandles(ctx, insts[0].FIGI, candles.Days(1), from, to)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range result {
+			fx.add(code, c.Time.AddDate(0, 0, 1), c.Close)
+		}
+	}
+
+	fx.sort()
+
+	return nil
+}
+
+func (fx *fxRates) add(currency string, t time.Time, rate float64) {
+	currency = strings.ToLower(strings.TrimSpace(currency))
+	fx.series[currency] = append(fx.series[currency], fxRate{time: t, rate: rate})
+}
+
+func (fx *fxRates) sort() {
+	for _, series := range fx.series {
+		sort.SliceStable(series, func(i, j int) bool { return series[i].time.Before(series[j].time) })
+	}
+}
+
+// rate returns the rate of the currency in effect at t: the latest one
+// not after t, or the first one for times before the series. It reports
+// false for currencies without rates.
+func (fx *fxRates) rate(currency string, t time.Time) (float64, bool) {
+	currency = strings.ToLower(currency)
+	if currency == fx.base {
+		return 1, true
+	}
+
+	series := fx.series[currency]
+	if len(series) == 0 {
+		return 0, false
+	}
+
+	i := sort.Search(len(series), func(i int) bool { return series[i].time.After(t) })
+	if i == 0 {
+		return series[0].rate, true
+	}
+
+	return series[i-1].rate, true
+}
+
+// convert returns the factor converting prices in the currency into the
+// target one at t, and false if either has no rates.
+func (fx *fxRates) convert(currency, target string, t time.Time) (float64, bool) {
+	if strings.EqualFold(currency, target) {
+		return 1, true
+	}
+
+	from, ok := fx.rate(currency, t)
+	if !ok {
+		return 0, false
+	}
+
+	to, ok := fx.rate(target, t)
+	if !ok {
+		return 0, false
+	}
+
+	return from / to, true
+}
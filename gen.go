@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// secondsPerYear converts the annual drift and volatility of -volatility to
+// the time between ticks.
+const secondsPerYear = 365 * 24 * 60 * 60
+
+func runGen(args []string) {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	idsFlag := fs.String("ids", "", "comma separated instrument IDs, by default -instruments IDs named SYN0, SYN1...")
+	instruments := fs.Int("instruments", 10, "number of instruments without -ids")
+	fromFlag := fs.String("from", "2024-01-02T10:00:00Z", "time of the first ticks, RFC3339 or 2006-01-02")
+	duration := fs.Duration("duration", time.Hour, "time span of the ticks")
+	count := fs.Int64("count", 0, "stop after this many ticks, 0 for no limit")
+	rate := fs.Float64("rate", 1, "mean ticks per second of an instrument, arriving at random")
+	price := fs.Float64("price", 100, "initial price; instruments after the first start at random around it")
+	tickSize := fs.String("tick-size", "0.01", "price increment prices are rounded to")
+	volatility := fs.Float64("volatility", 0.3, "annualized volatility of the geometric Brownian motion of prices")
+	drift := fs.Float64("drift", 0, "annualized drift of prices")
+	volume := fs.Float64("volume", 10, "mean tick volume in lots")
+	gapProb := fs.Float64("gap-prob", 0, "probability that a tick is followed by a pause of an instrument, e.g. 0.001")
+	gap := fs.Duration("gap", 10*time.Minute, "mean length of the pauses of -gap-prob")
+	seed := fs.Uint64("seed", 1, "random seed; the same flags and seed give the same ticks")
+	outputFormat := fs.String("output-format", "csv", "output format: csv or jsonl")
+	header := fs.Bool("header", false, "write a header row to the CSV output")
+	compressFlag := fs.String("compress", "none", "compress the output: none, gzip or zstd")
+	parseFlags(fs, args)
+
+	if fs.NArg() > 0 {
+		usagef("gen: unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	from, err := parseTime(*fromFlag)
+	if err != nil {
+		usagef("gen: bad -from: %v", err)
+	}
+
+	var ids []string
+
+	if *idsFlag != "" {
+		ids = strings.Split(*idsFlag, ",")
+	} else {
+		for i := 0; i < *instruments; i++ {
+			ids = append(ids, "SYN"+strconv.Itoa(i))
+		}
+	}
+
+	if len(ids) == 0 || *rate <= 0 || *price <= 0 || *volume <= 0 || *volatility < 0 || *gapProb < 0 || *gapProb >= 1 {
+		usagef("gen: need instruments, and positive -rate, -price and -volume, -volatility >= 0 and 0 <= -gap-prob < 1")
+	}
+
+	tick, err := strconv.ParseFloat(*tickSize, 64)
+	if err != nil || tick <= 0 {
+		usagef("gen: bad -tick-size %q", *tickSize)
+	}
+
+	if *outputFormat != "csv" && *outputFormat != "jsonl" {
+		usagef("gen: unknown output format: %s", *outputFormat)
+	}
+
+	out, err := compress(*compressFlag, os.Stdout)
+	if err != nil {
+		usage(err)
+	}
+
+	g := newTickGenerator(genOptions{
+		ids:        ids,
+		from:       from,
+		to:         from.Add(*duration),
+		rate:       *rate,
+		price:      *price,
+		tickSize:   tick,
+		volatility: *volatility,
+		drift:      *drift,
+		volume:     *volume,
+		gapProb:    *gapProb,
+		gap:        *gap,
+		seed:       *seed,
+	})
+
+	bw := bufio.NewWriter(out)
+	decimals := decimalPlaces(*tickSize)
+
+	if *header && *outputFormat == "csv" {
+		bw.WriteString("id,price,time,volume\n")
+	}
+
+	ctx := signalContext()
+
+	for n := int64(0); (*count == 0 || n < *count) && ctx.Err() == nil; n++ {
+		t, ok := g.next()
+		if !ok {
+			break
+		}
+
+		if err := writeGenTick(bw, *outputFormat, t, decimals); err != nil {
+			fatal(err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		fatal(err)
+	}
+
+	if err := out.Close(); err != nil {
+		fatal(err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		fatal(err)
+	}
+}
+
+// decimalPlaces returns the number of decimals of a number such as 0.01.
+func decimalPlaces(s string) int {
+	if _, frac, ok := strings.Cut(s, "."); ok {
+		return len(frac)
+	}
+
+	return 0
+}
+
+func writeGenTick(w *bufio.Writer, format string, t candles.Tick, decimals int) error {
+	price := strconv.FormatFloat(t.Price, 'f', decimals, 64)
+	volume := strconv.FormatFloat(t.Volume, 'f', -1, 64)
+	ts := t.Time.Format(time.RFC3339Nano)
+
+	if format == "jsonl" {
+		id, err := json.Marshal(t.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, `{"id":%s,"price":%s,"time":"%s","volume":%s}`+"\n", id, price, ts, volume)
+
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s,%s,%s,%s\n", csvField(t.ID), price, ts, volume)
+
+	return err
+}
+
+// csvField quotes a field if the CSV format requires it.
+func csvField(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// genOptions are the parameters of a tickGenerator, see the gen flags.
+type genOptions struct {
+	ids                       []string
+	from, to                  time.Time
+	rate                      float64
+	price, tickSize           float64
+	volatility, drift, volume float64
+	gapProb                   float64
+	gap                       time.Duration
+	seed                      uint64
+}
+
+// tickGenerator produces the ticks of the instruments in time order. Each
+// instrument trades at random times at the mean rate, pausing now and
+// then, with prices following a geometric Brownian motion and volumes a
+// geometric distribution.
+type tickGenerator struct {
+	opts genOptions
+	rnd  *rand.Rand
+	// queue holds the next tick of every instrument, the earliest first.
+	queue genQueue
+}
+
+func newTickGenerator(opts genOptions) *tickGenerator {
+	g := &tickGenerator{opts: opts, rnd: rand.New(rand.NewPCG(opts.seed, opts.seed))}
+
+	for i, id := range opts.ids {
+		price := opts.price
+		if i > 0 {
+			price *= math.Exp(g.rnd.NormFloat64() * 0.5)
+		}
+
+		g.queue = append(g.queue, &genInstrument{id: id, price: price, time: opts.from.Add(g.wait())})
+	}
+
+	heap.Init(&g.queue)
+
+	return g
+}
+
+// next returns the next tick, or false once the time span is over.
+func (g *tickGenerator) next() (candles.Tick, bool) {
+	inst := g.queue[0]
+	if !inst.time.Before(g.opts.to) {
+		return candles.Tick{}, false
+	}
+
+	tick := candles.Tick{
+		ID:     inst.id,
+		Price:  math.Max(g.opts.tickSize, math.Round(inst.price/g.opts.tickSize)*g.opts.tickSize),
+		Time:   inst.time,
+		Volume: 1 + math.Floor(math.Log(1-g.rnd.Float64())/math.Log(1-1/g.opts.volume)),
+	}
+
+	wait := g.wait()
+	if g.rnd.Float64() < g.opts.gapProb {
+		wait += time.Duration(g.rnd.ExpFloat64() * float64(g.opts.gap))
+	}
+
+	// The price moves over the time to the next tick.
+	dt := wait.Seconds() / secondsPerYear
+	sigma := g.opts.volatility
+	inst.price *= math.Exp((g.opts.drift-sigma*sigma/2)*dt + sigma*math.Sqrt(dt)*g.rnd.NormFloat64())
+	inst.time = inst.time.Add(wait)
+
+	heap.Fix(&g.queue, 0)
+
+	return tick, true
+}
+
+// wait returns a random time between the ticks of an instrument.
+func (g *tickGenerator) wait() time.Duration {
+	return time.Duration(g.rnd.ExpFloat64() / g.opts.rate * float64(time.Second))
+}
+
+type genInstrument struct {
+	id    string
+	price float64
+	// time is the time of the next tick.
+	time time.Time
+}
+
+type genQueue []*genInstrument
+
+func (q genQueue) Len() int { return len(q) }
+
+func (q genQueue) Less(i, j int) bool {
+	if !q[i].time.Equal(q[j].time) {
+		return q[i].time.Before(q[j].time)
+	}
+
+	return q[i].id < q[j].id
+}
+
+func (q genQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *genQueue) Push(x any) { *q = append(*q, x.(*genInstrument)) }
+
+func (q *genQueue) Pop() any {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return x
+}
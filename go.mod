@@ -1,3 +1,60 @@
 module github.com/mal-as/tinkoff_candles
 
-go 1.20
+go 1.22
+
+require github.com/gorilla/websocket v1.5.3
+
+require github.com/klauspost/compress v1.18.0
+
+require github.com/mattn/go-sqlite3 v1.14.22
+
+require github.com/twmb/franz-go/pkg/kmsg v1.8.0
+
+require github.com/redis/go-redis/v9 v9.7.3
+
+require github.com/nats-io/nats.go v1.37.0
+
+require github.com/lib/pq v1.10.9
+
+require golang.org/x/term v0.21.0
+
+require golang.org/x/image v0.18.0
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/BurntSushi/toml v1.5.0
+
+require github.com/fsnotify/fsnotify v1.7.0
+
+require google.golang.org/grpc v1.64.0
+
+require google.golang.org/protobuf v1.34.2
+
+require go.opentelemetry.io/otel v1.28.0
+
+require go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.28.0
+
+require go.opentelemetry.io/otel/sdk v1.28.0
+
+require go.opentelemetry.io/otel/trace v1.28.0
+
+require (
+	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.20.0 // indirect
+	github.com/nats-io/nkeys v0.4.7 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.28.0 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	go.opentelemetry.io/proto/otlp v1.3.1 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240701130421-f6361c86f094 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240701130421-f6361c86f094 // indirect
+)
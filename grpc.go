@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+func runServeGRPC(args []string) {
+	fs := flag.NewFlagSet("serve-grpc", flag.ExitOnError)
+	addr := fs.String("addr", ":9090", "gRPC listen address")
+	intervalsFlag := fs.String("intervals", "1m", "default comma separated candle intervals of calls setting none, e.g. 1m,5m,15m,1h,1d,1w,1mo")
+	tz := fs.String("tz", "UTC", "default time zone of candle boundaries")
+	lateTolerance := fs.Duration("late-tolerance", 0, "default time Stream calls wait for out of order ticks before closing a candle")
+	maxTicks := fs.Int("max-ticks", 10_000_000, "most ticks an Aggregate call may send")
+	maxMessage := fs.Int("max-message", 16<<20, "largest message in bytes a client may send")
+	parseFlags(fs, args)
+
+	intervals, err := candles.ParseIntervals(*intervalsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx := signalContext()
+
+	srv := &grpcServer{
+		ctx:           ctx,
+		intervals:     intervals,
+		loc:           loc,
+		lateTolerance: *lateTolerance,
+		maxTicks:      *maxTicks,
+	}
+
+	gs := grpc.NewServer(grpc.ForceServerCodec(grpcCodec{}), grpc.MaxRecvMsgSize(*maxMessage))
+	gs.RegisterService(&aggregatorService, srv)
+
+	go func() {
+		<-ctx.Done()
+
+		// Stream calls flush their open candles and return once ctx is
+		// done; Aggregate calls get shutdownTimeout to finish.
+		timer := time.AfterFunc(shutdownTimeout, gs.Stop)
+		defer timer.Stop()
+
+		gs.GracefulStop()
+	}()
+
+	slog.Info("serve-grpc: listening", "addr", ln.Addr().String())
+
+	if err := gs.Serve(ln); err != nil {
+		fatal(err)
+	}
+}
+
+// aggregatorService is the Aggregator service of aggregator.proto. Its
+// messages are encoded by grpcCodec rather than generated code.
+var aggregatorService = grpc.ServiceDesc{
+	ServiceName: "tinkoff_candles.Aggregator",
+	HandlerType: (*aggregatorServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Stream",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				return srv.(aggregatorServer).stream(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName: "Aggregate",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				return srv.(aggregatorServer).aggregate(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pkg/candles/aggregator.proto",
+}
+
+type aggregatorServer interface {
+	stream(grpc.ServerStream) error
+	aggregate(grpc.ServerStream) error
+}
+
+// grpcServer builds the candles of the ticks of gRPC calls, each call with
+// an aggregator of its own.
+type grpcServer struct {
+	// ctx is done when the server shuts down.
+	ctx           context.Context
+	intervals     []candles.Interval
+	loc           *time.Location
+	lateTolerance time.Duration
+	maxTicks      int
+}
+
+// callOptions are the Options message of a call.
+type callOptions struct {
+	intervals     []string
+	timezone      string
+	lateTolerance string
+	clock         bool
+}
+
+// tickBatch is the TickBatch message.
+type tickBatch struct {
+	options *callOptions
+	ticks   []candles.Tick
+}
+
+// aggregation is the configuration of a call.
+type aggregation struct {
+	intervals []candles.Interval
+	clock     bool
+	opts      []candles.Option
+}
+
+// configure returns the configuration of a call with the options of its
+// first batch.
+func (s *grpcServer) configure(o *callOptions) (aggregation, error) {
+	if o == nil {
+		o = &callOptions{}
+	}
+
+	a := aggregation{intervals: s.intervals, clock: o.clock}
+	loc := s.loc
+	lateTolerance := s.lateTolerance
+
+	var err error
+
+	if len(o.intervals) > 0 {
+		if a.intervals, err = candles.ParseIntervals(strings.Join(o.intervals, ",")); err != nil {
+			return a, err
+		}
+	}
+
+	if o.timezone != "" {
+		if loc, err = time.LoadLocation(o.timezone); err != nil {
+			return a, err
+		}
+	}
+
+	if o.lateTolerance != "" {
+		if lateTolerance, err = time.ParseDuration(o.lateTolerance); err != nil {
+			return a, fmt.Errorf("bad late_tolerance: %w", err)
+		}
+	}
+
+	a.opts = []candles.Option{
+		candles.WithIntervals(a.intervals...),
+		candles.WithTimezone(loc),
+		candles.WithLateTolerance(lateTolerance),
+	}
+
+	return a, nil
+}
+
+// first receives the first batch of a call and the configuration of its
+// options. A call closed before sending any returns io.EOF.
+func (s *grpcServer) first(stream grpc.ServerStream) (tickBatch, aggregation, error) {
+	var batch tickBatch
+
+	if err := stream.RecvMsg(&batch); err != nil {
+		return batch, aggregation{}, err
+	}
+
+	a, err := s.configure(batch.options)
+	if err != nil {
+		return batch, a, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return batch, a, nil
+}
+
+// stream serves a Stream call: closed candles are sent as ticks arrive and
+// the open ones once the client is done or the server shuts down.
+func (s *grpcServer) stream(stream grpc.ServerStream) error {
+	batch, a, err := s.first(stream)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	agg := candles.NewAggregator(a.opts...)
+
+	batches := make(chan tickBatch)
+	done := make(chan error, 1)
+
+	go func() {
+		for {
+			var batch tickBatch
+
+			if err := stream.RecvMsg(&batch); err != nil {
+				done <- err
+				return
+			}
+
+			select {
+			case batches <- batch:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	var clock <-chan time.Time
+
+	if a.clock {
+		ticker := time.NewTicker(clockPeriod(a.intervals))
+		defer ticker.Stop()
+
+		clock = ticker.C
+	}
+
+	for {
+		for _, tick := range batch.ticks {
+			if err := sendCandles(stream, agg.AddTick(tick)); err != nil {
+				return err
+			}
+		}
+
+		batch = tickBatch{}
+
+		select {
+		case batch = <-batches:
+		case now := <-clock:
+			if err := sendCandles(stream, agg.Advance(now)); err != nil {
+				return err
+			}
+		case err := <-done:
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+
+			return sendCandles(stream, agg.Flush())
+		case <-s.ctx.Done():
+			return sendCandles(stream, agg.Flush())
+		}
+	}
+}
+
+// aggregate serves an Aggregate call: the candles of all the ticks are
+// sent once the client is done.
+func (s *grpcServer) aggregate(stream grpc.ServerStream) error {
+	batch, a, err := s.first(stream)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ticks := batch.ticks
+	if len(ticks) > s.maxTicks {
+		return s.tooManyTicks()
+	}
+
+	for {
+		batch = tickBatch{}
+
+		err := stream.RecvMsg(&batch)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		ticks = append(ticks, batch.ticks...)
+		if len(ticks) > s.maxTicks {
+			return s.tooManyTicks()
+		}
+	}
+
+	slog.Debug("serve-grpc: aggregating", "ticks", len(ticks))
+
+	return sendCandles(stream, candles.Aggregate(ticks, a.opts...))
+}
+
+func (s *grpcServer) tooManyTicks() error {
+	return status.Errorf(codes.ResourceExhausted, "more than %d ticks", s.maxTicks)
+}
+
+func sendCandles(stream grpc.ServerStream, result []candles.Candle) error {
+	for i := range result {
+		if err := stream.SendMsg(&result[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// grpcCodec encodes the messages of aggregator.proto: candles sent and tick
+// batches received.
+type grpcCodec struct{}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+func (grpcCodec) Marshal(v any) ([]byte, error) {
+	c, ok := v.(*candles.Candle)
+	if !ok {
+		return nil, fmt.Errorf("grpc: can't marshal %T", v)
+	}
+
+	return c.AppendProto(nil), nil
+}
+
+func (grpcCodec) Unmarshal(data []byte, v any) error {
+	batch, ok := v.(*tickBatch)
+	if !ok {
+		return fmt.Errorf("grpc: can't unmarshal %T", v)
+	}
+
+	return walkMessage(data, func(num protowire.Number, data []byte) error {
+		switch num {
+		case 1:
+			o, err := parseCallOptions(data)
+			if err != nil {
+				return err
+			}
+
+			batch.options = o
+		case 2:
+			var tick candles.Tick
+
+			if err := tick.UnmarshalProto(data); err != nil {
+				return fmt.Errorf("tick %d: %w", len(batch.ticks)+1, err)
+			}
+
+			batch.ticks = append(batch.ticks, tick)
+		}
+
+		return nil
+	})
+}
+
+// parseCallOptions decodes the Options message.
+func parseCallOptions(data []byte) (*callOptions, error) {
+	o := &callOptions{}
+
+	err := walkMessage(data, func(num protowire.Number, data []byte) error {
+		switch num {
+		case 1:
+			o.intervals = append(o.intervals, string(data))
+		case 2:
+			o.timezone = string(data)
+		case 3:
+			o.lateTolerance = string(data)
+		case 4:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			o.clock = v != 0
+		}
+
+		return nil
+	})
+
+	return o, err
+}
+
+// walkMessage calls fn for every field of a message with the data of
+// length delimited fields or the raw varint of others.
+func walkMessage(b []byte, fn func(num protowire.Number, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		b = b[n:]
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data := b[:n]
+		if typ == protowire.BytesType {
+			data, _ = protowire.ConsumeBytes(data)
+		}
+
+		if err := fn(num, data); err != nil {
+			return err
+		}
+
+		b = b[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpRetries is how many times a failed request of an input URL is
+// retried.
+const httpRetries = 5
+
+// isURL reports whether an input is an HTTP or HTTPS URL.
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://")
+}
+
+// httpReader streams the body of an input URL. Requests failing with
+// network errors or transient statuses are retried with backoff, and a
+// body cut off midway is requested again from where it stopped if the
+// server accepts ranges.
+type httpReader struct {
+	ctx    context.Context
+	url    string
+	body   io.ReadCloser
+	offset int64
+	// ranges means the server accepts range requests.
+	ranges bool
+	// encoding is the content encoding of the first response; resumed
+	// ranges are of the encoded bytes.
+	encoding string
+}
+
+// openURL returns a reader of the content of the URL, decoding gzip
+// content encoding, and its size, negative if unknown.
+func openURL(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	r := &httpReader{ctx: ctx, url: url}
+
+	resp, err := r.get()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r.body = resp.Body
+	r.ranges = resp.Header.Get("Accept-Ranges") == "bytes"
+	r.encoding = resp.Header.Get("Content-Encoding")
+
+	if r.encoding != "gzip" {
+		return r, resp.ContentLength, nil
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		r.Close()
+		return nil, 0, fmt.Errorf("%s: %w", url, err)
+	}
+
+	return &gzipBody{Reader: zr, body: r}, resp.ContentLength, nil
+}
+
+// get requests the content from the offset on, retrying transient
+// failures.
+func (r *httpReader) get() (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := r.request()
+		if err == nil {
+			return resp, nil
+		}
+
+		var status *httpStatusError
+		if errors.As(err, &status) && !status.transient() || attempt >= httpRetries || r.ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := time.Duration(1<<attempt) * 500 * time.Millisecond
+		if status != nil && status.retryAfter > 0 {
+			delay = status.retryAfter
+		}
+
+		slog.Warn("input url: retrying", "url", r.url, "err", err, "delay", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-r.ctx.Done():
+			return nil, r.ctx.Err()
+		}
+	}
+}
+
+func (r *httpReader) request() (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Asking for gzip ourselves keeps the transport from decoding it, so
+	// that offsets count the bytes received.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	want := http.StatusOK
+	if r.offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+		want = http.StatusPartialContent
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != want {
+		resp.Body.Close()
+
+		status := &httpStatusError{url: r.url, status: resp.Status, code: resp.StatusCode}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			status.retryAfter = time.Duration(seconds) * time.Second
+		}
+
+		return nil, status
+	}
+
+	if r.offset > 0 && resp.Header.Get("Content-Encoding") != r.encoding {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: content encoding changed on resuming", r.url)
+	}
+
+	return resp, nil
+}
+
+func (r *httpReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+
+	if err == nil || err == io.EOF || !r.ranges || r.ctx.Err() != nil {
+		return n, err
+	}
+
+	slog.Warn("input url: resuming", "url", r.url, "offset", r.offset, "err", err)
+	r.body.Close()
+
+	resp, getErr := r.get()
+	if getErr != nil {
+		r.body = io.NopCloser(strings.NewReader(""))
+		return n, fmt.Errorf("%s: %w", r.url, err)
+	}
+
+	r.body = resp.Body
+
+	return n, nil
+}
+
+func (r *httpReader) Close() error {
+	return r.body.Close()
+}
+
+// gzipBody decodes a gzip encoded body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// httpStatusError is an unexpected response status of an input URL.
+type httpStatusError struct {
+	url        string
+	status     string
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return e.url + ": " + e.status
+}
+
+// transient reports whether the request may succeed if retried.
+func (e *httpStatusError) transient() bool {
+	return e.code == http.StatusTooManyRequests || e.code == http.StatusRequestTimeout || e.code >= 500
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mal-as/tinkoff_candles/internal/objstore"
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// inputOptions are how openInputs reads its inputs.
+type inputOptions struct {
+	format string
+	csv    candles.CSVOptions
+	// mmap maps uncompressed CSV files into memory and parses them in
+	// place.
+	mmap bool
+	// progress, if set, counts the input read.
+	progress *progress
+	// trace, if set, times the reading and parsing of ticks.
+	trace *pipelineTrace
+}
+
+// openInputs opens the files matched by the given paths and glob patterns
+// and returns a reader merging their ticks in time order. Directories stand
+// for the files they contain, "-" and an empty list for stdin, see
+// expandObjects for s3:// and gs:// objects; HTTP and HTTPS URLs are read
+// as they are. Gzip and zstd compressed
+// inputs are decompressed transparently.
+func openInputs(args []string, in inputOptions) (tickReader, func() error, error) {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	names, err := expandInputs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		closers []io.Closer
+		readers []tickReader
+	)
+
+	closeFiles := func() error {
+		var result error
+
+		for i := len(closers) - 1; i >= 0; i-- {
+			if err := closers[i].Close(); err != nil && result == nil {
+				result = err
+			}
+		}
+
+		return result
+	}
+
+	for _, name := range names {
+		if in.mmap && in.format == "csv" && name != "-" && !isRemote(name) {
+			mr, err := openMmap(name, in.csv)
+			if err != nil {
+				closeFiles()
+				return nil, nil, err
+			}
+
+			if mr != nil {
+				closers = append(closers, mr)
+
+				var r tickReader = mr
+				if in.progress != nil {
+					in.progress.addTotal(mr.Size())
+					r = &mmapProgressReader{r: mr, p: in.progress}
+				}
+
+				readers = append(readers, nameReader(r, name, len(names)))
+
+				continue
+			}
+		}
+
+		var r io.Reader
+
+		if isRemote(name) {
+			body, size, err := openRemote(name)
+			if err != nil {
+				closeFiles()
+				return nil, nil, err
+			}
+
+			closers = append(closers, body)
+			r = body
+
+			if in.progress != nil {
+				if size < 0 {
+					// Unknown, as of stdin.
+					size = -1 << 62
+				}
+
+				in.progress.addTotal(size)
+				r = &progressReader{r: body, p: in.progress}
+			}
+		} else {
+			var f *os.File
+
+			if name == "-" {
+				f = os.Stdin
+			} else if f, err = os.Open(name); err != nil {
+				closeFiles()
+				return nil, nil, err
+			} else {
+				closers = append(closers, f)
+			}
+
+			r = f
+
+			if in.progress != nil {
+				if r, err = in.progress.wrap(f); err != nil {
+					closeFiles()
+					return nil, nil, err
+				}
+			}
+		}
+
+		dr, err := decompress(r)
+		if err != nil {
+			closeFiles()
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		closers = append(closers, dr)
+
+		tr, err := newTickReader(in.format, in.trace.input(dr), in.csv)
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+
+		readers = append(readers, nameReader(tr, name, len(names)))
+	}
+
+	if len(readers) == 1 {
+		return readers[0], closeFiles, nil
+	}
+
+	return newMergeReader(readers), closeFiles, nil
+}
+
+// isRemote reports whether an input is read over the network: a URL or an
+// object.
+func isRemote(name string) bool {
+	return isURL(name) || objstore.IsURI(name)
+}
+
+// openRemote returns a reader of a URL or an object and its size, negative
+// if unknown.
+func openRemote(name string) (io.ReadCloser, int64, error) {
+	if isURL(name) {
+		return openURL(context.Background(), name)
+	}
+
+	return objstore.Open(context.Background(), name)
+}
+
+// nameReader adds the file name to the errors of r if it is one of several
+// inputs.
+func nameReader(r tickReader, name string, inputs int) tickReader {
+	if inputs > 1 {
+		return &namedTickReader{name: name, r: r}
+	}
+
+	return r
+}
+
+// openMmap maps the named CSV file into memory, or returns nil if it is
+// compressed and has to be read as a stream.
+func openMmap(name string, opts candles.CSVOptions) (*candles.MmapReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(f, magic)
+	f.Close()
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	if magic = magic[:n]; bytes.HasPrefix(magic, gzipMagic) || bytes.HasPrefix(magic, zstdMagic) {
+		return nil, nil
+	}
+
+	return candles.OpenMmapReader(name, opts)
+}
+
+func expandInputs(args []string) ([]string, error) {
+	var result []string
+
+	for _, arg := range args {
+		if arg == "-" {
+			result = append(result, arg)
+			continue
+		}
+
+		if isURL(arg) {
+			result = append(result, arg)
+			continue
+		}
+
+		if objstore.IsURI(arg) {
+			objects, err := expandObjects(arg)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, objects...)
+
+			continue
+		}
+
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matches) == 0 {
+			// Let os.Open report a missing file.
+			matches = []string{arg}
+		}
+
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			entries, err := os.ReadDir(match)
+			if err != nil {
+				result = append(result, match)
+				continue
+			}
+
+			for _, entry := range entries {
+				if entry.Type().IsRegular() {
+					result = append(result, filepath.Join(match, entry.Name()))
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// namedTickReader adds the input name to parse errors.
+type namedTickReader struct {
+	name string
+	r    tickReader
+}
+
+func (r *namedTickReader) Read() (candles.Tick, error) {
+	tick, err := r.r.Read()
+
+	var parseErr *candles.ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.File = r.name
+	}
+
+	return tick, err
+}
+
+// mergeReader merges the ticks of readers sorted by time. Ticks with equal
+// times come in the order of the readers.
+type mergeReader struct {
+	readers []tickReader
+	// pending are the indexes of the readers whose next tick is to be
+	// read into heads.
+	pending []int
+	heads   tickHeap
+}
+
+func newMergeReader(readers []tickReader) *mergeReader {
+	pending := make([]int, len(readers))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	return &mergeReader{readers: readers, pending: pending}
+}
+
+func (m *mergeReader) Read() (candles.Tick, error) {
+	for len(m.pending) > 0 {
+		i := m.pending[len(m.pending)-1]
+
+		tick, err := m.readers[i].Read()
+		if err == io.EOF {
+			m.pending = m.pending[:len(m.pending)-1]
+			continue
+		}
+
+		if err != nil {
+			// The reader stays pending, so the next call carries on with it.
+			return candles.Tick{}, err
+		}
+
+		m.pending = m.pending[:len(m.pending)-1]
+		heap.Push(&m.heads, tickHead{tick: tick, reader: i})
+	}
+
+	if len(m.heads) == 0 {
+		return candles.Tick{}, io.EOF
+	}
+
+	head := heap.Pop(&m.heads).(tickHead)
+	m.pending = append(m.pending, head.reader)
+
+	return head.tick, nil
+}
+
+type tickHead struct {
+	tick   candles.Tick
+	reader int
+}
+
+type tickHeap []tickHead
+
+func (h tickHeap) Len() int { return len(h) }
+
+func (h tickHeap) Less(i, j int) bool {
+	if h[i].tick.Before(h[j].tick) || h[j].tick.Before(h[i].tick) {
+		return h[i].tick.Before(h[j].tick)
+	}
+
+	return h[i].reader < h[j].reader
+}
+
+func (h tickHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *tickHeap) Push(x any) { *h = append(*h, x.(tickHead)) }
+
+func (h *tickHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return x
+}
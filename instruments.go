@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/tinkoff"
+)
+
+// instrumentLabels are the label columns -enrich adds to the candles.
+var instrumentLabels = []string{"ticker", "lot", "currency"}
+
+func runInstruments(args []string) {
+	fs := flag.NewFlagSet("instruments", flag.ExitOnError)
+	token := fs.String("token", os.Getenv("INVEST_TOKEN"), "Tinkoff Invest API token (default $INVEST_TOKEN)")
+	cache := fs.String("instruments-cache", defaultInstrumentsCache(), "file caching looked up instruments, empty to disable")
+	parseFlags(fs, args)
+
+	if *token == "" {
+		usagef("instruments: api token is required")
+	}
+
+	if fs.NArg() == 0 {
+		usagef("instruments: at least one ticker or FIGI is required")
+	}
+
+	insts, err := resolveInstruments(signalContext(), newTinkoffClient(*token), *cache, fs.Args())
+	if err != nil {
+		fatal(err)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"figi", "ticker", "class_code", "name", "lot", "currency"})
+
+	for _, inst := range insts {
+		w.Write([]string{inst.FIGI, inst.Ticker, inst.ClassCode, inst.Name, strconv.Itoa(inst.Lot), inst.Currency})
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		fatal(err)
+	}
+}
+
+// defaultInstrumentsCache returns the instruments cache file in the user
+// cache directory, or no file if there is none.
+func defaultInstrumentsCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "tinkoff_candles", "instruments.json")
+}
+
+// resolveInstruments looks up instruments by tickers or FIGIs, each
+// argument may be a comma separated list of them, through the cache file.
+func resolveInstruments(ctx context.Context, client *tinkoff.Client, cache string, refs []string) ([]tinkoff.Instrument, error) {
+	r, err := tinkoff.NewResolver(client, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []tinkoff.Instrument
+
+	for _, arg := range refs {
+		for _, ref := range strings.Split(arg, ",") {
+			inst, err := r.Resolve(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, inst)
+		}
+	}
+
+	return result, r.Save()
+}
+
+// labelWriter sets the labels of the instruments on the candles, by FIGI.
+type labelWriter struct {
+	candleWriter
+	labels map[string]map[string]string
+}
+
+func newLabelWriter(w candleWriter, insts []tinkoff.Instrument) *labelWriter {
+	labels := make(map[string]map[string]string)
+
+	for _, inst := range insts {
+		labels[inst.FIGI] = map[string]string{
+			"ticker":   inst.Ticker,
+			"lot":      strconv.Itoa(inst.Lot),
+			"currency": inst.Currency,
+		}
+	}
+
+	return &labelWriter{candleWriter: w, labels: labels}
+}
+
+func (w *labelWriter) Write(c candles.Candle) error {
+	c.Labels = w.labels[c.ID]
+	return w.candleWriter.Write(c)
+}
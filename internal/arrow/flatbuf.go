@@ -0,0 +1,188 @@
+package arrow
+
+import "encoding/binary"
+
+// builder builds a FlatBuffer back to front, the way the format expects:
+// strings, vectors and tables are written before the tables referring to
+// them, and offsets are counted from the end of the buffer.
+type builder struct {
+	buf      []byte
+	head     int
+	minAlign int
+
+	// fields holds the positions of the fields of the open table, 0 for
+	// absent ones, and start its position before them.
+	fields []int
+	start  int
+}
+
+// used returns the number of bytes written, which is also the position of
+// the last written object counted from the end.
+func (b *builder) used() int {
+	return len(b.buf) - b.head
+}
+
+func (b *builder) grow(n int) {
+	if b.head >= n {
+		return
+	}
+
+	used := b.used()
+	buf := make([]byte, 2*len(b.buf)+n)
+
+	copy(buf[len(buf)-used:], b.buf[b.head:])
+	b.buf, b.head = buf, len(buf)-used
+}
+
+// prep pads the buffer so that a value of size is aligned after additional
+// bytes are written.
+func (b *builder) prep(size, additional int) {
+	b.minAlign = max(b.minAlign, size)
+
+	pad := -(b.used() + additional) & (size - 1)
+	b.grow(pad + additional + size)
+
+	for range pad {
+		b.head--
+		b.buf[b.head] = 0
+	}
+}
+
+func (b *builder) place8(v uint8) {
+	b.head--
+	b.buf[b.head] = v
+}
+
+func (b *builder) place16(v uint16) {
+	b.head -= 2
+	binary.LittleEndian.PutUint16(b.buf[b.head:], v)
+}
+
+func (b *builder) place32(v uint32) {
+	b.head -= 4
+	binary.LittleEndian.PutUint32(b.buf[b.head:], v)
+}
+
+func (b *builder) place64(v uint64) {
+	b.head -= 8
+	binary.LittleEndian.PutUint64(b.buf[b.head:], v)
+}
+
+// placeOffset writes a reference to the object at off.
+func (b *builder) placeOffset(off int) {
+	b.prep(4, 0)
+	b.place32(uint32(b.used() + 4 - off))
+}
+
+func (b *builder) createString(s string) int {
+	b.prep(4, len(s)+1)
+	b.place8(0)
+
+	b.head -= len(s)
+	copy(b.buf[b.head:], s)
+
+	b.place32(uint32(len(s)))
+
+	return b.used()
+}
+
+// startVector prepares for n elements of size, which are then placed in
+// reverse order before endVector.
+func (b *builder) startVector(size, n, align int) {
+	b.prep(4, size*n)
+	b.prep(align, size*n)
+}
+
+func (b *builder) endVector(n int) int {
+	b.place32(uint32(n))
+	return b.used()
+}
+
+func (b *builder) createOffsets(offs []int) int {
+	b.startVector(4, len(offs), 4)
+
+	for i := len(offs) - 1; i >= 0; i-- {
+		b.placeOffset(offs[i])
+	}
+
+	return b.endVector(len(offs))
+}
+
+func (b *builder) startTable(fields int) {
+	b.fields = make([]int, fields)
+	b.start = b.used()
+}
+
+func (b *builder) addBool(field int, v bool) {
+	var x uint8
+	if v {
+		x = 1
+	}
+
+	b.prep(1, 0)
+	b.place8(x)
+	b.fields[field] = b.used()
+}
+
+func (b *builder) addUint8(field int, v uint8) {
+	b.prep(1, 0)
+	b.place8(v)
+	b.fields[field] = b.used()
+}
+
+func (b *builder) addInt16(field int, v int16) {
+	b.prep(2, 0)
+	b.place16(uint16(v))
+	b.fields[field] = b.used()
+}
+
+func (b *builder) addInt32(field int, v int32) {
+	b.prep(4, 0)
+	b.place32(uint32(v))
+	b.fields[field] = b.used()
+}
+
+func (b *builder) addInt64(field int, v int64) {
+	b.prep(8, 0)
+	b.place64(uint64(v))
+	b.fields[field] = b.used()
+}
+
+func (b *builder) addOffset(field, off int) {
+	b.placeOffset(off)
+	b.fields[field] = b.used()
+}
+
+// endTable writes the vtable of the open table right before it.
+func (b *builder) endTable() int {
+	b.prep(4, 0)
+	b.place32(0)
+
+	end := b.used()
+	b.grow(4 + 2*len(b.fields))
+
+	for i := len(b.fields) - 1; i >= 0; i-- {
+		var off uint16
+		if b.fields[i] != 0 {
+			off = uint16(end - b.fields[i])
+		}
+
+		b.place16(off)
+	}
+
+	b.place16(uint16(end - b.start))
+	b.place16(uint16(4 + 2*len(b.fields)))
+
+	binary.LittleEndian.PutUint32(b.buf[len(b.buf)-end:], uint32(b.used()-end))
+	b.fields = nil
+
+	return end
+}
+
+// finish writes the reference to the root table and returns the buffer.
+func (b *builder) finish(root int) []byte {
+	b.prep(b.minAlign, 4)
+	b.placeOffset(root)
+
+	return b.buf[b.head:]
+}
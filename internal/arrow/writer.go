@@ -0,0 +1,409 @@
+// Package arrow is a minimal writer of files in the Arrow IPC file format,
+// also known as Feather v2, with flat schemas of primitive columns. Record
+// batches are uncompressed and can be memory mapped by Arrow readers.
+package arrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Type is a column type.
+type Type int
+
+// Column types. Timestamps are nanoseconds since the Unix epoch and
+// durations are nanoseconds.
+const (
+	Utf8 Type = iota
+	Float64
+	Int64
+	Timestamp
+	Duration
+)
+
+// Field describes a column of the schema.
+type Field struct {
+	Name     string
+	Type     Type
+	Nullable bool
+	// Timezone is the time zone of a Timestamp column, empty for naive
+	// timestamps.
+	Timezone string
+}
+
+const (
+	metadataV5 = 4
+
+	headerSchema      = 1
+	headerRecordBatch = 3
+
+	typeInt           = 2
+	typeFloatingPoint = 3
+	typeUtf8          = 5
+	typeTimestamp     = 10
+	typeDuration      = 18
+
+	precisionDouble = 2
+	unitNanosecond  = 3
+)
+
+var magic = []byte("ARROW1")
+
+// column buffers the values of a column for the next record batch.
+type column struct {
+	validity []byte
+	nulls    int64
+	// offsets are the end offsets of the strings in data.
+	offsets []int32
+	data    bytes.Buffer
+}
+
+// block locates a record batch in the file.
+type block struct {
+	offset int64
+	meta   int32
+	body   int64
+}
+
+// Writer writes rows into an Arrow file. Values are appended column by
+// column with the Write methods and every row is finished with EndRow.
+type Writer struct {
+	w       io.Writer
+	fields  []Field
+	cols    []column
+	rows    int64
+	offset  int64
+	batches []block
+	err     error
+}
+
+// NewWriter writes the file header and schema to w and returns a writer of
+// the schema.
+func NewWriter(w io.Writer, fields []Field) (*Writer, error) {
+	aw := &Writer{w: w, fields: fields, cols: make([]column, len(fields))}
+
+	if err := aw.write(magic, []byte{0, 0}); err != nil {
+		return nil, err
+	}
+
+	var b builder
+
+	schema := aw.schema(&b)
+
+	if _, err := aw.message(&b, headerSchema, schema, nil); err != nil {
+		return nil, err
+	}
+
+	return aw, nil
+}
+
+// WriteString appends a value to a Utf8 column.
+func (w *Writer) WriteString(col int, s string) {
+	c := &w.cols[col]
+
+	c.data.WriteString(s)
+	c.offsets = append(c.offsets, int32(c.data.Len()))
+	w.valid(col, true)
+}
+
+// WriteDouble appends a value to a Float64 column.
+func (w *Writer) WriteDouble(col int, v float64) {
+	w.WriteInt64(col, int64(math.Float64bits(v)))
+}
+
+// WriteInt64 appends a value to an Int64, Timestamp or Duration column.
+func (w *Writer) WriteInt64(col int, v int64) {
+	var b [8]byte
+
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	w.cols[col].data.Write(b[:])
+	w.valid(col, true)
+}
+
+// WriteNull appends a null to a nullable column.
+func (w *Writer) WriteNull(col int) {
+	c := &w.cols[col]
+
+	if w.fields[col].Type == Utf8 {
+		c.offsets = append(c.offsets, int32(c.data.Len()))
+	} else {
+		c.data.Write(make([]byte, 8))
+	}
+
+	c.nulls++
+	w.valid(col, false)
+}
+
+// valid records in the validity bitmap of a nullable column whether the
+// value of the current row is set.
+func (w *Writer) valid(col int, ok bool) {
+	if !w.fields[col].Nullable {
+		return
+	}
+
+	c := &w.cols[col]
+
+	if w.rows%8 == 0 {
+		c.validity = append(c.validity, 0)
+	}
+
+	if ok {
+		c.validity[w.rows/8] |= 1 << (w.rows % 8)
+	}
+}
+
+// EndRow finishes the current row.
+func (w *Writer) EndRow() {
+	w.rows++
+}
+
+// Rows returns the number of rows buffered for the current record batch.
+func (w *Writer) Rows() int64 {
+	return w.rows
+}
+
+// Flush writes the buffered rows as a record batch.
+func (w *Writer) Flush() error {
+	if w.err != nil || w.rows == 0 {
+		return w.err
+	}
+
+	var body [][]byte
+
+	type buffer struct{ offset, length int64 }
+
+	var (
+		buffers []buffer
+		size    int64
+	)
+
+	add := func(data []byte) {
+		buffers = append(buffers, buffer{size, int64(len(data))})
+		body = append(body, data)
+		size += int64(len(data))
+
+		if pad := -len(data) & 7; pad > 0 {
+			body = append(body, make([]byte, pad))
+			size += int64(pad)
+		}
+	}
+
+	for i := range w.cols {
+		c := &w.cols[i]
+
+		if c.nulls > 0 {
+			add(c.validity)
+		} else {
+			add(nil)
+		}
+
+		if w.fields[i].Type == Utf8 {
+			offsets := make([]byte, 4*(len(c.offsets)+1))
+			for j, off := range c.offsets {
+				binary.LittleEndian.PutUint32(offsets[4*(j+1):], uint32(off))
+			}
+
+			add(offsets)
+		}
+
+		add(c.data.Bytes())
+	}
+
+	var b builder
+
+	b.startVector(16, len(buffers), 8)
+
+	for i := len(buffers) - 1; i >= 0; i-- {
+		b.place64(uint64(buffers[i].length))
+		b.place64(uint64(buffers[i].offset))
+	}
+
+	buffersVec := b.endVector(len(buffers))
+
+	b.startVector(16, len(w.cols), 8)
+
+	for i := len(w.cols) - 1; i >= 0; i-- {
+		b.place64(uint64(w.cols[i].nulls))
+		b.place64(uint64(w.rows))
+	}
+
+	nodes := b.endVector(len(w.cols))
+
+	b.startTable(3)
+	b.addInt64(0, w.rows)
+	b.addOffset(1, nodes)
+	b.addOffset(2, buffersVec)
+
+	batch := b.endTable()
+
+	blk, err := w.message(&b, headerRecordBatch, batch, body)
+	if err != nil {
+		w.err = err
+		return err
+	}
+
+	w.batches = append(w.batches, blk)
+	w.rows = 0
+
+	for i := range w.cols {
+		c := &w.cols[i]
+		c.validity, c.nulls, c.offsets = c.validity[:0], 0, c.offsets[:0]
+		c.data.Reset()
+	}
+
+	return nil
+}
+
+// Close flushes the buffered rows and writes the file footer. It doesn't
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// The end of stream marker, after which file readers find the footer.
+	if err := w.write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	var b builder
+
+	b.startVector(24, len(w.batches), 8)
+
+	for i := len(w.batches) - 1; i >= 0; i-- {
+		blk := w.batches[i]
+
+		b.place64(uint64(blk.body))
+		b.place32(0)
+		b.place32(uint32(blk.meta))
+		b.place64(uint64(blk.offset))
+	}
+
+	batches := b.endVector(len(w.batches))
+
+	b.startVector(24, 0, 8)
+	dictionaries := b.endVector(0)
+
+	schema := w.schema(&b)
+
+	b.startTable(4)
+	b.addOffset(1, schema)
+	b.addOffset(2, dictionaries)
+	b.addOffset(3, batches)
+	b.addInt16(0, metadataV5)
+
+	footer := b.finish(b.endTable())
+
+	var length [4]byte
+
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+
+	return w.write(footer, length[:], magic)
+}
+
+// schema builds the Schema table.
+func (w *Writer) schema(b *builder) int {
+	fields := make([]int, len(w.fields))
+
+	for i, f := range w.fields {
+		name := b.createString(f.Name)
+
+		var tz int
+		if f.Type == Timestamp && f.Timezone != "" {
+			tz = b.createString(f.Timezone)
+		}
+
+		var typeType uint8
+
+		switch f.Type {
+		case Utf8:
+			typeType = typeUtf8
+			b.startTable(0)
+		case Float64:
+			typeType = typeFloatingPoint
+			b.startTable(1)
+			b.addInt16(0, precisionDouble)
+		case Int64:
+			typeType = typeInt
+			b.startTable(2)
+			b.addInt32(0, 64)
+			b.addBool(1, true)
+		case Timestamp:
+			typeType = typeTimestamp
+			b.startTable(2)
+
+			if tz != 0 {
+				b.addOffset(1, tz)
+			}
+
+			b.addInt16(0, unitNanosecond)
+		case Duration:
+			typeType = typeDuration
+			b.startTable(1)
+			b.addInt16(0, unitNanosecond)
+		}
+
+		typ := b.endTable()
+		children := b.createOffsets(nil)
+
+		b.startTable(6)
+		b.addOffset(0, name)
+		b.addOffset(3, typ)
+		b.addOffset(5, children)
+		b.addBool(1, f.Nullable)
+		b.addUint8(2, typeType)
+
+		fields[i] = b.endTable()
+	}
+
+	vec := b.createOffsets(fields)
+
+	b.startTable(2)
+	b.addOffset(1, vec)
+
+	return b.endTable()
+}
+
+// message writes an encapsulated message with the header table and body,
+// returning where it is in the file.
+func (w *Writer) message(b *builder, headerType uint8, header int, body [][]byte) (block, error) {
+	var size int64
+	for _, data := range body {
+		size += int64(len(data))
+	}
+
+	b.startTable(4)
+	b.addInt64(3, size)
+	b.addOffset(2, header)
+	b.addInt16(0, metadataV5)
+	b.addUint8(1, headerType)
+
+	meta := b.finish(b.endTable())
+	pad := -len(meta) & 7
+
+	var prefix [8]byte
+
+	binary.LittleEndian.PutUint32(prefix[:], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)+pad))
+
+	blk := block{offset: w.offset, meta: int32(len(prefix) + len(meta) + pad), body: size}
+
+	chunks := append([][]byte{prefix[:], meta, make([]byte, pad)}, body...)
+
+	return blk, w.write(chunks...)
+}
+
+func (w *Writer) write(chunks ...[]byte) error {
+	for _, chunk := range chunks {
+		n, err := w.w.Write(chunk)
+		w.offset += int64(n)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
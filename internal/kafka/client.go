@@ -0,0 +1,368 @@
+// Package kafka is a minimal Kafka client: it produces records to and
+// consumes records from the partitions of a single topic, tracking consumer
+// offsets in a group without joining it. Requests are encoded by kmsg and
+// their versions negotiated with every broker.
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// maxVersions caps the negotiated request versions at the last ones that
+// address topics by name.
+var maxVersions = map[int16]int16{
+	0:  9,  // Produce
+	1:  12, // Fetch
+	2:  5,  // ListOffsets
+	3:  9,  // Metadata
+	8:  8,  // OffsetCommit
+	9:  7,  // OffsetFetch
+	10: 3,  // FindCoordinator
+	18: 3,  // ApiVersions
+}
+
+const dialTimeout = 10 * time.Second
+
+// Error is an error code returned by a broker.
+type Error struct {
+	Code int16
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("kafka error code %d", e.Code)
+}
+
+// Retriable reports whether the request may succeed after refreshing the
+// metadata: the partition leader moved or is not elected yet.
+func (e *Error) Retriable() bool {
+	switch e.Code {
+	case 3, 5, 6, 7, 13, 14, 15, 16, 74, 75:
+		return true
+	}
+
+	return false
+}
+
+func errorCode(code int16) error {
+	if code == 0 {
+		return nil
+	}
+
+	return &Error{Code: code}
+}
+
+// Client talks to the brokers of a cluster about a single topic.
+type Client struct {
+	seeds []string
+	topic string
+
+	mu      sync.Mutex
+	brokers map[int32]string
+	conns   map[string]*conn
+	// leaders are the leader brokers of the partitions of the topic.
+	leaders []int32
+}
+
+// NewClient returns a client of the topic bootstrapped from the seed
+// broker addresses and loads the topic metadata.
+func NewClient(ctx context.Context, seeds []string, topic string) (*Client, error) {
+	c := &Client{seeds: seeds, topic: topic, conns: make(map[string]*conn)}
+
+	if err := c.refresh(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Partitions returns the number of partitions of the topic.
+func (c *Client) Partitions() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.leaders)
+}
+
+// Close closes the connections to the brokers.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for addr, cn := range c.conns {
+		cn.close()
+		delete(c.conns, addr)
+	}
+
+	return nil
+}
+
+// refresh loads the brokers and the partition leaders of the topic from the
+// first seed broker that answers.
+func (c *Client) refresh(ctx context.Context) error {
+	var lastErr error
+
+	for _, addr := range c.seeds {
+		req := kmsg.NewPtrMetadataRequest()
+		topic := kmsg.NewMetadataRequestTopic()
+		topic.Topic = kmsg.StringPtr(c.topic)
+		req.Topics = []kmsg.MetadataRequestTopic{topic}
+
+		resp, err := c.request(ctx, addr, req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		meta := resp.(*kmsg.MetadataResponse)
+
+		if len(meta.Topics) != 1 {
+			return fmt.Errorf("no metadata of topic %s", c.topic)
+		}
+
+		if err := errorCode(meta.Topics[0].ErrorCode); err != nil {
+			return fmt.Errorf("topic %s: %w", c.topic, err)
+		}
+
+		brokers := make(map[int32]string)
+
+		for _, b := range meta.Brokers {
+			brokers[b.NodeID] = net.JoinHostPort(b.Host, strconv.Itoa(int(b.Port)))
+		}
+
+		leaders := make([]int32, len(meta.Topics[0].Partitions))
+
+		for _, p := range meta.Topics[0].Partitions {
+			if int(p.Partition) < len(leaders) {
+				leaders[p.Partition] = p.Leader
+			}
+		}
+
+		c.mu.Lock()
+		c.brokers, c.leaders = brokers, leaders
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	return fmt.Errorf("no seed broker answered: %w", lastErr)
+}
+
+// leader returns the address of the leader of the partition.
+func (c *Client) leader(partition int32) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int(partition) >= len(c.leaders) {
+		return "", fmt.Errorf("topic %s has no partition %d", c.topic, partition)
+	}
+
+	addr, ok := c.brokers[c.leaders[partition]]
+	if !ok {
+		return "", fmt.Errorf("partition %d of topic %s has no leader", partition, c.topic)
+	}
+
+	return addr, nil
+}
+
+// request sends the request to the broker at addr and returns its
+// response. A failed connection is dropped and dialed again next time.
+func (c *Client) request(ctx context.Context, addr string, req kmsg.Request) (kmsg.Response, error) {
+	c.mu.Lock()
+	cn, ok := c.conns[addr]
+	c.mu.Unlock()
+
+	if !ok {
+		var err error
+
+		if cn, err = dial(ctx, addr); err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.conns[addr] = cn
+		c.mu.Unlock()
+	}
+
+	resp, err := cn.request(ctx, req)
+	if err != nil {
+		c.mu.Lock()
+		if c.conns[addr] == cn {
+			delete(c.conns, addr)
+		}
+		c.mu.Unlock()
+
+		cn.close()
+	}
+
+	return resp, err
+}
+
+// conn is a connection to a broker. Requests on it are serialized.
+type conn struct {
+	mu       sync.Mutex
+	c        net.Conn
+	format   *kmsg.RequestFormatter
+	corr     int32
+	versions map[int16][2]int16
+}
+
+func dial(ctx context.Context, addr string) (*conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{c: nc, format: kmsg.NewRequestFormatter(kmsg.FormatterClientID("tinkoff_candles"))}
+
+	// ApiVersions v0 is understood by every broker.
+	req := kmsg.NewPtrApiVersionsRequest()
+	req.SetVersion(0)
+
+	resp, err := cn.roundTrip(ctx, req)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("%s: %w", addr, err)
+	}
+
+	versions := resp.(*kmsg.ApiVersionsResponse)
+	if err := errorCode(versions.ErrorCode); err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("%s: %w", addr, err)
+	}
+
+	cn.versions = make(map[int16][2]int16)
+
+	for _, k := range versions.ApiKeys {
+		cn.versions[k.ApiKey] = [2]int16{k.MinVersion, k.MaxVersion}
+	}
+
+	return cn, nil
+}
+
+// request negotiates the version of the request and sends it.
+func (cn *conn) request(ctx context.Context, req kmsg.Request) (kmsg.Response, error) {
+	v, ok := cn.versions[req.Key()]
+	if !ok {
+		return nil, fmt.Errorf("broker doesn't support request key %d", req.Key())
+	}
+
+	version := min(v[1], req.MaxVersion(), maxVersions[req.Key()])
+	if version < v[0] {
+		return nil, fmt.Errorf("broker requires request key %d version %d or later", req.Key(), v[0])
+	}
+
+	req.SetVersion(version)
+
+	return cn.roundTrip(ctx, req)
+}
+
+func (cn *conn) roundTrip(ctx context.Context, req kmsg.Request) (kmsg.Response, error) {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		cn.c.SetDeadline(deadline)
+	} else {
+		cn.c.SetDeadline(time.Time{})
+	}
+
+	// Unblock the I/O when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		cn.c.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	cn.corr++
+
+	if _, err := cn.c.Write(cn.format.AppendRequest(nil, req, cn.corr)); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	var size [4]byte
+
+	if _, err := io.ReadFull(cn.c, size[:]); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	body := make([]byte, binary.BigEndian.Uint32(size[:]))
+
+	if _, err := io.ReadFull(cn.c, body); err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	if len(body) < 4 || int32(binary.BigEndian.Uint32(body)) != cn.corr {
+		return nil, fmt.Errorf("unexpected response correlation")
+	}
+
+	body = body[4:]
+
+	resp := req.ResponseKind()
+	resp.SetVersion(req.GetVersion())
+
+	// Flexible responses have a tagged fields header, except ApiVersions.
+	if resp.IsFlexible() && resp.Key() != 18 {
+		var err error
+
+		if body, err = skipTags(body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := resp.ReadFrom(body); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (cn *conn) close() {
+	cn.c.Close()
+}
+
+// ctxErr returns the error of ctx if it interrupted the I/O.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// skipTags skips a tagged fields section.
+func skipTags(b []byte) ([]byte, error) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 {
+		return nil, fmt.Errorf("bad tagged fields")
+	}
+
+	b = b[size:]
+
+	for i := uint64(0); i < n; i++ {
+		if _, size = binary.Uvarint(b); size <= 0 {
+			return nil, fmt.Errorf("bad tagged fields")
+		}
+
+		b = b[size:]
+
+		length, size := binary.Uvarint(b)
+		if size <= 0 || uint64(len(b)-size) < length {
+			return nil, fmt.Errorf("bad tagged fields")
+		}
+
+		b = b[size+int(length):]
+	}
+
+	return b, nil
+}
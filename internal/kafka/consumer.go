@@ -0,0 +1,322 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const (
+	fetchMaxWait      = 500 * time.Millisecond
+	fetchMaxBytes     = 50 << 20
+	partitionMaxBytes = 1 << 20
+
+	errOffsetOutOfRange = 1
+)
+
+// Start is where a consumer without committed offsets starts reading.
+type Start int64
+
+// Starts, the special timestamps of ListOffsets.
+const (
+	StartLatest   Start = -1
+	StartEarliest Start = -2
+)
+
+// Consumer reads all partitions of the topic. With a group it resumes from
+// the offsets committed to the group; it doesn't join the group, so there
+// must be only one consumer per group.
+type Consumer struct {
+	c     *Client
+	group string
+	start Start
+	// offsets are the next offsets to fetch by partition.
+	offsets []int64
+}
+
+// NewConsumer returns a consumer of the topic. The group may be empty to
+// always start at start.
+func NewConsumer(ctx context.Context, seeds []string, topic, group string, start Start) (*Consumer, error) {
+	c, err := NewClient(ctx, seeds, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	cons := &Consumer{c: c, group: group, start: start, offsets: make([]int64, c.Partitions())}
+
+	if err := cons.init(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return cons, nil
+}
+
+// init loads the committed offsets and resets the other partitions.
+func (c *Consumer) init(ctx context.Context) error {
+	for i := range c.offsets {
+		c.offsets[i] = -1
+	}
+
+	if c.group != "" {
+		addr, err := c.coordinator(ctx)
+		if err != nil {
+			return err
+		}
+
+		req := kmsg.NewPtrOffsetFetchRequest()
+		req.Group = c.group
+
+		topic := kmsg.NewOffsetFetchRequestTopic()
+		topic.Topic = c.c.topic
+
+		for i := range c.offsets {
+			topic.Partitions = append(topic.Partitions, int32(i))
+		}
+
+		req.Topics = []kmsg.OffsetFetchRequestTopic{topic}
+
+		resp, err := c.c.request(ctx, addr, req)
+		if err != nil {
+			return err
+		}
+
+		fetched := resp.(*kmsg.OffsetFetchResponse)
+		if err := errorCode(fetched.ErrorCode); err != nil {
+			return fmt.Errorf("group %s: %w", c.group, err)
+		}
+
+		for _, topic := range fetched.Topics {
+			for _, part := range topic.Partitions {
+				if err := errorCode(part.ErrorCode); err != nil {
+					return fmt.Errorf("group %s: %w", c.group, err)
+				}
+
+				if int(part.Partition) < len(c.offsets) {
+					c.offsets[part.Partition] = part.Offset
+				}
+			}
+		}
+	}
+
+	for i, offset := range c.offsets {
+		if offset >= 0 {
+			continue
+		}
+
+		if err := c.reset(ctx, int32(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reset moves the partition to the start offset.
+func (c *Consumer) reset(ctx context.Context, partition int32) error {
+	addr, err := c.c.leader(partition)
+	if err != nil {
+		return err
+	}
+
+	req := kmsg.NewPtrListOffsetsRequest()
+	topic := kmsg.NewListOffsetsRequestTopic()
+	topic.Topic = c.c.topic
+
+	part := kmsg.NewListOffsetsRequestTopicPartition()
+	part.Partition = partition
+	part.Timestamp = int64(c.start)
+	topic.Partitions = []kmsg.ListOffsetsRequestTopicPartition{part}
+	req.Topics = []kmsg.ListOffsetsRequestTopic{topic}
+
+	resp, err := c.c.request(ctx, addr, req)
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range resp.(*kmsg.ListOffsetsResponse).Topics {
+		for _, part := range topic.Partitions {
+			if err := errorCode(part.ErrorCode); err != nil {
+				return err
+			}
+
+			if part.Partition == partition {
+				c.offsets[partition] = part.Offset
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("no offset of partition %d", partition)
+}
+
+// coordinator returns the address of the coordinator of the group.
+func (c *Consumer) coordinator(ctx context.Context) (string, error) {
+	var lastErr error
+
+	for _, addr := range c.c.seeds {
+		req := kmsg.NewPtrFindCoordinatorRequest()
+		req.CoordinatorKey = c.group
+
+		resp, err := c.c.request(ctx, addr, req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		found := resp.(*kmsg.FindCoordinatorResponse)
+		if err := errorCode(found.ErrorCode); err != nil {
+			return "", fmt.Errorf("group %s coordinator: %w", c.group, err)
+		}
+
+		return net.JoinHostPort(found.Host, strconv.Itoa(int(found.Port))), nil
+	}
+
+	return "", fmt.Errorf("no seed broker answered: %w", lastErr)
+}
+
+// Fetch returns the next records of all partitions, waiting a short while
+// for new ones if there are none. The result may be empty.
+func (c *Consumer) Fetch(ctx context.Context) ([]Record, error) {
+	requests := make(map[string]*kmsg.FetchRequest)
+	var order []string
+
+	for i, offset := range c.offsets {
+		addr, err := c.c.leader(int32(i))
+		if err != nil {
+			return nil, err
+		}
+
+		req, ok := requests[addr]
+		if !ok {
+			req = kmsg.NewPtrFetchRequest()
+			req.MaxWaitMillis = int32(fetchMaxWait / time.Millisecond)
+			req.MinBytes = 1
+			req.MaxBytes = fetchMaxBytes
+			req.SessionEpoch = -1
+
+			topic := kmsg.NewFetchRequestTopic()
+			topic.Topic = c.c.topic
+			req.Topics = []kmsg.FetchRequestTopic{topic}
+
+			requests[addr] = req
+			order = append(order, addr)
+		}
+
+		part := kmsg.NewFetchRequestTopicPartition()
+		part.Partition = int32(i)
+		part.FetchOffset = offset
+		part.PartitionMaxBytes = partitionMaxBytes
+		req.Topics[0].Partitions = append(req.Topics[0].Partitions, part)
+	}
+
+	var (
+		result  []Record
+		refresh bool
+	)
+
+	for _, addr := range order {
+		resp, err := c.c.request(ctx, addr, requests[addr])
+		if err != nil {
+			return nil, err
+		}
+
+		fetched := resp.(*kmsg.FetchResponse)
+		if err := errorCode(fetched.ErrorCode); err != nil {
+			return nil, err
+		}
+
+		for _, topic := range fetched.Topics {
+			for _, part := range topic.Partitions {
+				err := errorCode(part.ErrorCode)
+
+				switch {
+				case err == nil:
+				case part.ErrorCode == errOffsetOutOfRange:
+					if err := c.reset(ctx, part.Partition); err != nil {
+						return nil, err
+					}
+
+					continue
+				case err.(*Error).Retriable():
+					refresh = true
+					continue
+				default:
+					return nil, fmt.Errorf("partition %d: %w", part.Partition, err)
+				}
+
+				records, err := readBatches(part.RecordBatches, part.Partition, c.offsets[part.Partition])
+				if err != nil {
+					return nil, fmt.Errorf("partition %d: %w", part.Partition, err)
+				}
+
+				if len(records) > 0 {
+					c.offsets[part.Partition] = records[len(records)-1].Offset + 1
+				}
+
+				result = append(result, records...)
+			}
+		}
+	}
+
+	if refresh {
+		if err := c.c.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Commit commits offsets by partition to the group: the offsets of the
+// next records to consume, after those processed.
+func (c *Consumer) Commit(ctx context.Context, offsets map[int32]int64) error {
+	if c.group == "" {
+		return nil
+	}
+
+	addr, err := c.coordinator(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := kmsg.NewPtrOffsetCommitRequest()
+	req.Group = c.group
+	req.Generation = -1
+
+	topic := kmsg.NewOffsetCommitRequestTopic()
+	topic.Topic = c.c.topic
+
+	for partition, offset := range offsets {
+		part := kmsg.NewOffsetCommitRequestTopicPartition()
+		part.Partition = partition
+		part.Offset = offset
+		topic.Partitions = append(topic.Partitions, part)
+	}
+
+	req.Topics = []kmsg.OffsetCommitRequestTopic{topic}
+
+	resp, err := c.c.request(ctx, addr, req)
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range resp.(*kmsg.OffsetCommitResponse).Topics {
+		for _, part := range topic.Partitions {
+			if err := errorCode(part.ErrorCode); err != nil {
+				return fmt.Errorf("group %s: %w", c.group, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connections to the brokers.
+func (c *Consumer) Close() error {
+	return c.c.Close()
+}
@@ -0,0 +1,171 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const (
+	produceTimeout = 10 * time.Second
+	produceRetries = 3
+	retryBackoff   = 500 * time.Millisecond
+)
+
+// Producer produces records to the topic. Records with a key go to the
+// partition the Java client picks for it, so consumers see the records of a
+// key in order.
+type Producer struct {
+	c *Client
+}
+
+// NewProducer returns a producer to the topic.
+func NewProducer(ctx context.Context, seeds []string, topic string) (*Producer, error) {
+	c, err := NewClient(ctx, seeds, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Producer{c: c}, nil
+}
+
+// Produce writes the records and waits for all in-sync replicas to
+// acknowledge them. Produce requests failing because of a leader change
+// are retried after refreshing the metadata.
+func (p *Producer) Produce(ctx context.Context, records []Record) error {
+	partitions := make(map[int32][]Record)
+
+	n := int32(p.c.Partitions())
+	if n == 0 {
+		return fmt.Errorf("topic %s has no partitions", p.c.topic)
+	}
+
+	for i, r := range records {
+		partition := int32(i) % n
+		if r.Key != nil {
+			partition = int32(murmur2(r.Key)&0x7fffffff) % n
+		}
+
+		partitions[partition] = append(partitions[partition], r)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := p.produce(ctx, partitions)
+		if err == nil {
+			return nil
+		}
+
+		kerr, ok := err.(*Error)
+		if !ok || !kerr.Retriable() || attempt == produceRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(retryBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := p.c.refresh(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// produce sends a request per leader broker and removes the produced
+// partitions from the map.
+func (p *Producer) produce(ctx context.Context, partitions map[int32][]Record) error {
+	requests := make(map[string]*kmsg.ProduceRequest)
+	var order []string
+
+	for partition, records := range partitions {
+		addr, err := p.c.leader(partition)
+		if err != nil {
+			return err
+		}
+
+		req, ok := requests[addr]
+		if !ok {
+			req = kmsg.NewPtrProduceRequest()
+			req.Acks = -1
+			req.TimeoutMillis = int32(produceTimeout / time.Millisecond)
+
+			topic := kmsg.NewProduceRequestTopic()
+			topic.Topic = p.c.topic
+			req.Topics = []kmsg.ProduceRequestTopic{topic}
+
+			requests[addr] = req
+			order = append(order, addr)
+		}
+
+		part := kmsg.NewProduceRequestTopicPartition()
+		part.Partition = partition
+		part.Records = appendBatch(nil, records)
+		req.Topics[0].Partitions = append(req.Topics[0].Partitions, part)
+	}
+
+	for _, addr := range order {
+		resp, err := p.c.request(ctx, addr, requests[addr])
+		if err != nil {
+			return err
+		}
+
+		for _, topic := range resp.(*kmsg.ProduceResponse).Topics {
+			for _, part := range topic.Partitions {
+				if err := errorCode(part.ErrorCode); err != nil {
+					return err
+				}
+
+				delete(partitions, part.Partition)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connections to the brokers.
+func (p *Producer) Close() error {
+	return p.c.Close()
+}
+
+// murmur2 is the hash the Java client partitions keys by.
+func murmur2(data []byte) uint32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+
+	h := uint32(seed) ^ uint32(len(data))
+
+	for len(data) >= 4 {
+		k := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+		data = data[4:]
+	}
+
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return h
+}
@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Record is a message of a topic.
+type Record struct {
+	Key   []byte
+	Value []byte
+	Time  time.Time
+
+	// Partition and Offset locate a consumed record.
+	Partition int32
+	Offset    int64
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	// batchHeaderSize is the size of the record batch fields up to and
+	// including the CRC, which covers everything after it.
+	batchHeaderSize = 21
+	// lengthEnd is the end of the FirstOffset and Length fields the batch
+	// length doesn't count.
+	lengthEnd = 12
+
+	codecMask       = 0x07
+	codecGzip       = 1
+	codecZstd       = 4
+	controlBatchBit = 0x20
+)
+
+// appendBatch appends an uncompressed record batch of the records.
+func appendBatch(dst []byte, records []Record) []byte {
+	first := records[0].Time.UnixMilli()
+	maxTime := first
+
+	var body []byte
+
+	for i, r := range records {
+		ts := r.Time.UnixMilli()
+		maxTime = max(maxTime, ts)
+
+		rec := kmsg.Record{
+			TimestampDelta64: ts - first,
+			OffsetDelta:      int32(i),
+			Key:              r.Key,
+			Value:            r.Value,
+		}
+
+		// Length counts the bytes after itself, a 1 byte varint when zero.
+		rec.Length = int32(len(rec.AppendTo(nil)) - 1)
+		body = rec.AppendTo(body)
+	}
+
+	batch := kmsg.RecordBatch{
+		PartitionLeaderEpoch: -1,
+		Magic:                2,
+		LastOffsetDelta:      int32(len(records) - 1),
+		FirstTimestamp:       first,
+		MaxTimestamp:         maxTime,
+		ProducerID:           -1,
+		ProducerEpoch:        -1,
+		FirstSequence:        -1,
+		NumRecords:           int32(len(records)),
+		Records:              body,
+	}
+
+	start := len(dst)
+	dst = batch.AppendTo(dst)
+	b := dst[start:]
+
+	binary.BigEndian.PutUint32(b[8:lengthEnd], uint32(len(b)-lengthEnd))
+	binary.BigEndian.PutUint32(b[batchHeaderSize-4:batchHeaderSize], crc32.Checksum(b[batchHeaderSize:], castagnoli))
+
+	return dst
+}
+
+// readBatches decodes the records of the batches at or after offset. A
+// partial batch at the end, which brokers may return, is ignored.
+func readBatches(b []byte, partition int32, offset int64) ([]Record, error) {
+	var result []Record
+
+	for len(b) >= lengthEnd {
+		size := lengthEnd + int(int32(binary.BigEndian.Uint32(b[8:lengthEnd])))
+		if size < batchHeaderSize || size > len(b) {
+			break
+		}
+
+		raw := b[:size]
+		b = b[size:]
+
+		if raw[16] != 2 {
+			return nil, fmt.Errorf("unsupported message format version %d", raw[16])
+		}
+
+		var batch kmsg.RecordBatch
+
+		if err := batch.ReadFrom(raw); err != nil {
+			return nil, err
+		}
+
+		if batch.Attributes&controlBatchBit != 0 {
+			continue
+		}
+
+		records, err := decompress(batch.Records, batch.Attributes&codecMask)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := int32(0); i < batch.NumRecords; i++ {
+			length, n := binary.Varint(records)
+			if n <= 0 || int64(len(records)-n) < length {
+				return nil, fmt.Errorf("truncated record")
+			}
+
+			var rec kmsg.Record
+
+			if err := rec.ReadFrom(records[:n+int(length)]); err != nil {
+				return nil, err
+			}
+
+			records = records[n+int(length):]
+
+			r := Record{
+				Key:       rec.Key,
+				Value:     rec.Value,
+				Time:      time.UnixMilli(batch.FirstTimestamp + rec.TimestampDelta64),
+				Partition: partition,
+				Offset:    batch.FirstOffset + int64(rec.OffsetDelta),
+			}
+
+			if r.Offset >= offset {
+				result = append(result, r)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func decompress(b []byte, codec int16) ([]byte, error) {
+	switch codec {
+	case 0:
+		return b, nil
+	case codecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+
+		return io.ReadAll(r)
+	case codecZstd:
+		d, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer d.Close()
+
+		return d.DecodeAll(b, nil)
+	}
+
+	return nil, fmt.Errorf("unsupported compression codec %d", codec)
+}
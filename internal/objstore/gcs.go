@@ -0,0 +1,336 @@
+package objstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	gcsURL   = "https://storage.googleapis.com"
+	gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+	tokenURL = "https://oauth2.googleapis.com/token"
+)
+
+// gcsStore is a client of the JSON API of Google Cloud Storage, or of an
+// emulator at STORAGE_EMULATOR_HOST without authentication.
+type gcsStore struct {
+	base  string
+	token credential[string]
+}
+
+func newGCS() *gcsStore {
+	s := &gcsStore{base: gcsURL}
+
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+
+		s.base = strings.TrimSuffix(host, "/")
+		s.token.fetch = func(context.Context) (string, time.Time, error) { return "", time.Time{}, nil }
+	} else {
+		s.token.fetch = gcsFetchToken
+	}
+
+	return s
+}
+
+func (s *gcsStore) do(ctx context.Context, method, target string, body io.Reader, size int64) (*http.Response, error) {
+	token, err := s.token.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcs credentials: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+func (s *gcsStore) get(ctx context.Context, u URI) (io.ReadCloser, int64, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.base+"/storage/v1/b/"+url.PathEscape(u.Bucket)+"/o/"+url.PathEscape(u.Key)+"?alt=media", nil, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, 0, httpError("get", u, resp, gcsErrorMessage)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (s *gcsStore) put(ctx context.Context, u URI, body io.Reader, size int64) error {
+	query := url.Values{"uploadType": {"media"}, "name": {u.Key}}
+
+	resp, err := s.do(ctx, http.MethodPost, s.base+"/upload/storage/v1/b/"+url.PathEscape(u.Bucket)+"/o?"+query.Encode(), body, size)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("put", u, resp, gcsErrorMessage)
+	}
+
+	return nil
+}
+
+func (s *gcsStore) list(ctx context.Context, u URI) ([]string, error) {
+	var (
+		result []string
+		token  string
+	)
+
+	for {
+		query := url.Values{"prefix": {u.Key}, "fields": {"items(name),nextPageToken"}}
+		if token != "" {
+			query.Set("pageToken", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, s.base+"/storage/v1/b/"+url.PathEscape(u.Bucket)+"/o?"+query.Encode(), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, httpError("list", u, resp, gcsErrorMessage)
+		}
+
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", u, err)
+		}
+
+		for _, object := range page.Items {
+			result = append(result, URI{Scheme: u.Scheme, Bucket: u.Bucket, Key: object.Name}.String())
+		}
+
+		if page.NextPageToken == "" {
+			return result, nil
+		}
+
+		token = page.NextPageToken
+	}
+}
+
+func gcsErrorMessage(body []byte) string {
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	if json.Unmarshal(body, &e) != nil {
+		return ""
+	}
+
+	return e.Error.Message
+}
+
+// gcsCredentials is a credentials file of the kinds of Application Default
+// Credentials.
+type gcsCredentials struct {
+	Type string `json:"type"`
+	// Service account keys.
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	// User credentials of gcloud auth application-default login.
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// gcsFetchToken returns an access token of Application Default
+// Credentials: the GOOGLE_APPLICATION_CREDENTIALS file, the gcloud
+// credentials file or the metadata server.
+func gcsFetchToken(ctx context.Context) (string, time.Time, error) {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "gcloud", "application_default_credentials.json")
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") == "" {
+		return gcsMetadataToken(ctx)
+	}
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var creds gcsCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	form := url.Values{}
+
+	switch creds.Type {
+	case "service_account":
+		assertion, err := creds.assertion(time.Now())
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("%s: %w", path, err)
+		}
+
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+	default:
+		return "", time.Time{}, fmt.Errorf("%s: unsupported credentials type %q", path, creds.Type)
+	}
+
+	uri := creds.TokenURI
+	if uri == "" {
+		uri = tokenURL
+	}
+
+	req, err := http.NewRequest(http.MethodPost, uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return gcsToken(ctx, req)
+}
+
+// assertion returns the signed JWT a service account exchanges for an
+// access token.
+func (c gcsCredentials) assertion(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return "", errors.New("bad private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("private key is not RSA")
+	}
+
+	uri := c.TokenURI
+	if uri == "" {
+		uri = tokenURL
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": c.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   c.ClientEmail,
+		"scope": gcsScope,
+		"aud":   uri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+// gcsMetadataToken fetches an access token of the service account of the
+// instance from the metadata server, at GCE_METADATA_HOST if set.
+func gcsMetadataToken(ctx context.Context) (string, time.Time, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token?scopes="+url.QueryEscape(gcsScope), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	token, expires, err := gcsToken(ctx, req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("no credentials found: metadata server: %w", err)
+	}
+
+	return token, expires, nil
+}
+
+// gcsToken sends an OAuth 2 token request and returns the access token.
+func gcsToken(ctx context.Context, req *http.Request) (string, time.Time, error) {
+	body, err := readAll(ctx, req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	if err := json.Unmarshal([]byte(body), &token); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("no access token in the response")
+	}
+
+	return token.AccessToken, time.Now().Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
@@ -0,0 +1,183 @@
+// Package objstore reads, writes and lists the objects of Amazon S3 and
+// Google Cloud Storage addressed by s3://bucket/key and gs://bucket/key
+// URIs. Credentials come from the standard environment variables and
+// credential files of each cloud, or else from the instance metadata
+// service.
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimeout bounds the metadata and token requests; object transfers
+// are bounded by the context only.
+const requestTimeout = 10 * time.Second
+
+// IsURI reports whether s addresses an object rather than a local file.
+func IsURI(s string) bool {
+	return strings.HasPrefix(s, "s3://") || strings.HasPrefix(s, "gs://")
+}
+
+// URI is a parsed object URI.
+type URI struct {
+	// Scheme is s3 or gs.
+	Scheme string
+	Bucket string
+	Key    string
+}
+
+// Parse parses an s3://bucket/key or gs://bucket/key URI. The key may be
+// empty or a prefix ending with a slash.
+func Parse(s string) (URI, error) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || scheme != "s3" && scheme != "gs" {
+		return URI{}, fmt.Errorf("bad object uri %q, want s3://bucket/key or gs://bucket/key", s)
+	}
+
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return URI{}, fmt.Errorf("bad object uri %q: no bucket", s)
+	}
+
+	return URI{Scheme: scheme, Bucket: bucket, Key: key}, nil
+}
+
+func (u URI) String() string {
+	return u.Scheme + "://" + u.Bucket + "/" + u.Key
+}
+
+// store is the API of a cloud.
+type store interface {
+	get(ctx context.Context, u URI) (io.ReadCloser, int64, error)
+	put(ctx context.Context, u URI, body io.Reader, size int64) error
+	list(ctx context.Context, u URI) ([]string, error)
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]store{}
+)
+
+// storeOf returns the client of the cloud of u, shared by all calls so that
+// credentials are looked up once.
+func storeOf(u URI) store {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	s, ok := stores[u.Scheme]
+	if !ok {
+		if u.Scheme == "s3" {
+			s = newS3()
+		} else {
+			s = newGCS()
+		}
+
+		stores[u.Scheme] = s
+	}
+
+	return s
+}
+
+// Open returns a reader of the object and its size.
+func Open(ctx context.Context, uri string) (io.ReadCloser, int64, error) {
+	u, err := Parse(uri)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return storeOf(u).get(ctx, u)
+}
+
+// Put uploads size bytes of body as the object, replacing it.
+func Put(ctx context.Context, uri string, body io.Reader, size int64) error {
+	u, err := Parse(uri)
+	if err != nil {
+		return err
+	}
+
+	return storeOf(u).put(ctx, u, body, size)
+}
+
+// List returns the URIs of the objects whose keys start with the key of
+// uri, in key order.
+func List(ctx context.Context, uri string) ([]string, error) {
+	u, err := Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return storeOf(u).list(ctx, u)
+}
+
+// httpError returns the error of a failed response, with the message of its
+// body.
+func httpError(op string, u URI, resp *http.Response, message func(body []byte) string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	if m := message(body); m != "" {
+		return fmt.Errorf("%s %s: %s: %s", op, u, resp.Status, m)
+	}
+
+	return fmt.Errorf("%s %s: %s", op, u, resp.Status)
+}
+
+// credential is a secret valid until its expiry, zero if it doesn't
+// expire.
+type credential[T any] struct {
+	mu      sync.Mutex
+	value   T
+	expires time.Time
+	valid   bool
+	fetch   func(ctx context.Context) (T, time.Time, error)
+}
+
+// get returns the credential, fetching it anew shortly before it expires.
+func (c *credential[T]) get(ctx context.Context) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.valid && (c.expires.IsZero() || time.Until(c.expires) > 5*time.Minute) {
+		return c.value, nil
+	}
+
+	value, expires, err := c.fetch(ctx)
+	if err != nil {
+		return value, err
+	}
+
+	c.value, c.expires, c.valid = value, expires, true
+
+	return value, nil
+}
+
+// doTimeout sends a metadata or token request within requestTimeout.
+func doTimeout(ctx context.Context, req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// cancelBody releases the timeout of a response once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
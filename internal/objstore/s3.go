@@ -0,0 +1,511 @@
+package objstore
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// unsignedPayload is the payload hash of requests whose bodies aren't
+// signed, as allowed by S3.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3Store is a client of S3 or, with AWS_ENDPOINT_URL, of a compatible
+// service addressed path style.
+type s3Store struct {
+	region   string
+	endpoint string
+	creds    credential[s3Credentials]
+}
+
+type s3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Token           string
+}
+
+func newS3() *s3Store {
+	s := &s3Store{
+		region:   firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		endpoint: strings.TrimSuffix(firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"), "/"),
+	}
+
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+
+	s.creds.fetch = s3FetchCredentials
+
+	return s
+}
+
+// firstEnv returns the first set of the environment variables.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// url returns the URL of the object, or of the bucket for an empty key.
+// Buckets are addressed virtual host style on AWS except for names with
+// dots, which don't match its certificates.
+func (s *s3Store) url(u URI) *url.URL {
+	result := &url.URL{Scheme: "https", Host: "s3." + s.region + ".amazonaws.com"}
+	p := "/" + u.Bucket + "/" + u.Key
+
+	switch {
+	case s.endpoint != "":
+		base, err := url.Parse(s.endpoint)
+		if err == nil {
+			result.Scheme, result.Host = base.Scheme, base.Host
+			p = strings.TrimSuffix(base.Path, "/") + p
+		}
+	case !strings.Contains(u.Bucket, "."):
+		result.Host = u.Bucket + "." + result.Host
+		p = "/" + u.Key
+	}
+
+	if u.Key == "" {
+		p = strings.TrimSuffix(p, "/")
+		if p == "" {
+			p = "/"
+		}
+	}
+
+	result.Path = p
+	result.RawPath = awsEscape(p, false)
+
+	return result
+}
+
+func (s *s3Store) do(ctx context.Context, method string, u URI, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	creds, err := s.creds.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("s3 credentials: %w", err)
+	}
+
+	target := s.url(u)
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+
+	s.sign(req, creds, time.Now())
+
+	return http.DefaultClient.Do(req)
+}
+
+func (s *s3Store) get(ctx context.Context, u URI) (io.ReadCloser, int64, error) {
+	resp, err := s.do(ctx, http.MethodGet, u, nil, nil, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, 0, httpError("get", u, resp, s3ErrorMessage)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (s *s3Store) put(ctx context.Context, u URI, body io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, u, nil, body, size)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("put", u, resp, s3ErrorMessage)
+	}
+
+	return nil
+}
+
+func (s *s3Store) list(ctx context.Context, u URI) ([]string, error) {
+	var (
+		result []string
+		token  string
+	)
+
+	bucket := URI{Scheme: u.Scheme, Bucket: u.Bucket}
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {u.Key}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, bucket, query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, httpError("list", u, resp, s3ErrorMessage)
+		}
+
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", u, err)
+		}
+
+		for _, object := range page.Contents {
+			result = append(result, URI{Scheme: u.Scheme, Bucket: u.Bucket, Key: object.Key}.String())
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return result, nil
+		}
+
+		token = page.NextContinuationToken
+	}
+}
+
+func s3ErrorMessage(body []byte) string {
+	var e struct {
+		Code    string
+		Message string
+	}
+
+	if xml.Unmarshal(body, &e) != nil || e.Code == "" {
+		return ""
+	}
+
+	return e.Code + ": " + e.Message
+}
+
+// sign signs the request with AWS Signature Version 4, leaving its body
+// unsigned.
+func (s *s3Store) sign(req *http.Request, creds s3Credentials, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + s.region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonical strings.Builder
+
+	canonical.WriteString(req.Method + "\n" + req.URL.EscapedPath() + "\n" + req.URL.RawQuery + "\n")
+
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signed := strings.Join(names, ";")
+	canonical.WriteString("\n" + signed + "\n" + unsignedPayload)
+
+	hash := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+hex.EncodeToString(hmacSHA256(key, toSign)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes s the way signatures expect: everything but
+// unreserved characters and, unless escapeSlash, slashes.
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !escapeSlash {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
+
+// canonicalQuery encodes the query sorted by name as signatures expect.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var parts []string
+
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, awsEscape(name, true)+"="+awsEscape(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// s3FetchCredentials looks up credentials in the order of the AWS SDKs: the
+// environment, the shared credentials file, the container credentials
+// endpoint and the EC2 instance metadata service.
+func s3FetchCredentials(ctx context.Context) (s3Credentials, time.Time, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return s3Credentials{AccessKeyID: id, SecretAccessKey: secret, Token: os.Getenv("AWS_SESSION_TOKEN")}, time.Time{}, nil
+	}
+
+	creds, err := s3SharedCredentials()
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return creds, time.Time{}, err
+	}
+
+	if uri := s3ContainerURI(); uri != "" {
+		header := http.Header{}
+		if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+			header.Set("Authorization", token)
+		}
+
+		return s3FetchRole(ctx, uri, header)
+	}
+
+	if os.Getenv("AWS_EC2_METADATA_DISABLED") == "true" {
+		return s3Credentials{}, time.Time{}, errors.New("no credentials found")
+	}
+
+	return s3InstanceCredentials(ctx)
+}
+
+// s3SharedCredentials reads the AWS_PROFILE profile, default by default,
+// of the shared credentials file.
+func s3SharedCredentials() (s3Credentials, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return s3Credentials{}, os.ErrNotExist
+		}
+
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return s3Credentials{}, err
+	}
+
+	defer f.Close()
+
+	var (
+		creds   s3Credentials
+		section string
+	)
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.Token = strings.TrimSpace(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return s3Credentials{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		// Go on looking elsewhere.
+		return s3Credentials{}, fmt.Errorf("%s: no keys in profile %s: %w", path, profile, os.ErrNotExist)
+	}
+
+	return creds, nil
+}
+
+// s3ContainerURI returns the credentials endpoint of ECS and EKS
+// containers, if any.
+func s3ContainerURI() string {
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return uri
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return "http://169.254.170.2" + uri
+	}
+
+	return ""
+}
+
+// imdsURL is the EC2 instance metadata service.
+const imdsURL = "http://169.254.169.254/latest"
+
+// s3InstanceCredentials fetches the credentials of the instance role from
+// the instance metadata service, version 2.
+func s3InstanceCredentials(ctx context.Context) (s3Credentials, time.Time, error) {
+	req, err := http.NewRequest(http.MethodPut, imdsURL+"/api/token", nil)
+	if err != nil {
+		return s3Credentials{}, time.Time{}, err
+	}
+
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+
+	token, err := readAll(ctx, req)
+	if err != nil {
+		return s3Credentials{}, time.Time{}, fmt.Errorf("no credentials found: instance metadata: %w", err)
+	}
+
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+
+	req, err = http.NewRequest(http.MethodGet, imdsURL+"/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return s3Credentials{}, time.Time{}, err
+	}
+
+	req.Header = header.Clone()
+
+	role, err := readAll(ctx, req)
+	if err != nil {
+		return s3Credentials{}, time.Time{}, fmt.Errorf("instance role: %w", err)
+	}
+
+	role, _, _ = strings.Cut(strings.TrimSpace(role), "\n")
+
+	return s3FetchRole(ctx, imdsURL+"/meta-data/iam/security-credentials/"+role, header)
+}
+
+// s3FetchRole fetches temporary credentials in the JSON of the container
+// and instance metadata endpoints.
+func s3FetchRole(ctx context.Context, uri string, header http.Header) (s3Credentials, time.Time, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return s3Credentials{}, time.Time{}, err
+	}
+
+	req.Header = header.Clone()
+
+	body, err := readAll(ctx, req)
+	if err != nil {
+		return s3Credentials{}, time.Time{}, fmt.Errorf("role credentials: %w", err)
+	}
+
+	var role struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+
+	if err := json.Unmarshal([]byte(body), &role); err != nil {
+		return s3Credentials{}, time.Time{}, fmt.Errorf("role credentials: %w", err)
+	}
+
+	return s3Credentials{AccessKeyID: role.AccessKeyID, SecretAccessKey: role.SecretAccessKey, Token: role.Token}, role.Expiration, nil
+}
+
+// readAll sends a metadata request and returns the body of its successful
+// response.
+func readAll(ctx context.Context, req *http.Request) (string, error) {
+	resp, err := doTimeout(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", req.URL, resp.Status)
+	}
+
+	return string(body), nil
+}
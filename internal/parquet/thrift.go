@@ -0,0 +1,107 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol type ids.
+const (
+	ctBoolTrue  = 1
+	ctBoolFalse = 2
+	ctI32       = 5
+	ctI64       = 6
+	ctBinary    = 8
+	ctList      = 9
+	ctStruct    = 12
+)
+
+// compactWriter encodes Thrift structs with the compact protocol, which is
+// what Parquet uses for page headers and file metadata.
+type compactWriter struct {
+	buf bytes.Buffer
+	// last holds the id of the last written field of every open struct.
+	last []int16
+}
+
+func (w *compactWriter) fieldHeader(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(int64(id))
+	}
+
+	*last = id
+}
+
+func (w *compactWriter) varint(v int64) {
+	w.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (w *compactWriter) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *compactWriter) structBegin() {
+	w.last = append(w.last, 0)
+}
+
+func (w *compactWriter) structEnd() {
+	w.buf.WriteByte(0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *compactWriter) fieldStruct(id int16) {
+	w.fieldHeader(id, ctStruct)
+	w.structBegin()
+}
+
+func (w *compactWriter) fieldBool(id int16, v bool) {
+	if v {
+		w.fieldHeader(id, ctBoolTrue)
+	} else {
+		w.fieldHeader(id, ctBoolFalse)
+	}
+}
+
+func (w *compactWriter) fieldI32(id int16, v int32) {
+	w.fieldHeader(id, ctI32)
+	w.varint(int64(v))
+}
+
+func (w *compactWriter) fieldI64(id int16, v int64) {
+	w.fieldHeader(id, ctI64)
+	w.varint(v)
+}
+
+func (w *compactWriter) fieldString(id int16, s string) {
+	w.fieldHeader(id, ctBinary)
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// fieldList writes the header of a list field of n elements of typ.
+func (w *compactWriter) fieldList(id int16, typ byte, n int) {
+	w.fieldHeader(id, ctList)
+
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+
+	w.buf.WriteByte(0xf0 | typ)
+	w.uvarint(uint64(n))
+}
+
+func (w *compactWriter) listI32(v int32) {
+	w.varint(int64(v))
+}
+
+func (w *compactWriter) listString(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
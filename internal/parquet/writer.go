@@ -0,0 +1,256 @@
+// Package parquet is a minimal writer of Parquet files with flat schemas of
+// required columns. Every column chunk is a single uncompressed data page in
+// the PLAIN encoding, which any Parquet reader understands.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Type is a physical column type.
+type Type int32
+
+// Physical types.
+const (
+	Int64     Type = 2
+	Double    Type = 5
+	ByteArray Type = 6
+)
+
+// ConvertedType annotates how to interpret a physical type.
+type ConvertedType int32
+
+// Converted types.
+const (
+	None            ConvertedType = -1
+	UTF8            ConvertedType = 0
+	TimestampMicros ConvertedType = 10
+)
+
+const (
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	repetitionRequired = 0
+	pageTypeData       = 0
+	codecUncompressed  = 0
+)
+
+var magic = []byte("PAR1")
+
+// Column describes a column of the schema.
+type Column struct {
+	Name      string
+	Type      Type
+	Converted ConvertedType
+}
+
+// Writer writes rows into a Parquet file. Values are appended column by
+// column with the Write methods and every row is finished with EndRow.
+type Writer struct {
+	w      io.Writer
+	cols   []Column
+	bufs   []bytes.Buffer
+	rows   int64
+	offset int64
+	groups []rowGroup
+	err    error
+}
+
+type rowGroup struct {
+	rows   int64
+	chunks []columnChunk
+}
+
+type columnChunk struct {
+	offset int64
+	size   int64
+}
+
+// NewWriter writes the file header to w and returns a writer of the schema.
+func NewWriter(w io.Writer, cols []Column) (*Writer, error) {
+	if _, err := w.Write(magic); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		w:      w,
+		cols:   cols,
+		bufs:   make([]bytes.Buffer, len(cols)),
+		offset: int64(len(magic)),
+	}, nil
+}
+
+// WriteString appends a BYTE_ARRAY value to the column.
+func (w *Writer) WriteString(col int, s string) {
+	var n [4]byte
+
+	binary.LittleEndian.PutUint32(n[:], uint32(len(s)))
+	w.bufs[col].Write(n[:])
+	w.bufs[col].WriteString(s)
+}
+
+// WriteDouble appends a DOUBLE value to the column.
+func (w *Writer) WriteDouble(col int, v float64) {
+	var b [8]byte
+
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	w.bufs[col].Write(b[:])
+}
+
+// WriteInt64 appends an INT64 value to the column.
+func (w *Writer) WriteInt64(col int, v int64) {
+	var b [8]byte
+
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	w.bufs[col].Write(b[:])
+}
+
+// EndRow finishes the current row.
+func (w *Writer) EndRow() {
+	w.rows++
+}
+
+// Rows returns the number of rows buffered for the current row group.
+func (w *Writer) Rows() int64 {
+	return w.rows
+}
+
+// Flush writes the buffered rows as a row group.
+func (w *Writer) Flush() error {
+	if w.err != nil || w.rows == 0 {
+		return w.err
+	}
+
+	group := rowGroup{rows: w.rows}
+
+	for i := range w.cols {
+		var header compactWriter
+
+		data := w.bufs[i].Bytes()
+
+		header.structBegin()
+		header.fieldI32(1, pageTypeData)
+		header.fieldI32(2, int32(len(data)))
+		header.fieldI32(3, int32(len(data)))
+		header.fieldStruct(5)
+		header.fieldI32(1, int32(w.rows))
+		header.fieldI32(2, encodingPlain)
+		header.fieldI32(3, encodingRLE)
+		header.fieldI32(4, encodingRLE)
+		header.structEnd()
+		header.structEnd()
+
+		chunk := columnChunk{offset: w.offset, size: int64(header.buf.Len() + len(data))}
+
+		if w.err = w.write(header.buf.Bytes(), data); w.err != nil {
+			return w.err
+		}
+
+		group.chunks = append(group.chunks, chunk)
+		w.bufs[i].Reset()
+	}
+
+	w.groups = append(w.groups, group)
+	w.rows = 0
+
+	return nil
+}
+
+// Close flushes the buffered rows and writes the file footer. It doesn't
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var meta compactWriter
+
+	meta.structBegin()
+	meta.fieldI32(1, 1)
+
+	meta.fieldList(2, ctStruct, len(w.cols)+1)
+	meta.structBegin()
+	meta.fieldString(4, "schema")
+	meta.fieldI32(5, int32(len(w.cols)))
+	meta.structEnd()
+
+	for _, col := range w.cols {
+		meta.structBegin()
+		meta.fieldI32(1, int32(col.Type))
+		meta.fieldI32(3, repetitionRequired)
+		meta.fieldString(4, col.Name)
+
+		if col.Converted != None {
+			meta.fieldI32(6, int32(col.Converted))
+		}
+
+		meta.structEnd()
+	}
+
+	var rows int64
+	for _, group := range w.groups {
+		rows += group.rows
+	}
+
+	meta.fieldI64(3, rows)
+
+	meta.fieldList(4, ctStruct, len(w.groups))
+
+	for _, group := range w.groups {
+		var size int64
+
+		meta.structBegin()
+		meta.fieldList(1, ctStruct, len(group.chunks))
+
+		for i, chunk := range group.chunks {
+			size += chunk.size
+
+			meta.structBegin()
+			meta.fieldI64(2, chunk.offset)
+			meta.fieldStruct(3)
+			meta.fieldI32(1, int32(w.cols[i].Type))
+			meta.fieldList(2, ctI32, 2)
+			meta.listI32(encodingPlain)
+			meta.listI32(encodingRLE)
+			meta.fieldList(3, ctBinary, 1)
+			meta.listString(w.cols[i].Name)
+			meta.fieldI32(4, codecUncompressed)
+			meta.fieldI64(5, group.rows)
+			meta.fieldI64(6, chunk.size)
+			meta.fieldI64(7, chunk.size)
+			meta.fieldI64(9, chunk.offset)
+			meta.structEnd()
+			meta.structEnd()
+		}
+
+		meta.fieldI64(2, size)
+		meta.fieldI64(3, group.rows)
+		meta.structEnd()
+	}
+
+	meta.fieldString(6, "tinkoff_candles")
+	meta.structEnd()
+
+	var length [4]byte
+
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+
+	return w.write(meta.buf.Bytes(), length[:], magic)
+}
+
+func (w *Writer) write(chunks ...[]byte) error {
+	for _, chunk := range chunks {
+		n, err := w.w.Write(chunk)
+		w.offset += int64(n)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+// Package plot draws simple charts of rectangles, lines and text into SVG
+// or PNG images. Coordinates are in pixels from the top left corner.
+package plot
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// Align is the horizontal alignment of text relative to its position.
+type Align int
+
+// Alignments.
+const (
+	Left Align = iota
+	Center
+	Right
+)
+
+// Canvas is an image being drawn.
+type Canvas interface {
+	Size() (width, height int)
+	// FillRect fills the rectangle between the corners.
+	FillRect(x0, y0, x1, y1 float64, c color.Color)
+	// Line draws a line of the given width.
+	Line(x0, y0, x1, y1, width float64, c color.Color)
+	// Text draws a line of text vertically centered at y.
+	Text(x, y float64, s string, align Align, c color.Color)
+	// WriteTo encodes the image.
+	WriteTo(w io.Writer) (int64, error)
+}
+
+// New returns a canvas of the format named by the extension of path,
+// .svg or .png, with a white background.
+func New(path string, width, height int) (Canvas, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".svg":
+		return NewSVG(width, height), nil
+	case ".png":
+		return NewPNG(width, height), nil
+	}
+
+	return nil, fmt.Errorf("unknown image format of %s, want .svg or .png", path)
+}
+
+// Polyline draws lines through the points, skipping NaN values, which
+// break the line.
+func Polyline(c Canvas, xs, ys []float64, width float64, col color.Color) {
+	for i := 1; i < len(xs); i++ {
+		if math.IsNaN(ys[i-1]) || math.IsNaN(ys[i]) {
+			continue
+		}
+
+		c.Line(xs[i-1], ys[i-1], xs[i], ys[i], width, col)
+	}
+}
+
+// Ticks returns round values between lo and hi, about n of them, and the
+// number of decimals to print them with.
+func Ticks(lo, hi float64, n int) ([]float64, int) {
+	if !(hi > lo) || n < 1 {
+		return nil, 0
+	}
+
+	raw := (hi - lo) / float64(n)
+	exp := math.Pow(10, math.Floor(math.Log10(raw)))
+
+	var step float64
+
+	switch f := raw / exp; {
+	case f <= 1:
+		step = exp
+	case f <= 2:
+		step = 2 * exp
+	case f <= 5:
+		step = 5 * exp
+	default:
+		step = 10 * exp
+	}
+
+	var ticks []float64
+
+	for i := math.Ceil(lo / step); i*step <= hi; i++ {
+		ticks = append(ticks, i*step)
+	}
+
+	return ticks, max(0, int(-math.Floor(math.Log10(step)+1e-9)))
+}
@@ -0,0 +1,118 @@
+package plot
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// PNG is a canvas of a raster image, drawn without antialiasing.
+type PNG struct {
+	img *image.RGBA
+}
+
+// NewPNG returns a PNG canvas with a white background.
+func NewPNG(width, height int) *PNG {
+	p := &PNG{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+	draw.Draw(p.img, p.img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	return p
+}
+
+func (p *PNG) Size() (int, int) {
+	b := p.img.Bounds()
+	return b.Dx(), b.Dy()
+}
+
+func (p *PNG) FillRect(x0, y0, x1, y1 float64, c color.Color) {
+	r := image.Rect(int(math.Round(x0)), int(math.Round(y0)), int(math.Round(x1)), int(math.Round(y1)))
+
+	// Keep thin rectangles visible.
+	if r.Dx() == 0 {
+		r.Max.X++
+	}
+
+	if r.Dy() == 0 {
+		r.Max.Y++
+	}
+
+	draw.Draw(p.img, r, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// Line steps along the line in half pixels, painting the pixels within
+// width of it.
+func (p *PNG) Line(x0, y0, x1, y1, width float64, c color.Color) {
+	steps := int(math.Ceil(2*math.Hypot(x1-x0, y1-y0))) + 1
+	half := max(width, 1) / 2
+	src := image.NewUniform(c)
+
+	var last image.Rectangle
+
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		x, y := x0+(x1-x0)*t, y0+(y1-y0)*t
+
+		r := image.Rect(int(math.Round(x-half)), int(math.Round(y-half)), int(math.Round(x+half)), int(math.Round(y+half)))
+		if r == last {
+			continue
+		}
+
+		// Paint only the pixels not painted for the previous step, so
+		// translucent lines don't darken where steps overlap.
+		for py := r.Min.Y; py < r.Max.Y; py++ {
+			for px := r.Min.X; px < r.Max.X; px++ {
+				if pt := (image.Point{px, py}); !pt.In(last) {
+					draw.Draw(p.img, image.Rect(px, py, px+1, py+1), src, image.Point{}, draw.Over)
+				}
+			}
+		}
+
+		last = r
+	}
+}
+
+func (p *PNG) Text(x, y float64, s string, align Align, c color.Color) {
+	face := basicfont.Face7x13
+	d := font.Drawer{Dst: p.img, Src: image.NewUniform(c), Face: face}
+
+	w := d.MeasureString(s).Round()
+
+	switch align {
+	case Center:
+		x -= float64(w) / 2
+	case Right:
+		x -= float64(w)
+	}
+
+	m := face.Metrics()
+	baseline := y + float64(m.Ascent.Round()-m.Descent.Round())/2
+
+	d.Dot = fixed.P(int(math.Round(x)), int(math.Round(baseline)))
+	d.DrawString(s)
+}
+
+func (p *PNG) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := png.Encode(cw, p.img)
+
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,75 @@
+package plot
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// SVG is a canvas of SVG elements.
+type SVG struct {
+	width, height int
+	b             strings.Builder
+}
+
+// NewSVG returns an SVG canvas with a white background.
+func NewSVG(width, height int) *SVG {
+	s := &SVG{width: width, height: height}
+	s.FillRect(0, 0, float64(width), float64(height), color.White)
+
+	return s
+}
+
+func (s *SVG) Size() (int, int) {
+	return s.width, s.height
+}
+
+func (s *SVG) FillRect(x0, y0, x1, y1 float64, c color.Color) {
+	fmt.Fprintf(&s.b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" %s/>`+"\n",
+		min(x0, x1), min(y0, y1), abs(x1-x0), abs(y1-y0), paint("fill", c))
+}
+
+func (s *SVG) Line(x0, y0, x1, y1, width float64, c color.Color) {
+	fmt.Fprintf(&s.b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke-width="%g" %s/>`+"\n",
+		x0, y0, x1, y1, width, paint("stroke", c))
+}
+
+func (s *SVG) Text(x, y float64, text string, align Align, c color.Color) {
+	anchor := [...]string{Left: "start", Center: "middle", Right: "end"}[align]
+
+	var escaped strings.Builder
+
+	xml.EscapeText(&escaped, []byte(text))
+
+	fmt.Fprintf(&s.b, `<text x="%.1f" y="%.1f" text-anchor="%s" dominant-baseline="middle" %s>%s</text>`+"\n",
+		x, y, anchor, paint("fill", c), escaped.String())
+}
+
+func (s *SVG) WriteTo(w io.Writer) (int64, error) {
+	n, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12" shape-rendering="crispEdges">`+"\n%s</svg>\n",
+		s.width, s.height, s.width, s.height, s.b.String())
+
+	return int64(n), err
+}
+
+// paint returns the attribute of the color with its opacity.
+func paint(attr string, c color.Color) string {
+	rgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+
+	s := fmt.Sprintf(`%s="#%02x%02x%02x"`, attr, rgba.R, rgba.G, rgba.B)
+	if rgba.A < 255 {
+		s += fmt.Sprintf(` %s-opacity="%.2f"`, attr, float64(rgba.A)/255)
+	}
+
+	return s
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
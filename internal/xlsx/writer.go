@@ -0,0 +1,296 @@
+// Package xlsx is a minimal writer of Excel workbooks of plain sheets with
+// a bold frozen header row. Cells are strings, numbers or dates; strings are
+// stored inline, so the workbook needs no shared string table.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxRows is the number of rows of a sheet Excel can open, including the
+// header.
+const MaxRows = 1 << 20
+
+// Cell styles of styles.xml.
+const (
+	styleHeader = 1
+	styleTime   = 2
+)
+
+// epoch is day zero of Excel dates in the 1900 date system.
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Writer collects sheets in memory and writes the workbook on Close.
+type Writer struct {
+	w      io.Writer
+	sheets []*Sheet
+	names  map[string]bool
+}
+
+// Sheet is a worksheet. Cells are appended to the current row with the
+// Write methods and every row is finished with EndRow.
+type Sheet struct {
+	name  string
+	rows  int
+	col   int
+	open  bool
+	buf   bytes.Buffer
+	width []int
+}
+
+// NewWriter returns a writer of a workbook to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, names: make(map[string]bool)}
+}
+
+// AddSheet adds a sheet with the header row. The name is cleaned of
+// characters Excel doesn't allow, cut to 31 characters and made unique.
+func (w *Writer) AddSheet(name string, header []string) *Sheet {
+	s := &Sheet{name: w.uniqueName(name), width: make([]int, len(header))}
+	w.sheets = append(w.sheets, s)
+
+	for _, h := range header {
+		s.cell("inlineStr", styleHeader, "<is><t>"+escape(h)+"</t></is>", len(h))
+	}
+
+	s.EndRow()
+
+	return s
+}
+
+func (w *Writer) uniqueName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+
+		return r
+	}, name)
+
+	if name == "" {
+		name = "Sheet"
+	}
+
+	base := []rune(name)
+
+	for i := 1; ; i++ {
+		suffix := ""
+		if i > 1 {
+			suffix = fmt.Sprintf(" (%d)", i)
+		}
+
+		name = string(base[:min(len(base), 31-len(suffix))]) + suffix
+
+		if !w.names[strings.ToLower(name)] {
+			w.names[strings.ToLower(name)] = true
+			return name
+		}
+	}
+}
+
+// Rows returns the number of rows of the sheet, including the header.
+func (s *Sheet) Rows() int {
+	return s.rows
+}
+
+// WriteString appends a string cell.
+func (s *Sheet) WriteString(v string) {
+	s.cell("inlineStr", 0, "<is><t>"+escape(v)+"</t></is>", len(v))
+}
+
+// WriteNumber appends a number cell, or an empty one for NaN and
+// infinities, which Excel has no numbers for.
+func (s *Sheet) WriteNumber(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		s.WriteEmpty()
+		return
+	}
+
+	n := strconv.FormatFloat(v, 'g', -1, 64)
+	s.cell("", 0, "<v>"+n+"</v>", len(n))
+}
+
+// WriteTime appends a date and time cell showing the wall clock of t.
+// Excel dates have no time zone.
+func (s *Sheet) WriteTime(t time.Time) {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	days := float64(wall.Sub(epoch)) / float64(24*time.Hour)
+
+	s.cell("", styleTime, "<v>"+strconv.FormatFloat(days, 'f', -1, 64)+"</v>", len("2006-01-02 15:04:05"))
+}
+
+// WriteEmpty skips a cell.
+func (s *Sheet) WriteEmpty() {
+	s.col++
+}
+
+// EndRow finishes the current row.
+func (s *Sheet) EndRow() {
+	if s.open {
+		s.buf.WriteString("</row>")
+	}
+
+	s.rows++
+	s.col, s.open = 0, false
+}
+
+func (s *Sheet) cell(typ string, style int, value string, width int) {
+	if !s.open {
+		fmt.Fprintf(&s.buf, `<row r="%d">`, s.rows+1)
+		s.open = true
+	}
+
+	fmt.Fprintf(&s.buf, `<c r="%s%d"`, column(s.col), s.rows+1)
+
+	if typ != "" {
+		fmt.Fprintf(&s.buf, ` t="%s"`, typ)
+	}
+
+	if style != 0 {
+		fmt.Fprintf(&s.buf, ` s="%d"`, style)
+	}
+
+	s.buf.WriteString(">" + value + "</c>")
+
+	if s.col < len(s.width) {
+		s.width[s.col] = max(s.width[s.col], width)
+	}
+
+	s.col++
+}
+
+// Close writes the workbook. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if len(w.sheets) == 0 {
+		w.AddSheet("Sheet", nil)
+	}
+
+	z := zip.NewWriter(w.w)
+
+	var types, sheets, rels strings.Builder
+
+	for i, s := range w.sheets {
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(w.sheets)+1)
+
+	files := []struct{ name, data string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", stylesXML},
+	}
+
+	for _, f := range files {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(fw, xml.Header+f.data); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range w.sheets {
+		fw, err := z.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(fw, xml.Header+s.head()); err != nil {
+			return err
+		}
+
+		if _, err := s.buf.WriteTo(fw); err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(fw, `</sheetData></worksheet>`); err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+// head returns the start of the sheet XML up to its rows: the frozen header
+// and column widths fitting the longest values.
+func (s *Sheet) head() string {
+	var b strings.Builder
+
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0">`)
+	b.WriteString(`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+	b.WriteString(`</sheetView></sheetViews>`)
+
+	if len(s.width) > 0 {
+		b.WriteString(`<cols>`)
+
+		for i, width := range s.width {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, min(width, 60)+2)
+		}
+
+		b.WriteString(`</cols>`)
+	}
+
+	b.WriteString(`<sheetData>`)
+
+	return b.String()
+}
+
+// stylesXML defines the default style, the bold shaded header and the date
+// and time format.
+const stylesXML = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFD9D9D9"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="2"><border><left/><right/><top/><bottom/><diagonal/></border>` +
+	`<border><left/><right/><top/><bottom style="thin"><color auto="1"/></bottom><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="1" xfId="0" applyFont="1" applyFill="1" applyBorder="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// column returns the letters of the zero based column.
+func column(i int) string {
+	var b []byte
+
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+
+	return string(b)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+
+	xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/internal/kafka"
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// kafkaCommitTimeout bounds the final offset commit on shutdown.
+const kafkaCommitTimeout = 10 * time.Second
+
+// kafkaTickReader reads ticks from the messages of a Kafka topic until ctx
+// is done. Offsets are committed to the group by commit, only after the
+// candles of their ticks are written, so a crash repeats ticks rather than
+// loses them.
+type kafkaTickReader struct {
+	ctx     context.Context
+	c       *kafka.Consumer
+	parse   func(msg []byte) (candles.Tick, error)
+	pending []kafka.Record
+	// read are the records read and not committed yet by partition, in
+	// offset order.
+	read map[int32][]readRecord
+}
+
+// readRecord is the offset of a read record and the time of its tick, zero
+// if it wasn't parsed.
+type readRecord struct {
+	offset int64
+	time   time.Time
+}
+
+func openKafkaSource(ctx context.Context, u connectorURL, parse func(msg []byte) (candles.Tick, error)) (tickReader, func() error, error) {
+	start := kafka.StartEarliest
+
+	switch u.Query.Get("start") {
+	case "", "earliest":
+	case "latest":
+		start = kafka.StartLatest
+	default:
+		return nil, nil, fmt.Errorf("kafka start must be earliest or latest: %q", u.Query.Get("start"))
+	}
+
+	c, err := kafka.NewConsumer(ctx, u.Hosts, u.Path, u.Query.Get("group"), start)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &kafkaTickReader{ctx: ctx, c: c, parse: parse, read: make(map[int32][]readRecord)}
+
+	return r, r.Close, nil
+}
+
+func (r *kafkaTickReader) Read() (candles.Tick, error) {
+	for len(r.pending) == 0 {
+		records, err := r.c.Fetch(r.ctx)
+		if err != nil {
+			return r.eof(err)
+		}
+
+		r.pending = records
+	}
+
+	rec := r.pending[0]
+	r.pending = r.pending[1:]
+
+	tick, err := r.parse(rec.Value)
+	r.read[rec.Partition] = append(r.read[rec.Partition], readRecord{offset: rec.Offset, time: tick.Time})
+
+	if err != nil {
+		return candles.Tick{}, &candles.ParseError{
+			File:   fmt.Sprintf("partition %d", rec.Partition),
+			Line:   int(rec.Offset),
+			Record: string(rec.Value),
+			Err:    err,
+		}
+	}
+
+	return tick, nil
+}
+
+// eof ends the input when ctx is done.
+func (r *kafkaTickReader) eof(err error) (candles.Tick, error) {
+	if r.ctx.Err() != nil {
+		return candles.Tick{}, io.EOF
+	}
+
+	return candles.Tick{}, err
+}
+
+// commit commits the offsets after the longest run of read records of each
+// partition whose ticks are closed, their candles written.
+func (r *kafkaTickReader) commit(closed func(time.Time) bool) error {
+	offsets := make(map[int32]int64)
+
+	for partition, records := range r.read {
+		n := 0
+		for n < len(records) && closed(records[n].time) {
+			n++
+		}
+
+		if n > 0 {
+			offsets[partition] = records[n-1].offset + 1
+			r.read[partition] = records[n:]
+		}
+	}
+
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	// The last offsets are committed even after an interrupt.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.ctx), kafkaCommitTimeout)
+	defer cancel()
+
+	return r.c.Commit(ctx, offsets)
+}
+
+// Close closes the consumer. Offsets not committed yet are read again by
+// the next consumer of the group.
+func (r *kafkaTickReader) Close() error {
+	return r.c.Close()
+}
+
+// kafkaCandleWriter produces candles keyed by instrument ID to a Kafka
+// topic, one produce request per Flush.
+type kafkaCandleWriter struct {
+	ctx     context.Context
+	p       *kafka.Producer
+	avro    bool
+	pending []kafka.Record
+}
+
+func newKafkaCandleWriter(ctx context.Context, u connectorURL) (*kafkaCandleWriter, error) {
+	w := &kafkaCandleWriter{ctx: ctx}
+
+	switch u.Query.Get("format") {
+	case "", "json":
+	case "avro":
+		w.avro = true
+	default:
+		return nil, fmt.Errorf("kafka format must be json or avro: %q", u.Query.Get("format"))
+	}
+
+	var err error
+
+	if w.p, err = kafka.NewProducer(ctx, u.Hosts, u.Path); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *kafkaCandleWriter) Write(c candles.Candle) error {
+	var (
+		value []byte
+		err   error
+	)
+
+	if w.avro {
+		value = appendAvroCandle(nil, c)
+	} else if value, err = json.Marshal(c); err != nil {
+		return err
+	}
+
+	w.pending = append(w.pending, kafka.Record{Key: []byte(c.ID), Value: value, Time: time.Now()})
+
+	return nil
+}
+
+func (w *kafkaCandleWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	// The last candles are produced even after an interrupt.
+	err := w.p.Produce(context.WithoutCancel(w.ctx), w.pending)
+	w.pending = w.pending[:0]
+
+	return err
+}
+
+func (w *kafkaCandleWriter) Close() error {
+	defer w.p.Close()
+
+	return w.Flush()
+}
+
+// appendAvroCandle appends the Avro binary encoding of a candle record of
+// id, open, high, low, close, volume, time as timestamp-millis and
+// interval, see README.
+func appendAvroCandle(dst []byte, c candles.Candle) []byte {
+	dst = appendAvroString(dst, c.ID)
+
+	for _, v := range []float64{c.Open, c.High, c.Low, c.Close, c.Volume} {
+		dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+	}
+
+	dst = binary.AppendVarint(dst, c.Time.UnixMilli())
+
+	return appendAvroString(dst, c.Interval.String())
+}
+
+func appendAvroString(dst []byte, s string) []byte {
+	dst = binary.AppendVarint(dst, int64(len(s)))
+	return append(dst, s...)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// listenReader reads the tick lines local processes write into the
+// connections of a socket until ctx is done. Any number of writers may be
+// connected; each line is a tick in the -input-format as in -source
+// messages, and the lines of different connections interleave.
+type listenReader struct {
+	ctx   context.Context
+	ln    net.Listener
+	parse func(msg []byte) (candles.Tick, error)
+	lines chan listenLine
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+}
+
+// listenLine is a line read from a connection.
+type listenLine struct {
+	conn int
+	line int
+	text string
+}
+
+// openListen listens on unix:///path/to.sock, replacing a stale socket
+// file, or on tcp://host:port.
+func openListen(ctx context.Context, address string, in inputOptions) (tickReader, func() error, error) {
+	network, addr, ok := strings.Cut(address, "://")
+	if !ok || network != "unix" && network != "tcp" {
+		return nil, nil, fmt.Errorf("listen address must be unix:///path or tcp://host:port: %q", address)
+	}
+
+	parse, err := messageParser(in.format, in.csv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parse = in.trace.parser(parse)
+
+	if network == "unix" {
+		if info, err := os.Stat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr)
+		}
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &listenReader{ctx: ctx, ln: ln, parse: parse, lines: make(chan listenLine), conns: make(map[net.Conn]bool)}
+
+	r.wg.Add(1)
+	go r.accept()
+
+	slog.Info("listening for ticks", "address", address)
+
+	return r, r.Close, nil
+}
+
+func (r *listenReader) accept() {
+	defer r.wg.Done()
+
+	for n := 1; ; n++ {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			if r.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				slog.Warn("listen: accept failed", "err", err)
+				continue
+			}
+
+			return
+		}
+
+		r.mu.Lock()
+		r.conns[conn] = true
+		r.mu.Unlock()
+
+		r.wg.Add(1)
+		go r.serve(conn, n)
+	}
+}
+
+// serve reads the lines of a connection until the writer closes it.
+func (r *listenReader) serve(conn net.Conn, n int) {
+	defer r.wg.Done()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, conn)
+		r.mu.Unlock()
+
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		select {
+		case r.lines <- listenLine{conn: n, line: line, text: text}:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil && r.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+		slog.Warn("listen: connection failed", "conn", n, "err", err)
+	}
+}
+
+func (r *listenReader) Read() (candles.Tick, error) {
+	select {
+	case <-r.ctx.Done():
+		return candles.Tick{}, io.EOF
+	case l := <-r.lines:
+		tick, err := r.parse([]byte(l.text))
+		if err != nil {
+			return candles.Tick{}, &candles.ParseError{
+				File:   fmt.Sprintf("connection %d", l.conn),
+				Line:   l.line,
+				Record: l.text,
+				Err:    err,
+			}
+		}
+
+		return tick, nil
+	}
+}
+
+// Close stops listening and drops the connections.
+func (r *listenReader) Close() error {
+	err := r.ln.Close()
+
+	r.mu.Lock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	return err
+}
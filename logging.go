@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/tinkoff"
+)
+
+// logFlags are the logging flags every command has.
+type logFlags struct {
+	level  *string
+	format *string
+}
+
+func addLogFlags(fs *flag.FlagSet) logFlags {
+	return logFlags{
+		level:  fs.String("log-level", "info", "least severe messages logged to stderr: debug, info, warn or error"),
+		format: fs.String("log-format", "text", "format of log messages: text or json, a JSON object per line"),
+	}
+}
+
+// setupLogging sets the default logger as the flags ask for. Messages of
+// the log package go through it at the info level.
+func setupLogging(f logFlags) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(*f.level)); err != nil {
+		usagef("bad -log-level %q, want debug, info, warn or error", *f.level)
+	}
+
+	switch strings.ToLower(*f.format) {
+	case "text":
+		// The default handler, writing through the log package.
+		slog.SetLogLoggerLevel(level)
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	default:
+		usage(fmt.Errorf("unknown log format: %s", *f.format))
+	}
+}
+
+// newTinkoffClient returns an API client logging its retries and
+// reconnects.
+func newTinkoffClient(token string) *tinkoff.Client {
+	c := tinkoff.NewClient(token)
+
+	c.OnRetry = func(method string, status int, delay time.Duration) {
+		slog.Warn("tinkoff api: retrying", "method", method, "status", status, "delay", delay)
+	}
+
+	c.OnReconnect = func(err error, delay time.Duration) {
+		slog.Warn("tinkoff stream: connection lost, reconnecting", "err", err, "delay", delay)
+	}
+
+	return c
+}
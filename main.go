@@ -1,260 +1,190 @@
 package main
 
 import (
-	"bufio"
-	"encoding/csv"
+	"context"
+	"flag"
 	"fmt"
-	"log"
-	"math"
+	"io"
 	"os"
-	"sort"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
-)
-
-type inputLine struct {
-	ID    string
-	Coast float64
-	Time  time.Time
-}
 
-type candle struct {
-	ID         string
-	StartCoast float64
-	EndCoast   float64
-	MinCoast   float64
-	MaxCoast   float64
-	Time       time.Time
-	Interval   time.Duration
-}
-
-func (c candle) ToCSV() []string {
-	return []string{
-		c.ID,
-		fmt.Sprintf("%.2f", c.StartCoast),
-		fmt.Sprintf("%.2f", c.MaxCoast),
-		fmt.Sprintf("%.2f", c.MinCoast),
-		fmt.Sprintf("%.2f", c.EndCoast),
-		c.Time.Format(time.RFC3339),
-		formatInterval(c.Interval),
-	}
-}
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
 
 func main() {
-	var (
-		inputLines []inputLine
-		scanner    = bufio.NewScanner(os.Stdin)
-	)
-
-	for scanner.Scan() {
-		line := scanner.Text()
+	name, args := "aggregate", os.Args[1:]
 
-		if line == "" {
-			break
-		}
-
-		lineParts := strings.Split(line, ",")
-		if len(lineParts) < 3 {
-			log.Fatalf("bad user input: %s", line)
-		}
+	if len(args) > 0 && findCommand(args[0]) != nil {
+		name, args = args[0], args[1:]
+	}
 
-		coast, err := strconv.ParseFloat(lineParts[1], 64)
-		if err != nil {
-			log.Fatal(err)
+	if name == "help" {
+		if len(args) == 0 {
+			printCommands(os.Stdout)
+			return
 		}
 
-		t, err := time.Parse(time.RFC3339, lineParts[2])
-		if err != nil {
-			log.Fatal(err)
+		if findCommand(args[0]) == nil {
+			usagef("help: unknown command %q", args[0])
 		}
 
-		inputLines = append(inputLines, inputLine{
-			ID:    lineParts[0],
-			Coast: coast,
-			Time:  t,
-		})
+		name, args = args[0], []string{"-h"}
 	}
 
-	candles := solution(inputLines)
-
-	w := csv.NewWriter(os.Stdout)
-	w.Comma = ','
-	defer w.Flush()
+	findCommand(name).run(args)
+	stopProfiling()
+}
 
-	for _, candle := range candles {
-		if err := w.Write(candle.ToCSV()); err != nil {
-			log.Fatal(err)
+func writeCandles(w candleWriter, result []candles.Candle) {
+	for _, candle := range result {
+		if err := w.Write(candle); err != nil {
+			fatal(err)
 		}
 	}
 }
 
-func solution(inputLines []inputLine) []candle {
-	idLinesMap := make(map[string][]inputLine)
+func parseDelimiter(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
 
-	for _, line := range inputLines {
-		idLinesMap[line.ID] = append(idLinesMap[line.ID], line)
+	r := []rune(s)
+	if len(r) != 1 {
+		return 0, fmt.Errorf("delimiter must be a single character: %q", s)
 	}
 
-	idCandlesMap := make(map[string][]candle)
+	return r[0], nil
+}
 
-	for id, lines := range idLinesMap {
-		times := make([]time.Time, len(lines))
+// parseFormat parses the -scale and -rounding flags into a price format.
+func parseFormat(precision candles.Precision, scale, rounding string) (candles.Format, error) {
+	format := candles.Format{Precision: precision, Scale: candles.DefaultFormat.Scale}
 
-		for i := 0; i < len(lines); i++ {
-			times[i] = lines[i].Time
+	if scale == "auto" {
+		format.AutoScale = true
+	} else {
+		n, err := strconv.Atoi(scale)
+		if err != nil || n < 0 || n > 9 {
+			return candles.Format{}, fmt.Errorf("scale must be auto or from 0 to 9: %q", scale)
 		}
 
-		intervals := makeIntervals(times)
-
-		for i := 0; i < len(intervals); i++ {
-			dur := intervals[i]
-			timeSet := make(map[time.Time]struct{})
-
-			for _, t := range times {
-				startTime := t.Truncate(dur)
-				endTime := startTime.Add(dur)
-
-				if _, ok := timeSet[startTime]; ok {
-					continue
-				}
-
-				timeSet[startTime] = struct{}{}
-
-				idCandlesMap[id] = append(idCandlesMap[id], candle{
-					ID:         id,
-					StartCoast: startCoastOnInterval(startTime, endTime, lines),
-					EndCoast:   endCoastOnInterval(startTime, endTime, lines),
-					MinCoast:   minOnInterval(startTime, endTime, lines),
-					MaxCoast:   maxOnInterval(startTime, endTime, lines),
-					Time:       startTime,
-					Interval:   dur,
-				})
-			}
-		}
+		format.Scale = n
 	}
 
-	var result []candle
-
-	for _, candles := range idCandlesMap {
-		result = append(result, candles...)
-	}
+	var err error
 
-	sort.Slice(result, func(i, j int) bool {
-		if result[i].ID != result[j].ID {
-			return result[i].ID < result[j].ID
-		}
-		if result[i].Interval != result[j].Interval {
-			return result[i].Interval < result[j].Interval
-		}
-		return result[i].Time.Before(result[j].Time)
-	})
+	format.Rounding, err = candles.ParseRounding(rounding)
 
-	return result
+	return format, err
 }
 
-func makeIntervals(times []time.Time) []time.Duration {
-	durTimeSet := make(map[time.Duration]map[time.Time]struct{})
-
-	for _, dur := range []time.Duration{time.Minute, 2 * time.Minute, 5 * time.Minute} {
-		for i := 0; i < len(times)-1; i++ {
-			t2 := times[i+1].Truncate(dur)
-			t1 := times[i].Truncate(dur)
-			curDur := t2.Sub(t1)
-
-			if curDur == 0 {
-				curDur = dur
-			}
-
-			if durTimeSet[curDur] == nil {
-				durTimeSet[curDur] = make(map[time.Time]struct{})
-			}
-
-			durTimeSet[curDur][t1] = struct{}{}
-			durTimeSet[curDur][t2] = struct{}{}
-		}
-	}
-
-	result := make([]time.Duration, 0, len(durTimeSet))
-
-	for dur, times := range durTimeSet {
-		if len(times) < 2 {
-			continue
-		}
+// signalContext returns a context cancelled by SIGINT or SIGTERM. The first
+// signal restores the default handling, so a second one kills the process
+// if the shutdown hangs.
+func signalContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 
-		result = append(result, dur)
-	}
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	return result
+	return ctx
 }
 
-func minOnInterval(startTime, endTime time.Time, lines []inputLine) float64 {
-	min := math.MaxFloat64
-
-	for i := 0; i < len(lines); i++ {
-		curTime := lines[i].Time.Unix()
+// clockPeriod returns how often live streams advance the aggregator clock:
+// every second, or as often as the shortest sub-second interval ends.
+func clockPeriod(intervals []candles.Interval) time.Duration {
+	period := time.Second
 
-		if startTime.Unix() <= curTime && curTime < endTime.Unix() {
-			if lines[i].Coast < min {
-				min = lines[i].Coast
-			}
+	for _, interval := range intervals {
+		if !interval.IsCalendar() {
+			period = min(period, interval.Duration)
 		}
 	}
 
-	return min
+	return period
 }
 
-func maxOnInterval(startTime, endTime time.Time, lines []inputLine) float64 {
-	max := -1.0
-
-	for i := 0; i < len(lines); i++ {
-		curTime := lines[i].Time.Unix()
+// command is a subcommand of the binary.
+type command struct {
+	name string
+	// args describes the arguments after the flags.
+	args    string
+	summary string
+	run     func(args []string)
+}
 
-		if startTime.Unix() <= curTime && curTime < endTime.Unix() {
-			if lines[i].Coast > max {
-				max = lines[i].Coast
-			}
-		}
+// commands are the subcommands; aggregate runs when none is named. They are
+// set in init, as their usage refers to them.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"aggregate", "[ticks.csv...]", "build candles from ticks read from files or stdin (the default)", runAggregate},
+		{"fetch", "", "download historical candles from the Tinkoff API", runFetch},
+		{"stream", "", "build candles from live Tinkoff market data", runStream},
+		{"instruments", "ticker|figi...", "look up Tinkoff instruments by ticker or FIGI", runInstruments},
+		{"query", "", "read candles from a SQLite store", runQuery},
+		{"serve", "", "serve candles over HTTP and websocket", runServe},
+		{"serve-grpc", "", "build candles of the ticks of gRPC clients", runServeGRPC},
+		{"quality", "[ticks.csv...]", "report data quality problems of ticks", runQuality},
+		{"stats", "[ticks.csv...]", "summarize ticks by instrument", runStats},
+		{"resample", "[candles.csv...]", "build candles of longer intervals from candles", runResample},
+		{"validate", "[candles.csv...]", "check candles for consistency", runValidate},
+		{"diff", "ours.csv reference.csv", "compare two candle files", runDiff},
+		{"merge", "a.csv b.csv...", "combine candle files of overlapping runs", runMerge},
+		{"chart", "[candles.csv...]", "draw candles in the terminal or into an image", runChart},
+		{"report", "[candles.csv...]", "write an HTML report of candles", runReport},
+		{"gen", "", "generate synthetic ticks for benchmarks and tests", runGen},
+		{"bench", "[ticks.csv...]", "measure the aggregation throughput on given or generated ticks", runBench},
+		{"help", "[command]", "show the commands or the flags of a command", nil},
 	}
-
-	return max
 }
 
-func startCoastOnInterval(startTime, endTime time.Time, lines []inputLine) float64 {
-	for i := 0; i < len(lines); i++ {
-		curTime := lines[i].Time.Unix()
-
-		if startTime.Unix() <= curTime && curTime < endTime.Unix() {
-			return lines[i].Coast
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
 		}
 	}
 
-	return -1.0
+	return nil
 }
 
-func endCoastOnInterval(startTime, endTime time.Time, lines []inputLine) float64 {
-	for i := len(lines) - 1; i >= 0; i-- {
-		curTime := lines[i].Time.Unix()
+// printCommands writes the list of commands.
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "usage: tinkoff_candles [command] [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
 
-		if startTime.Unix() <= curTime && curTime < endTime.Unix() {
-			return lines[i].Coast
-		}
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
 	}
 
-	return -1.0
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "tinkoff_candles help <command>" for the flags of a command.`)
 }
 
-func formatInterval(interval time.Duration) string {
-	result := interval.String()
-	idx := strings.Index(result, "m")
+// commandUsage writes the usage of the command of fs with its flags.
+func commandUsage(fs *flag.FlagSet) {
+	c := findCommand(fs.Name())
+	w := fs.Output()
 
-	if idx == -1 {
-		return result
-	}
+	fmt.Fprintf(w, "usage: tinkoff_candles %s [flags] %s\n\n%s%s.\n\nflags:\n", c.name, c.args, strings.ToUpper(c.summary[:1]), c.summary[1:])
+	fs.PrintDefaults()
 
-	if idx == len(result)-1 {
-		return result
+	if c.name == "aggregate" {
+		fmt.Fprintln(w)
+		printCommands(w)
 	}
-
-	return result[:idx+1]
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	inputFormat := fs.String("input-format", "csv", "input format of all files: csv, jsonl or proto")
+	inputHeader := fs.Bool("input-header", false, "the first CSV row of all files names the columns")
+	outputFormat := fs.String("output-format", "csv", "output format: csv, jsonl, parquet, proto, arrow or xlsx")
+	header := fs.Bool("header", false, "write a header row to the CSV output")
+	columnsFlag := fs.String("columns", strings.Join(candles.DefaultColumns, ","), "comma separated CSV output columns")
+	strict := fs.Bool("strict", false, "fail if candles of the files conflict instead of warning")
+	parseFlags(fs, args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		usagef("merge: at least two candle files are required")
+	}
+
+	columns, err := candles.ParseColumns(*columnsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	result, err := readCandles(fs.Args()[:1], *inputFormat, *inputHeader)
+	if err != nil {
+		fatal(err)
+	}
+
+	conflicts := 0
+
+	for _, name := range fs.Args()[1:] {
+		next, err := readCandles([]string{name}, *inputFormat, *inputHeader)
+		if err != nil {
+			fatal(err)
+		}
+
+		merged, found := candles.MergeConflicts(result, next)
+
+		for _, c := range found {
+			slog.Warn("conflicting candles", "candle", describeCandle(c.A), "file", name,
+				"a", describeOHLCV(c.A), "b", describeOHLCV(c.B), "kept", describeOHLCV(c.Kept))
+		}
+
+		result = merged
+		conflicts += len(found)
+	}
+
+	if conflicts > 0 && *strict {
+		fatal(fmt.Errorf("merge: %d conflicting candles", conflicts))
+	}
+
+	w, err := newCandleWriter(*outputFormat, os.Stdout, writerOptions{columns: columns, header: *header})
+	if err != nil {
+		usage(err)
+	}
+
+	writeCandles(w, result)
+
+	if err := w.Close(); err != nil {
+		fatal(err)
+	}
+}
+
+// describeOHLCV formats the prices, volume and tick count of a candle.
+func describeOHLCV(c candles.Candle) string {
+	return fmt.Sprintf("o=%g h=%g l=%g c=%g v=%g n=%d", c.Open, c.High, c.Low, c.Close, c.Volume, c.Count)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// natsAckTimeout bounds the wait for the JetStream acknowledgements of the
+// candles of a Flush.
+const natsAckTimeout = 30 * time.Second
+
+// natsServers returns the server URLs of the connector address.
+func natsServers(u connectorURL) string {
+	servers := make([]string, len(u.Hosts))
+
+	for i, host := range u.Hosts {
+		servers[i] = "nats://" + host
+	}
+
+	return strings.Join(servers, ",")
+}
+
+// natsTickReader reads ticks from the messages of a NATS subject until ctx
+// is done. The subscription is a plain one: messages published while the
+// tool isn't running are lost.
+type natsTickReader struct {
+	ctx   context.Context
+	nc    *nats.Conn
+	sub   *nats.Subscription
+	parse func(msg []byte) (candles.Tick, error)
+	// n is the number of read messages.
+	n int
+}
+
+// openNATSSource subscribes to the subject of the path, such as ticks.>.
+// With the queue parameter the messages are shared by the subscribers of
+// the queue group.
+func openNATSSource(ctx context.Context, u connectorURL, parse func(msg []byte) (candles.Tick, error)) (tickReader, func() error, error) {
+	if u.Path == "" {
+		return nil, nil, fmt.Errorf("nats source needs a subject: nats://host:4222/ticks.>")
+	}
+
+	nc, err := nats.Connect(natsServers(u), nats.Name("tinkoff_candles"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sub *nats.Subscription
+
+	if queue := u.Query.Get("queue"); queue != "" {
+		sub, err = nc.QueueSubscribeSync(u.Path, queue)
+	} else {
+		sub, err = nc.SubscribeSync(u.Path)
+	}
+
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+
+	r := &natsTickReader{ctx: ctx, nc: nc, sub: sub, parse: parse}
+
+	return r, r.Close, nil
+}
+
+func (r *natsTickReader) Read() (candles.Tick, error) {
+	msg, err := r.sub.NextMsgWithContext(r.ctx)
+	if err != nil {
+		if r.ctx.Err() != nil {
+			return candles.Tick{}, io.EOF
+		}
+
+		return candles.Tick{}, err
+	}
+
+	r.n++
+
+	tick, err := r.parse(msg.Data)
+	if err != nil {
+		return candles.Tick{}, &candles.ParseError{File: msg.Subject, Line: r.n, Record: string(msg.Data), Err: err}
+	}
+
+	return tick, nil
+}
+
+func (r *natsTickReader) Close() error {
+	r.nc.Close()
+	return nil
+}
+
+// natsCandleWriter publishes candles as JSON to JetStream subjects such as
+// candles.SBER.1m, waiting for the acknowledgements on Flush.
+type natsCandleWriter struct {
+	nc      *nats.Conn
+	js      jetstream.JetStream
+	prefix  string
+	pending []jetstream.PubAckFuture
+}
+
+// newNATSCandleWriter returns a writer publishing under the subject prefix
+// of the path, candles by default. With the stream parameter a stream of
+// that name capturing the subjects is created unless it exists; otherwise
+// a stream must already capture them.
+func newNATSCandleWriter(ctx context.Context, u connectorURL) (*natsCandleWriter, error) {
+	nc, err := nats.Connect(natsServers(u), nats.Name("tinkoff_candles"))
+	if err != nil {
+		return nil, err
+	}
+
+	w := &natsCandleWriter{nc: nc, prefix: "candles"}
+
+	if u.Path != "" {
+		w.prefix = u.Path
+	}
+
+	if w.js, err = jetstream.New(nc); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	if name := u.Query.Get("stream"); name != "" {
+		if err := w.createStream(ctx, name); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("nats stream %s: %w", name, err)
+		}
+	}
+
+	return w, nil
+}
+
+func (w *natsCandleWriter) createStream(ctx context.Context, name string) error {
+	_, err := w.js.Stream(ctx, name)
+	if !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return err
+	}
+
+	_, err = w.js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:     name,
+		Subjects: []string{w.prefix + ".>"},
+		Storage:  jetstream.FileStorage,
+	})
+
+	return err
+}
+
+// subject returns the subject of the candle. Activity driven bars have no
+// interval.
+func (w *natsCandleWriter) subject(c candles.Candle) string {
+	subject := w.prefix + "." + natsToken(c.ID)
+
+	if s := c.Interval.String(); s != "" {
+		subject += "." + s
+	}
+
+	return subject
+}
+
+// natsToken replaces the characters of s that can't be in a subject token.
+func natsToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+
+		return r
+	}, s)
+}
+
+func (w *natsCandleWriter) Write(c candles.Candle) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	ack, err := w.js.PublishAsync(w.subject(c), data)
+	if err != nil {
+		return err
+	}
+
+	w.pending = append(w.pending, ack)
+
+	return nil
+}
+
+func (w *natsCandleWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	defer func() { w.pending = w.pending[:0] }()
+
+	// The last candles are acknowledged even after an interrupt.
+	timeout := time.After(natsAckTimeout)
+
+	for _, ack := range w.pending {
+		select {
+		case <-ack.Ok():
+		case err := <-ack.Err():
+			return fmt.Errorf("nats publish %s: %w", ack.Msg().Subject, err)
+		case <-timeout:
+			return fmt.Errorf("nats publish: no acknowledgement in %s", natsAckTimeout)
+		}
+	}
+
+	return nil
+}
+
+func (w *natsCandleWriter) Close() error {
+	defer w.nc.Close()
+
+	return w.Flush()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/internal/objstore"
+)
+
+// expandObjects returns the objects an s3:// or gs:// input argument
+// stands for: all objects under a key ending with a slash, the objects
+// matching a key with glob characters, or else the object itself.
+func expandObjects(arg string) ([]string, error) {
+	u, err := objstore.Parse(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	glob := strings.ContainsAny(u.Key, "*?[")
+	if !glob && u.Key != "" && !strings.HasSuffix(u.Key, "/") {
+		return []string{arg}, nil
+	}
+
+	prefix := u
+	if glob {
+		prefix.Key = u.Key[:strings.IndexAny(u.Key, "*?[")]
+	}
+
+	objects, err := objstore.List(context.Background(), prefix.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	for _, object := range objects {
+		key := strings.TrimPrefix(object, u.Scheme+"://"+u.Bucket+"/")
+
+		// Skip the markers of directories created by consoles.
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		if glob {
+			if ok, err := path.Match(u.Key, key); err != nil || !ok {
+				continue
+			}
+		}
+
+		result = append(result, object)
+	}
+
+	return result, nil
+}
+
+// joinOutput joins an output directory, local or an object prefix, and a
+// file name.
+func joinOutput(dir, name string) string {
+	if objstore.IsURI(dir) {
+		return strings.TrimSuffix(dir, "/") + "/" + name
+	}
+
+	return filepath.Join(dir, name)
+}
+
+// cleanOutput cleans an output path, local or an object URI.
+func cleanOutput(name string) string {
+	if scheme, rest, ok := strings.Cut(name, "://"); ok && objstore.IsURI(name) {
+		return scheme + "://" + path.Clean(rest)
+	}
+
+	return filepath.Clean(name)
+}
+
+// uploadFile uploads the local file as the object.
+func uploadFile(name, uri string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return objstore.Put(context.Background(), uri, f, info.Size())
+}
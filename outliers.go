@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// outliers drops the bad prints of -outliers and optionally writes them
+// with the median they deviate from to a CSV file: id,price,time,median.
+type outliers struct {
+	filter  *candles.OutlierFilter
+	dropped int
+	f       *os.File
+	w       *csv.Writer
+}
+
+func newOutliers(spec candles.OutlierSpec, path string) (*outliers, error) {
+	o := &outliers{filter: candles.NewOutlierFilter(spec)}
+
+	if path == "" {
+		return o, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	o.f = f
+	o.w = csv.NewWriter(f)
+
+	return o, o.w.Write([]string{"id", "price", "time", "median"})
+}
+
+// drop reports whether tick is an outlier, recording it if so.
+func (o *outliers) drop(tick candles.Tick) (bool, error) {
+	median, outlier := o.filter.Check(tick)
+	if !outlier {
+		return false, nil
+	}
+
+	o.dropped++
+	slog.Debug("dropped outlier tick", "id", tick.ID, "price", tick.Price, "time", tick.Time, "median", median)
+
+	if o.w == nil {
+		return true, nil
+	}
+
+	return true, o.w.Write([]string{
+		tick.ID,
+		strconv.FormatFloat(tick.Price, 'f', -1, 64),
+		tick.Time.Format(time.RFC3339Nano),
+		strconv.FormatFloat(median, 'f', -1, 64),
+	})
+}
+
+func (o *outliers) Close() error {
+	if o.f == nil {
+		return nil
+	}
+
+	o.w.Flush()
+
+	if err := o.w.Error(); err != nil {
+		o.f.Close()
+		return err
+	}
+
+	return o.f.Close()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/internal/parquet"
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// parquetRowGroupSize is the number of candles buffered before they are
+// written as a row group.
+const parquetRowGroupSize = 1 << 16
+
+var parquetColumns = []parquet.Column{
+	{Name: "id", Type: parquet.ByteArray, Converted: parquet.UTF8},
+	{Name: "open", Type: parquet.Double, Converted: parquet.None},
+	{Name: "high", Type: parquet.Double, Converted: parquet.None},
+	{Name: "low", Type: parquet.Double, Converted: parquet.None},
+	{Name: "close", Type: parquet.Double, Converted: parquet.None},
+	{Name: "volume", Type: parquet.Double, Converted: parquet.None},
+	{Name: "time", Type: parquet.Int64, Converted: parquet.TimestampMicros},
+	{Name: "interval", Type: parquet.ByteArray, Converted: parquet.UTF8},
+}
+
+// parquetCandleWriter writes candles into a single Parquet file or, when
+// dir is set, into files partitioned by instrument and date in the Hive
+// layout: dir/id=SBER/date=2023-04-11/candles.parquet.
+type parquetCandleWriter struct {
+	w          io.Writer
+	dir        string
+	columns    []parquet.Column
+	extra      []string
+	indicators []string
+	patterns   bool
+
+	single     *parquet.Writer
+	partitions map[string]*parquetPartition
+}
+
+type parquetPartition struct {
+	f  *os.File
+	pw *parquet.Writer
+}
+
+func newParquetCandleWriter(w io.Writer, dir string, opts writerOptions) *parquetCandleWriter {
+	columns := parquetColumns[:len(parquetColumns):len(parquetColumns)]
+
+	for _, name := range opts.extra {
+		switch extraType(name) {
+		case "int":
+			columns = append(columns, parquet.Column{Name: name, Type: parquet.Int64, Converted: parquet.None})
+		case "time":
+			columns = append(columns, parquet.Column{Name: name, Type: parquet.Int64, Converted: parquet.TimestampMicros})
+		default:
+			columns = append(columns, parquet.Column{Name: name, Type: parquet.Double, Converted: parquet.None})
+		}
+	}
+
+	for _, name := range opts.indicators {
+		columns = append(columns, parquet.Column{Name: name, Type: parquet.Double, Converted: parquet.None})
+	}
+
+	if opts.patterns {
+		columns = append(columns, parquet.Column{Name: "patterns", Type: parquet.ByteArray, Converted: parquet.UTF8})
+	}
+
+	return &parquetCandleWriter{
+		w:          w,
+		dir:        dir,
+		columns:    columns,
+		extra:      opts.extra,
+		indicators: opts.indicators,
+		patterns:   opts.patterns,
+		partitions: make(map[string]*parquetPartition),
+	}
+}
+
+func (w *parquetCandleWriter) Write(c candles.Candle) error {
+	pw, err := w.writer(c)
+	if err != nil {
+		return err
+	}
+
+	pw.WriteString(0, c.ID)
+	pw.WriteDouble(1, c.Open)
+	pw.WriteDouble(2, c.High)
+	pw.WriteDouble(3, c.Low)
+	pw.WriteDouble(4, c.Close)
+	pw.WriteDouble(5, c.Volume)
+	pw.WriteInt64(6, c.Time.UnixMicro())
+	pw.WriteString(7, c.Interval.String())
+
+	for i, name := range w.extra {
+		switch extraType(name) {
+		case "int":
+			pw.WriteInt64(len(parquetColumns)+i, extraInt(c, name))
+		case "time":
+			// The columns aren't nullable: filled gaps, without ticks, get
+			// the epoch.
+			var micros int64
+			if t := extraTime(c, name); !t.IsZero() {
+				micros = t.UnixMicro()
+			}
+
+			pw.WriteInt64(len(parquetColumns)+i, micros)
+		default:
+			pw.WriteDouble(len(parquetColumns)+i, extraFloat(c, name))
+		}
+	}
+
+	for i, name := range w.indicators {
+		v, ok := c.Indicators[name]
+		if !ok {
+			v = math.NaN()
+		}
+
+		pw.WriteDouble(len(parquetColumns)+len(w.extra)+i, v)
+	}
+
+	if w.patterns {
+		pw.WriteString(len(w.columns)-1, strings.Join(c.Patterns, "|"))
+	}
+
+	pw.EndRow()
+
+	if pw.Rows() >= parquetRowGroupSize {
+		return pw.Flush()
+	}
+
+	return nil
+}
+
+func (w *parquetCandleWriter) writer(c candles.Candle) (*parquet.Writer, error) {
+	if w.dir == "" {
+		if w.single == nil {
+			pw, err := parquet.NewWriter(w.w, w.columns)
+			if err != nil {
+				return nil, err
+			}
+
+			w.single = pw
+		}
+
+		return w.single, nil
+	}
+
+	path := filepath.Join(w.dir, "id="+c.ID, "date="+c.Time.Format("2006-01-02"), "candles.parquet")
+
+	if p, ok := w.partitions[path]; ok {
+		return p.pw, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pw, err := parquet.NewWriter(f, w.columns)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	w.partitions[path] = &parquetPartition{f: f, pw: pw}
+
+	return pw, nil
+}
+
+// Flush is a no-op: a Parquet file can only be read once it is closed.
+func (w *parquetCandleWriter) Flush() error {
+	return nil
+}
+
+func (w *parquetCandleWriter) Close() error {
+	if w.dir == "" {
+		if w.single == nil {
+			pw, err := parquet.NewWriter(w.w, w.columns)
+			if err != nil {
+				return err
+			}
+
+			w.single = pw
+		}
+
+		return w.single.Close()
+	}
+
+	var result error
+
+	for path, p := range w.partitions {
+		if err := p.pw.Close(); err != nil && result == nil {
+			result = fmt.Errorf("%s: %w", path, err)
+		}
+
+		if err := p.f.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,382 @@
+package candles
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Aggregate builds candles from ticks in any order; ticks with equal times
+// are ordered by sequence number, then keep their input order. Cancel and
+// amend ticks correct the trades before them, see ApplyCorrections. The result
+// is sorted by ID, then by interval, then by time. Instruments are
+// aggregated concurrently by the number of workers set with WithWorkers.
+func Aggregate(ticks []Tick, opts ...Option) []Candle {
+	result, _ := AggregateContext(context.Background(), ticks, opts...)
+	return result
+}
+
+// AggregateContext is like Aggregate but stops early and returns ctx.Err()
+// when ctx is done.
+func AggregateContext(ctx context.Context, ticks []Tick, opts ...Option) ([]Candle, error) {
+	cfg := newConfig(opts)
+	symbols := NewSymbols()
+	ticks, _ = ApplyCorrections(ticks)
+
+	var idTicks [][]Tick
+
+	for _, tick := range ticks {
+		sym := symbols.Symbol(tick.ID)
+		if sym == len(idTicks) {
+			idTicks = append(idTicks, nil)
+		}
+
+		// The candles share the table's copy of the ID.
+		tick.ID = symbols.Name(sym)
+		idTicks[sym] = append(idTicks[sym], tick)
+	}
+
+	idCandles := make([][]Candle, len(idTicks))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < cfg.workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				idCandles[i] = aggregateID(ctx, idTicks[i], cfg)
+			}
+		}()
+	}
+
+	for i := range idTicks {
+		select {
+		case jobs <- i:
+			continue
+		case <-ctx.Done():
+		}
+
+		break
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var result []Candle
+
+	for _, candles := range idCandles {
+		result = append(result, candles...)
+	}
+
+	sortCandles(result)
+
+	if cfg.carryOpen != CarryNone {
+		result = carryOpen(result, cfg)
+	}
+
+	if cfg.fillGaps {
+		result = fillGaps(result, cfg.schedule, cfg.calendar)
+	}
+
+	return result, nil
+}
+
+// aggregateID builds the candles of a single instrument. It returns early
+// when ctx is done.
+func aggregateID(ctx context.Context, ticks []Tick, cfg config) []Candle {
+	n := 0
+
+	for _, tick := range ticks {
+		if tick, ok := cfg.prepare(tick); ok {
+			ticks[n] = tick
+			n++
+		}
+	}
+
+	if ticks = ticks[:n]; len(ticks) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(ticks, func(i, j int) bool {
+		return ticks[i].Before(ticks[j])
+	})
+
+	intervals := cfg.intervals
+
+	if cfg.autoIntervals {
+		times := make([]time.Time, len(ticks))
+
+		for i := 0; i < len(ticks); i++ {
+			times[i] = ticks[i].Time
+		}
+
+		intervals = autoIntervals(times, intervals, cfg.location)
+	}
+
+	return appendCandles(ctx, nil, ticks, intervals, cfg)
+}
+
+// AggregateSorted aggregates the ticks of a single instrument like
+// Aggregate without holding them in memory. open returns a Source of the
+// ticks ordered by Tick.Before, those equal in both in input order, and is
+// called once per interval, so that only the open candle is kept. The
+// candles are passed to emit in the order of Aggregate. WithAutoIntervals
+// and WithWorkers have no effect.
+func AggregateSorted(ctx context.Context, open func() (Source, error), emit func(Candle) error, opts ...Option) error {
+	cfg := newConfig(opts)
+	intervals := slices.Clone(cfg.intervals)
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].less(intervals[j])
+	})
+
+	for _, interval := range intervals {
+		src, err := open()
+		if err != nil {
+			return err
+		}
+
+		if err := aggregateSorted(ctx, src, interval, cfg, emit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// aggregateSorted is AggregateSorted for a single interval.
+func aggregateSorted(ctx context.Context, src Source, interval Interval, cfg config, emit func(Candle) error) error {
+	var carrier *openCarrier
+	if cfg.carryOpen != CarryNone {
+		carrier = newOpenCarrier(cfg)
+	}
+
+	var filler *GapFiller
+	if cfg.fillGaps {
+		filler = newGapFiller(cfg.schedule, cfg.calendar)
+	}
+
+	var cur *Candle
+
+	var end time.Time
+
+	// complete passes on a closed candle, its open carried and its gaps
+	// filled.
+	complete := func(c Candle) error {
+		if carrier != nil {
+			c = carrier.next(c)
+		}
+
+		if filler == nil {
+			return emit(c)
+		}
+
+		for _, c := range filler.Next(c) {
+			if err := emit(c); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// add adds ticks of equal times: a correction refers to a trade at its
+	// time, so applying them to the group is applying them to the input.
+	add := func(ticks []Tick) error {
+		ticks, _ = ApplyCorrections(ticks)
+
+		for _, tick := range ticks {
+			tick, ok := cfg.prepare(tick)
+			if !ok || !cfg.trades(tick.Time) {
+				continue
+			}
+
+			if cur != nil && tick.Time.Before(end) {
+				cur.add(tick)
+				continue
+			}
+
+			if cur != nil {
+				if err := complete(*cur); err != nil {
+					return err
+				}
+			}
+
+			startTime, _ := cfg.truncate(interval, tick.Time)
+			cur = newCandle(tick, startTime, interval, cfg.precision)
+			end = cfg.end(interval, startTime)
+		}
+
+		return nil
+	}
+
+	var group []Tick
+
+	for n := 0; ; n++ {
+		if n%4096 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		tick, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(group) > 0 && !tick.Time.Equal(group[0].Time) {
+			if err := add(group); err != nil {
+				return err
+			}
+
+			group = group[:0]
+		}
+
+		group = append(group, tick)
+	}
+
+	if err := add(group); err != nil {
+		return err
+	}
+
+	if cur == nil {
+		return nil
+	}
+
+	return complete(*cur)
+}
+
+func sortCandles(result []Candle) {
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ID != result[j].ID {
+			return result[i].ID < result[j].ID
+		}
+		if result[i].Interval != result[j].Interval {
+			return result[i].Interval.less(result[j].Interval)
+		}
+		return result[i].Time.Before(result[j].Time)
+	})
+}
+
+// autoIntervals picks the intervals worth building for the ticks of an
+// instrument sorted by time. Every gap between distinct tick times counts
+// towards the shortest interval not shorter than it; the picked intervals
+// are the one holding the median gap and all longer ones whose candles the
+// ticks span at least two of. Only the sort order of intervals matters, so
+// the result doesn't depend on the order they were given in.
+func autoIntervals(times []time.Time, intervals []Interval, loc *time.Location) []Interval {
+	sorted := slices.Clone(intervals)
+	slices.SortFunc(sorted, func(a, b Interval) int {
+		if a.less(b) {
+			return -1
+		}
+
+		if b.less(a) {
+			return 1
+		}
+
+		return 0
+	})
+
+	histogram := make([]int, len(sorted))
+	gaps := 0
+
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		if gap == 0 {
+			continue
+		}
+
+		bucket, _ := slices.BinarySearchFunc(sorted, gap, func(interval Interval, gap time.Duration) int {
+			return cmp.Compare(interval.approx(), gap)
+		})
+
+		if bucket == len(sorted) {
+			bucket--
+		}
+
+		histogram[bucket]++
+		gaps++
+	}
+
+	median := 0
+
+	for seen := 0; median < len(sorted)-1; median++ {
+		seen += histogram[median]
+		if 2*seen >= gaps {
+			break
+		}
+	}
+
+	result := []Interval{sorted[median]}
+
+	first, last := times[0], times[len(times)-1]
+
+	for _, interval := range sorted[median+1:] {
+		if interval.Truncate(first, loc).Equal(interval.Truncate(last, loc)) {
+			break
+		}
+
+		result = append(result, interval)
+	}
+
+	return result
+}
+
+// appendCandles buckets ticks sorted by time into candles of all the
+// intervals in a single pass, keeping an open candle per interval. It
+// returns nil early when ctx is done.
+func appendCandles(ctx context.Context, result []Candle, ticks []Tick, intervals []Interval, cfg config) []Candle {
+	cur := make([]*Candle, len(intervals))
+	// ends are the ends of the open candles: ticks before them, being
+	// sorted, belong to them without truncating their times.
+	ends := make([]time.Time, len(intervals))
+
+	for n, tick := range ticks {
+		if n%4096 == 0 && ctx.Err() != nil {
+			return nil
+		}
+
+		if !cfg.trades(tick.Time) {
+			continue
+		}
+
+		for i, interval := range intervals {
+			if cur[i] != nil && tick.Time.Before(ends[i]) {
+				cur[i].add(tick)
+				continue
+			}
+
+			startTime, _ := cfg.truncate(interval, tick.Time)
+
+			if cur[i] != nil {
+				result = append(result, *cur[i])
+			}
+
+			cur[i] = newCandle(tick, startTime, interval, cfg.precision)
+			ends[i] = cfg.end(interval, startTime)
+		}
+	}
+
+	for _, c := range cur {
+		if c != nil {
+			result = append(result, *c)
+		}
+	}
+
+	return result
+}
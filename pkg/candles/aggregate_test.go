@@ -0,0 +1,187 @@
+package candles
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAutoIntervals(t *testing.T) {
+	base := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	every := func(step time.Duration, n int) []time.Time {
+		times := make([]time.Time, n)
+		for i := range times {
+			times[i] = base.Add(time.Duration(i) * step)
+		}
+
+		return times
+	}
+
+	minute, fiveMinutes, hour := Fixed(time.Minute), Fixed(5*time.Minute), Fixed(time.Hour)
+	day, week, month := Days(1), Weeks(1), Months(1)
+
+	tests := []struct {
+		name      string
+		times     []time.Time
+		intervals []Interval
+		want      []Interval
+	}{
+		{
+			name:      "dense",
+			times:     every(10*time.Second, 3*360+1),
+			intervals: []Interval{minute, fiveMinutes, hour, day},
+			want:      []Interval{minute, fiveMinutes, hour},
+		},
+		{
+			name:      "sparse",
+			times:     every(30*time.Minute, 3*48+1),
+			intervals: []Interval{minute, fiveMinutes, hour, day},
+			want:      []Interval{hour, day},
+		},
+		{
+			name:      "gap longer than the longest interval",
+			times:     []time.Time{base, base.Add(24 * time.Hour)},
+			intervals: []Interval{minute, fiveMinutes, hour},
+			want:      []Interval{hour},
+		},
+		{
+			name:      "single tick",
+			times:     []time.Time{base},
+			intervals: []Interval{minute, fiveMinutes, hour, day},
+			want:      []Interval{minute},
+		},
+		{
+			name:      "all gaps zero",
+			times:     []time.Time{base, base, base},
+			intervals: []Interval{minute, fiveMinutes, hour, day},
+			want:      []Interval{minute},
+		},
+		{
+			name:      "calendar intervals",
+			times:     every(24*time.Hour, 50),
+			intervals: []Interval{day, week, month},
+			want:      []Interval{day, week, month},
+		},
+		{
+			name:      "calendar intervals within a month",
+			times:     every(24*time.Hour, 19),
+			intervals: []Interval{day, week, month},
+			want:      []Interval{day, week},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders := [][]Interval{tt.intervals, slices.Clone(tt.intervals)}
+			slices.Reverse(orders[1])
+
+			// A rotation mixes the order further than a reversal.
+			orders = append(orders, append(slices.Clone(tt.intervals[1:]), tt.intervals[0]))
+
+			for _, intervals := range orders {
+				got := autoIntervals(tt.times, intervals, time.UTC)
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("autoIntervals(%v) = %v, want %v", intervals, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// sliceSource is a Source of a slice of ticks.
+type sliceSource []Tick
+
+func (s *sliceSource) Next() (Tick, error) {
+	if len(*s) == 0 {
+		return Tick{}, io.EOF
+	}
+
+	tick := (*s)[0]
+	*s = (*s)[1:]
+
+	return tick, nil
+}
+
+func TestAggregateSorted(t *testing.T) {
+	base := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	var ticks []Tick
+
+	for i := 0; i < 5000; i++ {
+		tick := Tick{
+			ID:     "SBER",
+			Price:  100 + rnd.Float64()*10,
+			Volume: float64(1 + rnd.IntN(10)),
+			Time:   base.Add(time.Duration(rnd.IntN(3*24*3600)) * time.Second),
+			Seq:    int64(rnd.IntN(3)),
+		}
+
+		ticks = append(ticks, tick)
+
+		// Correct some trades later in the input.
+		switch rnd.IntN(20) {
+		case 0:
+			tick.Kind = Cancel
+			ticks = append(ticks, tick)
+		case 1:
+			tick.Kind = Amend
+			tick.Price++
+			ticks = append(ticks, tick)
+		}
+	}
+
+	sorted := slices.Clone(ticks)
+
+	slices.SortStableFunc(sorted, func(a, b Tick) int {
+		switch {
+		case a.Before(b):
+			return -1
+		case b.Before(a):
+			return 1
+		}
+
+		return 0
+	})
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"carry open", []Option{WithCarryOpen(CarryIntraday)}},
+		{"fill gaps", []Option{WithFillGaps(true), WithCarryOpen(CarryAlways)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithIntervals(Days(1), Fixed(time.Minute), Fixed(time.Hour))}, tt.opts...)
+			want := Aggregate(slices.Clone(ticks), opts...)
+
+			var got []Candle
+
+			open := func() (Source, error) {
+				src := sliceSource(sorted)
+				return &src, nil
+			}
+
+			emit := func(c Candle) error {
+				got = append(got, c)
+				return nil
+			}
+
+			if err := AggregateSorted(context.Background(), open, emit, opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %d candles, want %d equal to Aggregate", len(got), len(want))
+			}
+		})
+	}
+}
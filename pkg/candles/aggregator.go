@@ -0,0 +1,480 @@
+package candles
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Aggregator builds candles from a stream of ticks. Unlike Aggregate it
+// emits a candle for every configured interval and keeps only the currently
+// open candles in memory.
+//
+// A candle is closed once the watermark, the latest tick time minus the late
+// tolerance, passes the end of its interval. Ticks may arrive out of order
+// as long as they are not older than the watermark; later ones are dropped
+// and counted by LateTicks.
+//
+// The methods of an Aggregator are safe for concurrent use. Instruments are
+// spread over shards with a lock each, so AddTick calls for different
+// instruments mostly run in parallel, while ticks of an instrument are
+// added one at a time. The watermark is shared: a call returns the candles
+// closed by the watermark it moved, so candles closed by concurrent calls
+// are returned by either of them, and a candle opened by a tick racing the
+// watermark past its end is closed by the next call that moves it. Each
+// candle is returned exactly once.
+type Aggregator struct {
+	cfg    config
+	seed   maphash.Seed
+	shards [aggregatorShards]shard
+
+	// watermark and nextClose are Unix nanoseconds, unset until known.
+	watermark atomic.Int64
+	nextClose atomic.Int64
+	late      atomic.Int64
+	unmatched atomic.Int64
+
+	// closeMu serializes closing candles and guards carrier, which sets
+	// the opens of candles with WithCarryOpen, and filler, which inserts
+	// gap candles with WithFillGaps.
+	closeMu sync.Mutex
+	carrier *openCarrier
+	filler  *GapFiller
+}
+
+// aggregatorShards is the number of locks the instruments of an Aggregator
+// are spread over.
+const aggregatorShards = 64
+
+// unset is the value of the watermark and nextClose before they are known.
+const unset = math.MinInt64
+
+// shard holds the open candles of some of the instruments.
+type shard struct {
+	mu     sync.Mutex
+	series map[string][]*series
+}
+
+// series holds the open candles of an instrument on a single interval,
+// sorted by time.
+type series struct {
+	open []*Candle
+}
+
+// NewAggregator returns an empty streaming aggregator.
+func NewAggregator(opts ...Option) *Aggregator {
+	a := &Aggregator{
+		cfg:  newConfig(opts),
+		seed: maphash.MakeSeed(),
+	}
+
+	a.reset()
+
+	if a.cfg.carryOpen != CarryNone {
+		a.carrier = newOpenCarrier(a.cfg)
+	}
+
+	if a.cfg.fillGaps {
+		a.filler = newGapFiller(a.cfg.schedule, a.cfg.calendar)
+	}
+
+	return a
+}
+
+// reset drops the open candles and the clock.
+func (a *Aggregator) reset() {
+	for i := range a.shards {
+		a.shards[i].series = make(map[string][]*series)
+	}
+
+	a.watermark.Store(unset)
+	a.nextClose.Store(unset)
+	a.late.Store(0)
+	a.unmatched.Store(0)
+}
+
+// AddTick adds a tick to the open candles of its instrument and returns the
+// candles closed by the time it carries. A cancel or amend tick corrects a
+// trade of the open candles instead, see WithCorrections.
+func (a *Aggregator) AddTick(tick Tick) []Candle {
+	tick, ok := a.cfg.prepare(tick)
+	result := a.Advance(tick.Time)
+
+	if !ok {
+		return result
+	}
+
+	sh := a.shard(tick.ID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if tick.Kind.Correction() {
+		a.correct(sh, tick)
+		return result
+	}
+
+	idSeries := sh.series[tick.ID]
+	if idSeries == nil {
+		idSeries = make([]*series, len(a.cfg.intervals))
+		for i := range idSeries {
+			idSeries[i] = &series{}
+		}
+
+		sh.series[tick.ID] = idSeries
+	}
+
+	// The watermark is read under the shard lock, so a candle is either
+	// seen late here or seen open by the close that passes its end.
+	watermark := a.watermark.Load()
+	late := false
+
+	for i, interval := range a.cfg.intervals {
+		startTime, ok := a.cfg.truncate(interval, tick.Time)
+		if !ok {
+			continue
+		}
+
+		endTime := a.cfg.end(interval, startTime)
+
+		if watermark >= endTime.UnixNano() {
+			late = true
+			continue
+		}
+
+		s := idSeries[i]
+		c := s.find(startTime)
+
+		if c != nil {
+			c.add(tick)
+		} else {
+			c = newCandle(tick, startTime, interval, a.cfg.precision)
+			s.insert(c)
+			a.updateNextClose(endTime)
+		}
+
+		if a.cfg.corrections {
+			c.trades = append(c.trades, tick)
+		}
+	}
+
+	if late {
+		a.late.Add(1)
+	}
+
+	return result
+}
+
+// Advance moves the aggregator clock to now and returns the candles of all
+// instruments whose interval has ended by the resulting watermark. It lets
+// live streams close candles of instruments that stopped trading.
+func (a *Aggregator) Advance(now time.Time) []Candle {
+	watermark := now.Add(-a.cfg.lateTolerance).UnixNano()
+
+	for {
+		cur := a.watermark.Load()
+		if watermark <= cur {
+			return nil
+		}
+
+		if a.watermark.CompareAndSwap(cur, watermark) {
+			break
+		}
+	}
+
+	if next := a.nextClose.Load(); next == unset || watermark < next {
+		return nil
+	}
+
+	a.closeMu.Lock()
+	defer a.closeMu.Unlock()
+
+	return a.closeBefore(a.watermark.Load())
+}
+
+// Flush closes and returns all open candles.
+func (a *Aggregator) Flush() []Candle {
+	a.closeMu.Lock()
+	defer a.closeMu.Unlock()
+
+	var result []Candle
+
+	a.nextClose.Store(unset)
+
+	for i := range a.shards {
+		sh := &a.shards[i]
+		sh.mu.Lock()
+
+		for id, idSeries := range sh.series {
+			for _, s := range idSeries {
+				for _, c := range s.open {
+					result = append(result, *c)
+				}
+			}
+
+			delete(sh.series, id)
+		}
+
+		sh.mu.Unlock()
+	}
+
+	sortCandles(result)
+
+	return a.complete(result)
+}
+
+// Partial returns the current state of the open candles that received
+// ticks since the previous call, marked Partial. They stay open and are
+// returned again, complete, once closed.
+func (a *Aggregator) Partial() []Candle {
+	var result []Candle
+
+	for i := range a.shards {
+		sh := &a.shards[i]
+		sh.mu.Lock()
+
+		for _, idSeries := range sh.series {
+			for _, s := range idSeries {
+				for _, c := range s.open {
+					if !c.changed {
+						continue
+					}
+
+					c.changed = false
+
+					partial := *c
+					partial.Partial = true
+					result = append(result, partial)
+				}
+			}
+		}
+
+		sh.mu.Unlock()
+	}
+
+	sortCandles(result)
+
+	if a.carrier != nil {
+		a.closeMu.Lock()
+
+		for i := range result {
+			result[i] = a.carrier.peek(result[i])
+		}
+
+		a.closeMu.Unlock()
+	}
+
+	return result
+}
+
+// Closed reports whether the watermark has passed the ends of all candles a
+// tick at t belongs to: once the candles returned so far are written, the
+// tick is done with, and a source may acknowledge it.
+func (a *Aggregator) Closed(t time.Time) bool {
+	watermark := a.watermark.Load()
+
+	for _, interval := range a.cfg.intervals {
+		startTime, ok := a.cfg.truncate(interval, t)
+		if ok && a.cfg.end(interval, startTime).UnixNano() > watermark {
+			return false
+		}
+	}
+
+	return true
+}
+
+// LateTicks returns the number of ticks dropped, for at least one interval,
+// because they arrived after their candle had been closed.
+func (a *Aggregator) LateTicks() int {
+	return int(a.late.Load())
+}
+
+// UnmatchedCorrections returns the number of cancel and amend ticks whose
+// trade wasn't found, for at least one interval, among the open candles:
+// because its candle had been closed, or the aggregator wasn't created
+// WithCorrections.
+func (a *Aggregator) UnmatchedCorrections() int {
+	return int(a.unmatched.Load())
+}
+
+// correct applies a correction to the open candles of its instrument. It
+// must be called with the shard lock held.
+func (a *Aggregator) correct(sh *shard, tick Tick) {
+	idSeries := sh.series[tick.ID]
+	if !a.cfg.corrections || idSeries == nil {
+		a.unmatched.Add(1)
+		return
+	}
+
+	unmatched := false
+
+	for i, interval := range a.cfg.intervals {
+		startTime, ok := a.cfg.truncate(interval, tick.Time)
+		if !ok {
+			continue
+		}
+
+		s := idSeries[i]
+
+		c := s.find(startTime)
+		if c == nil {
+			unmatched = true
+			continue
+		}
+
+		found, empty := c.correct(tick)
+		if !found {
+			unmatched = true
+		}
+
+		if empty {
+			s.remove(c)
+		}
+	}
+
+	if unmatched {
+		a.unmatched.Add(1)
+	}
+}
+
+// closeBefore closes the candles of all instruments whose interval ends
+// not later than now, in Unix nanoseconds. It must be called with closeMu
+// held.
+func (a *Aggregator) closeBefore(now int64) []Candle {
+	if next := a.nextClose.Load(); next == unset || now < next {
+		return nil
+	}
+
+	var result []Candle
+
+	// Candles opened from here on update nextClose themselves, the ones
+	// already open are visited below.
+	a.nextClose.Store(unset)
+
+	for i := range a.shards {
+		sh := &a.shards[i]
+		sh.mu.Lock()
+
+		for id, idSeries := range sh.series {
+			active := false
+
+			for _, s := range idSeries {
+				n := 0
+
+				for n < len(s.open) && now >= a.cfg.end(s.open[n].Interval, s.open[n].Time).UnixNano() {
+					result = append(result, *s.open[n])
+					n++
+				}
+
+				s.open = s.open[n:]
+
+				if len(s.open) > 0 {
+					active = true
+					a.updateNextClose(a.cfg.end(s.open[0].Interval, s.open[0].Time))
+				}
+			}
+
+			if !active {
+				delete(sh.series, id)
+			}
+		}
+
+		sh.mu.Unlock()
+	}
+
+	sortCandles(result)
+
+	return a.complete(result)
+}
+
+// complete sets the opens of the closed candles with WithCarryOpen and
+// inserts the gap candles before them with WithFillGaps. It must be called
+// with closeMu held.
+func (a *Aggregator) complete(result []Candle) []Candle {
+	if a.carrier != nil {
+		for i := range result {
+			result[i] = a.carrier.next(result[i])
+		}
+	}
+
+	if a.filler == nil {
+		return result
+	}
+
+	var filled []Candle
+
+	for _, c := range result {
+		filled = append(filled, a.filler.Next(c)...)
+	}
+
+	return filled
+}
+
+// shard returns the shard of an instrument.
+func (a *Aggregator) shard(id string) *shard {
+	return &a.shards[maphash.String(a.seed, id)%aggregatorShards]
+}
+
+// lockAll locks the aggregator against any change, for taking or replacing
+// its state.
+func (a *Aggregator) lockAll() {
+	a.closeMu.Lock()
+
+	for i := range a.shards {
+		a.shards[i].mu.Lock()
+	}
+}
+
+func (a *Aggregator) unlockAll() {
+	for i := range a.shards {
+		a.shards[i].mu.Unlock()
+	}
+
+	a.closeMu.Unlock()
+}
+
+func (a *Aggregator) updateNextClose(endTime time.Time) {
+	end := endTime.UnixNano()
+
+	for {
+		cur := a.nextClose.Load()
+		if cur != unset && cur <= end {
+			return
+		}
+
+		if a.nextClose.CompareAndSwap(cur, end) {
+			return
+		}
+	}
+}
+
+func (s *series) find(startTime time.Time) *Candle {
+	for i := len(s.open) - 1; i >= 0; i-- {
+		if s.open[i].Time.Equal(startTime) {
+			return s.open[i]
+		}
+	}
+
+	return nil
+}
+
+func (s *series) remove(c *Candle) {
+	for i, open := range s.open {
+		if open == c {
+			s.open = append(s.open[:i], s.open[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *series) insert(c *Candle) {
+	i := len(s.open)
+	for i > 0 && s.open[i-1].Time.After(c.Time) {
+		i--
+	}
+
+	s.open = append(s.open, nil)
+	copy(s.open[i+1:], s.open[i:])
+	s.open[i] = c
+}
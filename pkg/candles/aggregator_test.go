@@ -0,0 +1,187 @@
+package candles
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestAggregatorConcurrent adds ticks of overlapping instruments from
+// several goroutines while another one advances the clock and takes partial
+// candles. Every candle must be returned exactly once, and the volume of an
+// instrument must be conserved on every interval. Run it with -race.
+func TestAggregatorConcurrent(t *testing.T) {
+	const (
+		workers  = 8
+		rounds   = 50
+		perRound = 100
+		step     = 20 * time.Millisecond
+	)
+
+	ids := []string{"A", "B", "C", "D"}
+	intervals := []Interval{Fixed(time.Second), Fixed(10 * time.Second), Fixed(time.Minute)}
+	base := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	// Rounds run one after another, so the ticks of a round span less
+	// than the late tolerance and none is late.
+	agg := NewAggregator(WithIntervals(intervals...), WithLateTolerance(5*time.Second))
+
+	type key struct {
+		id       string
+		interval Interval
+		time     time.Time
+	}
+
+	var (
+		mu      sync.Mutex
+		seen    = make(map[key]int)
+		volumes = make(map[string]map[Interval]float64)
+		counts  = make(map[string]map[Interval]int)
+	)
+
+	collect := func(result []Candle) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, c := range result {
+			if c.Partial {
+				t.Errorf("closed candle %s %s %s marked partial", c.ID, c.Interval, c.Time)
+			}
+
+			seen[key{c.ID, c.Interval, c.Time}]++
+
+			if volumes[c.ID] == nil {
+				volumes[c.ID] = make(map[Interval]float64)
+				counts[c.ID] = make(map[Interval]int)
+			}
+
+			volumes[c.ID][c.Interval] += c.Volume
+			counts[c.ID][c.Interval] += c.Count
+		}
+	}
+
+	tickAt := func(w, i int) Tick {
+		return Tick{
+			ID:     ids[(w+i)%len(ids)],
+			Price:  float64(100 + (w*7+i)%13),
+			Volume: float64(w + 1),
+			Time:   base.Add(time.Duration(i) * step),
+		}
+	}
+
+	// roundStart is the time of the first tick of the current round, a
+	// clock no tick still to come is late for.
+	var roundStart atomic.Int64
+
+	roundStart.Store(base.UnixNano())
+
+	done := make(chan struct{})
+	clockDone := make(chan struct{})
+
+	go func() {
+		defer close(clockDone)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			collect(agg.Advance(time.Unix(0, roundStart.Load())))
+
+			for _, c := range agg.Partial() {
+				if !c.Partial {
+					t.Errorf("partial candle %s %s %s not marked partial", c.ID, c.Interval, c.Time)
+				}
+			}
+		}
+	}()
+
+	for r := 0; r < rounds; r++ {
+		roundStart.Store(base.Add(time.Duration(r*perRound) * step).UnixNano())
+
+		var wg sync.WaitGroup
+
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < perRound; j++ {
+					collect(agg.AddTick(tickAt(w, r*perRound+j)))
+				}
+			}()
+		}
+
+		wg.Wait()
+	}
+
+	close(done)
+	<-clockDone
+
+	collect(agg.Flush())
+
+	if late := agg.LateTicks(); late != 0 {
+		t.Fatalf("%d late ticks", late)
+	}
+
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("candle %s %s %s returned %d times", k.id, k.interval, k.time, n)
+		}
+	}
+
+	wantVolumes := make(map[string]float64)
+	wantCounts := make(map[string]int)
+
+	for w := 0; w < workers; w++ {
+		for i := 0; i < rounds*perRound; i++ {
+			tick := tickAt(w, i)
+			wantVolumes[tick.ID] += tick.Volume
+			wantCounts[tick.ID]++
+		}
+	}
+
+	for _, id := range ids {
+		for _, interval := range intervals {
+			if got := volumes[id][interval]; got != wantVolumes[id] {
+				t.Errorf("%s %s: volume %g, want %g", id, interval, got, wantVolumes[id])
+			}
+
+			if got := counts[id][interval]; got != wantCounts[id] {
+				t.Errorf("%s %s: %d ticks, want %d", id, interval, got, wantCounts[id])
+			}
+		}
+	}
+}
+
+func TestAggregatorClosed(t *testing.T) {
+	base := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	agg := NewAggregator(WithIntervals(Fixed(time.Minute), Fixed(5*time.Minute)), WithLateTolerance(10*time.Second))
+
+	agg.AddTick(Tick{ID: "A", Price: 1, Time: base.Add(30 * time.Second)})
+
+	if agg.Closed(base.Add(30 * time.Second)) {
+		t.Error("a tick of open candles is closed")
+	}
+
+	// The 1m candle is closed, the 5m one still open.
+	agg.AddTick(Tick{ID: "A", Price: 1, Time: base.Add(90 * time.Second)})
+
+	if agg.Closed(base.Add(30 * time.Second)) {
+		t.Error("a tick of an open 5m candle is closed")
+	}
+
+	agg.AddTick(Tick{ID: "A", Price: 1, Time: base.Add(5*time.Minute + 10*time.Second)})
+
+	if !agg.Closed(base.Add(30 * time.Second)) {
+		t.Error("a tick of closed candles is open")
+	}
+
+	if agg.Closed(base.Add(5 * time.Minute)) {
+		t.Error("a tick of the new candles is closed")
+	}
+}
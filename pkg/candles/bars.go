@@ -0,0 +1,164 @@
+package candles
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BarKind is the measure of activity that closes a bar.
+type BarKind int
+
+// Bar kinds.
+const (
+	// TickBars close after a number of ticks.
+	TickBars BarKind = iota
+	// VolumeBars close once their volume reaches the threshold.
+	VolumeBars
+	// DollarBars close once their turnover, price times volume, reaches
+	// the threshold.
+	DollarBars
+)
+
+var barKindNames = []string{"tick", "volume", "dollar"}
+
+// BarSpec configures activity driven bars.
+type BarSpec struct {
+	Kind      BarKind
+	Threshold float64
+	// Precision is the arithmetic of bar volumes.
+	Precision Precision
+}
+
+// ParseBarSpec parses a bar spec such as "tick:1000", "volume:50000" or
+// "dollar:1e6".
+func ParseBarSpec(s string) (BarSpec, error) {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return BarSpec{}, fmt.Errorf("bad bars %q: want kind:threshold", s)
+	}
+
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold <= 0 {
+		return BarSpec{}, fmt.Errorf("bad bars %q: threshold must be a positive number", s)
+	}
+
+	for kind, kindName := range barKindNames {
+		if name == kindName {
+			return BarSpec{Kind: BarKind(kind), Threshold: threshold}, nil
+		}
+	}
+
+	return BarSpec{}, fmt.Errorf("bad bars %q: unknown kind %q", s, name)
+}
+
+// String returns the spec in the notation accepted by ParseBarSpec.
+func (s BarSpec) String() string {
+	return barKindNames[s.Kind] + ":" + strconv.FormatFloat(s.Threshold, 'g', -1, 64)
+}
+
+// BarBuilder builds bars that close on activity rather than time from a
+// stream of ticks. A bar starts at its first tick, which sets its Time, and
+// includes the tick that makes it reach the threshold. Bars have a zero
+// Interval.
+type BarBuilder struct {
+	spec BarSpec
+	loc  *time.Location
+	open map[string]*bar
+}
+
+type bar struct {
+	candle *Candle
+	// progress is the number of ticks, volume or turnover of the bar.
+	progress float64
+}
+
+// NewBarBuilder returns a builder of bars of the spec. Bar times are
+// reported in loc.
+func NewBarBuilder(spec BarSpec, loc *time.Location) *BarBuilder {
+	return &BarBuilder{spec: spec, loc: loc, open: make(map[string]*bar)}
+}
+
+// AddTick adds a tick to the open bar of its instrument and returns the bar
+// if the tick closes it. Ticks of an instrument must be added in time order.
+// Quotes and corrections are ignored, a bar being built on the trades as
+// they come.
+func (b *BarBuilder) AddTick(tick Tick) (Candle, bool) {
+	if tick.Kind != Trade {
+		return Candle{}, false
+	}
+
+	cur := b.open[tick.ID]
+	if cur == nil {
+		cur = &bar{candle: newCandle(tick, tick.Time.In(b.loc), Interval{}, b.spec.Precision)}
+		b.open[tick.ID] = cur
+	} else {
+		cur.candle.add(tick)
+	}
+
+	switch b.spec.Kind {
+	case TickBars:
+		cur.progress++
+	case VolumeBars:
+		cur.progress = cur.candle.Volume
+	case DollarBars:
+		cur.progress += tick.Price * tick.Volume
+	}
+
+	if cur.progress < b.spec.Threshold {
+		return Candle{}, false
+	}
+
+	delete(b.open, tick.ID)
+
+	return *cur.candle, true
+}
+
+// Flush returns the unfinished bars sorted by ID.
+func (b *BarBuilder) Flush() []Candle {
+	var result []Candle
+
+	for id, cur := range b.open {
+		result = append(result, *cur.candle)
+		delete(b.open, id)
+	}
+
+	sortCandles(result)
+
+	return result
+}
+
+// Bars builds the bars of ticks in any order, including the unfinished last
+// bar of every instrument; ticks with equal times are ordered by sequence
+// number, then keep their input order. Corrections are applied first, see
+// ApplyCorrections. The result is sorted by ID, then by time.
+func Bars(ticks []Tick, spec BarSpec, loc *time.Location) []Candle {
+	ticks, _ = ApplyCorrections(ticks)
+	sorted := make([]Tick, len(ticks))
+	copy(sorted, ticks)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+
+		return sorted[i].Before(sorted[j])
+	})
+
+	b := NewBarBuilder(spec, loc)
+
+	var result []Candle
+
+	for _, tick := range sorted {
+		if c, ok := b.AddTick(tick); ok {
+			result = append(result, c)
+		}
+	}
+
+	result = append(result, b.Flush()...)
+	sortCandles(result)
+
+	return result
+}
@@ -0,0 +1,312 @@
+package candles
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Calendar is the trading days of an exchange: the weekdays other than its
+// holidays, plus the weekend days it declares working. With WithCalendar
+// gap filling skips the other days; their ticks are still aggregated.
+type Calendar struct {
+	// Location is the time zone in which times fall on days.
+	Location *time.Location
+
+	holidays map[civilDate]bool
+	workdays map[civilDate]bool
+	// rules are recurring holidays.
+	rules []func(civilDate) bool
+}
+
+type civilDate struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+func dateOf(t time.Time) civilDate {
+	year, month, day := t.Date()
+	return civilDate{year, month, day}
+}
+
+func (d civilDate) weekday() time.Weekday {
+	return time.Date(d.year, d.month, d.day, 0, 0, 0, 0, time.UTC).Weekday()
+}
+
+// add returns the date n days later.
+func (d civilDate) add(n int) civilDate {
+	return dateOf(time.Date(d.year, d.month, d.day+n, 0, 0, 0, 0, time.UTC))
+}
+
+func isWeekend(wd time.Weekday) bool {
+	return wd == time.Saturday || wd == time.Sunday
+}
+
+// NewCalendar returns a calendar of all weekdays in loc, to which holidays
+// and working weekend days are added with AddHoliday and AddWorkday.
+func NewCalendar(loc *time.Location) *Calendar {
+	return &Calendar{
+		Location: loc,
+		holidays: make(map[civilDate]bool),
+		workdays: make(map[civilDate]bool),
+	}
+}
+
+// AddHoliday makes the day of t in the calendar time zone a holiday.
+func (c *Calendar) AddHoliday(t time.Time) {
+	c.holidays[dateOf(t.In(c.Location))] = true
+}
+
+// AddWorkday makes the day of t in the calendar time zone a trading day,
+// even if it falls on a weekend or a holiday.
+func (c *Calendar) AddWorkday(t time.Time) {
+	c.workdays[dateOf(t.In(c.Location))] = true
+}
+
+// IsTradingDay reports whether the day of t in the calendar time zone is a
+// trading day.
+func (c *Calendar) IsTradingDay(t time.Time) bool {
+	return c.isTradingDate(dateOf(t.In(c.Location)))
+}
+
+func (c *Calendar) isTradingDate(d civilDate) bool {
+	if c.workdays[d] {
+		return true
+	}
+
+	if c.holidays[d] || isWeekend(d.weekday()) {
+		return false
+	}
+
+	for _, rule := range c.rules {
+		if rule(d) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HasTradingDay reports whether the candle of the interval starting at
+// start includes a trading day. Fixed interval candles belong to the day
+// they start on, calendar interval ones span the days of the candle time
+// zone.
+func (c *Calendar) HasTradingDay(i Interval, start time.Time) bool {
+	if !i.IsCalendar() {
+		return c.IsTradingDay(start)
+	}
+
+	for d, end := dateOf(start), dateOf(i.End(start)); d != end; d = d.add(1) {
+		if c.isTradingDate(d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewMOEXCalendar returns the calendar of the Moscow Exchange: the public
+// holidays of Russia it is closed on, those falling on a weekend moved to
+// the next Monday. Of the New Year holidays it only closes on January 1, 2
+// and 7, which don't move. Exchange decisions to trade on a holiday or a
+// weekend are not known to it and are added with AddWorkday.
+func NewMOEXCalendar() *Calendar {
+	c := NewCalendar(msk)
+	c.rules = append(c.rules, isRussianHoliday)
+
+	return c
+}
+
+// NewSPBCalendar returns the calendar of foreign shares on the SPB
+// Exchange, which follow the holidays of the US stock market.
+func NewSPBCalendar() *Calendar {
+	c := NewCalendar(msk)
+	c.rules = append(c.rules, isUSHoliday)
+
+	return c
+}
+
+// russianHolidays are the public holidays of Russia the Moscow Exchange is
+// closed on, the New Year ones first.
+var russianHolidays = []civilDate{
+	{0, time.January, 1}, {0, time.January, 2}, {0, time.January, 7},
+	{0, time.February, 23}, {0, time.March, 8}, {0, time.May, 1},
+	{0, time.May, 9}, {0, time.June, 12}, {0, time.November, 4},
+}
+
+func isRussianHoliday(d civilDate) bool {
+	for i, h := range russianHolidays {
+		h.year = d.year
+
+		if h == d {
+			return true
+		}
+
+		// A holiday on a weekend moves to the next Monday, except the New
+		// Year ones.
+		if i < 3 {
+			continue
+		}
+
+		if wd := h.weekday(); wd == time.Saturday && h.add(2) == d || wd == time.Sunday && h.add(1) == d {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isUSHoliday(d civilDate) bool {
+	y := d.year
+
+	// observed moves a holiday on Saturday to Friday and on Sunday to
+	// Monday.
+	observed := func(month time.Month, day int) civilDate {
+		h := civilDate{y, month, day}
+
+		switch h.weekday() {
+		case time.Saturday:
+			return h.add(-1)
+		case time.Sunday:
+			return h.add(1)
+		}
+
+		return h
+	}
+
+	// nth returns the n-th weekday of the month, counting from the end if
+	// n is negative.
+	nth := func(month time.Month, wd time.Weekday, n int) civilDate {
+		if n < 0 {
+			last := civilDate{y, month + 1, 1}.add(-1)
+			return last.add(-(int(last.weekday()-wd+7) % 7))
+		}
+
+		first := civilDate{y, month, 1}
+		return first.add(int(wd-first.weekday()+7)%7 + 7*(n-1))
+	}
+
+	holidays := []civilDate{
+		nth(time.January, time.Monday, 3),
+		nth(time.February, time.Monday, 3),
+		easter(y).add(-2),
+		nth(time.May, time.Monday, -1),
+		observed(time.July, 4),
+		nth(time.September, time.Monday, 1),
+		nth(time.November, time.Thursday, 4),
+		observed(time.December, 25),
+	}
+
+	// New Year's Day on a Saturday is not observed on the Friday before.
+	if h := (civilDate{y, time.January, 1}); h.weekday() != time.Saturday {
+		holidays = append(holidays, observed(time.January, 1))
+	}
+
+	if y >= 2022 {
+		holidays = append(holidays, observed(time.June, 19))
+	}
+
+	for _, h := range holidays {
+		if h == d {
+			return true
+		}
+	}
+
+	return false
+}
+
+// easter returns the Gregorian Easter Sunday of the year.
+func easter(year int) civilDate {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+
+	return civilDate{year, time.Month(month), day}
+}
+
+// ParseCalendar parses a comma separated list of calendars whose non
+// trading days are combined: moex, spb, or calendar files. A file lists a
+// date in the 2006-01-02 form per line: a holiday, or a trading day if the
+// date is prefixed with +; text after the date and lines starting with #
+// are comments. Days of files are in loc, unless the list starts with a
+// built-in calendar, whose time zone is then used.
+func ParseCalendar(s string, loc *time.Location) (*Calendar, error) {
+	var c *Calendar
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		var builtin *Calendar
+
+		switch strings.ToLower(part) {
+		case "moex":
+			builtin = NewMOEXCalendar()
+		case "spb":
+			builtin = NewSPBCalendar()
+		}
+
+		if c == nil {
+			c = NewCalendar(loc)
+			if builtin != nil {
+				c.Location = builtin.Location
+			}
+		}
+
+		if builtin != nil {
+			c.rules = append(c.rules, builtin.rules...)
+			continue
+		}
+
+		if err := c.readFile(part); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// readFile adds the days listed in a calendar file, see ParseCalendar.
+func (c *Calendar) readFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		field, _, _ := strings.Cut(text, " ")
+		add := c.AddHoliday
+
+		if rest, ok := strings.CutPrefix(field, "+"); ok {
+			field, add = rest, c.AddWorkday
+		}
+
+		t, err := time.ParseInLocation("2006-01-02", field, c.Location)
+		if err != nil {
+			return fmt.Errorf("%s:%d: bad date %q", name, line, field)
+		}
+
+		add(t)
+	}
+
+	return sc.Err()
+}
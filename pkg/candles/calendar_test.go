@@ -0,0 +1,71 @@
+package candles
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMOEXCalendar(t *testing.T) {
+	c := NewMOEXCalendar()
+
+	tests := []struct {
+		date    string
+		trading bool
+	}{
+		{"2024-01-01", false},
+		{"2024-01-02", false},
+		{"2024-01-03", true},
+		{"2024-01-05", true},
+		{"2024-01-06", false},
+		{"2024-01-08", true},
+		{"2025-01-07", false},
+		{"2024-02-23", false},
+		// Sunday November 4 moves to Monday.
+		{"2018-11-05", false},
+		{"2018-11-06", true},
+	}
+
+	for _, tt := range tests {
+		day, err := time.ParseInLocation("2006-01-02", tt.date, msk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := c.IsTradingDay(day.Add(12 * time.Hour)); got != tt.trading {
+			t.Errorf("IsTradingDay(%s) = %v, want %v", tt.date, got, tt.trading)
+		}
+	}
+}
+
+// TestCalendarKeepsTicks checks that ticks of a holiday are aggregated while
+// gap filling skips the holidays without ticks.
+func TestCalendarKeepsTicks(t *testing.T) {
+	at := func(date string) time.Time {
+		day, err := time.ParseInLocation("2006-01-02", date, msk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return day.Add(10 * time.Hour)
+	}
+
+	ticks := []Tick{
+		{ID: "SBER", Price: 274, Volume: 1, Time: at("2024-01-01")},
+		{ID: "SBER", Price: 270, Volume: 1, Time: at("2024-01-05")},
+	}
+
+	result := Aggregate(ticks, WithIntervals(Days(1)), WithTimezone(msk), WithCalendar(NewMOEXCalendar()), WithFillGaps(true))
+
+	var days []string
+
+	for _, c := range result {
+		days = append(days, c.Time.Format("2006-01-02"))
+	}
+
+	want := []string{"2024-01-01", "2024-01-03", "2024-01-04", "2024-01-05"}
+
+	if !slices.Equal(days, want) {
+		t.Errorf("candles of %v, want %v", days, want)
+	}
+}
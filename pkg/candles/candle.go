@@ -0,0 +1,449 @@
+package candles
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Candle aggregates the prices of an instrument on a single interval.
+type Candle struct {
+	ID       string
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Volume   float64
+	Time     time.Time
+	Interval Interval
+
+	// VWAP is the volume weighted average price, or the mean price of the
+	// candle when its volume is zero.
+	VWAP float64
+	// Count is the number of ticks in the candle.
+	Count int
+	// Spread and MaxSpread are the mean and the widest difference between
+	// the ask and bid prices of the ticks carrying them, zero without.
+	Spread    float64
+	MaxSpread float64
+	// FirstTime and LastTime are the times of the first and the last tick
+	// of the candle, and FirstSeq and LastSeq their sequence numbers, to
+	// audit the candle against the feed. They are zero for filled gaps.
+	FirstTime time.Time
+	LastTime  time.Time
+	FirstSeq  int64
+	LastSeq   int64
+	// Indicators are the values of technical indicators by column name,
+	// NaN while an indicator has too little history.
+	Indicators map[string]float64
+	// Patterns are the names of the candlestick patterns ending with the
+	// candle.
+	Patterns []string
+	// Labels are descriptive values by column name, such as the ticker of
+	// the instrument.
+	Labels map[string]string
+	// Partial marks the current state of a candle whose interval hasn't
+	// closed yet, see Aggregator.Partial.
+	Partial bool
+
+	// turnover is the sum of price times volume and priceSum the sum of
+	// prices of the ticks, from which VWAP is derived.
+	turnover float64
+	priceSum float64
+	// spreadSum is the sum of the spreads of the quoted ticks, whose
+	// number is quoted.
+	spreadSum float64
+	quoted    int
+
+	// precision is the arithmetic of the candle; with DecimalPrecision
+	// volume is the exact sum of tick volumes.
+	precision Precision
+	volume    Decimal
+
+	// first and last are the ticks that set Open and Close, so that out of
+	// order ticks update them correctly.
+	first Tick
+	last  Tick
+	// changed means ticks were added since the last Aggregator.Partial.
+	changed bool
+	// trades are the ticks of the candle, kept by an Aggregator
+	// WithCorrections.
+	trades []Tick
+}
+
+// DefaultColumns is the column order of ToCSV.
+var DefaultColumns = []string{"id", "open", "high", "low", "close", "time", "interval", "volume"}
+
+// ExtraColumns are the optional columns not included in DefaultColumns.
+var ExtraColumns = []string{"vwap", "count", "spread", "max_spread", "first_time", "last_time", "first_seq", "last_seq"}
+
+// ToCSV returns the candle as a CSV record:
+// ID,open,high,low,close,time,interval,volume.
+func (c Candle) ToCSV() []string {
+	return c.Columns(DefaultColumns)
+}
+
+// Columns returns the given fields of the candle formatted as in the CSV
+// output. Columns should be validated with ParseColumns or name indicators
+// or labels; indicator values not available yet are empty.
+func (c Candle) Columns(columns []string) []string {
+	return DefaultFormat.Columns(c, columns)
+}
+
+// Columns returns the given fields of the candle formatted with f, see
+// Candle.Columns.
+func (f Format) Columns(c Candle, columns []string) []string {
+	if f.AutoScale {
+		f.Scale = priceScale(c.Open, c.High, c.Low, c.Close)
+		f.AutoScale = false
+	}
+
+	result := make([]string, len(columns))
+
+	for i, column := range columns {
+		switch column {
+		case "id":
+			result[i] = c.ID
+		case "open":
+			result[i] = f.Price(c.Open)
+		case "high":
+			result[i] = f.Price(c.High)
+		case "low":
+			result[i] = f.Price(c.Low)
+		case "close":
+			result[i] = f.Price(c.Close)
+		case "volume":
+			result[i] = strconv.FormatFloat(c.Volume, 'f', -1, 64)
+		case "time":
+			result[i] = c.Time.Format(time.RFC3339Nano)
+		case "interval":
+			result[i] = c.Interval.String()
+		case "vwap":
+			result[i] = f.Price(c.VWAP)
+		case "count":
+			result[i] = strconv.Itoa(c.Count)
+		case "spread":
+			result[i] = f.Price(c.Spread)
+		case "max_spread":
+			result[i] = f.Price(c.MaxSpread)
+		case "first_time":
+			result[i] = formatOptionalTime(c.FirstTime)
+		case "last_time":
+			result[i] = formatOptionalTime(c.LastTime)
+		case "first_seq":
+			result[i] = strconv.FormatInt(c.FirstSeq, 10)
+		case "last_seq":
+			result[i] = strconv.FormatInt(c.LastSeq, 10)
+		case "patterns":
+			result[i] = strings.Join(c.Patterns, "|")
+		case "partial":
+			result[i] = strconv.FormatBool(c.Partial)
+		default:
+			if v, ok := c.Labels[column]; ok {
+				result[i] = v
+			} else if v, ok := c.Indicators[column]; ok && !math.IsNaN(v) {
+				result[i] = f.indicator(column, v)
+			}
+		}
+	}
+
+	return result
+}
+
+// formatOptionalTime formats t in RFC 3339, empty if zero.
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+// ParseColumns parses a comma separated list of candle columns such as
+// "id,time,open,high,low,close".
+func ParseColumns(s string) ([]string, error) {
+	var result []string
+
+	for _, column := range strings.Split(s, ",") {
+		column = strings.TrimSpace(column)
+
+		if !isColumn(column) {
+			return nil, fmt.Errorf("unknown column: %q", column)
+		}
+
+		result = append(result, column)
+	}
+
+	return result, nil
+}
+
+func isColumn(column string) bool {
+	for _, c := range DefaultColumns {
+		if c == column {
+			return true
+		}
+	}
+
+	for _, c := range ExtraColumns {
+		if c == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+type candleJSON struct {
+	ID       string    `json:"id"`
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Volume   float64   `json:"volume"`
+	Time     time.Time `json:"time"`
+	Interval string    `json:"interval,omitempty"`
+	VWAP     float64   `json:"vwap,omitempty"`
+	Count    int       `json:"count,omitempty"`
+
+	Spread    float64    `json:"spread,omitempty"`
+	MaxSpread float64    `json:"max_spread,omitempty"`
+	FirstTime *time.Time `json:"first_time,omitempty"`
+	LastTime  *time.Time `json:"last_time,omitempty"`
+	FirstSeq  int64      `json:"first_seq,omitempty"`
+	LastSeq   int64      `json:"last_seq,omitempty"`
+
+	Indicators map[string]float64 `json:"indicators,omitempty"`
+	Patterns   []string           `json:"patterns,omitempty"`
+	Labels     map[string]string  `json:"labels,omitempty"`
+	Partial    bool               `json:"partial,omitempty"`
+}
+
+// MarshalJSON encodes the candle as a JSON object with the interval in the
+// same notation as in the CSV output. Zero VWAP and Count and indicator
+// values not available yet are omitted.
+func (c Candle) MarshalJSON() ([]byte, error) {
+	var indicators map[string]float64
+
+	for name, v := range c.Indicators {
+		if math.IsNaN(v) {
+			continue
+		}
+
+		if indicators == nil {
+			indicators = make(map[string]float64)
+		}
+
+		indicators[name] = v
+	}
+
+	var firstTime, lastTime *time.Time
+
+	if !c.FirstTime.IsZero() {
+		firstTime = &c.FirstTime
+	}
+
+	if !c.LastTime.IsZero() {
+		lastTime = &c.LastTime
+	}
+
+	return json.Marshal(candleJSON{
+		ID:       c.ID,
+		Open:     c.Open,
+		High:     c.High,
+		Low:      c.Low,
+		Close:    c.Close,
+		Volume:   c.Volume,
+		Time:     c.Time,
+		Interval: c.Interval.String(),
+		VWAP:     c.VWAP,
+		Count:    c.Count,
+
+		Spread:    c.Spread,
+		MaxSpread: c.MaxSpread,
+		FirstTime: firstTime,
+		LastTime:  lastTime,
+		FirstSeq:  c.FirstSeq,
+		LastSeq:   c.LastSeq,
+
+		Indicators: indicators,
+		Patterns:   c.Patterns,
+		Labels:     c.Labels,
+		Partial:    c.Partial,
+	})
+}
+
+// UnmarshalJSON decodes a candle encoded by MarshalJSON.
+func (c *Candle) UnmarshalJSON(data []byte) error {
+	var v candleJSON
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	var interval Interval
+
+	if v.Interval != "" {
+		var err error
+
+		if interval, err = ParseInterval(v.Interval); err != nil {
+			return err
+		}
+	}
+
+	*c = Candle{
+		ID:       v.ID,
+		Open:     v.Open,
+		High:     v.High,
+		Low:      v.Low,
+		Close:    v.Close,
+		Volume:   v.Volume,
+		Time:     v.Time,
+		Interval: interval,
+		VWAP:     v.VWAP,
+		Count:    v.Count,
+
+		Spread:    v.Spread,
+		MaxSpread: v.MaxSpread,
+		FirstSeq:  v.FirstSeq,
+		LastSeq:   v.LastSeq,
+
+		Indicators: v.Indicators,
+		Patterns:   v.Patterns,
+		Labels:     v.Labels,
+		Partial:    v.Partial,
+	}
+
+	if v.FirstTime != nil {
+		c.FirstTime = *v.FirstTime
+	}
+
+	if v.LastTime != nil {
+		c.LastTime = *v.LastTime
+	}
+
+	return nil
+}
+
+func newCandle(tick Tick, startTime time.Time, interval Interval, precision Precision) *Candle {
+	c := &Candle{
+		ID:       tick.ID,
+		Open:     tick.Price,
+		High:     tick.Price,
+		Low:      tick.Price,
+		Close:    tick.Price,
+		Volume:   tick.Volume,
+		Time:     startTime,
+		Interval: interval,
+		VWAP:     tick.Price,
+		Count:    1,
+
+		turnover: tick.Price * tick.Volume,
+		priceSum: tick.Price,
+
+		precision: precision,
+		volume:    DecimalFromFloat(tick.Volume),
+
+		first: tick,
+		last:  tick,
+
+		changed: true,
+	}
+
+	c.setFirst(tick)
+	c.setLast(tick)
+	c.addSpread(tick)
+
+	return c
+}
+
+func (c *Candle) end() time.Time {
+	return c.Interval.End(c.Time)
+}
+
+func (c *Candle) add(tick Tick) {
+	if tick.Price > c.High {
+		c.High = tick.Price
+	}
+
+	if tick.Price < c.Low {
+		c.Low = tick.Price
+	}
+
+	if tick.Before(c.first) {
+		c.Open = tick.Price
+		c.setFirst(tick)
+	}
+
+	if !tick.Before(c.last) {
+		c.Close = tick.Price
+		c.setLast(tick)
+	}
+
+	if c.precision == DecimalPrecision {
+		c.volume += DecimalFromFloat(tick.Volume)
+		c.Volume = c.volume.Float()
+	} else {
+		c.Volume += tick.Volume
+	}
+
+	c.Count++
+	c.changed = true
+	c.turnover += tick.Price * tick.Volume
+	c.priceSum += tick.Price
+
+	if c.Volume != 0 {
+		c.VWAP = c.turnover / c.Volume
+	} else {
+		c.VWAP = c.priceSum / float64(c.Count)
+	}
+
+	c.addSpread(tick)
+}
+
+// setFirst makes tick the one setting the open of the candle.
+func (c *Candle) setFirst(tick Tick) {
+	c.first = tick
+	c.FirstTime = tick.Time.In(c.Time.Location())
+	c.FirstSeq = tick.Seq
+}
+
+// setLast makes tick the one setting the close of the candle.
+func (c *Candle) setLast(tick Tick) {
+	c.last = tick
+	c.LastTime = tick.Time.In(c.Time.Location())
+	c.LastSeq = tick.Seq
+}
+
+// addSpread adds the spread of the tick, if quoted, to the spread stats.
+func (c *Candle) addSpread(tick Tick) {
+	if tick.Bid == 0 || tick.Ask == 0 {
+		return
+	}
+
+	spread := tick.Ask - tick.Bid
+
+	if c.quoted == 0 || spread > c.MaxSpread {
+		c.MaxSpread = spread
+	}
+
+	c.quoted++
+	c.spreadSum += spread
+	c.Spread = c.spreadSum / float64(c.quoted)
+}
+
+func formatInterval(interval time.Duration) string {
+	result := interval.String()
+
+	if strings.HasSuffix(result, "m0s") {
+		result = result[:len(result)-2]
+	}
+
+	if strings.HasSuffix(result, "h0m") {
+		result = result[:len(result)-2]
+	}
+
+	return result
+}
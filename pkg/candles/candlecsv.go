@@ -0,0 +1,161 @@
+package candles
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CandleCSVReader reads candles from CSV records as written by Columns.
+type CandleCSVReader struct {
+	r       *csv.Reader
+	columns []string
+	header  bool
+}
+
+// NewCandleCSVReader returns a reader of candles from r. With header the
+// first record names the columns, otherwise they are DefaultColumns.
+func NewCandleCSVReader(r io.Reader, header bool) *CandleCSVReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	return &CandleCSVReader{r: cr, columns: DefaultColumns, header: header}
+}
+
+// Read returns the next candle or io.EOF at the end of the input.
+func (r *CandleCSVReader) Read() (Candle, error) {
+	if r.header {
+		r.header = false
+
+		record, err := r.r.Read()
+		if err != nil {
+			return Candle{}, err
+		}
+
+		r.columns = make([]string, len(record))
+		for i, name := range record {
+			r.columns[i] = strings.ToLower(strings.TrimSpace(name))
+		}
+	}
+
+	record, err := r.r.Read()
+	if err != nil {
+		var csvErr *csv.ParseError
+		if errors.As(err, &csvErr) {
+			return Candle{}, &ParseError{Line: csvErr.Line, Err: csvErr.Err}
+		}
+
+		return Candle{}, err
+	}
+
+	c, err := ParseCandleRecord(record, r.columns)
+	if err != nil {
+		line, _ := r.r.FieldPos(0)
+		return Candle{}, &ParseError{Line: line, Column: errorColumn(err), Record: strings.Join(record, ","), Err: err}
+	}
+
+	return c, nil
+}
+
+// Line returns the line of the last record read.
+func (r *CandleCSVReader) Line() int {
+	line, _ := r.r.FieldPos(0)
+	return line
+}
+
+// ParseCandleRecord parses a candle from the fields of a record named by
+// columns. Unknown columns are ignored; id, open, high, low, close, time and
+// interval are required.
+func ParseCandleRecord(record []string, columns []string) (Candle, error) {
+	for _, column := range requiredCandleColumns {
+		if !slices.Contains(columns, column) {
+			return Candle{}, &FieldError{Kind: ErrMissingField, Field: column}
+		}
+	}
+
+	if len(record) < len(columns) {
+		return Candle{}, &FieldError{Kind: ErrMissingField, Field: columns[len(record)]}
+	}
+
+	var (
+		c   Candle
+		err error
+	)
+
+	for i, column := range columns {
+		field := strings.TrimSpace(record[i])
+
+		switch column {
+		case "id":
+			c.ID = field
+		case "open":
+			c.Open, err = strconv.ParseFloat(field, 64)
+		case "high":
+			c.High, err = strconv.ParseFloat(field, 64)
+		case "low":
+			c.Low, err = strconv.ParseFloat(field, 64)
+		case "close":
+			c.Close, err = strconv.ParseFloat(field, 64)
+		case "time":
+			c.Time, err = time.Parse(time.RFC3339, field)
+		case "interval":
+			if field != "" {
+				c.Interval, err = ParseInterval(field)
+			}
+		case "volume":
+			c.Volume, err = strconv.ParseFloat(field, 64)
+		case "vwap":
+			c.VWAP, err = strconv.ParseFloat(field, 64)
+		case "count":
+			c.Count, err = strconv.Atoi(field)
+		case "spread":
+			c.Spread, err = strconv.ParseFloat(field, 64)
+		case "max_spread":
+			c.MaxSpread, err = strconv.ParseFloat(field, 64)
+		case "first_time":
+			if field != "" {
+				c.FirstTime, err = time.Parse(time.RFC3339, field)
+			}
+		case "last_time":
+			if field != "" {
+				c.LastTime, err = time.Parse(time.RFC3339, field)
+			}
+		case "first_seq":
+			c.FirstSeq, err = strconv.ParseInt(field, 10, 64)
+		case "last_seq":
+			c.LastSeq, err = strconv.ParseInt(field, 10, 64)
+		}
+
+		if err != nil {
+			return Candle{}, &FieldError{Kind: candleFieldKinds[column], Field: column, Column: i + 1, Err: err}
+		}
+	}
+
+	return c, nil
+}
+
+// candleFieldKinds are the kinds of FieldError of the candle columns.
+var candleFieldKinds = map[string]error{
+	"open":       ErrBadPrice,
+	"high":       ErrBadPrice,
+	"low":        ErrBadPrice,
+	"close":      ErrBadPrice,
+	"vwap":       ErrBadPrice,
+	"spread":     ErrBadPrice,
+	"max_spread": ErrBadPrice,
+	"first_time": ErrBadTimestamp,
+	"last_time":  ErrBadTimestamp,
+	"first_seq":  ErrBadSeq,
+	"last_seq":   ErrBadSeq,
+	"time":       ErrBadTimestamp,
+	"interval":   ErrBadInterval,
+	"volume":     ErrBadVolume,
+	"count":      ErrBadCount,
+}
+
+var requiredCandleColumns = []string{"id", "open", "high", "low", "close", "time", "interval"}
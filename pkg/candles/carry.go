@@ -0,0 +1,120 @@
+package candles
+
+import "fmt"
+
+// CarryOpen is which candles open at the close of the previous candle of
+// their series instead of at their first trade.
+type CarryOpen int
+
+const (
+	// CarryNone opens every candle at its first trade.
+	CarryNone CarryOpen = iota
+	// CarryIntraday opens candles at the previous close within a day, or
+	// a session with WithSessions; the first candle of a day or session
+	// opens at its first trade, showing the overnight gap.
+	CarryIntraday
+	// CarryAlways opens every candle but the first of a series at the
+	// previous close, across nights and sessions.
+	CarryAlways
+)
+
+// ParseCarryOpen parses a carry mode: none, intraday or always.
+func ParseCarryOpen(s string) (CarryOpen, error) {
+	switch s {
+	case "none":
+		return CarryNone, nil
+	case "intraday":
+		return CarryIntraday, nil
+	case "always":
+		return CarryAlways, nil
+	}
+
+	return 0, fmt.Errorf("unknown carry mode: %q", s)
+}
+
+// String returns the mode in the notation accepted by ParseCarryOpen.
+func (m CarryOpen) String() string {
+	switch m {
+	case CarryIntraday:
+		return "intraday"
+	case CarryAlways:
+		return "always"
+	}
+
+	return "none"
+}
+
+// openCarrier sets the opens of candles passed in time order per series as
+// WithCarryOpen requires.
+type openCarrier struct {
+	cfg  config
+	prev map[seriesKey]Candle
+}
+
+func newOpenCarrier(cfg config) *openCarrier {
+	return &openCarrier{cfg: cfg, prev: make(map[seriesKey]Candle)}
+}
+
+// next returns c with its open carried from the previous candle of its
+// series, which c then becomes.
+func (o *openCarrier) next(c Candle) Candle {
+	c = o.peek(c)
+
+	if c.Interval != (Interval{}) {
+		o.prev[seriesKey{c.ID, c.Interval}] = c
+	}
+
+	return c
+}
+
+// peek is like next but leaves the previous candle of the series as is, for
+// candles still open.
+func (o *openCarrier) peek(c Candle) Candle {
+	if c.Interval == (Interval{}) {
+		return c
+	}
+
+	prev, ok := o.prev[seriesKey{c.ID, c.Interval}]
+	if !ok || !o.carries(prev, c) {
+		return c
+	}
+
+	c.Open = prev.Close
+	c.High = max(c.High, c.Open)
+	c.Low = min(c.Low, c.Open)
+
+	return c
+}
+
+// carries reports whether c opens at the close of prev.
+func (o *openCarrier) carries(prev, c Candle) bool {
+	switch o.cfg.carryOpen {
+	case CarryAlways:
+		return true
+	case CarryNone:
+		return false
+	}
+
+	// Calendar interval candles start outside sessions and compare by day.
+	if s := o.cfg.schedule; s != nil {
+		prevOpen, _, prevOK := s.session(prev.Time)
+		open, _, ok := s.session(c.Time)
+
+		if prevOK && ok {
+			return prevOpen.Equal(open)
+		}
+	}
+
+	return dateOf(prev.Time.In(o.cfg.location)) == dateOf(c.Time.In(o.cfg.location))
+}
+
+// carryOpen sets the opens of candles sorted as returned by Aggregate.
+func carryOpen(result []Candle, cfg config) []Candle {
+	o := newOpenCarrier(cfg)
+
+	for i := range result {
+		result[i] = o.next(result[i])
+	}
+
+	return result
+}
@@ -0,0 +1,233 @@
+package candles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TickKind is the type of a tick record: a trade, a quote, or a correction
+// of an earlier trade.
+type TickKind int
+
+// Tick kinds.
+const (
+	// Trade is a print entering candles.
+	Trade TickKind = iota
+	// Cancel retracts an earlier trade, a bust.
+	Cancel
+	// Amend replaces the price and volume of an earlier trade.
+	Amend
+	// Quote carries the bid and ask prices instead of a trade, see
+	// WithMidpoints.
+	Quote
+)
+
+var tickKindNames = map[string]TickKind{
+	"":           Trade,
+	"trade":      Trade,
+	"cancel":     Cancel,
+	"cancelled":  Cancel,
+	"bust":       Cancel,
+	"amend":      Amend,
+	"correct":    Amend,
+	"correction": Amend,
+	"quote":      Quote,
+}
+
+// ParseTickKind parses a tick kind: trade, the default if empty, cancel or
+// amend, also called bust and correction, or quote.
+func ParseTickKind(s string) (TickKind, error) {
+	kind, ok := tickKindNames[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("unknown kind %q", s)
+	}
+
+	return kind, nil
+}
+
+// String returns the kind in the notation accepted by ParseTickKind.
+func (k TickKind) String() string {
+	switch k {
+	case Cancel:
+		return "cancel"
+	case Amend:
+		return "amend"
+	case Quote:
+		return "quote"
+	}
+
+	return "trade"
+}
+
+// Correction reports whether the kind corrects an earlier trade.
+func (k TickKind) Correction() bool {
+	return k == Cancel || k == Amend
+}
+
+// MarshalText encodes the kind as its name.
+func (k TickKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a kind parsed by ParseTickKind.
+func (k *TickKind) UnmarshalText(text []byte) error {
+	kind, err := ParseTickKind(string(text))
+	if err != nil {
+		return err
+	}
+
+	*k = kind
+
+	return nil
+}
+
+// correctionKey identifies the trade a correction refers to: a correction
+// carries the ID, time and sequence number of the trade it corrects.
+type correctionKey struct {
+	id   string
+	time int64
+	seq  int64
+}
+
+func keyOf(tick Tick) correctionKey {
+	return correctionKey{id: tick.ID, time: tick.Time.UnixNano(), seq: tick.Seq}
+}
+
+// corrects reports whether the correction refers to the trade.
+func (t Tick) corrects(trade Tick) bool {
+	return trade.ID == t.ID && trade.Time.Equal(t.Time) && trade.Seq == t.Seq
+}
+
+// apply returns trade as corrected by t and whether it is left at all.
+func (t Tick) apply(trade Tick) (Tick, bool) {
+	if t.Kind == Cancel {
+		return Tick{}, false
+	}
+
+	trade.Price = t.Price
+	trade.Volume = t.Volume
+
+	return trade, true
+}
+
+// ApplyCorrections returns the trades and quotes of ticks after applying
+// the cancel and amend records among them in input order. A correction
+// refers to the latest trade before it equal in ID, time and sequence
+// number; the number of corrections referring to no trade is returned too.
+// Ticks without corrections are returned as they are.
+func ApplyCorrections(ticks []Tick) ([]Tick, int) {
+	if !hasCorrections(ticks) {
+		return ticks, 0
+	}
+
+	result := make([]Tick, 0, len(ticks))
+	// trades are the indexes in result of the trades by key, the latest
+	// last; cancelled trades are marked with the Cancel kind and dropped
+	// at the end.
+	trades := make(map[correctionKey][]int)
+	cancelled := 0
+	unmatched := 0
+
+	for _, tick := range ticks {
+		if tick.Kind == Quote {
+			result = append(result, tick)
+			continue
+		}
+
+		key := keyOf(tick)
+
+		if tick.Kind == Trade {
+			trades[key] = append(trades[key], len(result))
+			result = append(result, tick)
+
+			continue
+		}
+
+		indexes := trades[key]
+		if len(indexes) == 0 {
+			unmatched++
+			continue
+		}
+
+		i := indexes[len(indexes)-1]
+
+		corrected, ok := tick.apply(result[i])
+		if ok {
+			result[i] = corrected
+			continue
+		}
+
+		result[i].Kind = Cancel
+		trades[key] = indexes[:len(indexes)-1]
+		cancelled++
+	}
+
+	if cancelled == 0 {
+		return result, unmatched
+	}
+
+	n := 0
+
+	for _, tick := range result {
+		if tick.Kind != Cancel {
+			result[n] = tick
+			n++
+		}
+	}
+
+	return result[:n], unmatched
+}
+
+func hasCorrections(ticks []Tick) bool {
+	for _, tick := range ticks {
+		if tick.Kind.Correction() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithCorrections makes an Aggregator keep the trades of its open candles,
+// so that cancel and amend ticks can retract or replace them and the
+// candles are rebuilt. Without it corrections are dropped and counted by
+// UnmatchedCorrections. Aggregate always applies corrections.
+func WithCorrections(keep bool) Option {
+	return func(cfg *config) {
+		cfg.corrections = keep
+	}
+}
+
+// correct applies a correction to the open candle of one interval, and
+// reports whether it found the trade. A candle left without trades is
+// reported empty.
+func (c *Candle) correct(tick Tick) (found, empty bool) {
+	i := len(c.trades) - 1
+	for i >= 0 && !tick.corrects(c.trades[i]) {
+		i--
+	}
+
+	if i < 0 {
+		return false, false
+	}
+
+	if corrected, ok := tick.apply(c.trades[i]); ok {
+		c.trades[i] = corrected
+	} else {
+		c.trades = append(c.trades[:i], c.trades[i+1:]...)
+	}
+
+	if len(c.trades) == 0 {
+		return true, true
+	}
+
+	rebuilt := newCandle(c.trades[0], c.Time, c.Interval, c.precision)
+	for _, trade := range c.trades[1:] {
+		rebuilt.add(trade)
+	}
+
+	rebuilt.trades = c.trades
+	*c = *rebuilt
+
+	return true, false
+}
@@ -0,0 +1,189 @@
+package candles
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CSVOptions configures CSVReader.
+type CSVOptions struct {
+	// Comma is the field delimiter, ',' by default.
+	Comma rune
+	// LazyQuotes allows quotes to appear in unquoted fields and
+	// non-doubled quotes in quoted fields.
+	LazyQuotes bool
+	// Header means the first record names the columns. Known names are
+	// id, price, time, volume and seq along with a few common aliases.
+	Header bool
+	// ParseTime parses timestamps, ParseTime if nil.
+	ParseTime TimeParser
+	// Precision selects how prices and volumes are parsed.
+	Precision Precision
+	// MaxLineBytes limits the length of input lines, 0 for no limit.
+	// Longer lines are parse errors of ErrLineTooLong.
+	MaxLineBytes int
+}
+
+// CSVReader reads ticks from CSV records.
+type CSVReader struct {
+	r       *csv.Reader
+	parser  TickParser
+	header  bool
+	symbols *Symbols
+}
+
+// NewCSVReader returns a reader of ticks from r.
+func NewCSVReader(r io.Reader, opts CSVOptions) *CSVReader {
+	if opts.MaxLineBytes > 0 {
+		r = &lineLimitReader{r: r, max: opts.MaxLineBytes}
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = opts.LazyQuotes
+	cr.ReuseRecord = true
+
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+
+	return &CSVReader{
+		r:       cr,
+		parser:  TickParser{Columns: DefaultTickColumns, ParseTime: opts.ParseTime, Precision: opts.Precision},
+		header:  opts.Header,
+		symbols: NewSymbols(),
+	}
+}
+
+// Read returns the next tick or io.EOF at the end of the input.
+func (r *CSVReader) Read() (Tick, error) {
+	if r.header {
+		r.header = false
+
+		record, err := r.r.Read()
+		if err != nil {
+			return Tick{}, err
+		}
+
+		if r.parser.Columns, err = TickColumnsFromHeader(record); err != nil {
+			return Tick{}, err
+		}
+	}
+
+	record, err := r.r.Read()
+	if err != nil {
+		var csvErr *csv.ParseError
+		if errors.As(err, &csvErr) {
+			return Tick{}, &ParseError{Line: csvErr.Line, Err: csvErr.Err}
+		}
+
+		return Tick{}, err
+	}
+
+	tick, err := r.parser.ParseRecord(record)
+	if err != nil {
+		line, _ := r.r.FieldPos(0)
+		return Tick{}, &ParseError{Line: line, Column: errorColumn(err), Record: strings.Join(record, string(r.r.Comma)), Err: err}
+	}
+
+	tick.ID = r.symbols.Intern(tick.ID)
+
+	return tick, nil
+}
+
+// ParseError is returned by the tick readers for a record that can't be
+// parsed. Reading may continue with the next record.
+type ParseError struct {
+	// File is the name of the input, if known.
+	File string
+	Line int
+	// Column is the 1-based number of the field that can't be parsed, 0 if
+	// unknown.
+	Column int
+	Record string
+	// Err is the cause, a *FieldError if a field is at fault.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// errorColumn returns the column of a *FieldError, or 0.
+func errorColumn(err error) int {
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		return fieldErr.Column
+	}
+
+	return 0
+}
+
+var tickColumnNames = map[string]string{
+	"id":        "id",
+	"ticker":    "id",
+	"figi":      "id",
+	"price":     "price",
+	"coast":     "price",
+	"time":      "time",
+	"ts":        "time",
+	"timestamp": "time",
+	"volume":    "volume",
+	"quantity":  "volume",
+	"qty":       "volume",
+	"seq":       "seq",
+	"sequence":  "seq",
+	"seq_no":    "seq",
+	"bid":       "bid",
+	"bid_price": "bid",
+	"ask":       "ask",
+	"ask_price": "ask",
+	"kind":      "kind",
+	"type":      "kind",
+	"action":    "kind",
+}
+
+// TickColumnsFromHeader maps tick fields to columns by the names in header.
+func TickColumnsFromHeader(header []string) (TickColumns, error) {
+	cols := TickColumns{ID: -1, Price: -1, Time: -1, Volume: -1, Seq: -1, Kind: -1, Bid: -1, Ask: -1}
+
+	for i, name := range header {
+		switch tickColumnNames[strings.ToLower(strings.TrimSpace(name))] {
+		case "id":
+			cols.ID = i
+		case "price":
+			cols.Price = i
+		case "time":
+			cols.Time = i
+		case "volume":
+			cols.Volume = i
+		case "seq":
+			cols.Seq = i
+		case "kind":
+			cols.Kind = i
+		case "bid":
+			cols.Bid = i
+		case "ask":
+			cols.Ask = i
+		}
+	}
+
+	quotes := cols.Bid >= 0 && cols.Ask >= 0
+
+	if cols.ID < 0 || cols.Time < 0 || cols.Price < 0 && !quotes {
+		return TickColumns{}, fmt.Errorf("header must name id, price or bid and ask, and time columns: %s", strings.Join(header, ","))
+	}
+
+	return cols, nil
+}
@@ -0,0 +1,197 @@
+package candles
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Decimal is a fixed point number with nine fractional digits, the
+// precision of the quotations of the API. Sums of decimals are exact where
+// float64 sums accumulate rounding errors.
+type Decimal int64
+
+const (
+	decimalDigits = 9
+	decimalScale  = 1_000_000_000
+)
+
+// ParseDecimal parses a decimal number such as "-12.3405". Unlike rounding
+// to float64 it fails on more than nine fractional digits.
+func ParseDecimal(s string) (Decimal, error) {
+	digits, neg := strings.CutPrefix(s, "-")
+	if !neg {
+		digits = strings.TrimPrefix(digits, "+")
+	}
+
+	whole, frac, _ := strings.Cut(digits, ".")
+
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid decimal: %q", s)
+	}
+
+	if len(frac) > decimalDigits {
+		return 0, fmt.Errorf("decimal has more than %d fractional digits: %q", decimalDigits, s)
+	}
+
+	var units int64
+
+	if whole != "" {
+		var err error
+
+		units, err = strconv.ParseInt(whole, 10, 64)
+		if err != nil || units > math.MaxInt64/decimalScale-1 {
+			return 0, fmt.Errorf("decimal out of range: %q", s)
+		}
+	}
+
+	var nanos int64
+
+	if frac != "" {
+		nanos, _ = strconv.ParseInt(frac+strings.Repeat("0", decimalDigits-len(frac)), 10, 64)
+	}
+
+	d := Decimal(units*decimalScale + nanos)
+	if neg {
+		d = -d
+	}
+
+	return d, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DecimalFromFloat returns the decimal nearest to f. A float64 parsed from
+// a decimal of up to 15 significant digits converts back to it exactly.
+func DecimalFromFloat(f float64) Decimal {
+	return Decimal(math.Round(f * decimalScale))
+}
+
+// Float returns the float64 nearest to the decimal.
+func (d Decimal) Float() float64 {
+	return float64(d) / decimalScale
+}
+
+// Round rounds the decimal to the given number of fractional digits in the
+// rounding mode; RoundDefault rounds half away from zero.
+func (d Decimal) Round(places int, mode Rounding) Decimal {
+	if places >= decimalDigits {
+		return d
+	}
+
+	unit := Decimal(math.Pow10(decimalDigits - places))
+	rem := d % unit
+	d -= rem
+
+	if rem == 0 {
+		return d
+	}
+
+	step := unit
+	if rem < 0 {
+		step, rem = -unit, -rem
+	}
+
+	switch mode {
+	case RoundHalfEven:
+		if rem > unit/2 || rem == unit/2 && (d/unit)%2 != 0 {
+			d += step
+		}
+	case RoundDown:
+	case RoundUp:
+		d += step
+	default:
+		if rem >= unit/2 {
+			d += step
+		}
+	}
+
+	return d
+}
+
+// Format returns the decimal rounded to the given number of fractional
+// digits in the rounding mode.
+func (d Decimal) Format(places int, mode Rounding) string {
+	d = d.Round(places, mode)
+
+	s := d.String()
+	whole, frac, _ := strings.Cut(s, ".")
+
+	if places <= 0 {
+		return whole
+	}
+
+	return whole + "." + frac + strings.Repeat("0", places-len(frac))
+}
+
+// String returns the decimal without trailing fractional zeros.
+func (d Decimal) String() string {
+	var sign string
+
+	u := uint64(d)
+	if d < 0 {
+		sign = "-"
+		u = uint64(-d)
+	}
+
+	s := sign + strconv.FormatUint(u/decimalScale, 10)
+
+	if nanos := u % decimalScale; nanos != 0 {
+		frac := fmt.Sprintf("%09d", nanos)
+		s += "." + strings.TrimRight(frac, "0")
+	}
+
+	return s
+}
+
+// Precision selects the arithmetic of prices and volumes.
+type Precision int
+
+// Precisions.
+const (
+	// FloatPrecision uses float64 arithmetic and formatting.
+	FloatPrecision Precision = iota
+	// DecimalPrecision parses numbers as decimals, sums volumes exactly and
+	// rounds prices half away from zero in the decimal notation.
+	DecimalPrecision
+)
+
+// ParsePrecision parses a precision: float or decimal.
+func ParsePrecision(s string) (Precision, error) {
+	switch s {
+	case "float":
+		return FloatPrecision, nil
+	case "decimal":
+		return DecimalPrecision, nil
+	}
+
+	return 0, fmt.Errorf("unknown precision: %q", s)
+}
+
+// String returns the precision in the notation accepted by ParsePrecision.
+func (p Precision) String() string {
+	if p == DecimalPrecision {
+		return "decimal"
+	}
+
+	return "float"
+}
+
+// parseNumber parses a price or a volume with the precision.
+func (p Precision) parseNumber(s string) (float64, error) {
+	if p == DecimalPrecision {
+		d, err := ParseDecimal(s)
+		return d.Float(), err
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,49 @@
+package candles
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of FieldError, to tell bad records apart with errors.Is.
+var (
+	ErrMissingField = errors.New("missing field")
+	ErrBadPrice     = errors.New("bad price")
+	ErrBadVolume    = errors.New("bad volume")
+	ErrBadTimestamp = errors.New("bad timestamp")
+	ErrBadSeq       = errors.New("bad sequence number")
+	ErrBadKind      = errors.New("bad tick kind")
+	ErrBadInterval  = errors.New("bad interval")
+	ErrBadCount     = errors.New("bad count")
+)
+
+// FieldError is returned by the parsers of ticks and candles for a field
+// that is missing or can't be parsed. It matches its Kind and its cause
+// with errors.Is.
+type FieldError struct {
+	// Kind is one of the Err variables above.
+	Kind error
+	// Field is the name of the field.
+	Field string
+	// Column is the 1-based number of the field in a CSV record, 0 for
+	// JSON or a missing field.
+	Column int
+	// Err is the cause, nil for a missing field.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%v %s", e.Kind, e.Field)
+	}
+
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *FieldError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+
+	return []error{e.Kind, e.Err}
+}
@@ -0,0 +1,87 @@
+package candles
+
+import "time"
+
+// GapFiller inserts synthetic candles for the intervals without ticks
+// between the candles of a series. A synthetic candle has open, high, low
+// and close equal to the previous close and zero volume. Each instrument
+// and interval is a separate series; activity driven bars are passed
+// through.
+type GapFiller struct {
+	prev map[seriesKey]Candle
+	// schedule and calendar, if set, limit the synthetic candles to their
+	// sessions and trading days.
+	schedule *Schedule
+	calendar *Calendar
+}
+
+// NewGapFiller returns a gap filler with no history.
+func NewGapFiller() *GapFiller {
+	return newGapFiller(nil, nil)
+}
+
+func newGapFiller(schedule *Schedule, calendar *Calendar) *GapFiller {
+	return &GapFiller{prev: make(map[seriesKey]Candle), schedule: schedule, calendar: calendar}
+}
+
+// Next returns the synthetic candles preceding c in its series followed by
+// c. Candles of a series must be passed in time order.
+func (f *GapFiller) Next(c Candle) []Candle {
+	if c.Interval == (Interval{}) {
+		return []Candle{c}
+	}
+
+	key := seriesKey{c.ID, c.Interval}
+
+	var result []Candle
+
+	if prev, ok := f.prev[key]; ok {
+		for t := f.next(c.Interval, prev.Time); t.Before(c.Time); t = f.next(c.Interval, t) {
+			if f.calendar != nil && !f.calendar.HasTradingDay(c.Interval, t) {
+				continue
+			}
+
+			result = append(result, Candle{
+				ID:       c.ID,
+				Open:     prev.Close,
+				High:     prev.Close,
+				Low:      prev.Close,
+				Close:    prev.Close,
+				Time:     t,
+				Interval: c.Interval,
+				VWAP:     prev.Close,
+			})
+		}
+	}
+
+	f.prev[key] = c
+
+	return append(result, c)
+}
+
+// next returns the start of the candle of the interval following start.
+func (f *GapFiller) next(i Interval, start time.Time) time.Time {
+	if f.schedule == nil {
+		return i.End(start)
+	}
+
+	return f.schedule.Next(i, start)
+}
+
+// FillGaps inserts synthetic candles into candles sorted as returned by
+// Aggregate.
+func FillGaps(result []Candle) []Candle {
+	return fillGaps(result, nil, nil)
+}
+
+func fillGaps(result []Candle, schedule *Schedule, calendar *Calendar) []Candle {
+	f := newGapFiller(schedule, calendar)
+
+	var filled []Candle
+
+	for _, c := range result {
+		filled = append(filled, f.Next(c)...)
+	}
+
+	return filled
+}
@@ -0,0 +1,108 @@
+package candles
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Format configures how prices of candles are formatted in the CSV output.
+type Format struct {
+	// Precision selects the arithmetic of rounding: FloatPrecision rounds
+	// the binary value, DecimalPrecision the decimal notation, so that
+	// 1.005 becomes 1.01 rather than 1.00.
+	Precision Precision
+	// Scale is the number of decimal places of prices.
+	Scale int
+	// AutoScale infers the scale of each candle from its prices: as many
+	// decimal places as its open, high, low and close need, at least
+	// DefaultFormat.Scale and at most nine.
+	AutoScale bool
+	// Rounding is the rounding mode. Modes other than RoundDefault round
+	// the decimal notation whatever the precision.
+	Rounding Rounding
+	// Ratios are the indicator columns of ratios rather than prices, such
+	// as returns, formatted in full precision.
+	Ratios []string
+}
+
+// DefaultFormat is the format of Candle.Columns: two decimal places.
+var DefaultFormat = Format{Scale: 2}
+
+// Price formats a price, VWAP or indicator value.
+func (f Format) Price(v float64) string {
+	scale := f.Scale
+	if f.AutoScale {
+		scale = priceScale(v)
+	}
+
+	if f.Precision == DecimalPrecision || f.Rounding != RoundDefault {
+		return DecimalFromFloat(v).Format(scale, f.Rounding)
+	}
+
+	return strconv.FormatFloat(v, 'f', scale, 64)
+}
+
+// indicator formats an indicator value, a price unless a ratio.
+func (f Format) indicator(column string, v float64) string {
+	if slices.Contains(f.Ratios, column) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return f.Price(v)
+}
+
+// priceScale returns the number of decimal places the prices need, at least
+// the default scale.
+func priceScale(prices ...float64) int {
+	scale := DefaultFormat.Scale
+
+	for _, p := range prices {
+		s := strconv.FormatFloat(p, 'f', -1, 64)
+
+		if _, frac, ok := strings.Cut(s, "."); ok && len(frac) > scale {
+			scale = min(len(frac), decimalDigits)
+		}
+	}
+
+	return scale
+}
+
+// Rounding is a rounding mode of prices.
+type Rounding int
+
+// Rounding modes.
+const (
+	// RoundDefault rounds half to even of the binary value with
+	// FloatPrecision, as %f does, and half away from zero with
+	// DecimalPrecision.
+	RoundDefault Rounding = iota
+	// RoundHalfUp rounds half away from zero.
+	RoundHalfUp
+	// RoundHalfEven rounds half to the even digit.
+	RoundHalfEven
+	// RoundDown truncates towards zero.
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+)
+
+// ParseRounding parses a rounding mode: default, half-up, half-even, down
+// or up.
+func ParseRounding(s string) (Rounding, error) {
+	switch s {
+	case "default":
+		return RoundDefault, nil
+	case "half-up":
+		return RoundHalfUp, nil
+	case "half-even":
+		return RoundHalfEven, nil
+	case "down":
+		return RoundDown, nil
+	case "up":
+		return RoundUp, nil
+	}
+
+	return 0, fmt.Errorf("unknown rounding mode: %q", s)
+}
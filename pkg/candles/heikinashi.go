@@ -0,0 +1,62 @@
+package candles
+
+import "math"
+
+// seriesKey identifies the candles of an instrument on a single interval.
+type seriesKey struct {
+	ID       string
+	Interval Interval
+}
+
+// HeikinAshi converts candles into Heikin-Ashi candles:
+//
+//	close = (open + high + low + close) / 4
+//	open  = (previous open + previous close) / 2, (open + close) / 2 first
+//	high  = max(high, open, close)
+//	low   = min(low, open, close)
+//
+// where open and close on the right are Heikin-Ashi values. Each instrument
+// and interval is a separate series.
+type HeikinAshi struct {
+	prev map[seriesKey]Candle
+}
+
+// NewHeikinAshi returns a converter with no history.
+func NewHeikinAshi() *HeikinAshi {
+	return &HeikinAshi{prev: make(map[seriesKey]Candle)}
+}
+
+// Next converts the next candle of its series. Candles of a series must be
+// passed in time order.
+func (h *HeikinAshi) Next(c Candle) Candle {
+	key := seriesKey{c.ID, c.Interval}
+	result := c
+
+	result.Close = (c.Open + c.High + c.Low + c.Close) / 4
+
+	if prev, ok := h.prev[key]; ok {
+		result.Open = (prev.Open + prev.Close) / 2
+	} else {
+		result.Open = (c.Open + c.Close) / 2
+	}
+
+	result.High = math.Max(c.High, math.Max(result.Open, result.Close))
+	result.Low = math.Min(c.Low, math.Min(result.Open, result.Close))
+
+	h.prev[key] = result
+
+	return result
+}
+
+// ToHeikinAshi converts candles sorted as returned by Aggregate into
+// Heikin-Ashi candles.
+func ToHeikinAshi(result []Candle) []Candle {
+	h := NewHeikinAshi()
+	converted := make([]Candle, len(result))
+
+	for i, c := range result {
+		converted[i] = h.Next(c)
+	}
+
+	return converted
+}
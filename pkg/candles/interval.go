@@ -0,0 +1,207 @@
+package candles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interval is the length of a candle: either a fixed duration or a whole
+// number of calendar days, ISO weeks or months. Exactly one field is set.
+type Interval struct {
+	Duration time.Duration
+	Days     int
+	Weeks    int
+	Months   int
+}
+
+// Fixed returns an interval of a fixed duration.
+func Fixed(d time.Duration) Interval {
+	return Interval{Duration: d}
+}
+
+// Days returns an interval of n calendar days starting at midnight.
+func Days(n int) Interval {
+	return Interval{Days: n}
+}
+
+// Weeks returns an interval of n ISO weeks starting at Monday midnight.
+func Weeks(n int) Interval {
+	return Interval{Weeks: n}
+}
+
+// Months returns an interval of n calendar months starting at midnight of
+// the first day of a month.
+func Months(n int) Interval {
+	return Interval{Months: n}
+}
+
+// IsCalendar reports whether the interval is aligned to calendar
+// boundaries rather than being a fixed duration.
+func (i Interval) IsCalendar() bool {
+	return i.Duration == 0
+}
+
+// Truncate returns the start of the interval containing t in loc. Fixed
+// intervals are aligned to the wall clock of loc at t, a candle cut at a
+// change of the UTC offset such as daylight saving time, and calendar
+// intervals to the calendar of loc.
+func (i Interval) Truncate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+
+	if !i.IsCalendar() {
+		start := wallTruncate(t, i.Duration)
+
+		if zoneStart, _ := t.ZoneBounds(); start.Before(zoneStart) {
+			return zoneStart
+		}
+
+		return start
+	}
+
+	year, month, day := t.Date()
+
+	switch {
+	case i.Months > 0:
+		m := year*12 + int(month) - 1
+		m -= mod(m, i.Months)
+
+		return time.Date(m/12, time.Month(m%12+1), 1, 0, 0, 0, 0, loc)
+	case i.Weeks > 0:
+		// 1970-01-05 is the first Monday after the Unix epoch.
+		days := civilDays(year, month, day) - 4
+		days -= mod(days, 7*i.Weeks)
+
+		return time.Date(1970, 1, 5+days, 0, 0, 0, 0, loc)
+	default:
+		days := civilDays(year, month, day)
+		days -= mod(days, i.Days)
+
+		return time.Date(1970, 1, 1+days, 0, 0, 0, 0, loc)
+	}
+}
+
+// End returns the end of the interval starting at start: for fixed
+// intervals the next wall clock boundary or the change of the UTC offset,
+// whichever is earlier, matching Truncate.
+func (i Interval) End(start time.Time) time.Time {
+	if !i.IsCalendar() {
+		end := wallTruncate(start, i.Duration).Add(i.Duration)
+
+		if _, zoneEnd := start.ZoneBounds(); !zoneEnd.IsZero() && zoneEnd.Before(end) {
+			return zoneEnd
+		}
+
+		return end
+	}
+
+	year, month, day := start.Date()
+
+	switch {
+	case i.Months > 0:
+		return time.Date(year, month+time.Month(i.Months), 1, 0, 0, 0, 0, start.Location())
+	case i.Weeks > 0:
+		return time.Date(year, month, day+7*i.Weeks, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Date(year, month, day+i.Days, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// wallTruncate truncates t to a multiple of d on the wall clock of its
+// location at the UTC offset of t.
+func wallTruncate(t time.Time, d time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+
+	return t.Add(shift).Truncate(d).Add(-shift)
+}
+
+// String returns the interval in the notation accepted by ParseInterval,
+// or an empty string for the zero interval of activity driven bars.
+func (i Interval) String() string {
+	switch {
+	case i.Months > 0:
+		return strconv.Itoa(i.Months) + "mo"
+	case i.Weeks > 0:
+		return strconv.Itoa(i.Weeks) + "w"
+	case i.Days > 0:
+		return strconv.Itoa(i.Days) + "d"
+	case i.Duration == 0:
+		return ""
+	}
+
+	return formatInterval(i.Duration)
+}
+
+// approx returns the nominal length of the interval, used for ordering.
+func (i Interval) approx() time.Duration {
+	switch {
+	case i.Months > 0:
+		return time.Duration(i.Months) * 30 * 24 * time.Hour
+	case i.Weeks > 0:
+		return time.Duration(i.Weeks) * 7 * 24 * time.Hour
+	case i.Days > 0:
+		return time.Duration(i.Days) * 24 * time.Hour
+	}
+
+	return i.Duration
+}
+
+func (i Interval) less(other Interval) bool {
+	if i.approx() != other.approx() {
+		return i.approx() < other.approx()
+	}
+
+	return i.String() < other.String()
+}
+
+// ParseInterval parses an interval: a Go duration such as "5m" or "1h30m",
+// or a number of calendar days, weeks or months such as "1d", "2w", "1mo".
+func ParseInterval(s string) (Interval, error) {
+	for _, unit := range []string{"mo", "w", "d"} {
+		n, ok := strings.CutSuffix(s, unit)
+		if !ok {
+			continue
+		}
+
+		count, err := strconv.Atoi(n)
+		if err != nil {
+			break
+		}
+
+		if count <= 0 {
+			return Interval{}, fmt.Errorf("interval must be positive: %s", s)
+		}
+
+		switch unit {
+		case "mo":
+			return Months(count), nil
+		case "w":
+			return Weeks(count), nil
+		default:
+			return Days(count), nil
+		}
+	}
+
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return Interval{}, err
+	}
+
+	if dur <= 0 {
+		return Interval{}, fmt.Errorf("interval must be positive: %s", s)
+	}
+
+	return Fixed(dur), nil
+}
+
+// civilDays returns the number of days from 1970-01-01 to the given date.
+func civilDays(year int, month time.Month, day int) int {
+	return int(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// mod returns a non-negative remainder of a divided by b.
+func mod(a, b int) int {
+	return (a%b + b) % b
+}
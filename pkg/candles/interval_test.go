@@ -0,0 +1,75 @@
+package candles
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestDaylightSaving aggregates ticks across the changes of the UTC offset
+// in New York in batch and streaming mode. The candles must not overlap,
+// must conserve the volume and must be the same in both modes.
+func TestDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	intervals := []Interval{Fixed(45 * time.Minute), Fixed(time.Hour), Fixed(4 * time.Hour)}
+
+	var ticks []Tick
+
+	for _, from := range []time.Time{
+		time.Date(2024, 3, 9, 20, 0, 0, 0, time.UTC),
+		time.Date(2024, 11, 2, 20, 0, 0, 0, time.UTC),
+	} {
+		for i := 0; i < 26*60; i += 7 {
+			ticks = append(ticks, Tick{ID: "SPY", Price: float64(100 + i%13), Volume: 1, Time: from.Add(time.Duration(i) * time.Minute)})
+		}
+	}
+
+	opts := []Option{WithIntervals(intervals...), WithTimezone(loc)}
+	want := Aggregate(append([]Tick(nil), ticks...), opts...)
+
+	agg := NewAggregator(opts...)
+
+	var got []Candle
+
+	for _, tick := range ticks {
+		got = append(got, agg.AddTick(tick)...)
+	}
+
+	got = append(got, agg.Flush()...)
+	sortCandles(got)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("streaming gives %d candles, batch %d different ones", len(got), len(want))
+	}
+
+	for _, interval := range intervals {
+		var end time.Time
+
+		volume := 0.0
+
+		for _, c := range want {
+			if c.Interval != interval {
+				continue
+			}
+
+			if c.Time.Before(end) {
+				t.Errorf("%s candle at %s starts before the previous one ends at %s", interval, c.Time, end)
+			}
+
+			if got := interval.Truncate(c.Time, loc); !got.Equal(c.Time) {
+				t.Errorf("%s candle at %s truncates to %s", interval, c.Time, got)
+			}
+
+			end = interval.End(c.Time)
+			volume += c.Volume
+		}
+
+		if volume != float64(len(ticks)) {
+			t.Errorf("%s candles have volume %v, want %d", interval, volume, len(ticks))
+		}
+	}
+}
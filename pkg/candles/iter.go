@@ -0,0 +1,29 @@
+//go:build go1.23
+
+package candles
+
+import "iter"
+
+// Candles lazily aggregates ticks like the streaming Aggregator: each candle
+// is yielded as soon as the ticks pulled so far close it, and the candles
+// still open are yielded once ticks are exhausted. Ticks are pulled only as
+// candles are consumed, so breaking out of the loop stops reading them.
+func Candles(ticks iter.Seq[Tick], opts ...Option) iter.Seq[Candle] {
+	return func(yield func(Candle) bool) {
+		a := NewAggregator(opts...)
+
+		for tick := range ticks {
+			for _, c := range a.AddTick(tick) {
+				if !yield(c) {
+					return
+				}
+			}
+		}
+
+		for _, c := range a.Flush() {
+			if !yield(c) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package candles
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrLineTooLong is returned for input lines longer than the limit set
+// with CSVOptions.MaxLineBytes or NewLineReader.
+var ErrLineTooLong = errors.New("line too long")
+
+// LineReader reads lines of any length, unlike bufio.Scanner, whose lines
+// are limited by its buffer.
+type LineReader struct {
+	r   *bufio.Reader
+	max int
+	buf []byte
+}
+
+// NewLineReader returns a reader of the lines of r. Lines longer than max
+// bytes are skipped with ErrLineTooLong; 0 means no limit.
+func NewLineReader(r io.Reader, max int) *LineReader {
+	return &LineReader{r: bufio.NewReader(r), max: max}
+}
+
+// ReadLine returns the next line without its \n or \r\n ending, valid until
+// the next call, or io.EOF at the end of the input. Reading continues with
+// the following line after ErrLineTooLong.
+func (r *LineReader) ReadLine() ([]byte, error) {
+	r.buf = r.buf[:0]
+	tooLong := false
+
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+
+		if !tooLong {
+			r.buf = append(r.buf, chunk...)
+
+			if r.max > 0 && len(bytes.TrimRight(r.buf, "\r\n")) > r.max {
+				// Drop the line as it is read rather than holding it all.
+				tooLong = true
+				r.buf = r.buf[:0]
+			}
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && (len(r.buf) > 0 || tooLong):
+		case err != nil:
+			return nil, err
+		}
+
+		if tooLong {
+			return nil, ErrLineTooLong
+		}
+
+		return bytes.TrimSuffix(bytes.TrimSuffix(r.buf, []byte{'\n'}), []byte{'\r'}), nil
+	}
+}
+
+// lineLimitReader fails reading with a *ParseError of ErrLineTooLong once
+// a line is longer than max bytes, and then drops the rest of the line. The
+// error comes with the start of the line, which the csv reader counts as a
+// line of its own.
+type lineLimitReader struct {
+	r       io.Reader
+	max     int
+	n       int
+	line    int
+	skip    bool
+	pending []byte
+}
+
+func (r *lineLimitReader) Read(p []byte) (int, error) {
+	var (
+		n   int
+		err error
+	)
+
+	if len(r.pending) > 0 {
+		n = copy(p, r.pending)
+		r.pending = r.pending[n:]
+	} else {
+		n, err = r.r.Read(p)
+	}
+
+	out := 0
+
+	for i := 0; i < n; i++ {
+		b := p[i]
+
+		if r.skip {
+			if b == '\n' {
+				r.skip = false
+				r.line++
+				r.n = 0
+			}
+
+			continue
+		}
+
+		p[out] = b
+		out++
+
+		if b == '\n' {
+			r.line++
+			r.n = 0
+
+			continue
+		}
+
+		if r.n++; r.n > r.max && b != '\r' {
+			// Keep what follows for the next reads, p belongs to the
+			// caller.
+			r.skip = true
+			r.pending = append(bytes.Clone(p[i+1:n]), r.pending...)
+
+			return out, &ParseError{Line: r.line + 1, Err: ErrLineTooLong}
+		}
+	}
+
+	return out, err
+}
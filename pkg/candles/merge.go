@@ -0,0 +1,89 @@
+package candles
+
+// Conflict is a candle of both sets given to MergeConflicts that differs
+// between them in a way a run missing some ticks can't explain. Kept is the
+// candle in the result.
+type Conflict struct {
+	A, B Candle
+	Kept Candle
+}
+
+// mergeKey identifies a candle: its instrument, interval and start.
+type mergeKey struct {
+	id       string
+	interval Interval
+	time     int64
+}
+
+// Merge combines two candle sets from overlapping runs, such as a backfill
+// and an existing store, see MergeConflicts.
+func Merge(a, b []Candle) []Candle {
+	result, _ := MergeConflicts(a, b)
+	return result
+}
+
+// MergeConflicts combines two candle sets from overlapping runs. A candle
+// of only one set is kept as it is; of two candles of the same instrument,
+// interval and time the one built from more ticks is kept, then the one
+// with more volume, then the one of a. They conflict unless the kept one
+// could have been built from the ticks of the other and more: its high not
+// lower, its low not higher and its volume not smaller, and, if built from
+// as many ticks and volume, equal. Candles repeated within a set are
+// merged the same way. The result is sorted as by Aggregate.
+func MergeConflicts(a, b []Candle) ([]Candle, []Conflict) {
+	index := make(map[mergeKey]int, len(a))
+	result := make([]Candle, 0, len(a)+len(b))
+
+	var conflicts []Conflict
+
+	for _, c := range append(a[:len(a):len(a)], b...) {
+		key := mergeKeyOf(c)
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(result)
+			result = append(result, c)
+
+			continue
+		}
+
+		kept, other := result[i], c
+		if prefer(c, kept) {
+			kept, other = c, kept
+		}
+
+		if !covers(kept, other) {
+			conflicts = append(conflicts, Conflict{A: result[i], B: c, Kept: kept})
+		}
+
+		result[i] = kept
+	}
+
+	sortCandles(result)
+
+	return result, conflicts
+}
+
+func mergeKeyOf(c Candle) mergeKey {
+	return mergeKey{id: c.ID, interval: c.Interval, time: c.Time.UnixNano()}
+}
+
+// prefer reports whether candle c is preferred over o, built from more
+// ticks or else more volume.
+func prefer(c, o Candle) bool {
+	if c.Count != o.Count {
+		return c.Count > o.Count
+	}
+
+	return c.Volume > o.Volume
+}
+
+// covers reports whether candle c could have been built from the ticks of
+// o and possibly more.
+func covers(c, o Candle) bool {
+	if c.Count == o.Count && c.Volume == o.Volume {
+		return c.Open == o.Open && c.High == o.High && c.Low == o.Low && c.Close == o.Close
+	}
+
+	return c.High >= o.High && c.Low <= o.Low && c.Volume >= o.Volume && c.Count >= o.Count
+}
@@ -0,0 +1,362 @@
+package candles
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// MmapReader reads ticks from a CSV file mapped into memory. It splits
+// records and parses plain decimal numbers itself, without copying lines
+// or allocating strings other than new instrument IDs, and falls back to
+// encoding/csv for records with quotes. The ticks and errors are those
+// CSVReader returns for the same file.
+type MmapReader struct {
+	data  []byte
+	unmap func() error
+	off   int
+	line  int
+
+	comma      byte
+	lazyQuotes bool
+	maxLine    int
+	parser     TickParser
+	header     bool
+
+	fields  []string
+	symbols *Symbols
+}
+
+// OpenMmapReader maps the named file into memory and returns a reader of
+// its ticks. The comma of opts must be a single byte character. Mapping
+// needs a file system that supports it; on systems without mmap the file
+// is read into memory instead.
+func OpenMmapReader(name string, opts CSVOptions) (*MmapReader, error) {
+	comma := opts.Comma
+	if comma == 0 {
+		comma = ','
+	}
+
+	if comma >= utf8.RuneSelf {
+		return nil, &os.PathError{Op: "mmap", Path: name, Err: errMmapComma}
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	data, unmap, err := mapFile(f)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: name, Err: err}
+	}
+
+	return &MmapReader{
+		data:       data,
+		unmap:      unmap,
+		comma:      byte(comma),
+		lazyQuotes: opts.LazyQuotes,
+		maxLine:    opts.MaxLineBytes,
+		parser:     TickParser{Columns: DefaultTickColumns, ParseTime: opts.ParseTime, Precision: opts.Precision},
+		header:     opts.Header,
+		symbols:    NewSymbols(),
+	}, nil
+}
+
+var errMmapComma = errors.New("the delimiter must be a single byte character")
+
+// Size returns the size of the file.
+func (r *MmapReader) Size() int64 {
+	return int64(len(r.data))
+}
+
+// Offset returns the number of bytes of the file read.
+func (r *MmapReader) Offset() int64 {
+	return int64(min(r.off, len(r.data)))
+}
+
+// Close unmaps the file.
+func (r *MmapReader) Close() error {
+	r.data = nil
+	return r.unmap()
+}
+
+// Read returns the next tick or io.EOF at the end of the file.
+func (r *MmapReader) Read() (Tick, error) {
+	if r.header {
+		r.header = false
+
+		record, _, err := r.next()
+		if err != nil {
+			return Tick{}, err
+		}
+
+		if r.parser.Columns, err = TickColumnsFromHeader(cloneFields(record)); err != nil {
+			return Tick{}, err
+		}
+	}
+
+	record, line, err := r.next()
+	if err != nil {
+		return Tick{}, err
+	}
+
+	if tick, ok := r.parseFast(record); ok {
+		return tick, nil
+	}
+
+	// The slow path parses copies, so that neither the tick nor the error
+	// refer to the mapped memory.
+	record = cloneFields(record)
+
+	tick, err := r.parser.ParseRecord(record)
+	if err != nil {
+		return Tick{}, &ParseError{Line: line, Column: errorColumn(err), Record: strings.Join(record, string(rune(r.comma))), Err: err}
+	}
+
+	tick.ID = r.symbols.Intern(tick.ID)
+
+	return tick, nil
+}
+
+// next returns the fields of the next record, pointing into the mapped
+// memory, and its line number. Empty lines are skipped.
+func (r *MmapReader) next() ([]string, int, error) {
+	for r.off < len(r.data) {
+		r.line++
+		line := r.line
+
+		end := bytes.IndexByte(r.data[r.off:], '\n')
+		if end < 0 {
+			end = len(r.data)
+		} else {
+			end += r.off
+		}
+
+		b := r.data[r.off:end]
+
+		if bytes.IndexByte(b, '"') >= 0 {
+			return r.nextQuoted()
+		}
+
+		r.off = end + 1
+
+		b = bytes.TrimSuffix(b, []byte{'\r'})
+		if len(b) == 0 {
+			continue
+		}
+
+		if r.maxLine > 0 && len(b) > r.maxLine {
+			return nil, 0, &ParseError{Line: line, Err: ErrLineTooLong}
+		}
+
+		r.fields = r.fields[:0]
+
+		for {
+			i := bytes.IndexByte(b, r.comma)
+			if i < 0 {
+				r.fields = append(r.fields, bytesString(b))
+				break
+			}
+
+			r.fields = append(r.fields, bytesString(b[:i]))
+			b = b[i+1:]
+		}
+
+		return r.fields, line, nil
+	}
+
+	return nil, 0, io.EOF
+}
+
+// nextQuoted parses the record at the current offset, which has quotes and
+// may span lines, with encoding/csv.
+func (r *MmapReader) nextQuoted() ([]string, int, error) {
+	line := r.line
+
+	cr := csv.NewReader(bytes.NewReader(r.data[r.off:]))
+	cr.Comma = rune(r.comma)
+	cr.LazyQuotes = r.lazyQuotes
+	cr.FieldsPerRecord = -1
+
+	record, err := cr.Read()
+
+	consumed := r.data[r.off : r.off+int(cr.InputOffset())]
+	if len(consumed) == 0 {
+		// Go on after the line of a record that can't be read at all.
+		consumed = r.data[r.off:]
+		if i := bytes.IndexByte(consumed, '\n'); i >= 0 {
+			consumed = consumed[:i+1]
+		}
+	}
+
+	lines := bytes.Count(consumed, []byte{'\n'})
+	if !bytes.HasSuffix(consumed, []byte{'\n'}) {
+		lines++
+	}
+
+	r.line += lines - 1
+	r.off += len(consumed)
+
+	if err != nil {
+		var csvErr *csv.ParseError
+		if errors.As(err, &csvErr) {
+			return nil, 0, &ParseError{Line: line + csvErr.Line - 1, Err: csvErr.Err}
+		}
+
+		return nil, 0, err
+	}
+
+	return record, line, nil
+}
+
+// parseFast parses a record of unquoted plain numbers without allocating.
+// It reports false for anything else, left to TickParser.
+func (r *MmapReader) parseFast(record []string) (Tick, bool) {
+	cols := r.parser.Columns
+
+	if r.parser.Precision != FloatPrecision || cols.Price < 0 || cols.Bid >= 0 || cols.Ask >= 0 || len(record) <= max(cols.ID, cols.Price, cols.Time) {
+		return Tick{}, false
+	}
+
+	var kind TickKind
+
+	if cols.Kind >= 0 && len(record) > cols.Kind && record[cols.Kind] != "" {
+		var err error
+
+		if kind, err = ParseTickKind(record[cols.Kind]); err != nil {
+			return Tick{}, false
+		}
+	}
+
+	price, ok := parseFloat(record[cols.Price])
+	if !ok {
+		return Tick{}, false
+	}
+
+	// A zone parsed by name refers to the mapped memory.
+	t, err := r.parser.parseTime(record[cols.Time])
+	if err != nil {
+		return Tick{}, false
+	}
+
+	if loc := t.Location(); loc != time.UTC && loc != time.Local {
+		if name, _ := t.Zone(); name != "" {
+			return Tick{}, false
+		}
+	}
+
+	var volume float64
+
+	if cols.Volume >= 0 && len(record) > cols.Volume && record[cols.Volume] != "" {
+		if volume, ok = parseFloat(record[cols.Volume]); !ok {
+			return Tick{}, false
+		}
+	}
+
+	var seq int64
+
+	if cols.Seq >= 0 && len(record) > cols.Seq && record[cols.Seq] != "" {
+		if seq, err = strconv.ParseInt(record[cols.Seq], 10, 64); err != nil {
+			return Tick{}, false
+		}
+	}
+
+	return Tick{
+		ID:     r.symbols.Intern(record[cols.ID]),
+		Price:  price,
+		Volume: volume,
+		Time:   t,
+		Seq:    seq,
+		Kind:   kind,
+	}, true
+}
+
+// pow10 are the powers of ten exactly representable as float64.
+var pow10 = [...]float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11,
+	1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22,
+}
+
+// parseFloat parses a plain decimal such as 123.45 or -0.5 to the same
+// value as strconv.ParseFloat: with at most 15 digits the digits are an
+// exact integer and dividing it by an exact power of ten rounds correctly.
+// It reports false for other forms.
+func parseFloat(s string) (float64, bool) {
+	i := 0
+	neg := false
+
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		neg = s[i] == '-'
+		i++
+	}
+
+	var (
+		mantissa uint64
+		digits   int
+		decimals = -1
+	)
+
+	for ; i < len(s); i++ {
+		c := s[i]
+
+		if c == '.' && decimals < 0 {
+			decimals = 0
+			continue
+		}
+
+		if c < '0' || c > '9' || digits == 15 {
+			return 0, false
+		}
+
+		mantissa = mantissa*10 + uint64(c-'0')
+		digits++
+
+		if decimals >= 0 {
+			decimals++
+		}
+	}
+
+	if digits == 0 {
+		return 0, false
+	}
+
+	f := float64(mantissa)
+	if decimals > 0 {
+		f /= pow10[decimals]
+	}
+
+	if neg {
+		f = -f
+	}
+
+	return f, true
+}
+
+// bytesString returns b as a string sharing its memory.
+func bytesString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	return unsafe.String(&b[0], len(b))
+}
+
+func cloneFields(record []string) []string {
+	result := make([]string, len(record))
+
+	for i, field := range record {
+		result[i] = strings.Clone(field)
+	}
+
+	return result
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package candles
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the content of f into memory, for systems without mmap.
+func mapFile(f *os.File) ([]byte, func() error, error) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,265 @@
+package candles
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultIntervals are the candle intervals used when none are configured.
+var DefaultIntervals = []Interval{Fixed(time.Minute), Fixed(2 * time.Minute), Fixed(5 * time.Minute)}
+
+// Option configures the aggregation.
+type Option func(*config)
+
+type config struct {
+	intervals     []Interval
+	location      *time.Location
+	lateTolerance time.Duration
+	workers       int
+	precision     Precision
+	autoIntervals bool
+	fillGaps      bool
+	volume        VolumeKind
+	schedule      *Schedule
+	calendar      *Calendar
+	carryOpen     CarryOpen
+	corrections   bool
+	midpoints     bool
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		intervals: DefaultIntervals,
+		location:  time.UTC,
+		workers:   1,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
+
+// WithIntervals sets the candle intervals. An empty list keeps the defaults.
+func WithIntervals(intervals ...Interval) Option {
+	return func(cfg *config) {
+		if len(intervals) > 0 {
+			cfg.intervals = intervals
+		}
+	}
+}
+
+// WithTimezone sets the time zone that aligns candle boundaries and in which
+// candle times are reported. UTC is used by default.
+func WithTimezone(loc *time.Location) Option {
+	return func(cfg *config) {
+		if loc != nil {
+			cfg.location = loc
+		}
+	}
+}
+
+// WithLocation is the former name of WithTimezone.
+//
+// Deprecated: use WithTimezone.
+func WithLocation(loc *time.Location) Option {
+	return WithTimezone(loc)
+}
+
+// WithLateTolerance makes the streaming Aggregator keep candles open for d
+// after the latest tick time passes their end, so that ticks arriving out
+// of order by up to d still get into their candles.
+func WithLateTolerance(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.lateTolerance = d
+	}
+}
+
+// WithWorkers sets how many instruments Aggregate processes concurrently.
+func WithWorkers(n int) Option {
+	return func(cfg *config) {
+		if n > 0 {
+			cfg.workers = n
+		}
+	}
+}
+
+// WithPrecision sets the arithmetic of candle volumes. FloatPrecision is
+// used by default.
+func WithPrecision(p Precision) Option {
+	return func(cfg *config) {
+		cfg.precision = p
+	}
+}
+
+// WithAutoIntervals makes Aggregate pick, for every instrument, the intervals
+// of the configured ones that suit the density of its ticks instead of
+// building all of them: the interval typical gaps between ticks fit in and
+// the longer ones the ticks span at least two candles of. The streaming
+// Aggregator always builds all intervals.
+func WithAutoIntervals(auto bool) Option {
+	return func(cfg *config) {
+		cfg.autoIntervals = auto
+	}
+}
+
+// WithFillGaps makes the aggregation insert synthetic candles for the
+// intervals without ticks, see GapFiller. The streaming Aggregator inserts
+// them as the candle after a gap closes.
+func WithFillGaps(fill bool) Option {
+	return func(cfg *config) {
+		cfg.fillGaps = fill
+	}
+}
+
+// WithSessions aligns candles to the trading sessions of the schedule and
+// drops ticks outside them, see Schedule. Candle times are still reported
+// in the WithTimezone time zone.
+func WithSessions(s *Schedule) Option {
+	return func(cfg *config) {
+		cfg.schedule = s
+	}
+}
+
+// WithCalendar makes gap filling skip the days that are not trading days
+// of the calendar. Ticks of such days are aggregated as any other.
+func WithCalendar(c *Calendar) Option {
+	return func(cfg *config) {
+		cfg.calendar = c
+	}
+}
+
+// WithCarryOpen sets which candles open at the close of the previous
+// candle instead of their first trade, with the high and low widened to
+// include it. CarryNone is used by default.
+func WithCarryOpen(m CarryOpen) Option {
+	return func(cfg *config) {
+		cfg.carryOpen = m
+	}
+}
+
+// WithVolume sets what the volume of candles measures. TradedVolume is used
+// by default.
+func WithVolume(kind VolumeKind) Option {
+	return func(cfg *config) {
+		cfg.volume = kind
+	}
+}
+
+// VolumeKind is what the volume of candles measures.
+type VolumeKind int
+
+const (
+	// TradedVolume sums the volumes of the ticks.
+	TradedVolume VolumeKind = iota
+	// TickVolume counts the ticks, for feeds such as quotes that carry no
+	// volumes. VWAP becomes the mean price.
+	TickVolume
+)
+
+// ParseVolumeKind parses a volume kind: traded or ticks.
+func ParseVolumeKind(s string) (VolumeKind, error) {
+	switch s {
+	case "traded":
+		return TradedVolume, nil
+	case "ticks":
+		return TickVolume, nil
+	}
+
+	return 0, fmt.Errorf("unknown volume: %q", s)
+}
+
+// String returns the kind in the notation accepted by ParseVolumeKind.
+func (k VolumeKind) String() string {
+	if k == TickVolume {
+		return "ticks"
+	}
+
+	return "traded"
+}
+
+// WithMidpoints builds candles from the midpoints of the bid and ask prices
+// of ticks, skipping the ones without both. By default candles are built
+// from trade prices and quotes are skipped.
+func WithMidpoints(mid bool) Option {
+	return func(cfg *config) {
+		cfg.midpoints = mid
+	}
+}
+
+// prepare returns the tick as it is added to candles, or false if it
+// doesn't enter them.
+func (cfg config) prepare(tick Tick) (Tick, bool) {
+	switch {
+	case tick.Kind.Correction():
+	case cfg.midpoints:
+		if tick.Bid == 0 || tick.Ask == 0 {
+			return tick, false
+		}
+
+		tick.Price = (tick.Bid + tick.Ask) / 2
+	case tick.Kind == Quote:
+		return tick, false
+	}
+
+	if cfg.volume == TickVolume {
+		tick.Volume = 1
+	}
+
+	return tick, true
+}
+
+// trades reports whether t is within the trading sessions.
+func (cfg config) trades(t time.Time) bool {
+	if cfg.schedule != nil {
+		_, _, ok := cfg.schedule.session(t)
+		return ok
+	}
+
+	return true
+}
+
+// truncate returns the start of the candle of the interval containing t,
+// or false if t is outside the trading sessions.
+func (cfg config) truncate(i Interval, t time.Time) (time.Time, bool) {
+	if cfg.schedule == nil {
+		return i.Truncate(t, cfg.location), true
+	}
+
+	start, ok := cfg.schedule.Truncate(i, t)
+
+	return start.In(cfg.location), ok
+}
+
+// end returns the end of the candle of the interval starting at start.
+func (cfg config) end(i Interval, start time.Time) time.Time {
+	if cfg.schedule == nil {
+		return i.End(start)
+	}
+
+	return cfg.schedule.End(i, start)
+}
+
+// ParseIntervals parses a comma separated list of intervals such as
+// "1m,5m,15m,1h,1d".
+func ParseIntervals(s string) ([]Interval, error) {
+	var result []Interval
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		interval, err := ParseInterval(part)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, interval)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,152 @@
+package candles
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OutlierKind is how far from the rolling median a price must be to be an
+// outlier.
+type OutlierKind int
+
+// Outlier kinds.
+const (
+	// PercentOutliers deviate from the median by more than a percentage
+	// of it.
+	PercentOutliers OutlierKind = iota
+	// MADOutliers deviate from the median by more than a number of median
+	// absolute deviations.
+	MADOutliers
+)
+
+var outlierKindNames = []string{"pct", "mad"}
+
+// DefaultOutlierWindow is the number of recent ticks of an instrument whose
+// median prices are compared with.
+const DefaultOutlierWindow = 50
+
+// minOutlierWindow is the number of ticks an instrument needs before its
+// outliers are told.
+const minOutlierWindow = 5
+
+// OutlierSpec configures an OutlierFilter.
+type OutlierSpec struct {
+	Kind      OutlierKind
+	Threshold float64
+	// Window is the number of recent ticks of an instrument in the rolling
+	// median, DefaultOutlierWindow if zero.
+	Window int
+}
+
+// ParseOutlierSpec parses an outlier spec such as "pct:5", prices more than
+// 5% away from the median, or "mad:5", more than 5 median absolute
+// deviations away.
+func ParseOutlierSpec(s string) (OutlierSpec, error) {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return OutlierSpec{}, fmt.Errorf("bad outliers %q: want pct:N or mad:N", s)
+	}
+
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold <= 0 {
+		return OutlierSpec{}, fmt.Errorf("bad outliers %q: threshold must be a positive number", s)
+	}
+
+	for kind, kindName := range outlierKindNames {
+		if name == kindName {
+			return OutlierSpec{Kind: OutlierKind(kind), Threshold: threshold}, nil
+		}
+	}
+
+	return OutlierSpec{}, fmt.Errorf("bad outliers %q: unknown kind %q", s, name)
+}
+
+// String returns the spec in the notation accepted by ParseOutlierSpec.
+func (s OutlierSpec) String() string {
+	return outlierKindNames[s.Kind] + ":" + strconv.FormatFloat(s.Threshold, 'g', -1, 64)
+}
+
+// OutlierFilter tells bad prints, prices far from the median of the recent
+// ticks of their instrument, so that a single erroneous tick doesn't set
+// the high or the low of a candle. All ticks, outliers too, enter the
+// window, so that a lasting move of the price is followed.
+type OutlierFilter struct {
+	spec    OutlierSpec
+	windows map[string]*priceWindow
+	scratch []float64
+}
+
+// priceWindow is a ring buffer of recent prices.
+type priceWindow struct {
+	prices []float64
+	next   int
+}
+
+// NewOutlierFilter returns a filter of ticks by the spec.
+func NewOutlierFilter(spec OutlierSpec) *OutlierFilter {
+	if spec.Window <= 0 {
+		spec.Window = DefaultOutlierWindow
+	}
+
+	return &OutlierFilter{spec: spec, windows: make(map[string]*priceWindow)}
+}
+
+// Check reports whether the tick is an outlier, along with the median of
+// the recent prices of its instrument it deviates from. Ticks must come in
+// time order per instrument.
+func (f *OutlierFilter) Check(tick Tick) (median float64, outlier bool) {
+	w := f.windows[tick.ID]
+	if w == nil {
+		w = &priceWindow{}
+		f.windows[tick.ID] = w
+	}
+
+	if len(w.prices) >= min(minOutlierWindow, f.spec.Window) {
+		median, outlier = f.judge(w.prices, tick.Price)
+	}
+
+	if len(w.prices) < f.spec.Window {
+		w.prices = append(w.prices, tick.Price)
+	} else {
+		w.prices[w.next] = tick.Price
+		w.next = (w.next + 1) % len(w.prices)
+	}
+
+	return median, outlier
+}
+
+// judge returns the median of prices and whether price is an outlier.
+func (f *OutlierFilter) judge(prices []float64, price float64) (float64, bool) {
+	f.scratch = append(f.scratch[:0], prices...)
+	median := medianOf(f.scratch)
+	deviation := math.Abs(price - median)
+
+	if f.spec.Kind == PercentOutliers {
+		return median, deviation > math.Abs(median)*f.spec.Threshold/100
+	}
+
+	for i, p := range prices {
+		f.scratch[i] = math.Abs(p - median)
+	}
+
+	// A flat price has no deviation; a hundredth of a percent of the
+	// median keeps the ordinary moves of a price step apart from outliers.
+	mad := max(medianOf(f.scratch), math.Abs(median)*1e-4)
+
+	return median, deviation > f.spec.Threshold*mad
+}
+
+// medianOf returns the median of values, which it sorts.
+func medianOf(values []float64) float64 {
+	slices.Sort(values)
+
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+
+	return (values[n/2-1] + values[n/2]) / 2
+}
@@ -0,0 +1,441 @@
+package candles
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// maxProtoMessage bounds the length of a framed message.
+const maxProtoMessage = 64 << 20
+
+// AppendProto appends the candle encoded as the Candle message of
+// candle.proto. Indicators with NaN values are omitted.
+func (c Candle) AppendProto(dst []byte) []byte {
+	dst = appendProtoString(dst, 1, c.ID)
+
+	for i, v := range []float64{c.Open, c.High, c.Low, c.Close, c.Volume} {
+		dst = appendProtoDouble(dst, 2+i, v)
+	}
+
+	dst = appendProtoTime(dst, 7, c.Time)
+
+	dst = appendProtoString(dst, 8, c.Interval.String())
+	dst = appendProtoDouble(dst, 9, c.VWAP)
+
+	if c.Count != 0 {
+		dst = appendProtoVarint(dst, 10, uint64(c.Count))
+	}
+
+	if c.Partial {
+		dst = appendProtoVarint(dst, 11, 1)
+	}
+
+	names := make([]string, 0, len(c.Indicators))
+	for name := range c.Indicators {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		v := c.Indicators[name]
+		if math.IsNaN(v) {
+			continue
+		}
+
+		entry := appendProtoString(nil, 1, name)
+		entry = appendProtoDouble(entry, 2, v)
+		dst = appendProtoBytes(dst, 12, entry)
+	}
+
+	for _, p := range c.Patterns {
+		dst = appendProtoBytes(dst, 13, []byte(p))
+	}
+
+	dst = appendProtoDouble(dst, 14, c.Spread)
+	dst = appendProtoDouble(dst, 15, c.MaxSpread)
+	dst = appendProtoTime(dst, 16, c.FirstTime)
+	dst = appendProtoTime(dst, 17, c.LastTime)
+
+	if c.FirstSeq != 0 {
+		dst = appendProtoVarint(dst, 18, uint64(c.FirstSeq))
+	}
+
+	if c.LastSeq != 0 {
+		dst = appendProtoVarint(dst, 19, uint64(c.LastSeq))
+	}
+
+	return dst
+}
+
+// UnmarshalProto decodes a Candle message of candle.proto. Unknown fields
+// are skipped.
+func (c *Candle) UnmarshalProto(b []byte) error {
+	*c = Candle{}
+
+	return walkProto(b, func(field int, wire int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			c.ID = string(data)
+		case 2:
+			c.Open = math.Float64frombits(v)
+		case 3:
+			c.High = math.Float64frombits(v)
+		case 4:
+			c.Low = math.Float64frombits(v)
+		case 5:
+			c.Close = math.Float64frombits(v)
+		case 6:
+			c.Volume = math.Float64frombits(v)
+		case 7:
+			return parseProtoTime(data, &c.Time)
+		case 8:
+			if len(data) == 0 {
+				return nil
+			}
+
+			interval, err := ParseInterval(string(data))
+			if err != nil {
+				return err
+			}
+
+			c.Interval = interval
+		case 9:
+			c.VWAP = math.Float64frombits(v)
+		case 10:
+			c.Count = int(int64(v))
+		case 11:
+			c.Partial = v != 0
+		case 12:
+			var (
+				name  string
+				value float64
+			)
+
+			err := walkProto(data, func(field int, wire int, v uint64, data []byte) error {
+				switch field {
+				case 1:
+					name = string(data)
+				case 2:
+					value = math.Float64frombits(v)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if c.Indicators == nil {
+				c.Indicators = make(map[string]float64)
+			}
+
+			c.Indicators[name] = value
+		case 13:
+			c.Patterns = append(c.Patterns, string(data))
+		case 14:
+			c.Spread = math.Float64frombits(v)
+		case 15:
+			c.MaxSpread = math.Float64frombits(v)
+		case 16:
+			return parseProtoTime(data, &c.FirstTime)
+		case 17:
+			return parseProtoTime(data, &c.LastTime)
+		case 18:
+			c.FirstSeq = int64(v)
+		case 19:
+			c.LastSeq = int64(v)
+		}
+
+		return nil
+	})
+}
+
+// AppendProto appends the tick encoded as the Tick message of
+// aggregator.proto.
+func (t Tick) AppendProto(dst []byte) []byte {
+	dst = appendProtoString(dst, 1, t.ID)
+	dst = appendProtoDouble(dst, 2, t.Price)
+	dst = appendProtoDouble(dst, 3, t.Volume)
+	dst = appendProtoTime(dst, 4, t.Time)
+
+	if t.Seq != 0 {
+		dst = appendProtoVarint(dst, 5, uint64(t.Seq))
+	}
+
+	if t.Kind != Trade {
+		dst = appendProtoVarint(dst, 6, uint64(t.Kind))
+	}
+
+	dst = appendProtoDouble(dst, 7, t.Bid)
+
+	return appendProtoDouble(dst, 8, t.Ask)
+}
+
+// UnmarshalProto decodes a Tick message of aggregator.proto. Unknown fields
+// are skipped.
+func (t *Tick) UnmarshalProto(b []byte) error {
+	*t = Tick{}
+
+	return walkProto(b, func(field int, wire int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			t.ID = string(data)
+		case 2:
+			t.Price = math.Float64frombits(v)
+		case 3:
+			t.Volume = math.Float64frombits(v)
+		case 4:
+			return parseProtoTime(data, &t.Time)
+		case 5:
+			t.Seq = int64(v)
+		case 6:
+			if v > uint64(Quote) {
+				return fmt.Errorf("unknown kind %d", v)
+			}
+
+			t.Kind = TickKind(v)
+		case 7:
+			t.Bid = math.Float64frombits(v)
+		case 8:
+			t.Ask = math.Float64frombits(v)
+		}
+
+		return nil
+	})
+}
+
+// ProtoWriter writes candles as length prefixed Candle messages.
+type ProtoWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewProtoWriter returns a writer of framed Candle messages to w.
+func NewProtoWriter(w io.Writer) *ProtoWriter {
+	return &ProtoWriter{w: bufio.NewWriter(w)}
+}
+
+// Write writes a candle prefixed by the varint length of its message.
+func (w *ProtoWriter) Write(c Candle) error {
+	w.buf = c.AppendProto(w.buf[:0])
+
+	var size [binary.MaxVarintLen64]byte
+
+	if _, err := w.w.Write(size[:binary.PutUvarint(size[:], uint64(len(w.buf)))]); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(w.buf)
+
+	return err
+}
+
+// Flush writes the buffered candles to the underlying writer.
+func (w *ProtoWriter) Flush() error {
+	return w.w.Flush()
+}
+
+// ProtoReader reads candles written by ProtoWriter.
+type ProtoReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewProtoReader returns a reader of framed Candle messages from r.
+func NewProtoReader(r io.Reader) *ProtoReader {
+	return &ProtoReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next candle or io.EOF at the end of the input.
+func (r *ProtoReader) Read() (Candle, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if err == io.EOF {
+			return Candle{}, io.EOF
+		}
+
+		return Candle{}, fmt.Errorf("proto frame: %w", err)
+	}
+
+	if size > maxProtoMessage {
+		return Candle{}, fmt.Errorf("proto frame of %d bytes is too long", size)
+	}
+
+	if cap(r.buf) < int(size) {
+		r.buf = make([]byte, size)
+	}
+
+	r.buf = r.buf[:size]
+
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return Candle{}, fmt.Errorf("proto frame: %w", noEOF(err))
+	}
+
+	var c Candle
+
+	if err := c.UnmarshalProto(r.buf); err != nil {
+		return Candle{}, err
+	}
+
+	return c, nil
+}
+
+// noEOF turns an EOF in the middle of a frame into ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+var errProtoTruncated = errors.New("truncated proto message")
+
+// walkProto calls fn for every field of a message with the value of varint
+// and fixed fields or the data of length delimited ones.
+func walkProto(b []byte, fn func(field int, wire int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+
+		b = b[n:]
+
+		var (
+			v    uint64
+			data []byte
+		)
+
+		switch wire := int(key & 7); wire {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errProtoTruncated
+			}
+
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errProtoTruncated
+			}
+
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errProtoTruncated
+			}
+
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return errProtoTruncated
+			}
+
+			data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported proto wire type %d", wire)
+		}
+
+		if err := fn(int(key>>3), int(key&7), v, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func appendProtoKey(dst []byte, field, wire int) []byte {
+	return binary.AppendUvarint(dst, uint64(field)<<3|uint64(wire))
+}
+
+func appendProtoVarint(dst []byte, field int, v uint64) []byte {
+	dst = appendProtoKey(dst, field, wireVarint)
+	return binary.AppendUvarint(dst, v)
+}
+
+// appendProtoDouble appends a double field unless zero, the proto3 default.
+// appendProtoTime appends a google.protobuf.Timestamp field, none if t is
+// zero.
+func appendProtoTime(dst []byte, field int, t time.Time) []byte {
+	if t.IsZero() {
+		return dst
+	}
+
+	var ts []byte
+
+	if s := t.Unix(); s != 0 {
+		ts = appendProtoVarint(ts, 1, uint64(s))
+	}
+
+	if ns := t.Nanosecond(); ns != 0 {
+		ts = appendProtoVarint(ts, 2, uint64(ns))
+	}
+
+	return appendProtoBytes(dst, field, ts)
+}
+
+// parseProtoTime decodes a google.protobuf.Timestamp into t, in UTC.
+func parseProtoTime(data []byte, t *time.Time) error {
+	var sec, nsec int64
+
+	err := walkProto(data, func(field int, wire int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			sec = int64(v)
+		case 2:
+			nsec = int64(int32(v))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*t = time.Unix(sec, nsec).UTC()
+
+	return nil
+}
+
+func appendProtoDouble(dst []byte, field int, v float64) []byte {
+	if v == 0 {
+		return dst
+	}
+
+	dst = appendProtoKey(dst, field, wireFixed64)
+
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+}
+
+func appendProtoBytes(dst []byte, field int, data []byte) []byte {
+	dst = appendProtoKey(dst, field, wireBytes)
+	dst = binary.AppendUvarint(dst, uint64(len(data)))
+
+	return append(dst, data...)
+}
+
+// appendProtoString appends a string field unless empty, the proto3
+// default.
+func appendProtoString(dst []byte, field int, s string) []byte {
+	if s == "" {
+		return dst
+	}
+
+	return appendProtoBytes(dst, field, []byte(s))
+}
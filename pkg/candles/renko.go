@@ -0,0 +1,142 @@
+package candles
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Direction is the direction of a Renko brick.
+type Direction int
+
+// Brick directions.
+const (
+	Up   Direction = 1
+	Down Direction = -1
+)
+
+// String returns "up" or "down".
+func (d Direction) String() string {
+	if d == Down {
+		return "down"
+	}
+
+	return "up"
+}
+
+// MarshalText encodes the direction as its String.
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a direction encoded by MarshalText.
+func (d *Direction) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "up":
+		*d = Up
+	case "down":
+		*d = Down
+	default:
+		return fmt.Errorf("bad brick direction: %q", text)
+	}
+
+	return nil
+}
+
+// Brick is a Renko brick: a price move of the brick size regardless of the
+// time it took. Time is the time of the tick that completed the brick.
+type Brick struct {
+	ID        string    `json:"id"`
+	Open      float64   `json:"open"`
+	Close     float64   `json:"close"`
+	Direction Direction `json:"direction"`
+	Time      time.Time `json:"time"`
+}
+
+// Renko builds Renko bricks from a stream of ticks. The first tick of an
+// instrument sets the base price. A brick is added in the direction of the
+// previous one when the price moves a brick size beyond its close, and in
+// the opposite direction when the price moves a brick size beyond its open.
+type Renko struct {
+	size  float64
+	loc   *time.Location
+	state map[string]*renkoState
+}
+
+// renkoState holds the price range of the last brick of an instrument as
+// multiples of the brick size from the base price, so that brick prices
+// don't accumulate rounding errors.
+type renkoState struct {
+	base      float64
+	low, high int
+}
+
+// NewRenko returns a Renko builder with the given positive brick size.
+// Brick times are reported in loc.
+func NewRenko(size float64, loc *time.Location) *Renko {
+	return &Renko{size: size, loc: loc, state: make(map[string]*renkoState)}
+}
+
+// AddTick returns the bricks completed by the tick. Ticks of an instrument
+// must be added in time order. Quotes and corrections are ignored.
+func (r *Renko) AddTick(tick Tick) []Brick {
+	if tick.Kind != Trade {
+		return nil
+	}
+
+	s, ok := r.state[tick.ID]
+	if !ok {
+		r.state[tick.ID] = &renkoState{base: tick.Price}
+		return nil
+	}
+
+	var result []Brick
+
+	for tick.Price >= r.level(s, s.high+1) {
+		result = append(result, r.brick(tick, r.level(s, s.high), r.level(s, s.high+1), Up))
+		s.low, s.high = s.high, s.high+1
+	}
+
+	for tick.Price <= r.level(s, s.low-1) {
+		result = append(result, r.brick(tick, r.level(s, s.low), r.level(s, s.low-1), Down))
+		s.low, s.high = s.low-1, s.low
+	}
+
+	return result
+}
+
+func (r *Renko) level(s *renkoState, n int) float64 {
+	return s.base + float64(n)*r.size
+}
+
+func (r *Renko) brick(tick Tick, open, close float64, dir Direction) Brick {
+	return Brick{ID: tick.ID, Open: open, Close: close, Direction: dir, Time: tick.Time.In(r.loc)}
+}
+
+// RenkoBricks builds the Renko bricks of ticks in any order; ticks with
+// equal times are ordered by sequence number, then keep their input order.
+// Corrections are applied first, see ApplyCorrections. The result is sorted
+// by ID, then by time.
+func RenkoBricks(ticks []Tick, size float64, loc *time.Location) []Brick {
+	ticks, _ = ApplyCorrections(ticks)
+	sorted := make([]Tick, len(ticks))
+	copy(sorted, ticks)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+
+		return sorted[i].Before(sorted[j])
+	})
+
+	r := NewRenko(size, loc)
+
+	var result []Brick
+
+	for _, tick := range sorted {
+		result = append(result, r.AddTick(tick)...)
+	}
+
+	return result
+}
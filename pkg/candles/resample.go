@@ -0,0 +1,147 @@
+package candles
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Resample merges candles into candles of a coarser interval with
+// boundaries in loc: the first open, the highest high, the lowest low, the
+// last close and the total volume and count. Only the finest interval of
+// every instrument is used, so candles of several intervals can be passed.
+// Every source candle must fit into a single target interval. The result is
+// sorted by ID, then by time.
+func Resample(result []Candle, interval Interval, loc *time.Location) ([]Candle, error) {
+	finest := make(map[string]Interval)
+
+	for _, c := range result {
+		if f, ok := finest[c.ID]; !ok || c.Interval.less(f) {
+			finest[c.ID] = c.Interval
+		}
+	}
+
+	var source []Candle
+
+	for _, c := range result {
+		if c.Interval != finest[c.ID] {
+			continue
+		}
+
+		if c.Interval == (Interval{}) || !c.Interval.less(interval) {
+			return nil, fmt.Errorf("can't resample %s candles of %s into %s", c.Interval, c.ID, interval)
+		}
+
+		source = append(source, c)
+	}
+
+	sort.SliceStable(source, func(i, j int) bool {
+		if source[i].ID != source[j].ID {
+			return source[i].ID < source[j].ID
+		}
+
+		return source[i].Time.Before(source[j].Time)
+	})
+
+	var (
+		resampled []Candle
+		cur       *Candle
+	)
+
+	for _, c := range source {
+		startTime := interval.Truncate(c.Time, loc)
+
+		if c.Interval.End(c.Time).After(interval.End(startTime)) {
+			return nil, fmt.Errorf("%s candle of %s at %s crosses a %s boundary", c.Interval, c.ID, c.Time.Format(time.RFC3339Nano), interval)
+		}
+
+		if cur != nil && cur.ID == c.ID && cur.Time.Equal(startTime) {
+			cur.merge(c)
+			continue
+		}
+
+		if cur != nil {
+			resampled = append(resampled, *cur)
+		}
+
+		cur = &Candle{
+			ID:        c.ID,
+			Open:      c.Open,
+			High:      c.High,
+			Low:       c.Low,
+			Close:     c.Close,
+			Volume:    c.Volume,
+			Time:      startTime,
+			Interval:  interval,
+			VWAP:      c.VWAP,
+			Count:     c.Count,
+			FirstTime: c.FirstTime.In(loc),
+			LastTime:  c.LastTime.In(loc),
+			FirstSeq:  c.FirstSeq,
+			LastSeq:   c.LastSeq,
+			turnover:  c.VWAP * c.Volume,
+			priceSum:  c.VWAP * float64(c.Count),
+		}
+
+		cur.mergeSpread(c)
+	}
+
+	if cur != nil {
+		resampled = append(resampled, *cur)
+	}
+
+	return resampled, nil
+}
+
+// merge adds the next candle of the same series.
+func (c *Candle) merge(o Candle) {
+	if o.High > c.High {
+		c.High = o.High
+	}
+
+	if o.Low < c.Low {
+		c.Low = o.Low
+	}
+
+	c.Close = o.Close
+	c.Volume += o.Volume
+
+	// Filled gaps have no ticks.
+	if !o.LastTime.IsZero() {
+		if c.FirstTime.IsZero() {
+			c.FirstTime, c.FirstSeq = o.FirstTime.In(c.Time.Location()), o.FirstSeq
+		}
+
+		c.LastTime, c.LastSeq = o.LastTime.In(c.Time.Location()), o.LastSeq
+	}
+
+	c.Count += o.Count
+	c.turnover += o.VWAP * o.Volume
+	c.priceSum += o.VWAP * float64(o.Count)
+
+	switch {
+	case c.Volume != 0:
+		c.VWAP = c.turnover / c.Volume
+	case c.Count != 0:
+		c.VWAP = c.priceSum / float64(c.Count)
+	}
+
+	c.mergeSpread(o)
+}
+
+// mergeSpread adds the spread stats of the next candle, weighing its mean
+// spread by its count.
+func (c *Candle) mergeSpread(o Candle) {
+	if o.Spread == 0 && o.MaxSpread == 0 {
+		return
+	}
+
+	if c.quoted == 0 || o.MaxSpread > c.MaxSpread {
+		c.MaxSpread = o.MaxSpread
+	}
+
+	n := max(o.Count, 1)
+	c.quoted += n
+	c.spreadSum += o.Spread * float64(n)
+	c.Spread = c.spreadSum / float64(c.quoted)
+}
@@ -0,0 +1,195 @@
+package candles
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Session is a daily trading session, from Open to Close after midnight in
+// the time zone of its Schedule.
+type Session struct {
+	Name  string
+	Open  time.Duration
+	Close time.Duration
+}
+
+// Schedule is the daily trading sessions of an exchange, sorted by time and
+// not overlapping. With WithSessions fixed interval candles are aligned to
+// the open of their session instead of the clock, the last candle of a
+// session ends at its close, so no candle spans two sessions, and ticks
+// outside the sessions are dropped.
+type Schedule struct {
+	Location *time.Location
+	Sessions []Session
+}
+
+// msk is Moscow time, fixed at UTC+3 since 2014.
+var msk = time.FixedZone("MSK", 3*60*60)
+
+// MOEX is the schedule of the Moscow Exchange stock market: the main
+// session from 10:00 to 18:40 and the evening one from 19:05 to 23:50
+// Moscow time.
+var MOEX = &Schedule{
+	Location: msk,
+	Sessions: []Session{
+		{Name: "main", Open: 10 * time.Hour, Close: 18*time.Hour + 40*time.Minute},
+		{Name: "evening", Open: 19*time.Hour + 5*time.Minute, Close: 23*time.Hour + 50*time.Minute},
+	},
+}
+
+// ParseSchedule parses a schedule: moex, or a comma separated list of
+// sessions in loc such as "10:00-18:40,19:05-23:50", each optionally
+// named as in "main=10:00-18:40".
+func ParseSchedule(s string, loc *time.Location) (*Schedule, error) {
+	if strings.EqualFold(s, "moex") {
+		return MOEX, nil
+	}
+
+	schedule := &Schedule{Location: loc}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		var session Session
+
+		if name, hours, ok := strings.Cut(part, "="); ok {
+			session.Name, part = name, hours
+		}
+
+		open, closeTime, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("bad session %q, want OPEN-CLOSE such as 10:00-18:40", part)
+		}
+
+		var err error
+
+		if session.Open, err = parseClock(open); err != nil {
+			return nil, err
+		}
+
+		if session.Close, err = parseClock(closeTime); err != nil {
+			return nil, err
+		}
+
+		if session.Close <= session.Open {
+			return nil, fmt.Errorf("session %s closes before it opens", part)
+		}
+
+		if n := len(schedule.Sessions); n > 0 && session.Open < schedule.Sessions[n-1].Close {
+			return nil, fmt.Errorf("session %s overlaps the previous one", part)
+		}
+
+		schedule.Sessions = append(schedule.Sessions, session)
+	}
+
+	return schedule, nil
+}
+
+// parseClock parses a time of day such as 10:00 or 18:39:59 as the
+// duration after midnight.
+func parseClock(s string) (time.Duration, error) {
+	layout := "15:04"
+	if strings.Count(s, ":") == 2 {
+		layout = "15:04:05"
+	}
+
+	t, err := time.Parse(layout, strings.TrimSpace(s))
+	if err != nil {
+		if s == "24:00" {
+			return 24 * time.Hour, nil
+		}
+
+		return 0, fmt.Errorf("bad time of day %q", s)
+	}
+
+	return t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)), nil
+}
+
+// Truncate returns the start of the candle of the interval containing t,
+// or false if t is outside the sessions. Calendar intervals are aligned to
+// the calendar of the schedule time zone.
+func (s *Schedule) Truncate(i Interval, t time.Time) (time.Time, bool) {
+	open, _, ok := s.session(t)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if i.IsCalendar() {
+		return i.Truncate(t, s.Location), true
+	}
+
+	return open.Add(t.Sub(open) / i.Duration * i.Duration), true
+}
+
+// End returns the end of the candle of the interval starting at start: the
+// end of the interval or the close of the session, whichever is earlier.
+func (s *Schedule) End(i Interval, start time.Time) time.Time {
+	if i.IsCalendar() {
+		return i.End(start)
+	}
+
+	// Candles are aligned to the session open rather than the wall clock.
+	end := start.Add(i.Duration)
+
+	if _, closeTime, ok := s.session(start); ok && closeTime.Before(end) {
+		return closeTime
+	}
+
+	return end
+}
+
+// Next returns the start of the candle of the interval following the one
+// starting at start, skipping the time between sessions.
+func (s *Schedule) Next(i Interval, start time.Time) time.Time {
+	end := s.End(i, start)
+
+	if i.IsCalendar() {
+		return end
+	}
+
+	if _, closeTime, ok := s.session(start); ok && end.Before(closeTime) {
+		return end
+	}
+
+	return s.nextOpen(end).In(start.Location())
+}
+
+// session returns the open and close of the session containing t.
+func (s *Schedule) session(t time.Time) (open, closeTime time.Time, ok bool) {
+	t = t.In(s.Location)
+	year, month, day := t.Date()
+
+	for _, session := range s.Sessions {
+		open = clockTime(year, month, day, session.Open, s.Location)
+		closeTime = clockTime(year, month, day, session.Close, s.Location)
+
+		if !t.Before(open) && t.Before(closeTime) {
+			return open, closeTime, true
+		}
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+// nextOpen returns the first session open not earlier than t.
+func (s *Schedule) nextOpen(t time.Time) time.Time {
+	t = t.In(s.Location)
+	year, month, day := t.Date()
+
+	for {
+		for _, session := range s.Sessions {
+			if open := clockTime(year, month, day, session.Open, s.Location); !open.Before(t) {
+				return open
+			}
+		}
+
+		day++
+	}
+}
+
+// clockTime returns the time d after midnight of the given day by the wall
+// clock of loc.
+func clockTime(year int, month time.Month, day int, d time.Duration, loc *time.Location) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, int(d), loc)
+}
@@ -0,0 +1,141 @@
+package candles
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Sink receives candles, such as a file or a database. Written candles may
+// be buffered until Flush.
+type Sink interface {
+	Write(c Candle) error
+	Flush() error
+}
+
+// CSVSinkOptions configures CSVSink.
+type CSVSinkOptions struct {
+	// Columns are the fields of the records, see Candle.Columns.
+	// DefaultColumns if nil.
+	Columns []string
+	// Header writes the column names as the first record.
+	Header bool
+	// Format formats the prices, DefaultFormat if nil.
+	Format *Format
+}
+
+// CSVSink writes candles as CSV records.
+type CSVSink struct {
+	w       *csv.Writer
+	columns []string
+	format  Format
+	// header is true while the header row is still to be written.
+	header bool
+}
+
+// NewCSVSink returns a sink writing CSV records to w.
+func NewCSVSink(w io.Writer, opts CSVSinkOptions) *CSVSink {
+	s := &CSVSink{w: csv.NewWriter(w), columns: opts.Columns, format: DefaultFormat, header: opts.Header}
+
+	if s.columns == nil {
+		s.columns = DefaultColumns
+	}
+
+	if opts.Format != nil {
+		s.format = *opts.Format
+	}
+
+	return s
+}
+
+func (s *CSVSink) Write(c Candle) error {
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+
+	return s.w.Write(s.format.Columns(c, s.columns))
+}
+
+// Flush writes the buffered records, and the header if no candles were
+// written.
+func (s *CSVSink) Flush() error {
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *CSVSink) writeHeader() error {
+	if !s.header {
+		return nil
+	}
+
+	s.header = false
+
+	return s.w.Write(s.columns)
+}
+
+// JSONSink writes candles as JSON lines, see Candle.MarshalJSON.
+type JSONSink struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewJSONSink returns a sink writing JSON lines to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	bw := bufio.NewWriter(w)
+	return &JSONSink{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (s *JSONSink) Write(c Candle) error {
+	return s.enc.Encode(c)
+}
+
+func (s *JSONSink) Flush() error {
+	return s.w.Flush()
+}
+
+// FileSink is a Sink writing a file.
+type FileSink struct {
+	Sink
+	f *os.File
+}
+
+// CreateSink creates a file of candles, or writes stdout if name is "-".
+// Files named *.jsonl, *.ndjson or *.json are written as JSON lines, others,
+// like stdout, as CSV with the options.
+func CreateSink(name string, opts CSVSinkOptions) (*FileSink, error) {
+	f := os.Stdout
+
+	if name != "-" {
+		var err error
+		if f, err = os.Create(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if isJSONFile(name) {
+		return &FileSink{Sink: NewJSONSink(f), f: f}, nil
+	}
+
+	return &FileSink{Sink: NewCSVSink(f, opts), f: f}, nil
+}
+
+// Close flushes the candles and closes the file, but not stdout.
+func (s *FileSink) Close() error {
+	err := s.Flush()
+
+	if s.f == os.Stdout {
+		return err
+	}
+
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,156 @@
+package candles
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Source is a stream of ticks, such as a file or a connection to a broker.
+// Next returns io.EOF once the stream ends; a *ParseError leaves the source
+// usable for the following ticks.
+type Source interface {
+	Next() (Tick, error)
+}
+
+// Next is Read, which makes CSVReader a Source.
+func (r *CSVReader) Next() (Tick, error) {
+	return r.Read()
+}
+
+// JSONReader reads ticks from JSON lines, see TickParser.ParseJSON. Empty
+// lines are skipped.
+type JSONReader struct {
+	r       *LineReader
+	parser  TickParser
+	line    int
+	symbols *Symbols
+}
+
+// NewJSONReader returns a reader of ticks from r. The columns of the parser
+// are not used.
+func NewJSONReader(r io.Reader, parser TickParser) *JSONReader {
+	return NewJSONReaderSize(r, parser, 0)
+}
+
+// NewJSONReaderSize is like NewJSONReader, but lines longer than max bytes
+// are parse errors. With max 0 lines may be of any length.
+func NewJSONReaderSize(r io.Reader, parser TickParser, max int) *JSONReader {
+	return &JSONReader{r: NewLineReader(r, max), parser: parser, symbols: NewSymbols()}
+}
+
+// Read returns the next tick or io.EOF at the end of the input.
+func (r *JSONReader) Read() (Tick, error) {
+	for {
+		line, err := r.r.ReadLine()
+		if err == io.EOF {
+			return Tick{}, io.EOF
+		}
+
+		r.line++
+
+		if err == ErrLineTooLong {
+			return Tick{}, &ParseError{Line: r.line, Err: err}
+		}
+
+		if err != nil {
+			return Tick{}, err
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		tick, err := r.parser.ParseJSON(line)
+		if err != nil {
+			return Tick{}, &ParseError{Line: r.line, Record: string(line), Err: err}
+		}
+
+		tick.ID = r.symbols.Intern(tick.ID)
+
+		return tick, nil
+	}
+}
+
+// Next is Read, which makes JSONReader a Source.
+func (r *JSONReader) Next() (Tick, error) {
+	return r.Read()
+}
+
+// FileSource is a Source reading a file.
+type FileSource struct {
+	Source
+	f *os.File
+}
+
+// OpenSource opens a file of ticks, or stdin if name is "-". Files named
+// *.jsonl, *.ndjson or *.json are read as JSON lines, others, like stdin,
+// as CSV.
+func OpenSource(name string, opts CSVOptions) (*FileSource, error) {
+	f := os.Stdin
+
+	if name != "-" {
+		var err error
+		if f, err = os.Open(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if isJSONFile(name) {
+		return &FileSource{Source: NewJSONReaderSize(f, TickParser{ParseTime: opts.ParseTime, Precision: opts.Precision}, opts.MaxLineBytes), f: f}, nil
+	}
+
+	return &FileSource{Source: NewCSVReader(f, opts), f: f}, nil
+}
+
+// Close closes the file, but not stdin.
+func (s *FileSource) Close() error {
+	if s.f == os.Stdin {
+		return nil
+	}
+
+	return s.f.Close()
+}
+
+func isJSONFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jsonl", ".ndjson", ".json":
+		return true
+	}
+
+	return false
+}
+
+// Copy aggregates the ticks of src into dst as a streaming Aggregator with
+// the options does, writing candles as they close, and flushes dst at the
+// end of src. It stops at the first error of either.
+func Copy(dst Sink, src Source, opts ...Option) error {
+	a := NewAggregator(opts...)
+
+	for {
+		tick, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, c := range a.AddTick(tick) {
+			if err := dst.Write(c); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range a.Flush() {
+		if err := dst.Write(c); err != nil {
+			return err
+		}
+	}
+
+	return dst.Flush()
+}
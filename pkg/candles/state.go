@@ -0,0 +1,201 @@
+package candles
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// aggregatorJSON is the state of an Aggregator: its clock and open candles.
+type aggregatorJSON struct {
+	// Intervals are the configured intervals, checked on restore.
+	Intervals []string      `json:"intervals"`
+	Watermark time.Time     `json:"watermark"`
+	Late      int           `json:"late,omitempty"`
+	Unmatched int           `json:"unmatched,omitempty"`
+	Candles   []candleState `json:"candles"`
+}
+
+// candleState is an open candle including the sums it is updated from.
+type candleState struct {
+	ID       string    `json:"id"`
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Volume   float64   `json:"volume"`
+	Time     time.Time `json:"time"`
+	Interval string    `json:"interval"`
+	VWAP     float64   `json:"vwap"`
+	Count    int       `json:"count"`
+
+	Turnover    float64 `json:"turnover"`
+	PriceSum    float64 `json:"price_sum"`
+	Spread      float64 `json:"spread,omitempty"`
+	MaxSpread   float64 `json:"max_spread,omitempty"`
+	SpreadSum   float64 `json:"spread_sum,omitempty"`
+	Quoted      int     `json:"quoted,omitempty"`
+	ExactVolume Decimal `json:"exact_volume"`
+	First       Tick    `json:"first"`
+	Last        Tick    `json:"last"`
+	// Trades are kept WithCorrections.
+	Trades []Tick `json:"trades,omitempty"`
+}
+
+// MarshalJSON encodes the state of the aggregator, its open candles and
+// clock, so that an aggregator created with the same options can carry on
+// from it after a restart.
+func (a *Aggregator) MarshalJSON() ([]byte, error) {
+	a.lockAll()
+	defer a.unlockAll()
+
+	v := aggregatorJSON{Late: a.LateTicks(), Unmatched: a.UnmatchedCorrections(), Candles: []candleState{}}
+
+	if w := a.watermark.Load(); w != unset {
+		v.Watermark = time.Unix(0, w).In(a.cfg.location)
+	}
+
+	for _, interval := range a.cfg.intervals {
+		v.Intervals = append(v.Intervals, interval.String())
+	}
+
+	idSeries := make(map[string][]*series)
+
+	for i := range a.shards {
+		for id, s := range a.shards[i].series {
+			idSeries[id] = s
+		}
+	}
+
+	ids := make([]string, 0, len(idSeries))
+	for id := range idSeries {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		for _, s := range idSeries[id] {
+			for _, c := range s.open {
+				v.Candles = append(v.Candles, candleState{
+					ID:          c.ID,
+					Open:        c.Open,
+					High:        c.High,
+					Low:         c.Low,
+					Close:       c.Close,
+					Volume:      c.Volume,
+					Time:        c.Time,
+					Interval:    c.Interval.String(),
+					VWAP:        c.VWAP,
+					Count:       c.Count,
+					Turnover:    c.turnover,
+					PriceSum:    c.priceSum,
+					Spread:      c.Spread,
+					MaxSpread:   c.MaxSpread,
+					SpreadSum:   c.spreadSum,
+					Quoted:      c.quoted,
+					ExactVolume: c.volume,
+					First:       c.first,
+					Last:        c.last,
+					Trades:      c.trades,
+				})
+			}
+		}
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON replaces the state of the aggregator with one encoded by
+// MarshalJSON. The aggregator must have been created with the same
+// intervals.
+func (a *Aggregator) UnmarshalJSON(data []byte) error {
+	var v aggregatorJSON
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	index := make(map[string]int)
+
+	for i, interval := range a.cfg.intervals {
+		index[interval.String()] = i
+	}
+
+	for _, s := range v.Intervals {
+		if _, ok := index[s]; !ok || len(v.Intervals) != len(a.cfg.intervals) {
+			return fmt.Errorf("state intervals %v differ from the configured ones", v.Intervals)
+		}
+	}
+
+	a.lockAll()
+	defer a.unlockAll()
+
+	a.reset()
+	a.late.Store(int64(v.Late))
+	a.unmatched.Store(int64(v.Unmatched))
+
+	if !v.Watermark.IsZero() {
+		a.watermark.Store(v.Watermark.UnixNano())
+	}
+
+	for _, state := range v.Candles {
+		i, ok := index[state.Interval]
+		if !ok {
+			return fmt.Errorf("state candle of unknown interval %q", state.Interval)
+		}
+
+		sh := a.shard(state.ID)
+
+		idSeries := sh.series[state.ID]
+		if idSeries == nil {
+			idSeries = make([]*series, len(a.cfg.intervals))
+			for j := range idSeries {
+				idSeries[j] = &series{}
+			}
+
+			sh.series[state.ID] = idSeries
+		}
+
+		c := &Candle{
+			ID:       state.ID,
+			Open:     state.Open,
+			High:     state.High,
+			Low:      state.Low,
+			Close:    state.Close,
+			Volume:   state.Volume,
+			Time:     state.Time.In(a.cfg.location),
+			Interval: a.cfg.intervals[i],
+			VWAP:     state.VWAP,
+			Count:    state.Count,
+
+			Spread:    state.Spread,
+			MaxSpread: state.MaxSpread,
+
+			turnover:  state.Turnover,
+			priceSum:  state.PriceSum,
+			spreadSum: state.SpreadSum,
+			quoted:    state.Quoted,
+
+			precision: a.cfg.precision,
+			volume:    state.ExactVolume,
+
+			FirstTime: state.First.Time.In(a.cfg.location),
+			LastTime:  state.Last.Time.In(a.cfg.location),
+			FirstSeq:  state.First.Seq,
+			LastSeq:   state.Last.Seq,
+
+			first: state.First,
+			last:  state.Last,
+
+			changed: true,
+			trades:  state.Trades,
+		}
+
+		idSeries[i].insert(c)
+		a.updateNextClose(a.cfg.end(c.Interval, c.Time))
+	}
+
+	return nil
+}
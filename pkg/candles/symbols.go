@@ -0,0 +1,48 @@
+package candles
+
+import "strings"
+
+// Symbols is a table of instrument IDs numbered in the order they are first
+// seen. Interning the IDs of ticks keeps a single copy of each instead of
+// one per tick, or, with the CSV readers, the whole line a field of which
+// the ID is. A Symbols is not safe for concurrent use.
+type Symbols struct {
+	symbols map[string]int
+	names   []string
+}
+
+// NewSymbols returns an empty table.
+func NewSymbols() *Symbols {
+	return &Symbols{symbols: make(map[string]int)}
+}
+
+// Symbol returns the number of the ID, adding it to the table if new.
+func (s *Symbols) Symbol(id string) int {
+	if sym, ok := s.symbols[id]; ok {
+		return sym
+	}
+
+	// Clone, as id may be a part of a longer string or of mapped memory.
+	id = strings.Clone(id)
+	sym := len(s.names)
+
+	s.symbols[id] = sym
+	s.names = append(s.names, id)
+
+	return sym
+}
+
+// Intern returns the copy of the ID held by the table.
+func (s *Symbols) Intern(id string) string {
+	return s.names[s.Symbol(id)]
+}
+
+// Name returns the ID numbered sym.
+func (s *Symbols) Name(sym int) string {
+	return s.names[sym]
+}
+
+// Len returns the number of IDs in the table.
+func (s *Symbols) Len() int {
+	return len(s.names)
+}
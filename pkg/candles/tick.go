@@ -0,0 +1,274 @@
+package candles
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tick is a single price observation of an instrument.
+type Tick struct {
+	ID     string    `json:"id"`
+	Price  float64   `json:"price"`
+	Volume float64   `json:"volume,omitempty"`
+	Time   time.Time `json:"time"`
+	// Seq is an optional sequence number ordering ticks with equal times.
+	Seq int64 `json:"seq,omitempty"`
+	// Kind tells trades from quotes and the corrections of earlier trades.
+	Kind TickKind `json:"kind,omitempty"`
+	// Bid and Ask are the best quotes at the time of the tick, zero if
+	// unknown.
+	Bid float64 `json:"bid,omitempty"`
+	Ask float64 `json:"ask,omitempty"`
+}
+
+// Before reports whether t is ordered before o: by time, then by sequence
+// number. Ticks equal in both keep their input order.
+func (t Tick) Before(o Tick) bool {
+	if !t.Time.Equal(o.Time) {
+		return t.Time.Before(o.Time)
+	}
+
+	return t.Seq < o.Seq
+}
+
+// ParseTick parses a tick from a line of the form
+// "ID,price,time(RFC3339)[,volume]".
+func ParseTick(line string) (Tick, error) {
+	return ParseTickRecord(strings.Split(line, ","), DefaultTickColumns)
+}
+
+// TickColumns maps the fields of a tick to the columns of a record. The
+// optional fields, and Price of quotes, are -1 when the record has no such
+// column.
+type TickColumns struct {
+	ID     int
+	Price  int
+	Time   int
+	Volume int
+	Seq    int
+	Kind   int
+	Bid    int
+	Ask    int
+}
+
+// DefaultTickColumns is the column layout of a headerless input:
+// id,price,time[,volume[,seq[,kind]]]. Quotes need a header naming their
+// bid and ask columns.
+var DefaultTickColumns = TickColumns{ID: 0, Price: 1, Time: 2, Volume: 3, Seq: 4, Kind: 5, Bid: -1, Ask: -1}
+
+// ParseTickRecord parses a tick from the fields of a record.
+func ParseTickRecord(record []string, cols TickColumns) (Tick, error) {
+	return TickParser{Columns: cols}.ParseRecord(record)
+}
+
+// ParseTickJSON parses a tick from a JSON object of the form
+// {"id":...,"price":...,"time":...,"volume":...,"seq":...}.
+func ParseTickJSON(line []byte) (Tick, error) {
+	return TickParser{}.ParseJSON(line)
+}
+
+// TickParser parses ticks with a custom column layout and time format.
+type TickParser struct {
+	// Columns is the layout of CSV records, DefaultTickColumns if zero.
+	Columns TickColumns
+	// ParseTime parses timestamps, ParseTime if nil.
+	ParseTime TimeParser
+	// Precision selects how prices and volumes are parsed. DecimalPrecision
+	// rejects numbers with more than nine fractional digits.
+	Precision Precision
+}
+
+// ParseRecord parses a tick from the fields of a record. A record with bid
+// and ask prices but no price is a Quote.
+func (p TickParser) ParseRecord(record []string) (Tick, error) {
+	cols := p.Columns
+	if cols == (TickColumns{}) {
+		cols = DefaultTickColumns
+	}
+
+	for _, f := range []struct {
+		name   string
+		column int
+	}{{"id", cols.ID}, {"price", cols.Price}, {"time", cols.Time}} {
+		if len(record) <= f.column {
+			return Tick{}, &FieldError{Kind: ErrMissingField, Field: f.name}
+		}
+	}
+
+	var (
+		kind TickKind
+		err  error
+	)
+
+	if cols.Kind >= 0 && len(record) > cols.Kind {
+		if kind, err = ParseTickKind(record[cols.Kind]); err != nil {
+			return Tick{}, &FieldError{Kind: ErrBadKind, Field: "kind", Column: cols.Kind + 1, Err: err}
+		}
+	}
+
+	var bid, ask float64
+
+	if cols.Bid >= 0 && len(record) > cols.Bid && record[cols.Bid] != "" {
+		if bid, err = p.Precision.parseNumber(record[cols.Bid]); err != nil {
+			return Tick{}, &FieldError{Kind: ErrBadPrice, Field: "bid", Column: cols.Bid + 1, Err: err}
+		}
+	}
+
+	if cols.Ask >= 0 && len(record) > cols.Ask && record[cols.Ask] != "" {
+		if ask, err = p.Precision.parseNumber(record[cols.Ask]); err != nil {
+			return Tick{}, &FieldError{Kind: ErrBadPrice, Field: "ask", Column: cols.Ask + 1, Err: err}
+		}
+	}
+
+	var price float64
+
+	switch {
+	case cols.Price >= 0 && record[cols.Price] != "":
+		if price, err = p.Precision.parseNumber(record[cols.Price]); err != nil {
+			return Tick{}, &FieldError{Kind: ErrBadPrice, Field: "price", Column: cols.Price + 1, Err: err}
+		}
+	case (kind == Trade || kind == Quote) && bid != 0 && ask != 0:
+		kind = Quote
+	case kind == Cancel:
+		// A cancel needs no price.
+	case cols.Price < 0:
+		return Tick{}, &FieldError{Kind: ErrMissingField, Field: "price"}
+	default:
+		_, err = p.Precision.parseNumber(record[cols.Price])
+		return Tick{}, &FieldError{Kind: ErrBadPrice, Field: "price", Column: cols.Price + 1, Err: err}
+	}
+
+	t, err := p.parseTime(record[cols.Time])
+	if err != nil {
+		return Tick{}, &FieldError{Kind: ErrBadTimestamp, Field: "time", Column: cols.Time + 1, Err: err}
+	}
+
+	var volume float64
+
+	if cols.Volume >= 0 && len(record) > cols.Volume && record[cols.Volume] != "" {
+		volume, err = p.Precision.parseNumber(record[cols.Volume])
+		if err != nil {
+			return Tick{}, &FieldError{Kind: ErrBadVolume, Field: "volume", Column: cols.Volume + 1, Err: err}
+		}
+	}
+
+	var seq int64
+
+	if cols.Seq >= 0 && len(record) > cols.Seq && record[cols.Seq] != "" {
+		seq, err = strconv.ParseInt(record[cols.Seq], 10, 64)
+		if err != nil {
+			return Tick{}, &FieldError{Kind: ErrBadSeq, Field: "seq", Column: cols.Seq + 1, Err: err}
+		}
+	}
+
+	return Tick{
+		ID:     record[cols.ID],
+		Price:  price,
+		Volume: volume,
+		Time:   t,
+		Seq:    seq,
+		Kind:   kind,
+		Bid:    bid,
+		Ask:    ask,
+	}, nil
+}
+
+type tickJSON struct {
+	ID     string          `json:"id"`
+	Price  json.Number     `json:"price"`
+	Volume json.Number     `json:"volume"`
+	Time   json.RawMessage `json:"time"`
+	Seq    int64           `json:"seq"`
+	Kind   string          `json:"kind"`
+	Bid    json.Number     `json:"bid"`
+	Ask    json.Number     `json:"ask"`
+}
+
+// ParseJSON parses a tick from a JSON object. The time may be a string or
+// a number. An object with bid and ask prices but no price is a Quote; any
+// other object but a cancel needs a price.
+func (p TickParser) ParseJSON(line []byte) (Tick, error) {
+	var v tickJSON
+
+	if err := json.Unmarshal(line, &v); err != nil {
+		return Tick{}, err
+	}
+
+	if v.ID == "" {
+		return Tick{}, &FieldError{Kind: ErrMissingField, Field: "id"}
+	}
+
+	if len(v.Time) == 0 {
+		return Tick{}, &FieldError{Kind: ErrMissingField, Field: "time"}
+	}
+
+	timeStr := string(v.Time)
+	if strings.HasPrefix(timeStr, `"`) {
+		if err := json.Unmarshal(v.Time, &timeStr); err != nil {
+			return Tick{}, &FieldError{Kind: ErrBadTimestamp, Field: "time", Err: err}
+		}
+	}
+
+	t, err := p.parseTime(timeStr)
+	if err != nil {
+		return Tick{}, &FieldError{Kind: ErrBadTimestamp, Field: "time", Err: err}
+	}
+
+	kind, err := ParseTickKind(v.Kind)
+	if err != nil {
+		return Tick{}, &FieldError{Kind: ErrBadKind, Field: "kind", Err: err}
+	}
+
+	var price, volume, bid, ask float64
+
+	for _, f := range []struct {
+		name  string
+		value json.Number
+		dst   *float64
+		kind  error
+	}{
+		{"price", v.Price, &price, ErrBadPrice},
+		{"volume", v.Volume, &volume, ErrBadVolume},
+		{"bid", v.Bid, &bid, ErrBadPrice},
+		{"ask", v.Ask, &ask, ErrBadPrice},
+	} {
+		if f.value == "" {
+			continue
+		}
+
+		if *f.dst, err = p.Precision.parseNumber(f.value.String()); err != nil {
+			return Tick{}, &FieldError{Kind: f.kind, Field: f.name, Err: err}
+		}
+	}
+
+	switch {
+	case v.Price != "":
+	case (kind == Trade || kind == Quote) && bid != 0 && ask != 0:
+		kind = Quote
+	case kind == Cancel:
+		// A cancel needs no price.
+	default:
+		return Tick{}, &FieldError{Kind: ErrMissingField, Field: "price"}
+	}
+
+	return Tick{
+		ID:     v.ID,
+		Price:  price,
+		Volume: volume,
+		Time:   t,
+		Seq:    v.Seq,
+		Kind:   kind,
+		Bid:    bid,
+		Ask:    ask,
+	}, nil
+}
+
+func (p TickParser) parseTime(s string) (time.Time, error) {
+	if p.ParseTime == nil {
+		return ParseTime(s)
+	}
+
+	return p.ParseTime(s)
+}
@@ -0,0 +1,40 @@
+package candles
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseJSONPrice(t *testing.T) {
+	tests := []struct {
+		line string
+		kind TickKind
+		err  error
+	}{
+		{`{"id":"X","price":1.5,"time":"2024-01-02T10:00:00Z"}`, Trade, nil},
+		{`{"id":"X","bid":1.5,"ask":1.6,"time":"2024-01-02T10:00:00Z"}`, Quote, nil},
+		{`{"id":"X","time":"2024-01-02T10:00:00Z","kind":"cancel"}`, Cancel, nil},
+		{`{"id":"X","time":"2024-01-02T10:00:00Z"}`, 0, ErrMissingField},
+		{`{"id":"X","bid":1.5,"time":"2024-01-02T10:00:00Z"}`, 0, ErrMissingField},
+		{`{"id":"X","time":"2024-01-02T10:00:00Z","kind":"amend"}`, 0, ErrMissingField},
+	}
+
+	for _, tt := range tests {
+		tick, err := TickParser{}.ParseJSON([]byte(tt.line))
+
+		if tt.err != nil {
+			var fe *FieldError
+			if !errors.As(err, &fe) || !errors.Is(fe.Kind, tt.err) || fe.Field != "price" {
+				t.Errorf("ParseJSON(%s) = %v, want a missing price", tt.line, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseJSON(%s): %v", tt.line, err)
+		} else if tick.Kind != tt.kind {
+			t.Errorf("ParseJSON(%s) is a %v, want %v", tt.line, tick.Kind, tt.kind)
+		}
+	}
+}
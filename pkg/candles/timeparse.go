@@ -0,0 +1,123 @@
+package candles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeParser parses the timestamp of a tick.
+type TimeParser func(s string) (time.Time, error)
+
+// autoLayouts are tried in order by ParseTime after RFC3339. Fractional
+// seconds are accepted after the seconds field of any of them.
+var autoLayouts = []string{
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"02.01.2006 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime parses a timestamp in any of the supported formats: RFC3339,
+// common date-time layouts without a time zone (taken as UTC) and Unix epoch
+// seconds, milliseconds, microseconds or nanoseconds told apart by the
+// number of digits.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	if t, err := parseUnix(s, ""); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range autoLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time format: %q", s)
+}
+
+// NewTimeParser returns a parser of the given format: "auto" (ParseTime),
+// "rfc3339", "unix", "unix_ms", "unix_us", "unix_ns" or a Go time layout
+// such as "2006-01-02 15:04:05".
+func NewTimeParser(format string) (TimeParser, error) {
+	switch format {
+	case "", "auto":
+		return ParseTime, nil
+	case "rfc3339":
+		return func(s string) (time.Time, error) {
+			return time.Parse(time.RFC3339, s)
+		}, nil
+	case "unix", "unix_ms", "unix_us", "unix_ns":
+		return func(s string) (time.Time, error) {
+			return parseUnix(s, format)
+		}, nil
+	}
+
+	if !strings.Contains(format, "2006") && !strings.Contains(format, "15") {
+		return nil, fmt.Errorf("unknown time format: %q", format)
+	}
+
+	return func(s string) (time.Time, error) {
+		return time.Parse(format, s)
+	}, nil
+}
+
+// parseUnix parses an epoch timestamp in the unit of format or, if format is
+// empty, in the unit implied by the number of integer digits.
+func parseUnix(s, format string) (time.Time, error) {
+	intPart, fracPart, _ := strings.Cut(s, ".")
+
+	sec, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var frac float64
+
+	if fracPart != "" {
+		if frac, err = strconv.ParseFloat("0."+fracPart, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if format == "" {
+		digits := len(strings.TrimPrefix(intPart, "-"))
+
+		switch {
+		case digits <= 10:
+			format = "unix"
+		case digits <= 13:
+			format = "unix_ms"
+		case digits <= 16:
+			format = "unix_us"
+		default:
+			format = "unix_ns"
+		}
+	}
+
+	var unit time.Duration
+
+	switch format {
+	case "unix":
+		unit = time.Second
+	case "unix_ms":
+		unit = time.Millisecond
+	case "unix_us":
+		unit = time.Microsecond
+	default:
+		unit = time.Nanosecond
+	}
+
+	ns := sec * int64(unit/time.Nanosecond)
+
+	return time.Unix(0, ns+int64(frac*float64(unit))).UTC(), nil
+}
@@ -0,0 +1,63 @@
+package candles
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Validator checks the integrity of candles:
+//
+//   - low <= open, close <= high;
+//   - the time is aligned to the interval in the location;
+//   - candles of a series don't overlap;
+//   - the open doesn't differ from the previous close of the series by more
+//     than a relative threshold.
+type Validator struct {
+	loc    *time.Location
+	maxGap float64
+	prev   map[seriesKey]Candle
+}
+
+// NewValidator returns a validator of candles with boundaries in loc that
+// reports opens differing from the previous close by more than maxGap,
+// e.g. 0.1 for 10%.
+func NewValidator(loc *time.Location, maxGap float64) *Validator {
+	return &Validator{loc: loc, maxGap: maxGap, prev: make(map[seriesKey]Candle)}
+}
+
+// Check returns the violations of the next candle, empty if it is valid.
+// Candles of a series must be passed in time order.
+func (v *Validator) Check(c Candle) []string {
+	var result []string
+
+	if c.Low > c.High || c.Open < c.Low || c.Open > c.High || c.Close < c.Low || c.Close > c.High {
+		result = append(result, fmt.Sprintf("prices out of range: open %v, high %v, low %v, close %v", c.Open, c.High, c.Low, c.Close))
+	}
+
+	if c.Interval == (Interval{}) {
+		return result
+	}
+
+	if start := c.Interval.Truncate(c.Time, v.loc); !start.Equal(c.Time) {
+		result = append(result, fmt.Sprintf("time %s is not aligned to %s, want %s", c.Time.Format(time.RFC3339Nano), c.Interval, start.Format(time.RFC3339Nano)))
+	}
+
+	key := seriesKey{c.ID, c.Interval}
+
+	if prev, ok := v.prev[key]; ok {
+		if end := prev.end(); end.After(c.Time) {
+			result = append(result, fmt.Sprintf("overlaps the previous candle at %s ending at %s", prev.Time.Format(time.RFC3339Nano), end.Format(time.RFC3339Nano)))
+		}
+
+		if prev.Close != 0 {
+			if gap := c.Open/prev.Close - 1; math.Abs(gap) > v.maxGap {
+				result = append(result, fmt.Sprintf("open %v differs from the previous close %v by %.1f%%", c.Open, prev.Close, gap*100))
+			}
+		}
+	}
+
+	v.prev[key] = c
+
+	return result
+}
@@ -0,0 +1,79 @@
+package indicators
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// macd is the moving average convergence divergence: the difference of a
+// fast and a slow EMA of closes, its EMA as the signal line and their
+// difference as the histogram.
+type macd struct {
+	columns []string
+	fast    *ema
+	slow    *ema
+	signal  *ema
+}
+
+func newMACD(fast, slow, signal int) *macd {
+	suffix := "_" + strings.Join(formatParams([]float64{float64(fast), float64(slow), float64(signal)}), "_")
+
+	return &macd{
+		columns: []string{"macd" + suffix, "macd_signal" + suffix, "macd_hist" + suffix},
+		fast:    newEMA(fast),
+		slow:    newEMA(slow),
+		signal:  newEMA(signal),
+	}
+}
+
+func (m *macd) Columns() []string {
+	return m.columns
+}
+
+func (m *macd) Next(c candles.Candle) []float64 {
+	value := m.fast.add(c.Close) - m.slow.add(c.Close)
+	if math.IsNaN(value) {
+		return []float64{value, math.NaN(), math.NaN()}
+	}
+
+	signal := m.signal.add(value)
+
+	return []float64{value, signal, value - signal}
+}
+
+// bollinger is the Bollinger Bands: the simple moving average of closes
+// and the bands a multiple of the standard deviation of the window above
+// and below it.
+type bollinger struct {
+	columns    []string
+	multiplier float64
+	mean       *sma
+	squares    *sma
+}
+
+func newBollinger(period int, multiplier float64) *bollinger {
+	suffix := "_" + strconv.Itoa(period) + "_" + strconv.FormatFloat(multiplier, 'g', -1, 64)
+
+	return &bollinger{
+		columns:    []string{"bb_upper" + suffix, "bb_middle" + suffix, "bb_lower" + suffix},
+		multiplier: multiplier,
+		mean:       newSMA(period),
+		squares:    newSMA(period),
+	}
+}
+
+func (b *bollinger) Columns() []string {
+	return b.columns
+}
+
+func (b *bollinger) Next(c candles.Candle) []float64 {
+	mean := b.mean.add(c.Close)
+	meanSquare := b.squares.add(c.Close * c.Close)
+
+	std := math.Sqrt(math.Max(meanSquare-mean*mean, 0))
+
+	return []float64{mean + b.multiplier*std, mean, mean - b.multiplier*std}
+}
@@ -0,0 +1,385 @@
+// Package indicators computes technical indicators over candle series.
+// Indicators are streaming: they take candles one at a time, so they work
+// on live candles as well as on a whole history.
+package indicators
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// Indicator computes values over the candles of a single series.
+type Indicator interface {
+	// Columns returns the names of the values.
+	Columns() []string
+	// Next adds the next candle of the series and returns the values, NaN
+	// while there are not enough candles yet.
+	Next(c candles.Candle) []float64
+}
+
+// Spec describes an indicator such as "sma:20" or "macd:12:26:9".
+type Spec struct {
+	Name   string
+	Params []float64
+}
+
+// String returns the spec in the notation accepted by Parse.
+func (s Spec) String() string {
+	return strings.Join(append([]string{s.Name}, formatParams(s.Params)...), ":")
+}
+
+// New returns a new indicator of the spec with no history. It fails if the
+// name is unknown or the parameters don't fit it.
+func (s Spec) New() (Indicator, error) {
+	def, ok := defs[s.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown indicator: %q", s.Name)
+	}
+
+	if err := def.check(s.Params); err != nil {
+		return nil, fmt.Errorf("bad indicator %q: %w", s, err)
+	}
+
+	p := s.Params
+
+	switch s.Name {
+	case "sma":
+		return newSMA(int(p[0])), nil
+	case "ema":
+		return newEMA(int(p[0])), nil
+	case "rsi":
+		return newRSI(int(p[0])), nil
+	case "macd":
+		return newMACD(int(p[0]), int(p[1]), int(p[2])), nil
+	case "bb":
+		return newBollinger(int(p[0]), p[1]), nil
+	case "tr":
+		return &tr{}, nil
+	case "atr":
+		return newATR(int(p[0])), nil
+	case "return":
+		return &simpleReturn{}, nil
+	case "log_return":
+		return &logReturn{}, nil
+	case "rvol":
+		return newRVol(int(p[0])), nil
+	case "parkinson":
+		return newRangeVolatility(s.Name, int(p[0]), parkinson), nil
+	case "garman_klass":
+		return newRangeVolatility(s.Name, int(p[0]), garmanKlass), nil
+	case "rogers_satchell":
+		return newRangeVolatility(s.Name, int(p[0]), rogersSatchell), nil
+	default:
+		return nil, fmt.Errorf("unknown indicator: %q", s.Name)
+	}
+}
+
+// indicatorDef describes the parameters of an indicator.
+type indicatorDef struct {
+	// defaults are the parameters used when none are given; nil makes
+	// them required.
+	defaults []float64
+	// count is the number of parameters.
+	count int
+	// periods is the number of leading parameters that are integers.
+	periods int
+}
+
+// check reports whether the parameters fit the indicator.
+func (d indicatorDef) check(params []float64) error {
+	if len(params) != d.count {
+		return fmt.Errorf("takes %d parameters", d.count)
+	}
+
+	for i, v := range params {
+		if !(v > 0) || i < d.periods && v != math.Trunc(v) {
+			return errors.New("parameters must be positive, periods integer")
+		}
+	}
+
+	return nil
+}
+
+var defs = map[string]indicatorDef{
+	"sma":  {count: 1, periods: 1},
+	"ema":  {count: 1, periods: 1},
+	"rsi":  {count: 1, periods: 1},
+	"macd": {defaults: []float64{12, 26, 9}, count: 3, periods: 3},
+	"bb":   {defaults: []float64{20, 2}, count: 2, periods: 1},
+	"tr":   {},
+	"atr":  {defaults: []float64{14}, count: 1, periods: 1},
+
+	"return":     {},
+	"log_return": {},
+	"rvol":       {defaults: []float64{20}, count: 1, periods: 1},
+
+	"parkinson":       {defaults: []float64{1}, count: 1, periods: 1},
+	"garman_klass":    {defaults: []float64{1}, count: 1, periods: 1},
+	"rogers_satchell": {defaults: []float64{1}, count: 1, periods: 1},
+}
+
+// Parse parses a comma separated list of indicators: "sma:N", "ema:N",
+// "rsi:N", "macd[:fast:slow:signal]" (12:26:9 by default) and
+// "bb[:period:multiplier]", Bollinger Bands (20:2 by default), "tr", the
+// true range, "atr[:N]", the average true range (14 by default), "return"
+// and "log_return", the simple and log returns of the close, and
+// "rvol[:N]", the realized volatility (20 by default), and the range based
+// volatility estimators "parkinson[:N]", "garman_klass[:N]" and
+// "rogers_satchell[:N]", of every candle by default or over N candles.
+// Periods are positive integers.
+func Parse(s string) ([]Spec, error) {
+	var result []Spec
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		fields := strings.Split(item, ":")
+
+		def, ok := defs[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown indicator: %q", item)
+		}
+
+		spec := Spec{Name: fields[0]}
+
+		switch {
+		case len(fields) == 1 && def.defaults != nil:
+			spec.Params = def.defaults
+		case len(fields)-1 != def.count:
+			return nil, fmt.Errorf("indicator %q takes %d parameters", item, def.count)
+		}
+
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil || v <= 0 || i < def.periods && v != math.Trunc(v) {
+				return nil, fmt.Errorf("bad indicator %q: parameters must be positive, periods integer", item)
+			}
+
+			spec.Params = append(spec.Params, v)
+		}
+
+		result = append(result, spec)
+	}
+
+	return result, nil
+}
+
+func formatParams(params []float64) []string {
+	result := make([]string, len(params))
+	for i, p := range params {
+		result[i] = strconv.FormatFloat(p, 'g', -1, 64)
+	}
+
+	return result
+}
+
+type seriesKey struct {
+	id       string
+	interval candles.Interval
+}
+
+// Pipeline computes a set of indicators over every instrument and interval
+// separately.
+type Pipeline struct {
+	specs  []Spec
+	series map[seriesKey][]Indicator
+}
+
+// NewPipeline returns a pipeline of the indicators. It fails if a spec
+// doesn't describe an indicator.
+func NewPipeline(specs []Spec) (*Pipeline, error) {
+	for _, spec := range specs {
+		if _, err := spec.New(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Pipeline{specs: specs, series: make(map[seriesKey][]Indicator)}, nil
+}
+
+// newSeries returns new indicators of all specs.
+func (p *Pipeline) newSeries() []Indicator {
+	result := make([]Indicator, len(p.specs))
+
+	for i, spec := range p.specs {
+		// NewPipeline checked the specs.
+		result[i], _ = spec.New()
+	}
+
+	return result
+}
+
+// Columns returns the names of the values of all indicators.
+func (p *Pipeline) Columns() []string {
+	var result []string
+
+	for _, ind := range p.newSeries() {
+		result = append(result, ind.Columns()...)
+	}
+
+	return result
+}
+
+// Ratios returns the names of the values that are ratios, such as returns,
+// rather than on the price scale.
+func (p *Pipeline) Ratios() []string {
+	var result []string
+
+	for _, ind := range p.newSeries() {
+		if isRatio(ind) {
+			result = append(result, ind.Columns()...)
+		}
+	}
+
+	return result
+}
+
+// Next adds the next candle of its series and returns the indicator values
+// by column name. Candles of a series must be passed in time order.
+func (p *Pipeline) Next(c candles.Candle) map[string]float64 {
+	key := seriesKey{c.ID, c.Interval}
+
+	series, ok := p.series[key]
+	if !ok {
+		series = p.newSeries()
+		p.series[key] = series
+	}
+
+	result := make(map[string]float64)
+
+	for _, ind := range series {
+		for i, v := range ind.Next(c) {
+			result[ind.Columns()[i]] = v
+		}
+	}
+
+	return result
+}
+
+// sma is the simple moving average of closes.
+type sma struct {
+	period int
+	window []float64
+	pos    int
+	sum    float64
+}
+
+func newSMA(period int) *sma {
+	return &sma{period: period}
+}
+
+func (s *sma) Columns() []string {
+	return []string{"sma_" + strconv.Itoa(s.period)}
+}
+
+func (s *sma) Next(c candles.Candle) []float64 {
+	return []float64{s.add(c.Close)}
+}
+
+func (s *sma) add(v float64) float64 {
+	s.sum += v
+
+	if len(s.window) < s.period {
+		s.window = append(s.window, v)
+	} else {
+		s.sum -= s.window[s.pos]
+		s.window[s.pos] = v
+		s.pos = (s.pos + 1) % s.period
+	}
+
+	if len(s.window) < s.period {
+		return math.NaN()
+	}
+
+	return s.sum / float64(s.period)
+}
+
+// ema is the exponential moving average of closes, seeded with the simple
+// average of the first period closes.
+type ema struct {
+	period int
+	alpha  float64
+	seed   *sma
+	value  float64
+	ready  bool
+}
+
+func newEMA(period int) *ema {
+	return &ema{period: period, alpha: 2 / float64(period+1), seed: newSMA(period)}
+}
+
+func (e *ema) Columns() []string {
+	return []string{"ema_" + strconv.Itoa(e.period)}
+}
+
+func (e *ema) Next(c candles.Candle) []float64 {
+	return []float64{e.add(c.Close)}
+}
+
+func (e *ema) add(v float64) float64 {
+	if e.ready {
+		e.value += e.alpha * (v - e.value)
+		return e.value
+	}
+
+	e.value = e.seed.add(v)
+	e.ready = !math.IsNaN(e.value)
+
+	return e.value
+}
+
+// rsi is the relative strength index with Wilder's smoothing.
+type rsi struct {
+	period  int
+	prev    float64
+	count   int
+	avgGain float64
+	avgLoss float64
+}
+
+func newRSI(period int) *rsi {
+	return &rsi{period: period}
+}
+
+func (r *rsi) Columns() []string {
+	return []string{"rsi_" + strconv.Itoa(r.period)}
+}
+
+func (r *rsi) Next(c candles.Candle) []float64 {
+	r.count++
+
+	if r.count == 1 {
+		r.prev = c.Close
+		return []float64{math.NaN()}
+	}
+
+	change := c.Close - r.prev
+	r.prev = c.Close
+
+	gain, loss := math.Max(change, 0), math.Max(-change, 0)
+	n := float64(r.period)
+
+	switch {
+	case r.count <= r.period:
+		r.avgGain += gain / n
+		r.avgLoss += loss / n
+
+		return []float64{math.NaN()}
+	case r.count == r.period+1:
+		r.avgGain += gain / n
+		r.avgLoss += loss / n
+	default:
+		r.avgGain = (r.avgGain*(n-1) + gain) / n
+		r.avgLoss = (r.avgLoss*(n-1) + loss) / n
+	}
+
+	if r.avgLoss == 0 {
+		return []float64{100}
+	}
+
+	return []float64{100 - 100/(1+r.avgGain/r.avgLoss)}
+}
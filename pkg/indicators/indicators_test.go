@@ -0,0 +1,48 @@
+package indicators
+
+import "testing"
+
+func TestSpecNew(t *testing.T) {
+	tests := []struct {
+		spec Spec
+		ok   bool
+	}{
+		{Spec{Name: "sma", Params: []float64{20}}, true},
+		{Spec{Name: "bb", Params: []float64{20, 2}}, true},
+		{Spec{Name: "tr"}, true},
+		{Spec{Name: "bb"}, false},
+		{Spec{Name: "macd", Params: []float64{12, 26}}, false},
+		{Spec{Name: "sma", Params: []float64{0}}, false},
+		{Spec{Name: "ema", Params: []float64{2.5}}, false},
+		{Spec{Name: "tr", Params: []float64{1}}, false},
+		{Spec{Name: "wma", Params: []float64{20}}, false},
+		{Spec{}, false},
+	}
+
+	for _, tt := range tests {
+		ind, err := tt.spec.New()
+
+		if tt.ok && (err != nil || ind == nil) {
+			t.Errorf("%v.New() = %v, %v, want an indicator", tt.spec, ind, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("%v.New() = %v, want an error", tt.spec, ind)
+		}
+	}
+
+	if _, err := NewPipeline([]Spec{{Name: "sma", Params: []float64{20}}, {Name: "bb"}}); err == nil {
+		t.Error("NewPipeline accepted a malformed spec")
+	}
+}
+
+func TestParseNew(t *testing.T) {
+	specs, err := Parse("sma:20,macd,bb,atr:5,rogers_satchell")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, spec := range specs {
+		if _, err := spec.New(); err != nil {
+			t.Errorf("%v.New(): %v", spec, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package indicators
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// ratio is implemented by the indicators of ratios rather than prices.
+type ratio interface {
+	ratio()
+}
+
+func isRatio(ind Indicator) bool {
+	_, ok := ind.(ratio)
+	return ok
+}
+
+// prevClose tracks the previous close of a series to compute returns. The
+// first candle has no previous close, so its return is NaN.
+type prevClose struct {
+	close   float64
+	started bool
+}
+
+// logReturn returns the log return of the close of c, NaN for the first
+// candle.
+func (p *prevClose) logReturn(c candles.Candle) float64 {
+	result := math.NaN()
+
+	if p.started {
+		result = math.Log(c.Close / p.close)
+	}
+
+	p.close = c.Close
+	p.started = true
+
+	return result
+}
+
+func (*prevClose) ratio() {}
+
+// simpleReturn is the relative change of the close from the previous one.
+type simpleReturn struct {
+	prevClose
+}
+
+func (*simpleReturn) Columns() []string {
+	return []string{"return"}
+}
+
+func (r *simpleReturn) Next(c candles.Candle) []float64 {
+	return []float64{math.Expm1(r.logReturn(c))}
+}
+
+// logReturn is the natural logarithm of the close over the previous one.
+type logReturn struct {
+	prevClose
+}
+
+func (*logReturn) Columns() []string {
+	return []string{"log_return"}
+}
+
+func (r *logReturn) Next(c candles.Candle) []float64 {
+	return []float64{r.logReturn(c)}
+}
+
+// rvol is the realized volatility: the square root of the sum of squared
+// log returns over the last period candles, not annualized.
+type rvol struct {
+	prevClose
+	squares *sma
+}
+
+func newRVol(period int) *rvol {
+	return &rvol{squares: newSMA(period)}
+}
+
+func (r *rvol) Columns() []string {
+	return []string{"rvol_" + strconv.Itoa(r.squares.period)}
+}
+
+func (r *rvol) Next(c candles.Candle) []float64 {
+	ret := r.logReturn(c)
+	if math.IsNaN(ret) {
+		return []float64{ret}
+	}
+
+	// The running sum may drift slightly below zero.
+	return []float64{math.Sqrt(math.Max(r.squares.add(ret*ret)*float64(r.squares.period), 0))}
+}
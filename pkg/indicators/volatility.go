@@ -0,0 +1,128 @@
+package indicators
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// trueRange tracks the previous close to compute the true range of a
+// candle: the largest of its range and the gaps from the previous close.
+// The first candle has no previous close, so its true range is its range.
+type trueRange struct {
+	prevClose float64
+	started   bool
+}
+
+func (t *trueRange) add(c candles.Candle) float64 {
+	result := c.High - c.Low
+
+	if t.started {
+		result = math.Max(result, math.Max(math.Abs(c.High-t.prevClose), math.Abs(c.Low-t.prevClose)))
+	}
+
+	t.prevClose = c.Close
+	t.started = true
+
+	return result
+}
+
+// tr is the true range of every candle.
+type tr struct {
+	trueRange
+}
+
+func (*tr) Columns() []string {
+	return []string{"tr"}
+}
+
+func (t *tr) Next(c candles.Candle) []float64 {
+	return []float64{t.add(c)}
+}
+
+// atr is the average true range with Wilder's smoothing, seeded with the
+// mean of the first period true ranges.
+type atr struct {
+	trueRange
+	period int
+	count  int
+	value  float64
+}
+
+func newATR(period int) *atr {
+	return &atr{period: period}
+}
+
+func (a *atr) Columns() []string {
+	return []string{"atr_" + strconv.Itoa(a.period)}
+}
+
+func (a *atr) Next(c candles.Candle) []float64 {
+	tr := a.add(c)
+	n := float64(a.period)
+
+	a.count++
+
+	switch {
+	case a.count < a.period:
+		a.value += tr / n
+		return []float64{math.NaN()}
+	case a.count == a.period:
+		a.value += tr / n
+	default:
+		a.value = (a.value*(n-1) + tr) / n
+	}
+
+	return []float64{a.value}
+}
+
+// rangeVolatility is a volatility estimator from the open, high, low and
+// close of candles: the square root of the mean of the variance estimates
+// of the last period candles, of every candle alone if the period is one.
+// It is not annualized.
+type rangeVolatility struct {
+	name     string
+	variance func(c candles.Candle) float64
+	mean     *sma
+}
+
+func newRangeVolatility(name string, period int, variance func(c candles.Candle) float64) *rangeVolatility {
+	return &rangeVolatility{name: name, variance: variance, mean: newSMA(period)}
+}
+
+func (v *rangeVolatility) Columns() []string {
+	if v.mean.period == 1 {
+		return []string{v.name}
+	}
+
+	return []string{v.name + "_" + strconv.Itoa(v.mean.period)}
+}
+
+func (v *rangeVolatility) Next(c candles.Candle) []float64 {
+	// The running sum may drift slightly below zero.
+	return []float64{math.Sqrt(math.Max(v.mean.add(v.variance(c)), 0))}
+}
+
+func (*rangeVolatility) ratio() {}
+
+// parkinson estimates the variance from the high and low alone.
+func parkinson(c candles.Candle) float64 {
+	hl := math.Log(c.High / c.Low)
+	return hl * hl / (4 * math.Ln2)
+}
+
+// garmanKlass estimates the variance from the high and low and the open
+// to close move.
+func garmanKlass(c candles.Candle) float64 {
+	hl := math.Log(c.High / c.Low)
+	co := math.Log(c.Close / c.Open)
+
+	return hl*hl/2 - (2*math.Ln2-1)*co*co
+}
+
+// rogersSatchell estimates the variance from all four prices, unbiased by
+// a drift of the price.
+func rogersSatchell(c candles.Candle) float64 {
+	return math.Log(c.High/c.Close)*math.Log(c.High/c.Open) + math.Log(c.Low/c.Close)*math.Log(c.Low/c.Open)
+}
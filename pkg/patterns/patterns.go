@@ -0,0 +1,125 @@
+// Package patterns detects candlestick patterns in candle series.
+package patterns
+
+import (
+	"math"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// Pattern names.
+const (
+	Doji             = "doji"
+	Hammer           = "hammer"
+	ShootingStar     = "shooting_star"
+	BullishEngulfing = "bullish_engulfing"
+	BearishEngulfing = "bearish_engulfing"
+	MorningStar      = "morning_star"
+	EveningStar      = "evening_star"
+)
+
+const (
+	// dojiBody is the largest body of a doji relative to its range.
+	dojiBody = 0.1
+	// starBody is the largest body of the middle candle of a star relative
+	// to the body of the first one.
+	starBody = 0.3
+)
+
+type seriesKey struct {
+	id       string
+	interval candles.Interval
+}
+
+// Detector detects patterns over the last three candles of every
+// instrument and interval separately.
+type Detector struct {
+	windows map[seriesKey][]candles.Candle
+}
+
+// NewDetector returns a detector with no history.
+func NewDetector() *Detector {
+	return &Detector{windows: make(map[seriesKey][]candles.Candle)}
+}
+
+// Next adds the next candle of its series and returns the names of the
+// patterns that end with it. Candles of a series must be passed in time
+// order.
+func (d *Detector) Next(c candles.Candle) []string {
+	key := seriesKey{c.ID, c.Interval}
+
+	window := append(d.windows[key], c)
+	if len(window) > 3 {
+		window = window[len(window)-3:]
+	}
+
+	d.windows[key] = window
+
+	return Detect(window)
+}
+
+// Detect returns the names of the patterns that end with the last of the
+// candles, which are consecutive candles of a series.
+func Detect(window []candles.Candle) []string {
+	var result []string
+
+	n := len(window)
+	if n == 0 {
+		return nil
+	}
+
+	cur := window[n-1]
+	body := math.Abs(cur.Close - cur.Open)
+	rng := cur.High - cur.Low
+	upper := cur.High - math.Max(cur.Open, cur.Close)
+	lower := math.Min(cur.Open, cur.Close) - cur.Low
+
+	if rng > 0 && body <= dojiBody*rng {
+		result = append(result, Doji)
+	}
+
+	if rng > 0 && lower >= 2*body && upper <= body {
+		result = append(result, Hammer)
+	}
+
+	if rng > 0 && upper >= 2*body && lower <= body {
+		result = append(result, ShootingStar)
+	}
+
+	if n >= 2 {
+		prev := window[n-2]
+
+		if bearish(prev) && bullish(cur) && cur.Open <= prev.Close && cur.Close >= prev.Open && body > prev.Open-prev.Close {
+			result = append(result, BullishEngulfing)
+		}
+
+		if bullish(prev) && bearish(cur) && cur.Open >= prev.Close && cur.Close <= prev.Open && body > prev.Close-prev.Open {
+			result = append(result, BearishEngulfing)
+		}
+	}
+
+	if n >= 3 {
+		first, star := window[n-3], window[n-2]
+		firstBody := math.Abs(first.Close - first.Open)
+		small := math.Abs(star.Close-star.Open) <= starBody*firstBody
+		middle := (first.Open + first.Close) / 2
+
+		if bearish(first) && small && bullish(cur) && cur.Close > middle {
+			result = append(result, MorningStar)
+		}
+
+		if bullish(first) && small && bearish(cur) && cur.Close < middle {
+			result = append(result, EveningStar)
+		}
+	}
+
+	return result
+}
+
+func bullish(c candles.Candle) bool {
+	return c.Close > c.Open
+}
+
+func bearish(c candles.Candle) bool {
+	return c.Close < c.Open
+}
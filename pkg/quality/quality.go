@@ -0,0 +1,172 @@
+// Package quality checks tick data for problems that distort candles.
+package quality
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// Report is the result of a data quality check.
+type Report struct {
+	Ticks int `json:"ticks"`
+	// BadLines is the number of input records that could not be parsed.
+	BadLines    int                `json:"bad_lines"`
+	Instruments []InstrumentReport `json:"instruments"`
+}
+
+// InstrumentReport lists the problems found in the ticks of an instrument.
+type InstrumentReport struct {
+	ID    string    `json:"id"`
+	Ticks int       `json:"ticks"`
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+
+	// MissingIntervals is the number of intervals without ticks between
+	// the first and the last tick, listed by Gaps. Gaps are found in input
+	// order, so out of order ticks don't fill them.
+	MissingIntervals int   `json:"missing_intervals"`
+	Gaps             []Gap `json:"gaps,omitempty"`
+	// DuplicateTimes counts ticks with the same time as the previous one.
+	DuplicateTimes int `json:"duplicate_times"`
+	// NonMonotonic counts ticks earlier than the previous one.
+	NonMonotonic int     `json:"non_monotonic"`
+	Spikes       []Spike `json:"spikes,omitempty"`
+}
+
+// Gap is a run of consecutive intervals without ticks.
+type Gap struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Intervals int       `json:"intervals"`
+}
+
+// Spike is a price change from the previous tick beyond the threshold.
+type Spike struct {
+	Time     time.Time `json:"time"`
+	Price    float64   `json:"price"`
+	Previous float64   `json:"previous"`
+	// Change is the relative change, e.g. 0.15 for 15%.
+	Change float64 `json:"change"`
+}
+
+// Checker accumulates the problems of a stream of ticks.
+type Checker struct {
+	// Calendar, if set, keeps intervals without a trading day out of the
+	// missing ones.
+	Calendar *candles.Calendar
+
+	interval       candles.Interval
+	loc            *time.Location
+	spikeThreshold float64
+	instruments    map[string]*instrument
+	ticks          int
+}
+
+type instrument struct {
+	report     InstrumentReport
+	prev       candles.Tick
+	lastBucket time.Time
+}
+
+// NewChecker returns a checker looking for intervals without ticks, with
+// boundaries in loc, and for relative price changes above spikeThreshold.
+func NewChecker(interval candles.Interval, loc *time.Location, spikeThreshold float64) *Checker {
+	return &Checker{
+		interval:       interval,
+		loc:            loc,
+		spikeThreshold: spikeThreshold,
+		instruments:    make(map[string]*instrument),
+	}
+}
+
+// Add checks the next tick in input order.
+func (c *Checker) Add(tick candles.Tick) {
+	c.ticks++
+	tick.Time = tick.Time.In(c.loc)
+
+	bucket := c.interval.Truncate(tick.Time, c.loc)
+
+	inst := c.instruments[tick.ID]
+	if inst == nil {
+		c.instruments[tick.ID] = &instrument{
+			report:     InstrumentReport{ID: tick.ID, Ticks: 1, First: tick.Time, Last: tick.Time},
+			prev:       tick,
+			lastBucket: bucket,
+		}
+
+		return
+	}
+
+	r := &inst.report
+	r.Ticks++
+
+	switch {
+	case tick.Time.Equal(inst.prev.Time):
+		r.DuplicateTimes++
+	case tick.Time.Before(inst.prev.Time):
+		r.NonMonotonic++
+	}
+
+	if tick.Time.Before(r.First) {
+		r.First = tick.Time
+	}
+
+	if tick.Time.After(r.Last) {
+		r.Last = tick.Time
+	}
+
+	if bucket.After(inst.lastBucket) {
+		from := c.interval.End(inst.lastBucket)
+
+		if n := c.intervalsBetween(from, bucket); n > 0 {
+			r.MissingIntervals += n
+			r.Gaps = append(r.Gaps, Gap{From: from, To: bucket, Intervals: n})
+		}
+
+		inst.lastBucket = bucket
+	}
+
+	if prev := inst.prev.Price; prev != 0 {
+		change := tick.Price/prev - 1
+
+		if math.Abs(change) > c.spikeThreshold {
+			r.Spikes = append(r.Spikes, Spike{Time: tick.Time, Price: tick.Price, Previous: prev, Change: change})
+		}
+	}
+
+	inst.prev = tick
+}
+
+// intervalsBetween returns the number of intervals in [from, to).
+func (c *Checker) intervalsBetween(from, to time.Time) int {
+	if !c.interval.IsCalendar() && c.Calendar == nil {
+		return int(to.Sub(from) / c.interval.Duration)
+	}
+
+	n := 0
+	for t := from; t.Before(to); t = c.interval.End(t) {
+		if c.Calendar == nil || c.Calendar.HasTradingDay(c.interval, t) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Report returns the problems found so far, instruments sorted by ID.
+func (c *Checker) Report() Report {
+	result := Report{Ticks: c.ticks, Instruments: []InstrumentReport{}}
+
+	for _, inst := range c.instruments {
+		result.Instruments = append(result.Instruments, inst.report)
+	}
+
+	sort.Slice(result.Instruments, func(i, j int) bool {
+		return result.Instruments[i].ID < result.Instruments[j].ID
+	})
+
+	return result
+}
@@ -0,0 +1,150 @@
+// Package store keeps candles in a SQLite database.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS candles (
+	id       TEXT    NOT NULL,
+	interval TEXT    NOT NULL,
+	time     INTEGER NOT NULL,
+	open     REAL    NOT NULL,
+	high     REAL    NOT NULL,
+	low      REAL    NOT NULL,
+	close    REAL    NOT NULL,
+	volume   REAL    NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS candles_id_interval_time ON candles (id, interval, time);
+`
+
+// Store is a SQLite database of candles. A candle is identified by its
+// instrument, interval and start time; writing it again replaces it.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it if it doesn't exist.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("store: %s: %w", path, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Write saves the candles in a single transaction.
+func (s *Store) Write(ctx context.Context, result []candles.Candle) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR REPLACE INTO candles
+		(id, interval, time, open, high, low, close, volume) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, c := range result {
+		_, err := stmt.ExecContext(ctx, c.ID, c.Interval.String(), c.Time.UnixNano(), c.Open, c.High, c.Low, c.Close, c.Volume)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Query selects candles. Empty fields don't restrict the result.
+type Query struct {
+	ID       string
+	Interval string
+	// From and To limit the candle start times to [From, To).
+	From time.Time
+	To   time.Time
+}
+
+// Query returns the candles matching q ordered by instrument, interval and
+// time. Times are returned in UTC.
+func (s *Store) Query(ctx context.Context, q Query) ([]candles.Candle, error) {
+	where := "1 = 1"
+
+	var args []any
+
+	if q.ID != "" {
+		where += " AND id = ?"
+		args = append(args, q.ID)
+	}
+
+	if q.Interval != "" {
+		where += " AND interval = ?"
+		args = append(args, q.Interval)
+	}
+
+	if !q.From.IsZero() {
+		where += " AND time >= ?"
+		args = append(args, q.From.UnixNano())
+	}
+
+	if !q.To.IsZero() {
+		where += " AND time < ?"
+		args = append(args, q.To.UnixNano())
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, interval, time, open, high, low, close, volume
+		FROM candles WHERE `+where+` ORDER BY id, interval, time`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var result []candles.Candle
+
+	for rows.Next() {
+		var (
+			c        candles.Candle
+			interval string
+			nanos    int64
+		)
+
+		if err := rows.Scan(&c.ID, &interval, &nanos, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume); err != nil {
+			return nil, err
+		}
+
+		if interval != "" {
+			if c.Interval, err = candles.ParseInterval(interval); err != nil {
+				return nil, fmt.Errorf("store: bad interval %q: %w", interval, err)
+			}
+		}
+
+		c.Time = time.Unix(0, nanos).UTC()
+		result = append(result, c)
+	}
+
+	return result, rows.Err()
+}
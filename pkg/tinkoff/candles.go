@@ -0,0 +1,114 @@
+package tinkoff
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+type candleInterval struct {
+	name string
+	// maxRange is the widest time range a single GetCandles request may
+	// cover for the interval.
+	maxRange time.Duration
+}
+
+var candleIntervals = map[candles.Interval]candleInterval{
+	candles.Fixed(time.Minute):      {"CANDLE_INTERVAL_1_MIN", 24 * time.Hour},
+	candles.Fixed(2 * time.Minute):  {"CANDLE_INTERVAL_2_MIN", 24 * time.Hour},
+	candles.Fixed(3 * time.Minute):  {"CANDLE_INTERVAL_3_MIN", 24 * time.Hour},
+	candles.Fixed(5 * time.Minute):  {"CANDLE_INTERVAL_5_MIN", 24 * time.Hour},
+	candles.Fixed(10 * time.Minute): {"CANDLE_INTERVAL_10_MIN", 24 * time.Hour},
+	candles.Fixed(15 * time.Minute): {"CANDLE_INTERVAL_15_MIN", 24 * time.Hour},
+	candles.Fixed(30 * time.Minute): {"CANDLE_INTERVAL_30_MIN", 2 * 24 * time.Hour},
+	candles.Fixed(time.Hour):        {"CANDLE_INTERVAL_HOUR", 7 * 24 * time.Hour},
+	candles.Fixed(2 * time.Hour):    {"CANDLE_INTERVAL_2_HOUR", 30 * 24 * time.Hour},
+	candles.Fixed(4 * time.Hour):    {"CANDLE_INTERVAL_4_HOUR", 30 * 24 * time.Hour},
+	candles.Days(1):                 {"CANDLE_INTERVAL_DAY", 365 * 24 * time.Hour},
+	candles.Weeks(1):                {"CANDLE_INTERVAL_WEEK", 2 * 365 * 24 * time.Hour},
+	candles.Months(1):               {"CANDLE_INTERVAL_MONTH", 10 * 365 * 24 * time.Hour},
+}
+
+// Quotation is a fixed point number as encoded by the API.
+type Quotation struct {
+	Units string `json:"units"`
+	Nano  int32  `json:"nano"`
+}
+
+// Float returns the quotation as a float64.
+func (q Quotation) Float() float64 {
+	units, _ := strconv.ParseInt(q.Units, 10, 64)
+	return float64(units) + float64(q.Nano)/1e9
+}
+
+type historicCandle struct {
+	Open       Quotation `json:"open"`
+	High       Quotation `json:"high"`
+	Low        Quotation `json:"low"`
+	Close      Quotation `json:"close"`
+	Volume     string    `json:"volume"`
+	Time       time.Time `json:"time"`
+	IsComplete bool      `json:"isComplete"`
+}
+
+type getCandlesRequest struct {
+	Figi     string    `json:"figi"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Interval string    `json:"interval"`
+}
+
+type getCandlesResponse struct {
+	Candles []historicCandle `json:"candles"`
+}
+
+// GetCandles returns the candles of the instrument with the given FIGI on
+// [from, to). The range is split into as many requests as the API limits
+// for the interval require.
+func (c *Client) GetCandles(ctx context.Context, figi string, interval candles.Interval, from, to time.Time) ([]candles.Candle, error) {
+	ci, ok := candleIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("interval %s is not supported by the api", interval)
+	}
+
+	var result []candles.Candle
+
+	for start := from; start.Before(to); start = start.Add(ci.maxRange) {
+		end := start.Add(ci.maxRange)
+		if end.After(to) {
+			end = to
+		}
+
+		var resp getCandlesResponse
+
+		err := c.call(ctx, "MarketDataService/GetCandles", getCandlesRequest{
+			Figi:     figi,
+			From:     start,
+			To:       end,
+			Interval: ci.name,
+		}, &resp)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hc := range resp.Candles {
+			volume, _ := strconv.ParseFloat(hc.Volume, 64)
+
+			result = append(result, candles.Candle{
+				ID:       figi,
+				Open:     hc.Open.Float(),
+				High:     hc.High.Float(),
+				Low:      hc.Low.Float(),
+				Close:    hc.Close.Float(),
+				Volume:   volume,
+				Time:     hc.Time,
+				Interval: interval,
+			})
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,126 @@
+// Package tinkoff is a minimal client for the Tinkoff Invest API. It talks to
+// the REST gateway of the API, which exposes the same gRPC services as JSON
+// over HTTP.
+package tinkoff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultBaseURL is the production REST gateway of the Invest API.
+const DefaultBaseURL = "https://invest-public-api.tinkoff.ru/rest"
+
+const servicePrefix = "/tinkoff.public.invest.api.contract.v1."
+
+// Client calls Invest API methods with a bearer token.
+type Client struct {
+	Token      string
+	BaseURL    string
+	StreamURL  string
+	HTTPClient *http.Client
+	// MaxRetries limits how many times a request is repeated after the
+	// rate limit is hit or the server is temporarily unavailable.
+	MaxRetries int
+	// OnReconnect, if set, is called before a stream reconnects after an
+	// error.
+	OnReconnect func(err error, delay time.Duration)
+	// OnRetry, if set, is called before a request of the method is
+	// repeated after a response with the status.
+	OnRetry func(method string, status int, delay time.Duration)
+}
+
+// NewClient returns a client for the production API.
+func NewClient(token string) *Client {
+	return &Client{
+		Token:      token,
+		BaseURL:    DefaultBaseURL,
+		StreamURL:  DefaultStreamURL,
+		HTTPClient: &http.Client{Timeout: time.Minute},
+		MaxRetries: 5,
+	}
+}
+
+// APIError is a non-successful response of the API.
+type APIError struct {
+	StatusCode int
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("tinkoff api: status %d, code %d: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (c *Client) call(ctx context.Context, method string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+servicePrefix+method, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		httpResp, err := c.HTTPClient.Do(httpReq)
+		if err != nil {
+			return err
+		}
+
+		data, err := io.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+
+		if err != nil {
+			return err
+		}
+
+		if httpResp.StatusCode == http.StatusOK {
+			return json.Unmarshal(data, resp)
+		}
+
+		retryable := httpResp.StatusCode == http.StatusTooManyRequests ||
+			httpResp.StatusCode == http.StatusServiceUnavailable
+
+		if !retryable || attempt >= c.MaxRetries {
+			apiErr := &APIError{StatusCode: httpResp.StatusCode}
+			if json.Unmarshal(data, apiErr) != nil {
+				apiErr.Message = string(data)
+			}
+
+			return apiErr
+		}
+
+		delay := retryDelay(httpResp.Header, attempt)
+
+		if c.OnRetry != nil {
+			c.OnRetry(method, httpResp.StatusCode, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retryDelay returns the time until the rate limit window resets, falling
+// back to exponential backoff when the server doesn't report it.
+func retryDelay(header http.Header, attempt int) time.Duration {
+	if reset, err := strconv.Atoi(header.Get("x-ratelimit-reset")); err == nil && reset > 0 {
+		return time.Duration(reset) * time.Second
+	}
+
+	return time.Duration(1<<attempt) * time.Second
+}
@@ -0,0 +1,245 @@
+package tinkoff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Instrument is the reference data of an instrument.
+type Instrument struct {
+	FIGI      string `json:"figi"`
+	Ticker    string `json:"ticker"`
+	ClassCode string `json:"classCode"`
+	Name      string `json:"name"`
+	// Lot is the number of units in a lot.
+	Lot      int    `json:"lot"`
+	Currency string `json:"currency"`
+}
+
+type getInstrumentByRequest struct {
+	IDType    string `json:"idType"`
+	ClassCode string `json:"classCode,omitempty"`
+	ID        string `json:"id"`
+}
+
+type getInstrumentByResponse struct {
+	Instrument Instrument `json:"instrument"`
+}
+
+type findInstrumentRequest struct {
+	Query string `json:"query"`
+}
+
+type findInstrumentResponse struct {
+	Instruments []struct {
+		FIGI                  string `json:"figi"`
+		Ticker                string `json:"ticker"`
+		ClassCode             string `json:"classCode"`
+		APITradeAvailableFlag bool   `json:"apiTradeAvailableFlag"`
+	} `json:"instruments"`
+}
+
+// InstrumentByFIGI returns the instrument with the given FIGI.
+func (c *Client) InstrumentByFIGI(ctx context.Context, figi string) (Instrument, error) {
+	return c.instrumentBy(ctx, getInstrumentByRequest{IDType: "INSTRUMENT_ID_TYPE_FIGI", ID: figi})
+}
+
+// InstrumentByTicker returns the instrument with the given ticker in the
+// trading mode of classCode, e.g. TQBR for Moscow Exchange shares.
+func (c *Client) InstrumentByTicker(ctx context.Context, ticker, classCode string) (Instrument, error) {
+	return c.instrumentBy(ctx, getInstrumentByRequest{IDType: "INSTRUMENT_ID_TYPE_TICKER", ClassCode: classCode, ID: ticker})
+}
+
+func (c *Client) instrumentBy(ctx context.Context, req getInstrumentByRequest) (Instrument, error) {
+	var resp getInstrumentByResponse
+
+	if err := c.call(ctx, "InstrumentsService/GetInstrumentBy", req, &resp); err != nil {
+		return Instrument{}, err
+	}
+
+	return resp.Instrument, nil
+}
+
+// LookupInstrument returns the instrument referred to by ref: a FIGI, a
+// ticker in the TICKER@CLASS form, or a bare ticker, which must name a
+// single instrument available for trading through the API.
+func (c *Client) LookupInstrument(ctx context.Context, ref string) (Instrument, error) {
+	if IsFIGI(ref) {
+		return c.InstrumentByFIGI(ctx, ref)
+	}
+
+	if ticker, classCode, ok := strings.Cut(ref, "@"); ok {
+		return c.InstrumentByTicker(ctx, ticker, classCode)
+	}
+
+	var resp findInstrumentResponse
+
+	if err := c.call(ctx, "InstrumentsService/FindInstrument", findInstrumentRequest{Query: ref}, &resp); err != nil {
+		return Instrument{}, err
+	}
+
+	var figis, refs []string
+
+	for _, inst := range resp.Instruments {
+		if strings.EqualFold(inst.Ticker, ref) && inst.APITradeAvailableFlag {
+			figis = append(figis, inst.FIGI)
+			refs = append(refs, inst.Ticker+"@"+inst.ClassCode)
+		}
+	}
+
+	switch len(figis) {
+	case 0:
+		return Instrument{}, errors.New("instrument not found")
+	case 1:
+		return c.InstrumentByFIGI(ctx, figis[0])
+	}
+
+	return Instrument{}, fmt.Errorf("ambiguous ticker, use one of %s", strings.Join(refs, ", "))
+}
+
+// IsFIGI reports whether ref looks like a FIGI rather than a ticker: twelve
+// upper case letters and digits starting with BBG or, for instruments
+// without a Bloomberg FIGI, TCS.
+func IsFIGI(ref string) bool {
+	if len(ref) != 12 || !strings.HasPrefix(ref, "BBG") && !strings.HasPrefix(ref, "TCS") {
+		return false
+	}
+
+	for _, r := range ref {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DefaultInstrumentMaxAge is how long a Resolver trusts a cached
+// instrument.
+const DefaultInstrumentMaxAge = 7 * 24 * time.Hour
+
+// Resolver looks up instruments, keeping the ones found in a JSON file so
+// that later runs don't call the API again.
+type Resolver struct {
+	Client *Client
+	// MaxAge is how long a cached instrument is used before it is looked
+	// up again.
+	MaxAge time.Duration
+
+	path    string
+	cache   instrumentCache
+	changed bool
+}
+
+// instrumentCache is the content of the cache file: the instruments by
+// FIGI and the FIGIs by the references they were looked up with.
+type instrumentCache struct {
+	Instruments map[string]cachedInstrument `json:"instruments"`
+	Refs        map[string]string           `json:"refs"`
+}
+
+type cachedInstrument struct {
+	Instrument
+	Fetched time.Time `json:"fetched"`
+}
+
+// NewResolver returns a resolver caching instruments in the file at path,
+// which is read if it exists. An empty path disables the cache.
+func NewResolver(c *Client, path string) (*Resolver, error) {
+	r := &Resolver{
+		Client: c,
+		MaxAge: DefaultInstrumentMaxAge,
+		path:   path,
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(data, &r.cache); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	if r.cache.Instruments == nil {
+		r.cache.Instruments = make(map[string]cachedInstrument)
+	}
+
+	if r.cache.Refs == nil {
+		r.cache.Refs = make(map[string]string)
+	}
+
+	return r, nil
+}
+
+// Resolve returns the instrument referred to by ref as LookupInstrument
+// does, from the cache if it holds a recent enough copy. References are
+// case insensitive.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (Instrument, error) {
+	ref = strings.ToUpper(strings.TrimSpace(ref))
+
+	figi := ref
+	if f, ok := r.cache.Refs[ref]; ok {
+		figi = f
+	}
+
+	if cached, ok := r.cache.Instruments[figi]; ok && time.Since(cached.Fetched) < r.MaxAge {
+		return cached.Instrument, nil
+	}
+
+	inst, err := r.Client.LookupInstrument(ctx, ref)
+	if err != nil {
+		return Instrument{}, fmt.Errorf("%s: %w", ref, err)
+	}
+
+	r.cache.Instruments[inst.FIGI] = cachedInstrument{Instrument: inst, Fetched: time.Now().UTC()}
+	r.cache.Refs[ref] = inst.FIGI
+	r.changed = true
+
+	return inst, nil
+}
+
+// Save writes the cache file if instruments were looked up since it was
+// read.
+func (r *Resolver) Save() error {
+	if r.path == "" || !r.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.cache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	// Write a temporary file and rename it, so that concurrent runs never
+	// read a partial cache.
+	tmp := r.path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, r.path); err != nil {
+		return err
+	}
+
+	r.changed = false
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package tinkoff
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// DefaultStreamURL is the production WebSocket gateway of the Invest API
+// streaming services.
+const DefaultStreamURL = "wss://invest-public-api.tinkoff.ru/ws"
+
+const (
+	maxReconnectDelay  = 30 * time.Second
+	streamReadTimeout  = 3 * time.Minute
+	streamCloseTimeout = 5 * time.Second
+)
+
+type tradeInstrument struct {
+	Figi string `json:"figi"`
+}
+
+type subscribeTradesRequest struct {
+	SubscriptionAction string            `json:"subscriptionAction"`
+	Instruments        []tradeInstrument `json:"instruments"`
+}
+
+type marketDataRequest struct {
+	SubscribeTradesRequest *subscribeTradesRequest `json:"subscribeTradesRequest,omitempty"`
+}
+
+type trade struct {
+	Figi     string    `json:"figi"`
+	Price    Quotation `json:"price"`
+	Quantity string    `json:"quantity"`
+	Time     time.Time `json:"time"`
+}
+
+type marketDataResponse struct {
+	Trade *trade `json:"trade"`
+}
+
+// SubscribeTrades subscribes to the trades of the given instruments through
+// MarketDataStream and calls handle for every trade. On connection loss it
+// reconnects with exponential backoff and subscribes again. It returns only
+// when ctx is done, after unsubscribing and closing the connection.
+func (c *Client) SubscribeTrades(ctx context.Context, figis []string, handle func(candles.Tick)) error {
+	delay := time.Second
+
+	for {
+		start := time.Now()
+		err := c.streamTrades(ctx, figis, handle)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if time.Since(start) > maxReconnectDelay {
+			delay = time.Second
+		}
+
+		if c.OnReconnect != nil {
+			c.OnReconnect(err, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (c *Client) streamTrades(ctx context.Context, figis []string, handle func(candles.Tick)) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.Token)
+
+	dialer := websocket.Dialer{
+		Subprotocols:     []string{"json"},
+		HandshakeTimeout: 30 * time.Second,
+	}
+
+	conn, _, err := dialer.DialContext(ctx, c.StreamURL+servicePrefix+"MarketDataStreamService/MarketDataStream", header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	instruments := make([]tradeInstrument, len(figis))
+	for i, figi := range figis {
+		instruments[i] = tradeInstrument{Figi: figi}
+	}
+
+	err = conn.WriteJSON(marketDataRequest{
+		SubscribeTradesRequest: &subscribeTradesRequest{
+			SubscriptionAction: "SUBSCRIPTION_ACTION_SUBSCRIBE",
+			Instruments:        instruments,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// On cancellation unsubscribe and close the connection gracefully. The
+	// trades received meanwhile are still handled; the read loop returns once
+	// the server acknowledges the close or the close timeout expires.
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+
+		conn.WriteJSON(marketDataRequest{
+			SubscribeTradesRequest: &subscribeTradesRequest{
+				SubscriptionAction: "SUBSCRIPTION_ACTION_UNSUBSCRIBE",
+				Instruments:        instruments,
+			},
+		})
+
+		deadline := time.Now().Add(streamCloseTimeout)
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+		conn.SetReadDeadline(deadline)
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(streamReadTimeout))
+
+		// The deadline must not outlive a cancellation that happened before
+		// it was set.
+		if ctx.Err() != nil {
+			conn.SetReadDeadline(time.Now().Add(streamCloseTimeout))
+		}
+
+		var resp marketDataResponse
+
+		if err := conn.ReadJSON(&resp); err != nil {
+			return err
+		}
+
+		if resp.Trade == nil {
+			continue
+		}
+
+		quantity, _ := strconv.ParseFloat(resp.Trade.Quantity, 64)
+
+		handle(candles.Tick{
+			ID:     resp.Trade.Figi,
+			Price:  resp.Trade.Price.Float(),
+			Volume: quantity,
+			Time:   resp.Trade.Time,
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	rpprof "runtime/pprof"
+)
+
+// profileFlags are the profiling flags every command has.
+type profileFlags struct {
+	addr       *string
+	cpuProfile *string
+	memProfile *string
+}
+
+func addProfileFlags(fs *flag.FlagSet) profileFlags {
+	return profileFlags{
+		addr:       fs.String("pprof", "", "serve live profiles at /debug/pprof/ on this address, e.g. :6060"),
+		cpuProfile: fs.String("cpuprofile", "", "write a CPU profile of the run to this file"),
+		memProfile: fs.String("memprofile", "", "write a heap profile to this file at the end of the run"),
+	}
+}
+
+// stopProfiling finishes the profiles started by startProfiling. main and
+// fatal call it before the process exits.
+var stopProfiling = func() {}
+
+// startProfiling starts the profiling the flags ask for.
+func startProfiling(p profileFlags) {
+	if *p.addr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+		// Listen now, so that a busy port fails the run.
+		ln, err := net.Listen("tcp", *p.addr)
+		if err != nil {
+			fatal(fmt.Errorf("pprof: %w", err))
+		}
+
+		go func() {
+			slog.Error("pprof", "err", http.Serve(ln, mux))
+		}()
+	}
+
+	var cpu *os.File
+
+	if *p.cpuProfile != "" {
+		var err error
+		if cpu, err = os.Create(*p.cpuProfile); err != nil {
+			fatal(err)
+		}
+
+		if err := rpprof.StartCPUProfile(cpu); err != nil {
+			fatal(err)
+		}
+	}
+
+	memProfile := *p.memProfile
+
+	stopProfiling = func() {
+		// Once, as fatal may be called from here.
+		stopProfiling = func() {}
+
+		if cpu != nil {
+			rpprof.StopCPUProfile()
+
+			if err := cpu.Close(); err != nil {
+				fatal(err)
+			}
+		}
+
+		if memProfile != "" {
+			f, err := os.Create(memProfile)
+			if err != nil {
+				fatal(err)
+			}
+
+			// Up to date statistics of the live heap.
+			runtime.GC()
+
+			if err := rpprof.WriteHeapProfile(f); err != nil {
+				f.Close()
+				fatal(err)
+			}
+
+			if err := f.Close(); err != nil {
+				fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// progress reports how far the reading of input files is: a line redrawn
+// on a terminal, a log line now and then otherwise.
+type progress struct {
+	// total is the size of the input files, or negative if stdin is read.
+	total atomic.Int64
+	read  atomic.Int64
+	ticks atomic.Int64
+	start time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newProgress() *progress {
+	return &progress{start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (p *progress) addTotal(n int64) {
+	p.total.Add(n)
+}
+
+// wrap returns a reader of f counting the bytes read, after adding the size
+// of f to the total.
+func (p *progress) wrap(f *os.File) (io.Reader, error) {
+	if f == os.Stdin {
+		p.total.Store(-1 << 62)
+		return f, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	p.addTotal(info.Size())
+
+	return &progressReader{r: f, p: p}, nil
+}
+
+// run reports the progress until finish is called.
+func (p *progress) run() {
+	tty := term.IsTerminal(int(os.Stderr.Fd()))
+
+	every := 30 * time.Second
+	if tty {
+		every = time.Second
+	}
+
+	go func() {
+		defer close(p.done)
+
+		t := time.NewTicker(every)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				if tty {
+					// Clear the line.
+					fmt.Fprint(os.Stderr, "\r\033[K")
+				}
+
+				return
+			case <-t.C:
+			}
+
+			if tty {
+				fmt.Fprintf(os.Stderr, "\r\033[K%s", p)
+			} else {
+				slog.Info("progress: " + p.String())
+			}
+		}
+	}()
+}
+
+// finish stops reporting.
+func (p *progress) finish() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *progress) String() string {
+	elapsed := time.Since(p.start)
+	ticks := p.ticks.Load()
+	s := fmt.Sprintf("%s ticks, %s ticks/s", humanCount(float64(ticks)), humanCount(float64(ticks)/elapsed.Seconds()))
+
+	total, read := p.total.Load(), p.read.Load()
+	if total <= 0 || read == 0 {
+		return s
+	}
+
+	done := min(float64(read)/float64(total), 1)
+	eta := time.Duration(float64(elapsed) * (1 - done) / done)
+
+	return fmt.Sprintf("%s %5.1f%% %s, ETA %v", progressBar(done, 20), 100*done, s, eta.Round(time.Second))
+}
+
+// progressBar draws a bar of the width filled to the done share.
+func progressBar(done float64, width int) string {
+	bar := make([]byte, width)
+
+	for i := range bar {
+		bar[i] = ' '
+		if float64(i) < done*float64(width) {
+			bar[i] = '#'
+		}
+	}
+
+	return "[" + string(bar) + "]"
+}
+
+// humanCount formats a number with a k, M or G suffix.
+func humanCount(n float64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fG", n/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", n/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fk", n/1e3)
+	}
+
+	return fmt.Sprintf("%.0f", n)
+}
+
+// progressReader counts the bytes read of a file.
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.read.Add(int64(n))
+
+	return n, err
+}
+
+// mmapProgressReader counts the bytes of a mapped file read.
+type mmapProgressReader struct {
+	r    *candles.MmapReader
+	p    *progress
+	last int64
+}
+
+func (r *mmapProgressReader) Read() (candles.Tick, error) {
+	tick, err := r.r.Read()
+
+	off := r.r.Offset()
+	r.p.read.Add(off - r.last)
+	r.last = off
+
+	return tick, err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/quality"
+)
+
+func runQuality(args []string) {
+	fs := flag.NewFlagSet("quality", flag.ExitOnError)
+	intervalFlag := fs.String("interval", "1m", "interval whose empty buckets are reported as missing, e.g. 1m or 1d")
+	tz := fs.String("tz", "UTC", "time zone of interval boundaries and report times, e.g. Europe/Moscow")
+	calendarFlag := fs.String("calendar", "", "don't report intervals of non trading days as missing: moex, spb or calendar files, see README")
+	spike := fs.Float64("spike", 0.1, "relative price change from the previous tick reported as a spike")
+	inputFormat := fs.String("input-format", "csv", "input format: csv or jsonl")
+	delimiter := fs.String("delimiter", ",", "CSV input field delimiter, \\t for tab")
+	maxLineBytes := fs.Int("max-line-bytes", 0, "treat input lines longer than this many bytes as bad records, 0 for no limit")
+	inputHeader := fs.Bool("input-header", false, "the first CSV input row names the columns (id, price, time, volume)")
+	mmapFlag := fs.Bool("mmap", false, "map uncompressed CSV input files into memory and parse them in place, faster for huge files")
+	timeFormat := fs.String("time-format", "auto", "input time format: auto, rfc3339, unix, unix_ms, unix_us, unix_ns or a Go layout")
+	parseFlags(fs, args)
+
+	interval, err := candles.ParseInterval(*intervalFlag)
+	if err != nil {
+		usagef("quality: bad -interval: %v", err)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	comma, err := parseDelimiter(*delimiter)
+	if err != nil {
+		usage(err)
+	}
+
+	parseTime, err := candles.NewTimeParser(*timeFormat)
+	if err != nil {
+		usage(err)
+	}
+
+	r, closeInputs, err := openInputs(fs.Args(), inputOptions{
+		format: *inputFormat,
+		csv: candles.CSVOptions{
+			Comma:        comma,
+			Header:       *inputHeader,
+			ParseTime:    parseTime,
+			MaxLineBytes: *maxLineBytes,
+		},
+		mmap: *mmapFlag,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	defer closeInputs()
+
+	var (
+		checker = quality.NewChecker(interval, loc, *spike)
+		bad     rejects
+	)
+
+	if *calendarFlag != "" {
+		if checker.Calendar, err = candles.ParseCalendar(*calendarFlag, loc); err != nil {
+			usagef("quality: bad -calendar: %v", err)
+		}
+	}
+
+	for {
+		tick, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if skipped, _ := bad.add(err); skipped {
+			continue
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+
+		checker.Add(tick)
+	}
+
+	report := checker.Report()
+	report.BadLines = bad.count
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(report); err != nil {
+		fatal(err)
+	}
+}
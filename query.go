@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/store"
+)
+
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	db := fs.String("db", "", "SQLite candle store written with -store")
+	id := fs.String("id", "", "instrument id (default all)")
+	intervalFlag := fs.String("interval", "", "candle interval, e.g. 5m or 1d (default all)")
+	fromFlag := fs.String("from", "", "start of the range, RFC3339 or 2006-01-02")
+	toFlag := fs.String("to", "", "end of the range, RFC3339 or 2006-01-02")
+	tz := fs.String("tz", "UTC", "time zone of output times, e.g. Europe/Moscow")
+	outputFormat := fs.String("output-format", "csv", "output format: csv, jsonl, parquet, proto, arrow or xlsx")
+	header := fs.Bool("header", false, "write a header row to the CSV output")
+	columnsFlag := fs.String("columns", strings.Join(candles.DefaultColumns, ","), "comma separated CSV output columns")
+	parseFlags(fs, args)
+
+	if *db == "" {
+		usagef("query: -db is required")
+	}
+
+	q := store.Query{ID: *id}
+
+	if *intervalFlag != "" {
+		interval, err := candles.ParseInterval(*intervalFlag)
+		if err != nil {
+			usagef("query: bad -interval: %v", err)
+		}
+
+		q.Interval = interval.String()
+	}
+
+	var err error
+
+	if *fromFlag != "" {
+		if q.From, err = parseTime(*fromFlag); err != nil {
+			usagef("query: bad -from: %v", err)
+		}
+	}
+
+	if *toFlag != "" {
+		if q.To, err = parseTime(*toFlag); err != nil {
+			usagef("query: bad -to: %v", err)
+		}
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	columns, err := candles.ParseColumns(*columnsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	w, err := newCandleWriter(*outputFormat, os.Stdout, writerOptions{columns: columns, header: *header})
+	if err != nil {
+		usage(err)
+	}
+
+	s, err := store.Open(*db)
+	if err != nil {
+		fatal(err)
+	}
+
+	defer s.Close()
+
+	result, err := s.Query(signalContext(), q)
+	if err != nil {
+		fatal(err)
+	}
+
+	for i := range result {
+		result[i].Time = result[i].Time.In(loc)
+	}
+
+	writeCandles(w, result)
+
+	if err := w.Close(); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// refLabels are the label columns -ref adds to the candles.
+var refLabels = []string{"lot", "currency", "isin"}
+
+// reference is the instrument metadata of a -ref file: the labels of the
+// instruments and the currency values of their price points, by ID. With
+// fx prices are converted into the currency too.
+type reference struct {
+	labels   map[string]map[string]string
+	points   map[string]float64
+	fx       *fxRates
+	currency string
+	// quoted are the currencies prices are quoted in, by ID.
+	quoted  map[string]string
+	missing map[string]bool
+	noRates map[string]bool
+}
+
+// readReference reads a CSV file headed by column names: id, also called
+// figi, and any of lot, currency, isin and point_value. An empty or missing
+// point value leaves the prices as they are.
+func readReference(path string) (*reference, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: no header", path)
+	}
+
+	index := map[string]int{}
+
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "figi" {
+			name = "id"
+		}
+
+		index[name] = i
+	}
+
+	id, ok := index["id"]
+	if !ok {
+		return nil, fmt.Errorf("%s: no id column", path)
+	}
+
+	ref := &reference{
+		labels:  make(map[string]map[string]string),
+		points:  make(map[string]float64),
+		missing: make(map[string]bool),
+		noRates: make(map[string]bool),
+	}
+
+	for _, record := range records[1:] {
+		labels := make(map[string]string)
+
+		for _, name := range refLabels {
+			if i, ok := index[name]; ok {
+				labels[name] = record[i]
+			}
+		}
+
+		ref.labels[record[id]] = labels
+
+		i, ok := index["point_value"]
+		if !ok || strings.TrimSpace(record[i]) == "" {
+			continue
+		}
+
+		point, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 64)
+		if err != nil || point <= 0 {
+			return nil, fmt.Errorf("%s: %s: bad point value %q", path, record[id], record[i])
+		}
+
+		ref.points[record[id]] = point
+	}
+
+	return ref, nil
+}
+
+// convertTo makes convert turn prices into the currency by the rates, and
+// relabels the instruments it can convert.
+func (ref *reference) convertTo(currency string, fx *fxRates) error {
+	if _, ok := fx.rate(currency, time.Time{}); !ok {
+		return fmt.Errorf("no fx rates of -currency %s", currency)
+	}
+
+	ref.fx = fx
+	ref.currency = currency
+	ref.quoted = make(map[string]string, len(ref.labels))
+
+	for id, labels := range ref.labels {
+		ref.quoted[id] = labels["currency"]
+
+		if _, ok := fx.rate(labels["currency"], time.Time{}); ok {
+			labels["currency"] = currency
+		}
+	}
+
+	return nil
+}
+
+// convert returns the tick with its prices in points converted into
+// currency, and into the -currency one, warning once about each instrument
+// missing from the file and each currency without rates.
+func (ref *reference) convert(tick candles.Tick) candles.Tick {
+	if _, ok := ref.labels[tick.ID]; !ok {
+		if !ref.missing[tick.ID] {
+			ref.missing[tick.ID] = true
+			slog.Warn("instrument missing from the reference file", "id", tick.ID)
+		}
+
+		return tick
+	}
+
+	point, ok := ref.points[tick.ID]
+	if !ok {
+		point = 1
+	}
+
+	if ref.fx != nil {
+		currency := ref.quoted[tick.ID]
+
+		rate, ok := ref.fx.convert(currency, ref.currency, tick.Time)
+		if !ok {
+			if !ref.noRates[currency] {
+				ref.noRates[currency] = true
+				slog.Warn("no fx rates, prices left unconverted", "id", tick.ID, "currency", currency)
+			}
+
+			rate = 1
+		}
+
+		point *= rate
+	}
+
+	if point == 1 {
+		return tick
+	}
+
+	tick.Price *= point
+	tick.Bid *= point
+	tick.Ask *= point
+
+	return tick
+}
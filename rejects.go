@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// rejects counts the records skipped in lenient mode and optionally writes
+// them with the error reason to a CSV file: line,error,record.
+type rejects struct {
+	count int
+	f     *os.File
+	w     *csv.Writer
+}
+
+func newRejects(path string) (*rejects, error) {
+	r := &rejects{}
+
+	if path == "" {
+		return r, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.f = f
+	r.w = csv.NewWriter(f)
+
+	return r, r.w.Write([]string{"line", "error", "record"})
+}
+
+// add records err if it is a parse error and reports whether it was one.
+func (r *rejects) add(err error) (bool, error) {
+	var parseErr *candles.ParseError
+	if !errors.As(err, &parseErr) {
+		return false, nil
+	}
+
+	r.count++
+
+	if r.w == nil {
+		return true, nil
+	}
+
+	return true, r.w.Write([]string{strconv.Itoa(parseErr.Line), parseErr.Err.Error(), parseErr.Record})
+}
+
+func (r *rejects) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	r.w.Flush()
+
+	if err := r.w.Error(); err != nil {
+		r.f.Close()
+		return err
+	}
+
+	return r.f.Close()
+}
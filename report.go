@@ -0,0 +1,261 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"flag"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/store"
+)
+
+//go:embed report.html.tmpl
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"num": compactNumber,
+	"pct": func(v float64) string {
+		if math.IsNaN(v) {
+			return "—"
+		}
+
+		return strconv.FormatFloat(v*100, 'f', 2, 64) + "%"
+	},
+	"price": func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	},
+}).Parse(reportHTML))
+
+// reportData is the data of the report template.
+type reportData struct {
+	Title     string
+	Interval  string
+	Generated string
+	Series    []reportSeries
+}
+
+// reportSeries is the section of an instrument: its statistics and the
+// candles for the chart.
+type reportSeries struct {
+	ID    string
+	Stats reportStats
+	// Candles are the chart data, columns of times formatted in the report
+	// time zone and prices.
+	Candles struct {
+		T          []string
+		O, H, L, C []float64
+		V          []float64
+	}
+}
+
+// reportStats summarizes the candles of an instrument. Changes and
+// volatility are fractions.
+type reportStats struct {
+	Candles         int
+	First, Last     string
+	Open, High, Low float64
+	Close, Volume   float64
+	Change          float64
+	Volatility      float64
+	MaxDrawdown     float64
+	AverageRange    float64
+	UpCandles       float64
+	LargestMove     float64
+	LargestMoveTime string
+}
+
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	db := fs.String("db", "", "SQLite candle store written with -store to read instead of candle files")
+	ids := fs.String("id", "", "comma separated instruments to report (default all)")
+	intervalFlag := fs.String("interval", "", "candle interval to report, e.g. 5m or 1d (default the first one)")
+	tz := fs.String("tz", "UTC", "time zone of report times, e.g. Europe/Moscow")
+	title := fs.String("title", "Candles report", "title of the report")
+	output := fs.String("o", "", "write the report into this file instead of stdout")
+	inputFormat := fs.String("input-format", "csv", "input format: csv, jsonl or proto")
+	inputHeader := fs.Bool("input-header", false, "the first CSV input row names the columns")
+	parseFlags(fs, args)
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	var interval string
+
+	if *intervalFlag != "" {
+		i, err := candles.ParseInterval(*intervalFlag)
+		if err != nil {
+			usagef("report: bad -interval: %v", err)
+		}
+
+		interval = i.String()
+	}
+
+	var all []candles.Candle
+
+	if *db != "" {
+		s, err := store.Open(*db)
+		if err != nil {
+			fatal(err)
+		}
+
+		all, err = s.Query(signalContext(), store.Query{Interval: interval})
+		s.Close()
+
+		if err != nil {
+			fatal(err)
+		}
+	} else if all, err = readCandles(fs.Args(), *inputFormat, *inputHeader); err != nil {
+		fatal(err)
+	}
+
+	var wanted []string
+	if *ids != "" {
+		wanted = strings.Split(*ids, ",")
+	}
+
+	if interval == "" && len(all) > 0 {
+		interval = all[0].Interval.String()
+	}
+
+	data := reportData{Title: *title, Interval: interval, Generated: time.Now().In(loc).Format("2006-01-02 15:04 MST")}
+
+	for _, id := range reportIDs(all, wanted) {
+		cs := chartCandles(all, id, interval)
+		if len(cs) == 0 {
+			continue
+		}
+
+		for i := range cs {
+			cs[i].Time = cs[i].Time.In(loc)
+		}
+
+		data.Series = append(data.Series, newReportSeries(cs))
+	}
+
+	if len(data.Series) == 0 {
+		fatal(errors.New("report: no candles to report"))
+	}
+
+	var w io.Writer = os.Stdout
+
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatal(err)
+		}
+
+		defer f.Close()
+
+		w = f
+	}
+
+	if err := reportTemplate.Execute(w, data); err != nil {
+		fatal(err)
+	}
+}
+
+// reportIDs returns the instruments of the candles in order of appearance,
+// only the wanted ones if any.
+func reportIDs(all []candles.Candle, wanted []string) []string {
+	var ids []string
+
+	for _, c := range all {
+		if !slices.Contains(ids, c.ID) && (wanted == nil || slices.Contains(wanted, c.ID)) {
+			ids = append(ids, c.ID)
+		}
+	}
+
+	return ids
+}
+
+// newReportSeries computes the statistics of candles of an instrument in
+// time order.
+func newReportSeries(cs []candles.Candle) reportSeries {
+	const layout = "2006-01-02 15:04"
+
+	first, last := cs[0], cs[len(cs)-1]
+
+	s := reportSeries{ID: first.ID}
+	st := &s.Stats
+
+	st.Candles = len(cs)
+	st.First, st.Last = first.Time.Format(layout), last.Time.Format(layout)
+	st.Open, st.Close = first.Open, last.Close
+	st.High, st.Low = math.Inf(-1), math.Inf(1)
+	st.Change = last.Close/first.Open - 1
+	st.Volatility = math.NaN()
+
+	var (
+		returns []float64
+		largest float64
+		peak    float64
+		up      int
+		ranges  float64
+	)
+
+	for i, c := range cs {
+		st.High, st.Low = max(st.High, c.High), min(st.Low, c.Low)
+		st.Volume += c.Volume
+
+		if c.Close > c.Open {
+			up++
+		}
+
+		if c.Low > 0 {
+			ranges += c.High/c.Low - 1
+		}
+
+		peak = max(peak, c.Close)
+		if peak > 0 {
+			st.MaxDrawdown = max(st.MaxDrawdown, 1-c.Close/peak)
+		}
+
+		if i > 0 && cs[i-1].Close > 0 && c.Close > 0 {
+			r := math.Log(c.Close / cs[i-1].Close)
+			returns = append(returns, r)
+
+			if math.Abs(r) > largest {
+				largest = math.Abs(r)
+				st.LargestMove, st.LargestMoveTime = math.Exp(r)-1, c.Time.Format(layout)
+			}
+		}
+
+		s.Candles.T = append(s.Candles.T, c.Time.Format(layout))
+		s.Candles.O = append(s.Candles.O, c.Open)
+		s.Candles.H = append(s.Candles.H, c.High)
+		s.Candles.L = append(s.Candles.L, c.Low)
+		s.Candles.C = append(s.Candles.C, c.Close)
+		s.Candles.V = append(s.Candles.V, c.Volume)
+	}
+
+	st.UpCandles = float64(up) / float64(len(cs))
+	st.AverageRange = ranges / float64(len(cs))
+
+	if len(returns) > 1 {
+		var mean float64
+		for _, r := range returns {
+			mean += r
+		}
+
+		mean /= float64(len(returns))
+
+		var sum float64
+		for _, r := range returns {
+			sum += (r - mean) * (r - mean)
+		}
+
+		st.Volatility = math.Sqrt(sum / float64(len(returns)-1))
+	}
+
+	return s
+}
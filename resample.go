@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+func runResample(args []string) {
+	fs := flag.NewFlagSet("resample", flag.ExitOnError)
+	intervalsFlag := fs.String("intervals", "5m", "comma separated target intervals, e.g. 5m,1h,1d")
+	tz := fs.String("tz", "UTC", "time zone of candle boundaries and output times, e.g. Europe/Moscow")
+	inputFormat := fs.String("input-format", "csv", "input format: csv, jsonl or proto")
+	inputHeader := fs.Bool("input-header", false, "the first CSV input row names the columns")
+	outputFormat := fs.String("output-format", "csv", "output format: csv, jsonl, parquet, proto, arrow or xlsx")
+	header := fs.Bool("header", false, "write a header row to the CSV output")
+	columnsFlag := fs.String("columns", strings.Join(candles.DefaultColumns, ","), "comma separated CSV output columns")
+	parseFlags(fs, args)
+
+	intervals, err := candles.ParseIntervals(*intervalsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	columns, err := candles.ParseColumns(*columnsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	source, err := readCandles(fs.Args(), *inputFormat, *inputHeader)
+	if err != nil {
+		fatal(err)
+	}
+
+	w, err := newCandleWriter(*outputFormat, os.Stdout, writerOptions{columns: columns, header: *header})
+	if err != nil {
+		usage(err)
+	}
+
+	for _, interval := range intervals {
+		result, err := candles.Resample(source, interval, loc)
+		if err != nil {
+			fatal(err)
+		}
+
+		writeCandles(w, result)
+	}
+
+	if err := w.Close(); err != nil {
+		fatal(err)
+	}
+}
+
+// readCandles reads all candles of the named files, stdin if there are
+// none or for "-".
+func readCandles(names []string, format string, header bool) ([]candles.Candle, error) {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	var result []candles.Candle
+
+	for _, name := range names {
+		f := os.Stdin
+
+		if name != "-" {
+			var err error
+
+			if f, err = os.Open(name); err != nil {
+				return nil, err
+			}
+		}
+
+		cs, err := readCandleFile(f, format, header)
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		result = append(result, cs...)
+	}
+
+	return result, nil
+}
+
+func readCandleFile(f *os.File, format string, header bool) ([]candles.Candle, error) {
+	dr, err := decompress(f)
+	if err != nil {
+		return nil, err
+	}
+
+	defer dr.Close()
+
+	r, err := newCandleReader(format, dr, header)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []candles.Candle
+
+	for {
+		c, err := r.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, c)
+	}
+}
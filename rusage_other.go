@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// peakRSS returns 0 where the peak resident set size is not known.
+func peakRSS() int64 {
+	return 0
+}
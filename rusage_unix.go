@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// peakRSS returns the peak resident set size of the process in bytes.
+func peakRSS() int64 {
+	var ru syscall.Rusage
+
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+
+	// Linux reports kilobytes, macOS bytes.
+	if runtime.GOOS == "darwin" {
+		return int64(ru.Maxrss)
+	}
+
+	return int64(ru.Maxrss) * 1024
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/store"
+)
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "HTTP listen address")
+	db := fs.String("db", "file::memory:?cache=shared", "SQLite candle store to serve and to save closed candles into (default in memory)")
+	intervalsFlag := fs.String("intervals", "1m,2m,5m", "comma separated candle intervals of ingested ticks, e.g. 1m,5m,15m,1h,1d,1w,1mo")
+	tz := fs.String("tz", "UTC", "time zone of candle boundaries and output times, e.g. Europe/Moscow")
+	lateTolerance := fs.Duration("late-tolerance", 3*time.Second, "how long to wait for delayed ticks before closing a candle")
+	clock := fs.Bool("clock", true, "also close candles by the wall clock, for live ticks")
+	parseFlags(fs, args)
+
+	intervals, err := candles.ParseIntervals(*intervalsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	s, err := store.Open(*db)
+	if err != nil {
+		fatal(err)
+	}
+
+	defer s.Close()
+
+	srv := &server{
+		store: s,
+		hub:   newHub(),
+		loc:   loc,
+		agg: candles.NewAggregator(
+			candles.WithIntervals(intervals...),
+			candles.WithTimezone(loc),
+			candles.WithLateTolerance(*lateTolerance),
+		),
+	}
+
+	ctx := signalContext()
+
+	if *clock {
+		go srv.tick(ctx, clockPeriod(intervals))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /candles", srv.handleCandles)
+	mux.HandleFunc("POST /ticks", srv.handleTicks)
+	mux.HandleFunc("GET /candles/stream", srv.hub.handleSSE)
+	mux.HandleFunc("GET /ws", srv.hub.handle)
+
+	hs := &http.Server{Addr: *addr, Handler: mux}
+	stopped := make(chan struct{})
+
+	go func() {
+		<-ctx.Done()
+
+		// Save the open candles and let the WebSocket and event stream
+		// clients go first: the server waits for the event streams. Ticks
+		// posted from now on are refused.
+		srv.mu.Lock()
+		srv.closed = true
+		result := srv.agg.Flush()
+		srv.mu.Unlock()
+
+		if err := srv.save(context.Background(), result); err != nil {
+			slog.Error("serve: saving candles", "err", err)
+		}
+
+		srv.hub.close()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := hs.Shutdown(shutdownCtx); err != nil {
+			slog.Error("serve: shutdown", "err", err)
+		}
+
+		close(stopped)
+	}()
+
+	slog.Info("serve: listening", "addr", *addr)
+
+	if err := hs.ListenAndServe(); err != http.ErrServerClosed {
+		fatal(err)
+	}
+
+	<-stopped
+}
+
+// shutdownTimeout limits how long serve waits for in-flight requests on
+// shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// server serves the candles of a store and saves there the candles closed
+// by the ingested ticks, pushing them to WebSocket clients as well.
+type server struct {
+	store *store.Store
+	hub   *hub
+	loc   *time.Location
+
+	mu  sync.Mutex
+	agg *candles.Aggregator
+	// closed is set on shutdown, once the open candles are saved.
+	closed bool
+}
+
+// tick advances the aggregator clock every period until ctx is done.
+func (s *server) tick(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.mu.Lock()
+			closed := s.agg.Advance(now)
+			s.mu.Unlock()
+
+			if err := s.save(context.Background(), closed); err != nil {
+				slog.Error("serve: saving candles", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *server) save(ctx context.Context, closed []candles.Candle) error {
+	if len(closed) == 0 {
+		return nil
+	}
+
+	if err := s.store.Write(ctx, closed); err != nil {
+		return err
+	}
+
+	s.hub.publish(closed)
+
+	return nil
+}
+
+// handleCandles returns the candles selected by the id, interval, from and
+// to query parameters as a JSON array.
+func (s *server) handleCandles(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := store.Query{ID: params.Get("id")}
+
+	if v := params.Get("interval"); v != "" {
+		interval, err := candles.ParseInterval(v)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, fmt.Errorf("bad interval: %w", err))
+			return
+		}
+
+		q.Interval = interval.String()
+	}
+
+	var err error
+
+	if v := params.Get("from"); v != "" {
+		if q.From, err = parseTime(v); err != nil {
+			httpError(w, http.StatusBadRequest, fmt.Errorf("bad from: %w", err))
+			return
+		}
+	}
+
+	if v := params.Get("to"); v != "" {
+		if q.To, err = parseTime(v); err != nil {
+			httpError(w, http.StatusBadRequest, fmt.Errorf("bad to: %w", err))
+			return
+		}
+	}
+
+	result, err := s.store.Query(r.Context(), q)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for i := range result {
+		result[i].Time = result[i].Time.In(s.loc)
+	}
+
+	if result == nil {
+		result = []candles.Candle{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleTicks adds the ticks of the request body to the aggregator. The
+// body is CSV for the text/csv content type and JSON lines otherwise.
+func (s *server) handleTicks(w http.ResponseWriter, r *http.Request) {
+	format := "jsonl"
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		format = "csv"
+	}
+
+	tr, err := newTickReader(format, r.Body, candles.CSVOptions{})
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var ticks []candles.Tick
+
+	for {
+		tick, err := tr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ticks = append(ticks, tick)
+	}
+
+	var closed []candles.Candle
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		httpError(w, http.StatusServiceUnavailable, errors.New("shutting down"))
+
+		return
+	}
+
+	for _, tick := range ticks {
+		closed = append(closed, s.agg.AddTick(tick)...)
+	}
+	s.mu.Unlock()
+
+	if err := s.save(r.Context(), closed); err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// tickMemory is the approximate memory a buffered tick takes while it is
+// aggregated: the tick, its copy grouped by instrument and its share of
+// the candles.
+const tickMemory = 192
+
+// spillEngine is a batchEngine within a memory budget. Once the buffered
+// ticks exceed it they are sorted by instrument and time and written to a
+// temporary run file. At the end the runs of each instrument are merged in
+// time order, once per interval, into candles.AggregateSorted, which keeps
+// only the open candle, so the output is that of batchEngine whatever the
+// size of an instrument.
+type spillEngine struct {
+	w      candleWriter
+	opts   []candles.Option
+	budget int64
+
+	ticks []candles.Tick
+	dir   string
+	runs  []run
+}
+
+// run is a run file and the byte ranges of its instruments, in ID order.
+type run struct {
+	name     string
+	segments []segment
+}
+
+type segment struct {
+	id     string
+	off, n int64
+}
+
+func newSpillEngine(w candleWriter, opts []candles.Option, budget int64) *spillEngine {
+	return &spillEngine{w: w, opts: opts, budget: budget}
+}
+
+func (e *spillEngine) add(tick candles.Tick) error {
+	e.ticks = append(e.ticks, tick)
+
+	if int64(len(e.ticks))*tickMemory < e.budget {
+		return nil
+	}
+
+	return e.spill()
+}
+
+// spill writes the buffered ticks sorted by instrument and time to a new
+// run file.
+func (e *spillEngine) spill() error {
+	if e.dir == "" {
+		dir, err := os.MkdirTemp("", "tinkoff_candles-")
+		if err != nil {
+			return err
+		}
+
+		e.dir = dir
+	}
+
+	// Stable, so that equal ticks keep their input order for corrections.
+	slices.SortStableFunc(e.ticks, func(a, b candles.Tick) int {
+		if c := strings.Compare(a.ID, b.ID); c != 0 {
+			return c
+		}
+
+		switch {
+		case a.Before(b):
+			return -1
+		case b.Before(a):
+			return 1
+		}
+
+		return 0
+	})
+
+	r := run{name: filepath.Join(e.dir, "run"+strconv.Itoa(len(e.runs)))}
+
+	f, err := os.Create(r.name)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+
+	var buf []byte
+
+	var off int64
+
+	for _, tick := range e.ticks {
+		if buf, err = appendSpilledTick(buf[:0], tick); err != nil {
+			f.Close()
+			return err
+		}
+
+		if n := len(r.segments); n == 0 || r.segments[n-1].id != tick.ID {
+			r.segments = append(r.segments, segment{id: tick.ID, off: off})
+		}
+
+		bw.Write(buf)
+		off += int64(len(buf))
+		r.segments[len(r.segments)-1].n += int64(len(buf))
+	}
+
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	e.runs = append(e.runs, r)
+	e.ticks = e.ticks[:0]
+
+	return nil
+}
+
+func (e *spillEngine) finish(ctx context.Context) error {
+	if len(e.runs) == 0 {
+		return (&batchEngine{w: e.w, opts: e.opts, ticks: e.ticks}).finish(ctx)
+	}
+
+	defer os.RemoveAll(e.dir)
+
+	if err := e.spill(); err != nil {
+		return err
+	}
+
+	e.ticks = nil
+
+	files := make([]*os.File, len(e.runs))
+
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+
+	for i, r := range e.runs {
+		f, err := os.Open(r.name)
+		if err != nil {
+			return err
+		}
+
+		files[i] = f
+	}
+
+	// next is the index of the next segment of each run.
+	next := make([]int, len(e.runs))
+
+	for {
+		id, ok := e.nextID(next)
+		if !ok {
+			break
+		}
+
+		var parts []*os.File
+
+		var segments []segment
+
+		for i, r := range e.runs {
+			if next[i] < len(r.segments) && r.segments[next[i]].id == id {
+				parts = append(parts, files[i])
+				segments = append(segments, r.segments[next[i]])
+				next[i]++
+			}
+		}
+
+		// The instrument is read again for each interval.
+		open := func() (candles.Source, error) {
+			m := &runMerger{}
+
+			for i, seg := range segments {
+				m.add(io.NewSectionReader(parts[i], seg.off, seg.n))
+			}
+
+			return m, nil
+		}
+
+		if err := candles.AggregateSorted(ctx, open, e.w.Write, e.opts...); err != nil {
+			return err
+		}
+	}
+
+	return e.w.Close()
+}
+
+// nextID returns the least ID among the next segments of the runs.
+func (e *spillEngine) nextID(next []int) (string, bool) {
+	id, ok := "", false
+
+	for i, r := range e.runs {
+		if next[i] < len(r.segments) && (!ok || r.segments[next[i]].id < id) {
+			id, ok = r.segments[next[i]].id, true
+		}
+	}
+
+	return id, ok
+}
+
+// appendSpilledTick appends the run file encoding of a tick: the length
+// prefixed ID, the price, the volume, the bid and the ask, the sequence
+// number, the kind and the time in the binary form of time.Time, which
+// keeps its offset.
+func appendSpilledTick(dst []byte, tick candles.Tick) ([]byte, error) {
+	t, err := tick.Time.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	dst = binary.AppendUvarint(dst, uint64(len(tick.ID)))
+	dst = append(dst, tick.ID...)
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(tick.Price))
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(tick.Volume))
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(tick.Bid))
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(tick.Ask))
+	dst = binary.AppendVarint(dst, tick.Seq)
+	dst = append(dst, byte(tick.Kind), byte(len(t)))
+
+	return append(dst, t...), nil
+}
+
+// runReader reads the ticks of a segment of a run file.
+type runReader struct {
+	r   *bufio.Reader
+	buf []byte
+	// id is the last ID read, shared by the following ticks of the
+	// instrument.
+	id string
+}
+
+func newRunReader(r io.Reader) *runReader {
+	return &runReader{r: bufio.NewReader(r)}
+}
+
+func (r *runReader) Read() (candles.Tick, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return candles.Tick{}, err
+	}
+
+	if r.buf, err = r.read(int(n)); err != nil {
+		return candles.Tick{}, err
+	}
+
+	if string(r.buf) != r.id {
+		r.id = string(r.buf)
+	}
+
+	tick := candles.Tick{ID: r.id}
+
+	if r.buf, err = r.read(32); err != nil {
+		return candles.Tick{}, err
+	}
+
+	tick.Price = math.Float64frombits(binary.LittleEndian.Uint64(r.buf))
+	tick.Volume = math.Float64frombits(binary.LittleEndian.Uint64(r.buf[8:]))
+	tick.Bid = math.Float64frombits(binary.LittleEndian.Uint64(r.buf[16:]))
+	tick.Ask = math.Float64frombits(binary.LittleEndian.Uint64(r.buf[24:]))
+
+	if tick.Seq, err = binary.ReadVarint(r.r); err != nil {
+		return candles.Tick{}, noEOF(err)
+	}
+
+	kind, err := r.r.ReadByte()
+	if err != nil {
+		return candles.Tick{}, noEOF(err)
+	}
+
+	tick.Kind = candles.TickKind(kind)
+
+	size, err := r.r.ReadByte()
+	if err != nil {
+		return candles.Tick{}, noEOF(err)
+	}
+
+	if r.buf, err = r.read(int(size)); err != nil {
+		return candles.Tick{}, err
+	}
+
+	if err := tick.Time.UnmarshalBinary(r.buf); err != nil {
+		return candles.Tick{}, err
+	}
+
+	return tick, nil
+}
+
+// read reads n bytes into the buffer of the reader.
+func (r *runReader) read(n int) ([]byte, error) {
+	buf := slices.Grow(r.buf[:0], n)[:n]
+
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return nil, noEOF(err)
+	}
+
+	return buf, nil
+}
+
+// noEOF turns the end of a run in the middle of a tick into an error.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("truncated run file: %w", io.ErrUnexpectedEOF)
+	}
+
+	return err
+}
+
+// runMerger merges the segments of an instrument in the runs into a stream
+// of its ticks in time order, ticks equal in time and sequence number in the
+// order of the runs.
+type runMerger struct {
+	runs []*runReader
+	heap runHeap
+	err  error
+}
+
+// add adds the next run to merge.
+func (m *runMerger) add(r io.Reader) {
+	m.runs = append(m.runs, newRunReader(r))
+
+	if m.err == nil {
+		m.err = m.push(len(m.runs) - 1)
+	}
+}
+
+// push reads the next tick of the run into the heap.
+func (m *runMerger) push(run int) error {
+	tick, err := m.runs[run].Read()
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("run file: %w", err)
+	}
+
+	heap.Push(&m.heap, runTick{tick: tick, run: run})
+
+	return nil
+}
+
+// Next makes runMerger a candles.Source.
+func (m *runMerger) Next() (candles.Tick, error) {
+	if m.err != nil {
+		return candles.Tick{}, m.err
+	}
+
+	if m.heap.Len() == 0 {
+		return candles.Tick{}, io.EOF
+	}
+
+	top := heap.Pop(&m.heap).(runTick)
+
+	return top.tick, m.push(top.run)
+}
+
+type runTick struct {
+	tick candles.Tick
+	run  int
+}
+
+type runHeap []runTick
+
+func (h runHeap) Len() int { return len(h) }
+
+func (h runHeap) Less(i, j int) bool {
+	if h[i].tick.Before(h[j].tick) {
+		return true
+	}
+
+	if h[j].tick.Before(h[i].tick) {
+		return false
+	}
+
+	return h[i].run < h[j].run
+}
+
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *runHeap) Push(x any) { *h = append(*h, x.(runTick)) }
+
+func (h *runHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return x
+}
+
+// parseSize parses a size in bytes such as 512MB or 2G; the suffixes K, M,
+// G and T, optionally followed by B, are powers of 1024.
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	shift := 0
+
+	if i := strings.IndexAny(num, "KMGT"); i >= 0 && i == len(num)-1 {
+		shift = 10 * (strings.IndexByte("KMGT", num[i]) + 1)
+		num = num[:i]
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad size %q, want bytes or a number with K, M, G or T such as 512MB", s)
+	}
+
+	return int64(n * float64(int64(1)<<shift)), nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/internal/objstore"
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// splitWriter writes candles into a separate file per instrument and
+// optionally per interval and date, such as out/SBER_1m.csv. Files are
+// created on the first candle under a temporary name and renamed into place
+// once complete, on Close or when rotated.
+type splitWriter struct {
+	// path returns the file of a candle.
+	path func(c candles.Candle) string
+	// open returns a writer of the output format to a new file.
+	open     func(w io.Writer) (candleWriter, error)
+	compress string
+	// rotate closes the files of earlier dates as soon as a candle of a
+	// later date starts a new file. Candles must come in time order as in
+	// -stream mode.
+	rotate bool
+	files  map[string]*splitFile
+	// paths are the open files in creation order.
+	paths []string
+	// rotated are the files already closed by rotation.
+	rotated map[string]bool
+}
+
+type splitFile struct {
+	f *os.File
+	z io.WriteCloser
+	w candleWriter
+	// date is the date of the latest candle of the file.
+	date string
+}
+
+// splitKeys are the candle fields -split-by accepts.
+var splitKeys = []string{"id", "interval", "date"}
+
+// splitPath returns a function naming files in dir by the comma separated
+// candle fields of splitBy joined with underscores.
+func splitPath(dir, splitBy, ext string) (func(c candles.Candle) string, error) {
+	keys := strings.Split(splitBy, ",")
+
+	for i, key := range keys {
+		keys[i] = strings.TrimSpace(key)
+
+		if !slices.Contains(splitKeys, keys[i]) {
+			return nil, fmt.Errorf("unknown -split-by field: %q", key)
+		}
+	}
+
+	return func(c candles.Candle) string {
+		var parts []string
+
+		for _, key := range keys {
+			switch key {
+			case "id":
+				parts = append(parts, sanitizeFileName(c.ID))
+			case "interval":
+				// Activity driven bars have no interval.
+				if s := c.Interval.String(); s != "" {
+					parts = append(parts, s)
+				}
+			case "date":
+				parts = append(parts, c.Time.Format(time.DateOnly))
+			}
+		}
+
+		return joinOutput(dir, strings.Join(parts, "_")+"."+ext)
+	}, nil
+}
+
+// outputName is the data of -output templates.
+type outputName struct {
+	ID       string
+	Interval string
+	// Date is the date of the candle, 2006-01-02.
+	Date  string
+	Year  string
+	Month string
+}
+
+// templatePath returns a function naming files by the -output template such
+// as "candles/{{.ID}}/{{.Date}}.csv".
+func templatePath(text string) (func(c candles.Candle) string, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	execute := func(c candles.Candle) (string, error) {
+		var b strings.Builder
+
+		err := tmpl.Execute(&b, outputName{
+			ID:       sanitizeFileName(c.ID),
+			Interval: c.Interval.String(),
+			Date:     c.Time.Format(time.DateOnly),
+			Year:     c.Time.Format("2006"),
+			Month:    c.Time.Format("01"),
+		})
+
+		return cleanOutput(b.String()), err
+	}
+
+	// Fail on unknown fields now rather than on the first candle.
+	if _, err := execute(candles.Candle{}); err != nil {
+		return nil, err
+	}
+
+	return func(c candles.Candle) string {
+		path, _ := execute(c)
+		return path
+	}, nil
+}
+
+// sanitizeFileName replaces the characters of s that can't be in a file
+// name.
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator || r == 0 {
+			return '_'
+		}
+
+		return r
+	}, s)
+}
+
+func (w *splitWriter) Write(c candles.Candle) error {
+	path := w.path(c)
+	date := c.Time.Format(time.DateOnly)
+
+	file, ok := w.files[path]
+	if !ok {
+		if w.rotated[path] {
+			return fmt.Errorf("candle %s %s %s arrived after its file %s was rotated", c.ID, c.Interval, c.Time.Format(time.RFC3339Nano), path)
+		}
+
+		if w.rotate {
+			if err := w.rotateBefore(date); err != nil {
+				return err
+			}
+		}
+
+		var err error
+
+		if file, err = w.create(path); err != nil {
+			return err
+		}
+	}
+
+	file.date = max(file.date, date)
+
+	return file.w.Write(c)
+}
+
+// rotateBefore closes the files whose latest candle is before date.
+func (w *splitWriter) rotateBefore(date string) error {
+	var open []string
+
+	for _, path := range w.paths {
+		if w.files[path].date >= date {
+			open = append(open, path)
+			continue
+		}
+
+		if err := w.finish(path); err != nil {
+			return err
+		}
+
+		if w.rotated == nil {
+			w.rotated = make(map[string]bool)
+		}
+
+		w.rotated[path] = true
+	}
+
+	w.paths = open
+
+	return nil
+}
+
+func (w *splitWriter) create(path string) (*splitFile, error) {
+	var (
+		f   *os.File
+		err error
+	)
+
+	if objstore.IsURI(path) {
+		// Objects are staged in local files and uploaded once complete.
+		f, err = os.CreateTemp("", ".candles-*.tmp")
+	} else if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+		f, err = os.Create(tempPath(path))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	z, err := compress(w.compress, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cw, err := w.open(z)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	file := &splitFile{f: f, z: z, w: cw}
+
+	if w.files == nil {
+		w.files = make(map[string]*splitFile)
+	}
+
+	w.files[path] = file
+	w.paths = append(w.paths, path)
+
+	return file, nil
+}
+
+// tempPath returns the hidden file a file is written to until complete.
+func tempPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+}
+
+// finish closes the file and renames it into place, or uploads it.
+func (w *splitWriter) finish(path string) error {
+	file := w.files[path]
+	delete(w.files, path)
+
+	for _, err := range []error{file.w.Close(), file.z.Close(), file.f.Close()} {
+		if err != nil {
+			return err
+		}
+	}
+
+	if objstore.IsURI(path) {
+		defer os.Remove(file.f.Name())
+		return uploadFile(file.f.Name(), path)
+	}
+
+	return os.Rename(file.f.Name(), path)
+}
+
+func (w *splitWriter) Flush() error {
+	for _, path := range w.paths {
+		if err := w.files[path].w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close finishes all files, returning the first error.
+func (w *splitWriter) Close() error {
+	var first error
+
+	for _, path := range w.paths {
+		if err := w.finish(path); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	w.paths = nil
+
+	return first
+}
+
+// outputExt returns the file extension of the output format and
+// compression.
+func outputExt(format, compression string) string {
+	if format == "proto" {
+		format = "pb"
+	}
+
+	switch compression {
+	case "gzip":
+		return format + ".gz"
+	case "zstd":
+		return format + ".zst"
+	}
+
+	return format
+}
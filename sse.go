@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// sseHeartbeat is how often an idle event stream gets a comment, so that
+// proxies don't drop the connection.
+const sseHeartbeat = 15 * time.Second
+
+// handleSSE streams the closed candles selected by the comma separated id
+// and interval query parameters as server-sent events, each a candle event
+// with the candle in JSON as data.
+func (h *hub) handleSSE(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	sub, err := newSubscription(strings.Split(params.Get("id"), ","), strings.Split(params.Get("interval"), ","))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	client := &wsClient{send: make(chan candles.Candle, wsSendBuffer), sub: sub}
+
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	h.mu.Unlock()
+
+	defer h.remove(client)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+
+		select {
+		case c, ok := <-client.send:
+			if !ok {
+				return
+			}
+
+			err = writeEvent(w, "candle", c)
+		case <-heartbeat.C:
+			_, err = w.Write([]byte(": ping\n\n"))
+		case <-r.Context().Done():
+			return
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes an event with v in JSON as its data.
+func writeEvent(w http.ResponseWriter, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte("event: " + event + "\ndata: " + string(data) + "\n\n"))
+
+	return err
+}
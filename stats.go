@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// statsReport summarizes the ticks of a dump.
+type statsReport struct {
+	Ticks int `json:"ticks"`
+	// BadLines is the number of input records that could not be parsed.
+	BadLines    int               `json:"bad_lines"`
+	Instruments []instrumentStats `json:"instruments"`
+}
+
+// instrumentStats summarizes the ticks of an instrument. Prices and volume
+// are of trades only.
+type instrumentStats struct {
+	ID        string    `json:"id"`
+	Ticks     int       `json:"ticks"`
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+	MinPrice  float64   `json:"min_price"`
+	MaxPrice  float64   `json:"max_price"`
+	MeanPrice float64   `json:"mean_price"`
+	Volume    float64   `json:"volume"`
+	// MaxGap is the longest time without ticks, found in input order as
+	// by quality, starting at MaxGapFrom.
+	MaxGap     string          `json:"max_gap"`
+	MaxGapFrom time.Time       `json:"max_gap_from"`
+	Intervals  []intervalStats `json:"intervals"`
+
+	trades   int
+	priceSum float64
+	gap      time.Duration
+	// buckets are the start times of the candles of every interval.
+	buckets []map[int64]bool
+}
+
+// intervalStats counts the candles of an instrument in an interval.
+type intervalStats struct {
+	Interval       string  `json:"interval"`
+	Candles        int     `json:"candles"`
+	TicksPerCandle float64 `json:"ticks_per_candle"`
+}
+
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	intervalsFlag := fs.String("intervals", "1m,1h,1d", "comma separated intervals to count candles of")
+	tz := fs.String("tz", "UTC", "time zone of interval boundaries and output times, e.g. Europe/Moscow")
+	outputFormat := fs.String("output-format", "table", "output format: table or json")
+	inputFormat := fs.String("input-format", "csv", "input format: csv or jsonl")
+	delimiter := fs.String("delimiter", ",", "CSV input field delimiter, \\t for tab")
+	maxLineBytes := fs.Int("max-line-bytes", 0, "treat input lines longer than this many bytes as bad records, 0 for no limit")
+	inputHeader := fs.Bool("input-header", false, "the first CSV input row names the columns (id, price, time, volume)")
+	mmapFlag := fs.Bool("mmap", false, "map uncompressed CSV input files into memory and parse them in place, faster for huge files")
+	timeFormat := fs.String("time-format", "auto", "input time format: auto, rfc3339, unix, unix_ms, unix_us, unix_ns or a Go layout")
+	parseFlags(fs, args)
+
+	intervals, err := candles.ParseIntervals(*intervalsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	if *outputFormat != "table" && *outputFormat != "json" {
+		usagef("stats: unknown output format: %s", *outputFormat)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	comma, err := parseDelimiter(*delimiter)
+	if err != nil {
+		usage(err)
+	}
+
+	parseTime, err := candles.NewTimeParser(*timeFormat)
+	if err != nil {
+		usage(err)
+	}
+
+	r, closeInputs, err := openInputs(fs.Args(), inputOptions{
+		format: *inputFormat,
+		csv: candles.CSVOptions{
+			Comma:        comma,
+			Header:       *inputHeader,
+			ParseTime:    parseTime,
+			MaxLineBytes: *maxLineBytes,
+		},
+		mmap: *mmapFlag,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	defer closeInputs()
+
+	var (
+		report statsReport
+		byID   = make(map[string]*instrumentStats)
+		bad    rejects
+	)
+
+	for {
+		tick, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if skipped, _ := bad.add(err); skipped {
+			continue
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+
+		s, ok := byID[tick.ID]
+		if !ok {
+			s = &instrumentStats{ID: tick.ID, MinPrice: math.Inf(1), MaxPrice: math.Inf(-1)}
+			s.buckets = make([]map[int64]bool, len(intervals))
+
+			for i := range s.buckets {
+				s.buckets[i] = make(map[int64]bool)
+			}
+
+			byID[tick.ID] = s
+		}
+
+		report.Ticks++
+		s.add(tick, intervals, loc)
+	}
+
+	report.BadLines = bad.count
+
+	for _, s := range byID {
+		s.finish(intervals, loc)
+		report.Instruments = append(report.Instruments, *s)
+	}
+
+	slices.SortFunc(report.Instruments, func(a, b instrumentStats) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	if *outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(report); err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
+	if err := writeStatsTable(os.Stdout, report, intervals); err != nil {
+		fatal(err)
+	}
+}
+
+func (s *instrumentStats) add(tick candles.Tick, intervals []candles.Interval, loc *time.Location) {
+	switch {
+	case s.Ticks == 0:
+		s.First, s.Last = tick.Time, tick.Time
+	case tick.Time.After(s.Last):
+		if gap := tick.Time.Sub(s.Last); gap > s.gap {
+			s.gap = gap
+			s.MaxGapFrom = s.Last
+		}
+
+		s.Last = tick.Time
+	case tick.Time.Before(s.First):
+		s.First = tick.Time
+	}
+
+	s.Ticks++
+
+	for i, interval := range intervals {
+		s.buckets[i][interval.Truncate(tick.Time, loc).UnixNano()] = true
+	}
+
+	if tick.Kind != candles.Trade {
+		return
+	}
+
+	s.trades++
+	s.priceSum += tick.Price
+	s.MinPrice = math.Min(s.MinPrice, tick.Price)
+	s.MaxPrice = math.Max(s.MaxPrice, tick.Price)
+	s.Volume += tick.Volume
+}
+
+// finish computes the summary values from the accumulated ones.
+func (s *instrumentStats) finish(intervals []candles.Interval, loc *time.Location) {
+	s.First, s.Last = s.First.In(loc), s.Last.In(loc)
+	s.MaxGap = s.gap.String()
+
+	if !s.MaxGapFrom.IsZero() {
+		s.MaxGapFrom = s.MaxGapFrom.In(loc)
+	}
+
+	if s.trades > 0 {
+		s.MeanPrice = s.priceSum / float64(s.trades)
+	} else {
+		s.MinPrice, s.MaxPrice = 0, 0
+	}
+
+	for i, interval := range intervals {
+		n := len(s.buckets[i])
+		s.Intervals = append(s.Intervals, intervalStats{
+			Interval:       interval.String(),
+			Candles:        n,
+			TicksPerCandle: float64(s.Ticks) / float64(n),
+		})
+	}
+}
+
+// writeStatsTable writes the summaries as an aligned table, a row per
+// instrument.
+func writeStatsTable(w io.Writer, report statsReport, intervals []candles.Interval) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprint(tw, "id\tticks\tfirst\tlast\tmin\tmax\tmean\tvolume\tmax_gap")
+
+	for _, interval := range intervals {
+		fmt.Fprintf(tw, "\t%s\tticks/%s", interval, interval)
+	}
+
+	fmt.Fprintln(tw)
+
+	for _, s := range report.Instruments {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%g\t%g\t%s\t%g\t%s", s.ID, s.Ticks,
+			s.First.Format(time.RFC3339), s.Last.Format(time.RFC3339),
+			s.MinPrice, s.MaxPrice, strconv.FormatFloat(s.MeanPrice, 'f', 4, 64), s.Volume, s.MaxGap)
+
+		for _, i := range s.Intervals {
+			fmt.Fprintf(tw, "\t%d\t%.1f", i.Candles, i.TicksPerCandle)
+		}
+
+		fmt.Fprintln(tw)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if report.BadLines > 0 {
+		fmt.Fprintf(w, "\n%d ticks, %d bad lines\n", report.Ticks, report.BadLines)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/store"
+)
+
+// storeCandleWriter saves candles into a SQLite store, one transaction per
+// Flush.
+type storeCandleWriter struct {
+	s       *store.Store
+	pending []candles.Candle
+}
+
+func newStoreCandleWriter(path string) (*storeCandleWriter, error) {
+	s, err := store.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storeCandleWriter{s: s}, nil
+}
+
+func (w *storeCandleWriter) Write(c candles.Candle) error {
+	w.pending = append(w.pending, c)
+	return nil
+}
+
+func (w *storeCandleWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	err := w.s.Write(context.Background(), w.pending)
+	w.pending = w.pending[:0]
+
+	return err
+}
+
+func (w *storeCandleWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		w.s.Close()
+		return err
+	}
+
+	return w.s.Close()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+func runStream(args []string) {
+	fs := flag.NewFlagSet("stream", flag.ExitOnError)
+	token := fs.String("token", os.Getenv("INVEST_TOKEN"), "Tinkoff Invest API token (default $INVEST_TOKEN)")
+	figis := fs.String("figi", "", "comma separated FIGIs or tickers of the instruments, e.g. SBER or SBER@TQBR")
+	intervalsFlag := fs.String("intervals", "1m,2m,5m", "comma separated candle intervals, e.g. 1m,5m,15m,1h,1d,1w,1mo")
+	tz := fs.String("tz", "UTC", "time zone of candle boundaries and output times, e.g. Europe/Moscow")
+	sessionsFlag := fs.String("session-candles", "", "align candles to trading sessions and drop trades outside them: moex, or sessions in -tz such as 10:00-18:40,19:05-23:50")
+	carryFlag := fs.String("carry-open", "none", "which candles open at the previous close instead of their first trade: none, intraday (not the first candle of a day or session) or always")
+	lateTolerance := fs.Duration("late-tolerance", 3*time.Second, "how long to wait for delayed trades before closing a candle")
+	outputFormat := fs.String("output-format", "csv", "output format: csv, jsonl or proto")
+	wsAddr := fs.String("ws", "", "also push closed candles to WebSocket clients of /ws on this address, e.g. :8080")
+	enrich := fs.Bool("enrich", false, "add the ticker, lot and currency columns of the instruments to csv and jsonl output")
+	cache := fs.String("instruments-cache", defaultInstrumentsCache(), "file caching looked up instruments, empty to disable")
+	parseFlags(fs, args)
+
+	if *token == "" {
+		usagef("stream: api token is required")
+	}
+
+	if *figis == "" {
+		usagef("stream: at least one FIGI or ticker is required")
+	}
+
+	if *outputFormat == "parquet" || *outputFormat == "arrow" || *outputFormat == "xlsx" {
+		usagef("stream: %s output is not supported, the file is only readable once it is closed", *outputFormat)
+	}
+
+	if *enrich && *outputFormat == "proto" {
+		usagef("stream: -enrich requires csv or jsonl output")
+	}
+
+	intervals, err := candles.ParseIntervals(*intervalsFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	carry, err := candles.ParseCarryOpen(*carryFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	var schedule *candles.Schedule
+
+	if *sessionsFlag != "" {
+		if schedule, err = candles.ParseSchedule(*sessionsFlag, loc); err != nil {
+			usagef("stream: bad -session-candles: %v", err)
+		}
+	}
+
+	var opts writerOptions
+	if *enrich {
+		opts.labels = instrumentLabels
+	}
+
+	w, err := newCandleWriter(*outputFormat, os.Stdout, opts)
+	if err != nil {
+		usage(err)
+	}
+
+	agg := candles.NewAggregator(
+		candles.WithIntervals(intervals...),
+		candles.WithTimezone(loc),
+		candles.WithLateTolerance(*lateTolerance),
+		candles.WithSessions(schedule),
+		candles.WithCarryOpen(carry),
+	)
+
+	var (
+		ticks  = make(chan candles.Tick)
+		errc   = make(chan error, 1)
+		done   = make(chan struct{})
+		ctx    = signalContext()
+		client = newTinkoffClient(*token)
+		ticker = time.NewTicker(clockPeriod(intervals))
+	)
+
+	defer ticker.Stop()
+
+	h := newHub()
+
+	if *wsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /ws", h.handle)
+
+		go func() {
+			errc <- http.ListenAndServe(*wsAddr, mux)
+		}()
+	}
+
+	insts, err := resolveInstruments(ctx, client, *cache, []string{*figis})
+	if err != nil {
+		fatal(err)
+	}
+
+	if *enrich {
+		w = newLabelWriter(w, insts)
+	}
+
+	figiList := make([]string, len(insts))
+	for i, inst := range insts {
+		figiList[i] = inst.FIGI
+	}
+
+	// SubscribeTrades returns only once ctx is cancelled by a signal and
+	// the subscription is drained.
+	go func() {
+		client.SubscribeTrades(ctx, figiList, func(tick candles.Tick) {
+			ticks <- tick
+		})
+		close(done)
+	}()
+
+	for {
+		var closed []candles.Candle
+
+		select {
+		case tick := <-ticks:
+			closed = agg.AddTick(tick)
+		case now := <-ticker.C:
+			closed = agg.Advance(now)
+		case err := <-errc:
+			fatal(err)
+		case <-done:
+			result := agg.Flush()
+			writeCandles(w, result)
+			h.publish(result)
+
+			if err := w.Close(); err != nil {
+				fatal(err)
+			}
+
+			return
+		}
+
+		if len(closed) == 0 {
+			continue
+		}
+
+		writeCandles(w, closed)
+		h.publish(closed)
+
+		if err := w.Flush(); err != nil {
+			fatal(err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// Pipeline stages timed by pipelineTrace.
+const (
+	stageRead = iota
+	stageParse
+	stageAggregate
+	stageSink
+	stageCount
+)
+
+var stageNames = [stageCount]string{"read", "parse", "aggregate", "sink"}
+
+// pipelineTrace times the stages of the aggregate loop and exports every
+// window of it as an OpenTelemetry span with a child span per stage: the
+// stages run tick by tick, far too often for spans of their own, so the
+// child spans start with the window and last as long as the stage took in
+// total within it.
+//
+// Reading a tick is split between the read and parse stages by timing
+// one of them inside tickReader.Read: the input of files, or the parser
+// of broker and socket messages. Likewise the sink is timed by a
+// candleWriter inside the engine.
+type pipelineTrace struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	every    time.Duration
+
+	start   time.Time
+	stages  [stageCount]time.Duration
+	ticks   int
+	candles atomic.Int64
+
+	// inner is the time spent in the timed stage of reading, inputs or
+	// parsing, since the last tick.
+	inner      atomic.Int64
+	innerStage int
+	// sink is the time spent writing candles since the last call.
+	sink atomic.Int64
+}
+
+// startTracing returns the trace of the pipeline exported to the OTLP/HTTP
+// collector at endpoint, such as http://localhost:4318, or to the one of
+// the OTEL_EXPORTER_OTLP_ENDPOINT environment variables if empty. It
+// returns nil without either.
+func startTracing(ctx context.Context, endpoint string, every time.Duration) (*pipelineTrace, error) {
+	var opts []otlptracehttp.Option
+
+	switch {
+	case endpoint != "":
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.Trim(u.Path, "/") == "" {
+			u.Path = "/v1/traces"
+		}
+
+		opts = append(opts, otlptracehttp.WithEndpointURL(u.String()))
+	case os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "":
+		return nil, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "tinkoff_candles")),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+
+	return &pipelineTrace{
+		provider:   provider,
+		tracer:     provider.Tracer("github.com/mal-as/tinkoff_candles"),
+		every:      every,
+		start:      time.Now(),
+		innerStage: stageRead,
+	}, nil
+}
+
+// now returns the current time, or the zero time without a trace.
+func (p *pipelineTrace) now() time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+
+	return time.Now()
+}
+
+// read accounts for the reading of a tick that started at start.
+func (p *pipelineTrace) read(start time.Time) {
+	if p == nil {
+		return
+	}
+
+	total := time.Since(start)
+	inner := min(time.Duration(p.inner.Swap(0)), total)
+
+	p.stages[p.innerStage] += inner
+	p.stages[stageRead+stageParse-p.innerStage] += total - inner
+}
+
+// aggregate accounts for the adding of a tick to the engine that started
+// at start, writing candles included, and exports the window if it is
+// over.
+func (p *pipelineTrace) aggregate(start time.Time) {
+	if p == nil {
+		return
+	}
+
+	p.ticks++
+
+	if now := p.engine(start); now.Sub(p.start) >= p.every {
+		p.export(now)
+	}
+}
+
+// finish accounts for the finishing of the engine that started at start.
+func (p *pipelineTrace) finish(start time.Time) {
+	if p != nil {
+		p.engine(start)
+	}
+}
+
+// engine splits the time since start between the aggregate and the sink
+// stages and returns the current time.
+func (p *pipelineTrace) engine(start time.Time) time.Time {
+	now := time.Now()
+	total := now.Sub(start)
+	sink := time.Duration(p.sink.Swap(0))
+
+	p.stages[stageSink] += sink
+	p.stages[stageAggregate] += max(total-sink, 0)
+
+	return now
+}
+
+// export ends the window at end.
+func (p *pipelineTrace) export(end time.Time) {
+	_, window := p.tracer.Start(context.Background(), "aggregate", trace.WithTimestamp(p.start))
+	window.SetAttributes(
+		attribute.Int("ticks", p.ticks),
+		attribute.Int64("candles", p.candles.Swap(0)),
+	)
+
+	ctx := trace.ContextWithSpan(context.Background(), window)
+
+	for stage, d := range p.stages {
+		_, span := p.tracer.Start(ctx, stageNames[stage], trace.WithTimestamp(p.start))
+		span.End(trace.WithTimestamp(p.start.Add(d)))
+	}
+
+	window.End(trace.WithTimestamp(end))
+
+	p.start = end
+	p.stages = [stageCount]time.Duration{}
+	p.ticks = 0
+}
+
+// shutdown exports the last window and the spans not sent yet.
+func (p *pipelineTrace) shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.ticks > 0 || p.stages != [stageCount]time.Duration{} {
+		p.export(time.Now())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	return p.provider.Shutdown(ctx)
+}
+
+// input returns r timed as the read stage.
+func (p *pipelineTrace) input(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+
+	p.innerStage = stageRead
+
+	return &timedReader{r: r, spent: &p.inner}
+}
+
+// parser returns parse timed as the parse stage.
+func (p *pipelineTrace) parser(parse func(msg []byte) (candles.Tick, error)) func(msg []byte) (candles.Tick, error) {
+	if p == nil {
+		return parse
+	}
+
+	p.innerStage = stageParse
+
+	return func(msg []byte) (candles.Tick, error) {
+		start := time.Now()
+		tick, err := parse(msg)
+		p.inner.Add(int64(time.Since(start)))
+
+		return tick, err
+	}
+}
+
+// writer returns w timed as the sink stage.
+func (p *pipelineTrace) writer(w candleWriter) candleWriter {
+	if p == nil {
+		return w
+	}
+
+	return &timedWriter{candleWriter: w, p: p}
+}
+
+// timedReader adds the time spent reading to spent.
+type timedReader struct {
+	r     io.Reader
+	spent *atomic.Int64
+}
+
+func (r *timedReader) Read(b []byte) (int, error) {
+	start := time.Now()
+	n, err := r.r.Read(b)
+	r.spent.Add(int64(time.Since(start)))
+
+	return n, err
+}
+
+// timedWriter adds the time spent writing candles to the sink stage.
+type timedWriter struct {
+	candleWriter
+	p *pipelineTrace
+}
+
+func (w *timedWriter) Write(c candles.Candle) error {
+	start := time.Now()
+	err := w.candleWriter.Write(c)
+	w.p.sink.Add(int64(time.Since(start)))
+	w.p.candles.Add(1)
+
+	return err
+}
+
+func (w *timedWriter) Flush() error {
+	start := time.Now()
+	err := w.candleWriter.Flush()
+	w.p.sink.Add(int64(time.Since(start)))
+
+	return err
+}
+
+func (w *timedWriter) Close() error {
+	start := time.Now()
+	err := w.candleWriter.Close()
+	w.p.sink.Add(int64(time.Since(start)))
+
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+	"github.com/mal-as/tinkoff_candles/pkg/indicators"
+	"github.com/mal-as/tinkoff_candles/pkg/patterns"
+)
+
+// withCandleType wraps w to convert candles into the given candle type.
+func withCandleType(candleType string, w candleWriter) (candleWriter, error) {
+	switch candleType {
+	case "regular":
+		return w, nil
+	case "heikin-ashi":
+		return &heikinAshiWriter{candleWriter: w, ha: candles.NewHeikinAshi()}, nil
+	}
+
+	return nil, fmt.Errorf("unknown candle type: %s", candleType)
+}
+
+// indicatorWriter sets the indicator values of the candles.
+type indicatorWriter struct {
+	candleWriter
+	p *indicators.Pipeline
+}
+
+func (w *indicatorWriter) Write(c candles.Candle) error {
+	c.Indicators = w.p.Next(c)
+	return w.candleWriter.Write(c)
+}
+
+// patternWriter sets the candlestick patterns of the candles.
+type patternWriter struct {
+	candleWriter
+	d *patterns.Detector
+}
+
+func (w *patternWriter) Write(c candles.Candle) error {
+	c.Patterns = w.d.Next(c)
+	return w.candleWriter.Write(c)
+}
+
+type heikinAshiWriter struct {
+	candleWriter
+	ha *candles.HeikinAshi
+}
+
+func (w *heikinAshiWriter) Write(c candles.Candle) error {
+	return w.candleWriter.Write(w.ha.Next(c))
+}
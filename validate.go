@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	tz := fs.String("tz", "UTC", "time zone the candle boundaries are aligned to, e.g. Europe/Moscow")
+	maxGap := fs.Float64("max-gap", 0.1, "largest relative difference of an open from the previous close")
+	inputFormat := fs.String("input-format", "csv", "input format: csv, jsonl or proto")
+	inputHeader := fs.Bool("input-header", false, "the first CSV input row names the columns")
+	parseFlags(fs, args)
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		usage(err)
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	v := candles.NewValidator(loc, *maxGap)
+	violations := 0
+
+	for _, name := range names {
+		n, err := validateFile(v, name, *inputFormat, *inputHeader)
+		if err != nil {
+			fatal(err)
+		}
+
+		violations += n
+	}
+
+	if violations > 0 {
+		fatal(fmt.Errorf("%d violations", violations))
+	}
+}
+
+// validateFile prints the violations of the candles in the named file and
+// returns their number.
+func validateFile(v *candles.Validator, name, format string, header bool) (int, error) {
+	f := os.Stdin
+
+	if name != "-" {
+		var err error
+
+		if f, err = os.Open(name); err != nil {
+			return 0, err
+		}
+
+		defer f.Close()
+	}
+
+	dr, err := decompress(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+
+	defer dr.Close()
+
+	r, err := newCandleReader(format, dr, header)
+	if err != nil {
+		return 0, err
+	}
+
+	violations := 0
+
+	for {
+		c, err := r.Read()
+		if err == io.EOF {
+			return violations, nil
+		}
+
+		if err != nil {
+			return violations, fmt.Errorf("%s: %w", name, err)
+		}
+
+		for _, msg := range v.Check(c) {
+			fmt.Printf("%s:%d: %s %s %s: %s\n", name, r.Line(), c.ID, c.Interval, c.Time.Format(time.RFC3339Nano), msg)
+			violations++
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// watchSettle is how long a new file must keep its size to be taken as
+// completely written.
+const watchSettle = 500 * time.Millisecond
+
+// watchReader reads the tick files appearing in a directory one after
+// another until ctx is done, starting with the files already there in name
+// order. Once a file is read to the end, done is called and the file is
+// moved into the done subdirectory. Hidden files are skipped.
+type watchReader struct {
+	ctx     context.Context
+	dir     string
+	doneDir string
+	in      inputOptions
+	watcher *fsnotify.Watcher
+	queue   []string
+	queued  map[string]bool
+	// done is called with the name of each file read to the end, before
+	// it is moved.
+	done func(name string) error
+
+	cur      tickReader
+	curName  string
+	closeCur func() error
+}
+
+func openWatch(ctx context.Context, dir string, in inputOptions) (*watchReader, error) {
+	doneDir := filepath.Join(dir, "done")
+	if err := os.MkdirAll(doneDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch before listing, so that no file slips in between.
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+
+	r := &watchReader{ctx: ctx, dir: dir, doneDir: doneDir, in: in, watcher: watcher, queued: make(map[string]bool)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		r.enqueue(filepath.Join(dir, entry.Name()))
+	}
+
+	return r, nil
+}
+
+// enqueue adds a file to read unless it is hidden, not a regular file or
+// already queued.
+func (r *watchReader) enqueue(name string) {
+	if strings.HasPrefix(filepath.Base(name), ".") || r.queued[name] {
+		return
+	}
+
+	if info, err := os.Stat(name); err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	r.queued[name] = true
+	r.queue = append(r.queue, name)
+	sort.Strings(r.queue)
+}
+
+func (r *watchReader) Read() (candles.Tick, error) {
+	for {
+		if r.cur != nil {
+			tick, err := r.cur.Read()
+			if err != io.EOF {
+				return tick, err
+			}
+
+			if err := r.finishFile(); err != nil {
+				return candles.Tick{}, err
+			}
+
+			continue
+		}
+
+		if len(r.queue) == 0 {
+			if err := r.wait(); err != nil {
+				return candles.Tick{}, err
+			}
+
+			continue
+		}
+
+		name := r.queue[0]
+		r.queue = r.queue[1:]
+
+		if err := r.settle(name); err != nil {
+			return candles.Tick{}, err
+		}
+
+		cur, closeCur, err := openInputs([]string{name}, r.in)
+		if err != nil {
+			return candles.Tick{}, err
+		}
+
+		slog.Info("processing file", "file", name)
+		r.cur, r.curName, r.closeCur = cur, name, closeCur
+	}
+}
+
+// finishFile closes the file read to the end, hands it to done and moves it
+// into the done directory.
+func (r *watchReader) finishFile() error {
+	name := r.curName
+
+	if err := r.closeCur(); err != nil {
+		return err
+	}
+
+	r.cur, r.curName, r.closeCur = nil, "", nil
+	delete(r.queued, name)
+
+	if r.done != nil {
+		if err := r.done(name); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(name, filepath.Join(r.doneDir, filepath.Base(name)))
+}
+
+// wait waits for new files, returning io.EOF once ctx is done.
+func (r *watchReader) wait() error {
+	select {
+	case <-r.ctx.Done():
+		return io.EOF
+	case event, ok := <-r.watcher.Events:
+		if !ok {
+			return io.EOF
+		}
+
+		if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+			r.enqueue(event.Name)
+		}
+	case err, ok := <-r.watcher.Errors:
+		if !ok {
+			return io.EOF
+		}
+
+		slog.Warn("watch: file events lost", "err", err)
+	}
+
+	return nil
+}
+
+// settle waits until the file stops growing, as a file copied into the
+// directory shows up before it is written.
+func (r *watchReader) settle(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return nil
+		case <-time.After(watchSettle):
+		}
+
+		next, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+
+		if next.Size() == info.Size() && next.ModTime().Equal(info.ModTime()) {
+			return nil
+		}
+
+		info = next
+	}
+}
+
+// Close stops watching, leaving a partly read file in place to be read
+// again.
+func (r *watchReader) Close() error {
+	if r.cur != nil {
+		r.closeCur()
+	}
+
+	return r.watcher.Close()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// wsSendBuffer is the number of candles queued for a client. A client that
+// falls this far behind is disconnected.
+const wsSendBuffer = 256
+
+// hub pushes closed candles to WebSocket clients.
+type hub struct {
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+}
+
+type wsClient struct {
+	send chan candles.Candle
+
+	mu  sync.Mutex
+	sub subscription
+}
+
+// subscription selects candles by instrument and interval. An empty set
+// matches everything.
+type subscription struct {
+	ids       map[string]bool
+	intervals map[candles.Interval]bool
+}
+
+// subscribeMessage is sent by clients to replace their subscription.
+type subscribeMessage struct {
+	IDs       []string `json:"ids"`
+	Intervals []string `json:"intervals"`
+}
+
+func newHub() *hub {
+	return &hub{
+		upgrader: websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+		clients:  make(map[*wsClient]struct{}),
+	}
+}
+
+func newSubscription(ids, intervals []string) (subscription, error) {
+	sub := subscription{ids: make(map[string]bool), intervals: make(map[candles.Interval]bool)}
+
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			sub.ids[id] = true
+		}
+	}
+
+	for _, s := range intervals {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		interval, err := candles.ParseInterval(s)
+		if err != nil {
+			return subscription{}, err
+		}
+
+		sub.intervals[interval] = true
+	}
+
+	return sub, nil
+}
+
+func (s subscription) match(c candles.Candle) bool {
+	return (len(s.ids) == 0 || s.ids[c.ID]) && (len(s.intervals) == 0 || s.intervals[c.Interval])
+}
+
+// publish sends the candles to the subscribed clients.
+func (h *hub) publish(result []candles.Candle) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		client.mu.Lock()
+		sub := client.sub
+		client.mu.Unlock()
+
+		for _, c := range result {
+			if !sub.match(c) {
+				continue
+			}
+
+			select {
+			case client.send <- c:
+				continue
+			default:
+			}
+
+			delete(h.clients, client)
+			close(client.send)
+
+			break
+		}
+	}
+}
+
+// handle upgrades the request to a WebSocket connection. The initial
+// subscription comes from the comma separated id and interval query
+// parameters; a client may replace it later by sending a subscribeMessage.
+func (h *hub) handle(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	sub, err := newSubscription(strings.Split(params.Get("id"), ","), strings.Split(params.Get("interval"), ","))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	client := &wsClient{send: make(chan candles.Candle, wsSendBuffer), sub: sub}
+
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	h.mu.Unlock()
+
+	go h.readLoop(conn, client)
+
+	for c := range client.send {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+		if err := conn.WriteJSON(c); err != nil {
+			break
+		}
+	}
+
+	h.remove(client)
+	conn.Close()
+}
+
+func (h *hub) readLoop(conn *websocket.Conn, client *wsClient) {
+	defer h.remove(client)
+
+	for {
+		var msg subscribeMessage
+
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		sub, err := newSubscription(msg.IDs, msg.Intervals)
+		if err != nil {
+			slog.Warn("ws: bad subscription", "err", err)
+			continue
+		}
+
+		client.mu.Lock()
+		client.sub = sub
+		client.mu.Unlock()
+	}
+}
+
+// close disconnects all clients once their queued candles are sent.
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		delete(h.clients, client)
+		close(client.send)
+	}
+}
+
+func (h *hub) remove(client *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
+	}
+}
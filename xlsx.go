@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mal-as/tinkoff_candles/internal/xlsx"
+	"github.com/mal-as/tinkoff_candles/pkg/candles"
+)
+
+// xlsxCandleWriter writes candles into an Excel workbook with a sheet per
+// instrument or per interval. The workbook is written on Close.
+type xlsxCandleWriter struct {
+	xw         *xlsx.Writer
+	sheetBy    string
+	header     []string
+	extra      []string
+	indicators []string
+	patterns   bool
+	sheets     map[string]*xlsx.Sheet
+}
+
+func newXLSXCandleWriter(w io.Writer, opts writerOptions) (*xlsxCandleWriter, error) {
+	sheetBy := opts.sheetBy
+	if sheetBy == "" {
+		sheetBy = "id"
+	}
+
+	if sheetBy != "id" && sheetBy != "interval" {
+		return nil, fmt.Errorf("unknown sheet field: %q, want id or interval", sheetBy)
+	}
+
+	header := append(candles.DefaultColumns[:len(candles.DefaultColumns):len(candles.DefaultColumns)], opts.extra...)
+	header = append(header, opts.indicators...)
+
+	if opts.patterns {
+		header = append(header, "patterns")
+	}
+
+	return &xlsxCandleWriter{
+		xw:         xlsx.NewWriter(w),
+		sheetBy:    sheetBy,
+		header:     header,
+		extra:      opts.extra,
+		indicators: opts.indicators,
+		patterns:   opts.patterns,
+		sheets:     make(map[string]*xlsx.Sheet),
+	}, nil
+}
+
+func (w *xlsxCandleWriter) Write(c candles.Candle) error {
+	name := c.ID
+	if w.sheetBy == "interval" {
+		name = c.Interval.String()
+	}
+
+	s, ok := w.sheets[name]
+	if !ok {
+		s = w.xw.AddSheet(name, w.header)
+		w.sheets[name] = s
+	}
+
+	if s.Rows() >= xlsx.MaxRows {
+		return fmt.Errorf("xlsx: sheet %s exceeds %d rows, the most Excel opens", name, xlsx.MaxRows)
+	}
+
+	for _, column := range w.header[:len(candles.DefaultColumns)] {
+		switch column {
+		case "id":
+			s.WriteString(c.ID)
+		case "open":
+			s.WriteNumber(c.Open)
+		case "high":
+			s.WriteNumber(c.High)
+		case "low":
+			s.WriteNumber(c.Low)
+		case "close":
+			s.WriteNumber(c.Close)
+		case "volume":
+			s.WriteNumber(c.Volume)
+		case "time":
+			s.WriteTime(c.Time)
+		case "interval":
+			s.WriteString(c.Interval.String())
+		}
+	}
+
+	for _, name := range w.extra {
+		switch extraType(name) {
+		case "int":
+			s.WriteNumber(float64(extraInt(c, name)))
+		case "time":
+			if t := extraTime(c, name); t.IsZero() {
+				s.WriteEmpty()
+			} else {
+				s.WriteTime(t)
+			}
+		default:
+			s.WriteNumber(extraFloat(c, name))
+		}
+	}
+
+	for _, name := range w.indicators {
+		if v, ok := c.Indicators[name]; ok {
+			s.WriteNumber(v)
+		} else {
+			s.WriteEmpty()
+		}
+	}
+
+	if w.patterns {
+		s.WriteString(strings.Join(c.Patterns, "|"))
+	}
+
+	s.EndRow()
+
+	return nil
+}
+
+// Flush is a no-op: the workbook is written as a whole on Close.
+func (w *xlsxCandleWriter) Flush() error {
+	return nil
+}
+
+func (w *xlsxCandleWriter) Close() error {
+	return w.xw.Close()
+}